@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/database"
+)
+
+const usage = `Usage: admin <command>
+
+Commands:
+  hash-password         read a password from stdin and print its bcrypt hash,
+                        for use as ADMIN_PASSWORD_HASH
+  set-role EMAIL ROLE   assign ROLE (Admin or Client) to the user with EMAIL
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "hash-password":
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.Fatalf("Failed to read the password: %v", err)
+		}
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			log.Fatalf("The password must not be empty")
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Fatalf("Failed to hash the password: %v", err)
+		}
+		fmt.Println(string(hash))
+
+	case "set-role":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		email, role := flag.Arg(1), flag.Arg(2)
+
+		db, err := database.Open(config.LoadDatabaseConfig())
+		if err != nil {
+			log.Fatalf("Failed to connect to the database: %v", err)
+		}
+		defer db.Close()
+
+		if err := database.NewRoleDB(db).SetUserRole(context.Background(), email, role); err != nil {
+			log.Fatalf("Failed to set the role of %s: %v", email, err)
+		}
+		fmt.Printf("%s is now %s\n", email, role)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,90 +1,172 @@
 package main
 
 import (
-	"fmt"
-	"log"
-	"net/http"
+	"context"
+	"log/slog"
 	"os"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"time"
 
 	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/cache"
 	"github.com/ntentasd/db-deliverable3/internal/database"
-	"github.com/ntentasd/db-deliverable3/internal/memcached"
-	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/logging"
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
+	"github.com/ntentasd/db-deliverable3/internal/metrics"
+	"github.com/ntentasd/db-deliverable3/internal/migrations"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
 	"github.com/ntentasd/db-deliverable3/internal/server"
+	"github.com/ntentasd/db-deliverable3/internal/telemetry"
 	"github.com/ntentasd/db-deliverable3/internal/tracing"
 )
 
 func main() {
+	// Everything is logged through slog from here on, the log package
+	// included.
+	logger := logging.New(config.LoadLogConfig(), os.Stdout)
+	slog.SetDefault(logger)
+
 	cleanup := tracing.Init("DatadriveAPI")
 	defer cleanup()
 
 	// Retrieve jwt secret from the environment
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		log.Fatalf("JWT_SECRET environment variable is not set")
+		fatal("JWT_SECRET environment variable is not set", nil)
 	}
 
-	memcachedConfig := config.LoadMemcachedConfig()
+	cacheConfig := config.LoadCacheConfig()
+
+	apiMetrics := metrics.New()
 
-	cacheClient := memcached.NewClient(memcachedConfig.Host, memcachedConfig.Port)
+	cacheClient, err := cache.New(cacheConfig)
+	if err != nil {
+		fatal("Failed to initialize the cache", err)
+	}
+	cacheClient = apiMetrics.InstrumentCache(cacheClient, cacheConfig.Backend)
 
 	// Load the configuration
 	dbConfig := config.LoadDatabaseConfig()
 
+	if config.LoadMigrationConfig().OnStart {
+		runMigrations(dbConfig)
+	}
+
 	// Initialize the Database
-	db, database, err := database.InitDB(dbConfig, cacheClient, 300) //  5 minutes Cache TTL
+	db, repositories, err := database.InitDB(dbConfig, cacheClient, cache.Options{
+		TTL:   cacheConfig.TTL,
+		Stale: cacheConfig.Stale,
+	}, logger)
 	if err != nil {
-		log.Fatalf("Failed to initialize the database: %v", err)
+		fatal("Failed to initialize the database", err)
 	}
 	defer db.Close()
 
-	// Initialize the Fiber app
-	app := fiber.New()
-	app.Use(logger.New())
-	app.Use(middleware.CorrelationMiddleware())
-	// app.Use(middleware.TracingMiddleware())
-	app.Use(middleware.OriginMiddleware())
+	apiMetrics.RegisterDatabase(db, repositories)
+
+	if adminConfig := config.LoadAdminConfig(); adminConfig.Email != "" && adminConfig.PasswordHash != "" {
+		err := database.BootstrapAdmin(context.Background(), repositories, adminConfig.Email, adminConfig.UserName, adminConfig.PasswordHash)
+		if err != nil {
+			fatal("Failed to bootstrap the admin account", err)
+		}
+		logger.Info("Admin account is ready", "email", adminConfig.Email)
+	}
 
 	origin := os.Getenv("FRONTEND_ORIGIN")
 	if origin == "" {
 		origin = "http://localhost:3000"
 	}
 
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:  fmt.Sprintf("%s, http://datadrive-ui", origin),
-		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:  "Content-Type, Authorization",
-		ExposeHeaders: "Content-Length",
-	}))
+	mailConfig := config.LoadMailConfig()
+
+	mail, err := mailer.New(mailConfig, logger)
+	if err != nil {
+		fatal("Failed to initialize the mailer", err)
+	}
+
+	payments, err := payment.New(config.LoadPaymentConfig())
+	if err != nil {
+		fatal("Failed to initialize the payment provider", err)
+	}
+
+	pricingRules, err := pricing.New(config.LoadPricingConfig())
+	if err != nil {
+		fatal("Failed to load the pricing rules", err)
+	}
+
+	scoringModel, err := telemetry.NewScoringModel(config.LoadScoringConfig())
+	if err != nil {
+		fatal("Failed to load the scoring model", err)
+	}
+
+	subscriptionConfig := config.LoadSubscriptionConfig()
+
+	// Initialize the Fiber app
+	app := server.NewApp(origin, apiMetrics, logger)
 
-	app.Options("/*", func(c *fiber.Ctx) error {
-		return c.SendStatus(fiber.StatusOK) // Respond with 200 OK for preflight requests
-	})
+	// The metrics are served apart from the API, so that they are not
+	// exposed with it.
+	metricsApp := server.NewMetricsApp(apiMetrics)
+	metricsAddr := config.LoadMetricsConfig().Addr
+	go func() {
+		fatal("The metrics server stopped", metricsApp.Listen(metricsAddr))
+	}()
 
 	// Setup routes
 	server := server.Server{
-		FiberApp:  app,
-		Database:  database,
-		JWTSecret: jwtSecret,
+		FiberApp:          app,
+		Database:          repositories,
+		JWTSecret:         jwtSecret,
+		Mailer:            mail,
+		AppURL:            mailConfig.AppURL,
+		Payments:          payments,
+		Pricing:           pricingRules,
+		ScoringModel:      scoringModel,
+		IdempotencyWindow: config.LoadIdempotencyConfig().Window,
+
+		SubscriptionGracePeriod:   subscriptionConfig.GracePeriod,
+		SubscriptionRetryInterval: subscriptionConfig.RetryInterval,
+		Logger:                    logger,
 	}
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.Status(http.StatusOK).JSON(fiber.Map{
-			"status":  "healthy",
-			"message": "service is up and running",
-		})
-	})
+	server.SetupRoutes()
 
-	server.SetupCarRoutes()
-	server.SetupTripRoutes()
-	server.SetupUserRoutes()
-	server.SetupReviewRoutes()
-	server.SetupSubscriptionRoutes()
+	go server.ExpireReservations(context.Background(), time.Minute)
+	go server.PurgeIdempotencyKeys(context.Background(), time.Hour)
+	go server.RenewSubscriptions(context.Background(), subscriptionConfig.RenewalInterval)
 
 	// Start server
-	log.Fatal(app.Listen(":8000"))
+	fatal("The server stopped", app.Listen(":8000"))
+}
+
+func runMigrations(dbConfig config.DatabaseConfig) {
+	db, err := database.OpenMigrationDB(dbConfig)
+	if err != nil {
+		fatal("Failed to connect to the database for migrations", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		fatal("Failed to load migrations", err)
+	}
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		fatal("Failed to apply migrations", err)
+	}
+
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
+}
+
+// fatal logs msg, with err when there is one, and exits.
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
 }
@@ -0,0 +1,32 @@
+// Command fakepay serves the deterministic fake payment provider over HTTP,
+// as a local stand-in for a real provider. Point the API at it with
+// PAYMENT_PROVIDER=http and PAYMENT_PROVIDER_URL. Declines are configured
+// with the FAKE_PAYMENT_* variables, see config.LoadPaymentConfig.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+)
+
+func main() {
+	paymentConfig := config.LoadPaymentConfig()
+
+	port := os.Getenv("FAKE_PAYMENT_PORT")
+	if port == "" {
+		port = "8090"
+	}
+
+	fake := payment.NewFake(payment.FakeConfig{
+		DeclineAbove:     paymentConfig.FakeDeclineAbove,
+		DeclineCustomers: paymentConfig.FakeDeclineCustomers,
+		Fail:             paymentConfig.FakeFail,
+	})
+
+	log.Printf("Fake payment provider listening on :%s", port)
+	log.Fatal(http.ListenAndServe(":"+port, fake.Handler()))
+}
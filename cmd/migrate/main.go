@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/migrations"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  status    list every migration and whether it has been applied
+  up        apply all pending migrations
+  down N    roll back the N most recently applied migrations (default 1)
+  redo      roll back the last migration and apply it again
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbConfig := config.LoadDatabaseConfig()
+
+	db, err := database.OpenMigrationDB(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, appliedAt)
+		}
+
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		n := 1
+		if flag.NArg() > 1 {
+			n, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of migrations: %q", flag.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(ctx, n)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+
+	case "redo":
+		migration, err := migrator.Redo(ctx)
+		if err != nil {
+			log.Fatalf("Redo failed: %v", err)
+		}
+		fmt.Printf("redone   %04d_%s\n", migration.Version, migration.Name)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
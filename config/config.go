@@ -2,7 +2,13 @@ package config
 
 import (
 	"log"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type DatabaseConfig struct {
@@ -13,9 +19,94 @@ type DatabaseConfig struct {
 	Password string
 }
 
-type MemcachedConfig struct {
-	Host string
-	Port string
+type MigrationConfig struct {
+	OnStart bool
+}
+
+// AdminConfig describes the administrator account created on startup. It is
+// only used when both Email and PasswordHash are set.
+type AdminConfig struct {
+	Email        string
+	UserName     string
+	PasswordHash string
+}
+
+// MailConfig selects how mail is delivered. Driver is one of smtp, file or
+// log. AppURL is the address of the UI that links in emails point to.
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+	AppURL       string
+}
+
+// PaymentConfig selects the payment provider. Provider is fake, for the
+// in-process fake, or http, for a provider at URL such as cmd/fakepay. The
+// Fake fields configure which operations the fake declines.
+type PaymentConfig struct {
+	Provider             string
+	URL                  string
+	FakeDeclineAbove     money.Amount
+	FakeDeclineCustomers []string
+	FakeFail             []string
+}
+
+// IdempotencyConfig sets how long the responses to requests sent with an
+// Idempotency-Key are kept for retries.
+type IdempotencyConfig struct {
+	Window time.Duration
+}
+
+// SubscriptionConfig sets how often subscriptions are renewed and how failed
+// renewals are retried.
+type SubscriptionConfig struct {
+	RenewalInterval time.Duration
+	GracePeriod     time.Duration
+	RetryInterval   time.Duration
+}
+
+// CacheConfig selects the cache in front of the hot reads. Backend is
+// memcached, memory for an in-process LRU of Size entries, or none. TTL is
+// how long cached reads are fresh, and Stale how much longer they are served
+// while they are refreshed in the background.
+type CacheConfig struct {
+	Backend       string
+	TTL           time.Duration
+	Stale         time.Duration
+	Size          int
+	MemcachedHost string
+	MemcachedPort string
+}
+
+// LogConfig sets how the API logs. Format is json, for production, or
+// text, for development. Lines below Level are dropped.
+type LogConfig struct {
+	Format string
+	Level  slog.Level
+}
+
+// PricingConfig tunes how trips are priced. Rules is JSON in the shape of
+// pricing.Rules, decoded over the default rules, and TimeZone the IANA name
+// of the time zone of the time of day multipliers, the fleet's when empty.
+type PricingConfig struct {
+	Rules    string
+	TimeZone string
+}
+
+// ScoringConfig tunes how driving behavior is scored. Model is JSON in the
+// shape of telemetry.ScoringModel, decoded over the default model.
+type ScoringConfig struct {
+	Model string
+}
+
+// MetricsConfig is the address the metrics are served on, apart from the
+// API.
+type MetricsConfig struct {
+	Addr string
 }
 
 func LoadDatabaseConfig() DatabaseConfig {
@@ -44,8 +135,8 @@ func LoadDatabaseConfig() DatabaseConfig {
 		password = "password"
 	}
 
-	log.Printf("Database Config - Host: %s, Port: %s, Name: %s, User: %s, Password: %s",
-		host, port, name, user, password,
+	log.Printf("Database Config - Host: %s, Port: %s, Name: %s, User: %s, Password set: %t",
+		host, port, name, user, os.Getenv("DB_PASSWORD") != "",
 	)
 
 	return DatabaseConfig{
@@ -57,7 +148,47 @@ func LoadDatabaseConfig() DatabaseConfig {
 	}
 }
 
-func LoadMemcachedConfig() MemcachedConfig {
+func LoadLogConfig() LogConfig {
+	format := os.Getenv("LOG_FORMAT")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "text":
+	default:
+		log.Printf("Ignoring invalid LOG_FORMAT %q", format)
+		format = "json"
+	}
+
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			log.Printf("Ignoring invalid LOG_LEVEL %q", value)
+			level = slog.LevelInfo
+		}
+	}
+
+	return LogConfig{
+		Format: format,
+		Level:  level,
+	}
+}
+
+func LoadCacheConfig() CacheConfig {
+	backend := os.Getenv("CACHE_BACKEND")
+	if backend == "" {
+		backend = "memcached"
+	}
+
+	size := 10000
+	if value := os.Getenv("CACHE_SIZE"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Ignoring invalid CACHE_SIZE %q", value)
+		} else {
+			size = parsed
+		}
+	}
+
 	host := os.Getenv("MEMCACHED_HOST")
 	if host == "" {
 		host = "localhost"
@@ -68,10 +199,230 @@ func LoadMemcachedConfig() MemcachedConfig {
 		port = "11211"
 	}
 
-	log.Printf("Memcached Config - Host: %s, Port: %s", host, port)
+	ttl := durationEnv("CACHE_TTL", 5*time.Minute)
+	stale := durationEnv("CACHE_STALE_TTL", time.Minute)
+
+	log.Printf("Cache Config - Backend: %s, TTL: %s, Stale TTL: %s, Size: %d, Memcached Host: %s, Memcached Port: %s",
+		backend, ttl, stale, size, host, port,
+	)
+
+	return CacheConfig{
+		Backend:       backend,
+		TTL:           ttl,
+		Stale:         stale,
+		Size:          size,
+		MemcachedHost: host,
+		MemcachedPort: port,
+	}
+}
+
+func LoadMigrationConfig() MigrationConfig {
+	onStart := os.Getenv("MIGRATE_ON_START") == "true"
+
+	log.Printf("Migration Config - On start: %t", onStart)
+
+	return MigrationConfig{
+		OnStart: onStart,
+	}
+}
+
+func LoadAdminConfig() AdminConfig {
+	email := os.Getenv("ADMIN_EMAIL")
+
+	username := os.Getenv("ADMIN_USERNAME")
+	if username == "" {
+		username = "admin"
+	}
+
+	passwordHash := os.Getenv("ADMIN_PASSWORD_HASH")
+
+	log.Printf("Admin Config - Email: %s, Username: %s, Password hash set: %t",
+		email, username, passwordHash != "",
+	)
+
+	return AdminConfig{
+		Email:        email,
+		UserName:     username,
+		PasswordHash: passwordHash,
+	}
+}
+
+func LoadMailConfig() MailConfig {
+	driver := os.Getenv("MAIL_DRIVER")
+	if driver == "" {
+		driver = "log"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "DataDrive <no-reply@datadrive.com>"
+	}
+
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost == "" {
+		smtpHost = "localhost"
+	}
+
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "1025"
+	}
+
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost"
+	}
+
+	smtpUsername := os.Getenv("SMTP_USERNAME")
+
+	log.Printf("Mail Config - Driver: %s, From: %s, SMTP: %s:%s, SMTP user: %s, Dir: %s, App URL: %s",
+		driver, from, smtpHost, smtpPort, smtpUsername, dir, appURL,
+	)
+
+	return MailConfig{
+		Driver:       driver,
+		From:         from,
+		SMTPHost:     smtpHost,
+		SMTPPort:     smtpPort,
+		SMTPUsername: smtpUsername,
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          dir,
+		AppURL:       appURL,
+	}
+}
+
+func LoadPaymentConfig() PaymentConfig {
+	provider := os.Getenv("PAYMENT_PROVIDER")
+	if provider == "" {
+		provider = "fake"
+	}
+
+	url := os.Getenv("PAYMENT_PROVIDER_URL")
+	if url == "" {
+		url = "http://localhost:8090"
+	}
+
+	var declineAbove money.Amount
+	if value := os.Getenv("FAKE_PAYMENT_DECLINE_ABOVE"); value != "" {
+		parsed, err := money.Parse(value)
+		if err != nil {
+			log.Printf("Ignoring invalid FAKE_PAYMENT_DECLINE_ABOVE %q: %v", value, err)
+		} else {
+			declineAbove = parsed
+		}
+	}
+
+	declineCustomers := splitList(os.Getenv("FAKE_PAYMENT_DECLINE_CUSTOMERS"))
+	fail := splitList(os.Getenv("FAKE_PAYMENT_FAIL"))
+
+	log.Printf("Payment Config - Provider: %s, URL: %s, Fake decline above: %s, Fake declined customers: %d, Fake failing operations: %v",
+		provider, url, declineAbove, len(declineCustomers), fail,
+	)
+
+	return PaymentConfig{
+		Provider:             provider,
+		URL:                  url,
+		FakeDeclineAbove:     declineAbove,
+		FakeDeclineCustomers: declineCustomers,
+		FakeFail:             fail,
+	}
+}
+
+func LoadIdempotencyConfig() IdempotencyConfig {
+	window := 24 * time.Hour
+	if value := os.Getenv("IDEMPOTENCY_WINDOW"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Ignoring invalid IDEMPOTENCY_WINDOW %q", value)
+		} else {
+			window = parsed
+		}
+	}
+
+	log.Printf("Idempotency Config - Window: %s", window)
+
+	return IdempotencyConfig{
+		Window: window,
+	}
+}
+
+func LoadSubscriptionConfig() SubscriptionConfig {
+	renewalInterval := durationEnv("SUBSCRIPTION_RENEWAL_INTERVAL", time.Hour)
+	gracePeriod := durationEnv("SUBSCRIPTION_GRACE_PERIOD", 72*time.Hour)
+	retryInterval := durationEnv("SUBSCRIPTION_RETRY_INTERVAL", 24*time.Hour)
+
+	log.Printf("Subscription Config - Renewal interval: %s, Grace period: %s, Retry interval: %s",
+		renewalInterval, gracePeriod, retryInterval)
+
+	return SubscriptionConfig{
+		RenewalInterval: renewalInterval,
+		GracePeriod:     gracePeriod,
+		RetryInterval:   retryInterval,
+	}
+}
+
+func LoadPricingConfig() PricingConfig {
+	rules := os.Getenv("PRICING_RULES")
+	timeZone := os.Getenv("PRICING_TIMEZONE")
+
+	log.Printf("Pricing Config - Time zone: %q, Rules overridden: %t", timeZone, rules != "")
+
+	return PricingConfig{
+		Rules:    rules,
+		TimeZone: timeZone,
+	}
+}
+
+func LoadScoringConfig() ScoringConfig {
+	model := os.Getenv("SCORING_MODEL")
+
+	log.Printf("Scoring Config - Model overridden: %t", model != "")
+
+	return ScoringConfig{
+		Model: model,
+	}
+}
+
+func LoadMetricsConfig() MetricsConfig {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = ":9100"
+	}
+
+	log.Printf("Metrics Config - Address: %s", addr)
+
+	return MetricsConfig{
+		Addr: addr,
+	}
+}
+
+// durationEnv reads a positive duration from the environment variable name,
+// falling back to fallback when it is unset or invalid.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return parsed
+}
 
-	return MemcachedConfig{
-		Host: host,
-		Port: port,
+// splitList splits a comma separated environment variable.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
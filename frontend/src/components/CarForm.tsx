@@ -14,6 +14,8 @@ const CarForm: React.FC<CarFormProps> = ({ onInsert }) => {
     status: "AVAILABLE",
     costPerKm: "",
     location: "",
+    latitude: "",
+    longitude: "",
   });
   const [errors, setErrors] = useState<Record<string, string>>({});
 
@@ -31,6 +33,8 @@ const CarForm: React.FC<CarFormProps> = ({ onInsert }) => {
         status: formData.status,
         cost_per_km: parseFloat(formData.costPerKm.replace(",", ".")),
         location: formData.location,
+        latitude: parseFloat(formData.latitude.replace(",", ".")),
+        longitude: parseFloat(formData.longitude.replace(",", ".")),
       };
 
       await addCar(newCar);
@@ -42,6 +46,8 @@ const CarForm: React.FC<CarFormProps> = ({ onInsert }) => {
         status: "AVAILABLE",
         costPerKm: "",
         location: "",
+        latitude: "",
+        longitude: "",
       });
 
       setErrors({});
@@ -136,6 +142,38 @@ const CarForm: React.FC<CarFormProps> = ({ onInsert }) => {
           required
         />
       </div>
+      <div>
+        <label className="block text-sm font-medium text-gray-300">
+          Latitude
+        </label>
+        <input
+          type="text"
+          name="latitude"
+          value={formData.latitude}
+          onChange={handleChange}
+          className="w-full p-2 mt-1 rounded bg-gray-700 border border-gray-600 text-white focus:outline-none focus:ring-2 focus:ring-teal-500"
+          required
+        />
+        {errors.latitude && (
+          <p className="text-red-500 text-sm mt-1">{capitalizeFirstLetter(errors.latitude)}</p>
+        )}
+      </div>
+      <div>
+        <label className="block text-sm font-medium text-gray-300">
+          Longitude
+        </label>
+        <input
+          type="text"
+          name="longitude"
+          value={formData.longitude}
+          onChange={handleChange}
+          className="w-full p-2 mt-1 rounded bg-gray-700 border border-gray-600 text-white focus:outline-none focus:ring-2 focus:ring-teal-500"
+          required
+        />
+        {errors.longitude && (
+          <p className="text-red-500 text-sm mt-1">{capitalizeFirstLetter(errors.longitude)}</p>
+        )}
+      </div>
       <button
         type="submit"
         className="w-full bg-teal-500 text-white py-2 rounded hover:bg-teal-600 focus:outline-none focus:ring-2 focus:ring-teal-500 transition"
@@ -8,6 +8,8 @@ export interface Car {
   status: string;
   cost_per_km: number;
   location: string;
+  latitude?: number;
+  longitude?: number;
 }
 
 interface CarResponse {
@@ -63,6 +65,8 @@ export const addCar = async (car: {
   model: string;
   cost_per_km: number;
   location: string;
+  latitude: number;
+  longitude: number;
 }) => {
   try {
     const response = await api.post(
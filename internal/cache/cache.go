@@ -0,0 +1,60 @@
+// Package cache puts a key-value cache in front of the repositories. Values
+// are opaque bytes; callers encode them, usually as JSON.
+//
+// A Cache is only ever an optimisation: callers fall back to the database
+// on any error, so a backend that is down or evicts early costs latency but
+// never correctness.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/config"
+)
+
+// ErrMiss is returned by Get for keys that are not cached.
+var ErrMiss = errors.New("cache: miss")
+
+// Cache is a key-value store whose entries expire.
+type Cache interface {
+	// Get returns the value cached under key, or ErrMiss.
+	Get(key string) ([]byte, error)
+	// Set caches value under key for ttl. A zero ttl keeps it until it is
+	// evicted.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete forgets key. Deleting a key that is not cached is not an
+	// error.
+	Delete(key string) error
+}
+
+// New returns the cache selected by cfg: memcached, memory for an LRU of
+// cfg.Size entries in the process, or none.
+func New(cfg config.CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "memcached":
+		return NewMemcached(cfg.MemcachedHost, cfg.MemcachedPort), nil
+	case "memory":
+		return NewLRU(cfg.Size), nil
+	case "none":
+		return Nop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// Nop caches nothing, for deployments without a cache.
+type Nop struct{}
+
+func (Nop) Get(key string) ([]byte, error) {
+	return nil, ErrMiss
+}
+
+func (Nop) Set(key string, value []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (Nop) Delete(key string) error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+
+	get := func(key string) string {
+		t.Helper()
+		value, err := c.Get(key)
+		if errors.Is(err, ErrMiss) {
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		return string(value)
+	}
+
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), time.Minute)
+	if get("a") != "1" || get("b") != "2" {
+		t.Fatalf("got a=%q b=%q, want both cached", get("a"), get("b"))
+	}
+
+	// a was read after b, so b is the least recently used.
+	get("a")
+	c.Set("c", []byte("3"), 0)
+	if get("b") != "" || get("a") != "1" || get("c") != "3" {
+		t.Fatalf("got a=%q b=%q c=%q, want b evicted", get("a"), get("b"), get("c"))
+	}
+
+	c.Set("a", []byte("4"), time.Minute)
+	if get("a") != "4" || c.Len() != 2 {
+		t.Fatalf("got a=%q with %d entries, want a replaced in place", get("a"), c.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if get("a") != "" || get("c") != "3" {
+		t.Fatalf("got a=%q c=%q, want a expired and c kept", get("a"), get("c"))
+	}
+
+	c.Delete("c")
+	c.Delete("missing")
+	if get("c") != "" || c.Len() != 0 {
+		t.Fatalf("got c=%q with %d entries, want an empty cache", get("c"), c.Len())
+	}
+}
+
+func TestLRUCopiesValues(t *testing.T) {
+	c := NewLRU(1)
+	value := []byte("cars")
+	c.Set("key", value, 0)
+	value[0] = 'b'
+
+	got, _ := c.Get("key")
+	got[1] = 'x'
+	if again, _ := c.Get("key"); string(again) != "cars" {
+		t.Fatalf("got %q, want the cached value unaffected by its callers", again)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	c := NewLRU(100)
+	cars := NewNamespace(c, "cars")
+	reviews := NewNamespace(c, "reviews")
+
+	key := func(n *Namespace, key string) string {
+		t.Helper()
+		namespaced, err := n.Key(key)
+		if err != nil {
+			t.Fatalf("Key(%q): %v", key, err)
+		}
+		return namespaced
+	}
+
+	page1 := key(cars, "page=1:size=5")
+	page2 := key(cars, "page=2:size=100")
+	c.Set(page1, []byte("first"), 0)
+	c.Set(page2, []byte("second"), 0)
+	c.Set(key(reviews, "ABC1234"), []byte("reviews"), 0)
+
+	if key(cars, "page=1:size=5") != page1 {
+		t.Fatal("got a different key within the same generation")
+	}
+
+	// Generations are told apart by the clock, which may not have moved
+	// since the first one.
+	time.Sleep(time.Millisecond)
+	if err := cars.Invalidate(); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	for _, page := range []string{"page=1:size=5", "page=2:size=100"} {
+		if _, err := c.Get(key(cars, page)); !errors.Is(err, ErrMiss) {
+			t.Fatalf("got %v for %s after invalidating, want a miss", err, page)
+		}
+	}
+	if value, err := c.Get(key(reviews, "ABC1234")); err != nil || string(value) != "reviews" {
+		t.Fatalf("got %q, %v, want other namespaces kept", value, err)
+	}
+
+	// Losing the generation invalidates the namespace too.
+	current := key(cars, "page=1:size=5")
+	c.Set(current, []byte("first"), 0)
+	time.Sleep(time.Millisecond)
+	c.Delete("cars:generation")
+	if key(cars, "page=1:size=5") == current {
+		t.Fatal("got the same key after the generation was evicted")
+	}
+}
+
+func TestNop(t *testing.T) {
+	var c Cache = Nop{}
+	if err := c.Set("key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := c.Get("key"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("got %v, want a miss", err)
+	}
+}
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Options tune a Loader.
+type Options struct {
+	// TTL is how long a loaded value is fresh. A zero TTL caches nothing.
+	TTL time.Duration
+	// Stale is how long after TTL the value is still served, while it is
+	// loaded again in the background.
+	Stale time.Duration
+	// NotFound is the error the load returns for what does not exist. It is
+	// cached for NegativeTTL, so that lookups of missing things do not each
+	// reach the database.
+	NotFound    error
+	NegativeTTL time.Duration
+}
+
+// Stats counts how the reads of a Loader were served.
+type Stats struct {
+	// Hits were served fresh from the cache, and StaleHits from a stale
+	// value while it was refreshed.
+	Hits      int64
+	StaleHits int64
+	// NegativeHits were answered with the cached NotFound.
+	NegativeHits int64
+	// Misses had to wait for a load, shared with the concurrent misses of
+	// the same key.
+	Misses int64
+	// Loads and LoadErrors count the calls of the load function, the
+	// background refreshes included.
+	Loads      int64
+	LoadErrors int64
+}
+
+// Reporter reports how the reads of a cache were served, for metrics.
+type Reporter interface {
+	Name() string
+	Stats() Stats
+}
+
+// Loader reads values of type T through the cache: a miss loads the value
+// and caches it. Concurrent misses of a key share one load, so a cold key
+// costs a single query however many requests ask for it.
+//
+// The keys of a Loader live in a Namespace of the same name, which
+// Invalidate starts anew.
+type Loader[T any] struct {
+	name      string
+	cache     Cache
+	namespace *Namespace
+	options   Options
+
+	group      singleflight.Group
+	refreshing sync.Map
+
+	hits, staleHits, negativeHits, misses, loads, loadErrors atomic.Int64
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// entry is what a Loader caches for a key.
+type entry[T any] struct {
+	Value      T         `json:"value"`
+	NotFound   bool      `json:"not_found,omitempty"`
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// NewLoader returns a loader whose keys are cached in c under name.
+func NewLoader[T any](c Cache, name string, options Options) *Loader[T] {
+	if c == nil {
+		c = Nop{}
+	}
+	return &Loader[T]{
+		name:      name,
+		cache:     c,
+		namespace: NewNamespace(c, name),
+		options:   options,
+		now:       time.Now,
+	}
+}
+
+// Name returns the name of the loader.
+func (l *Loader[T]) Name() string {
+	return l.name
+}
+
+// Get returns the value of key, from the cache or from load.
+//
+// load runs detached from the cancellation of ctx, since other callers may
+// be waiting for it; it should bound itself with a timeout.
+func (l *Loader[T]) Get(ctx context.Context, key string, load func(context.Context) (T, error)) (T, error) {
+	span := trace.SpanFromContext(ctx)
+
+	if l.options.TTL <= 0 {
+		l.misses.Add(1)
+		return l.load(ctx, load)
+	}
+
+	cacheKey, err := l.namespace.Key(key)
+	if err != nil {
+		// Without the generation of the namespace, nothing cached can be
+		// trusted to be current.
+		span.AddEvent("Cache unavailable", trace.WithAttributes(
+			attribute.String("cache.name", l.name),
+			attribute.String("error", err.Error()),
+		))
+		l.misses.Add(1)
+		return l.load(ctx, load)
+	}
+	attributes := trace.WithAttributes(
+		attribute.String("cache.name", l.name),
+		attribute.String("cache.key", cacheKey),
+	)
+
+	if cached, ok := l.cached(cacheKey); ok {
+		switch {
+		case cached.NotFound:
+			l.negativeHits.Add(1)
+			span.AddEvent("Cache hit", attributes, trace.WithAttributes(attribute.Bool("cache.not_found", true)))
+			var zero T
+			return zero, l.options.NotFound
+		case l.now().Before(cached.FreshUntil):
+			l.hits.Add(1)
+			span.AddEvent("Cache hit", attributes)
+			return cached.Value, nil
+		default:
+			l.staleHits.Add(1)
+			span.AddEvent("Cache stale hit", attributes)
+			l.refresh(ctx, cacheKey, load)
+			return cached.Value, nil
+		}
+	}
+
+	l.misses.Add(1)
+	span.AddEvent("Cache miss", attributes)
+
+	result, err, shared := l.group.Do(cacheKey, func() (any, error) {
+		return l.loadAndStore(context.WithoutCancel(ctx), cacheKey, load)
+	})
+	if shared {
+		span.AddEvent("Cache load shared", attributes)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.(T), nil
+}
+
+// Invalidate drops every value cached by the loader.
+func (l *Loader[T]) Invalidate() error {
+	return l.namespace.Invalidate()
+}
+
+// Stats returns the counts of the reads so far.
+func (l *Loader[T]) Stats() Stats {
+	return Stats{
+		Hits:         l.hits.Load(),
+		StaleHits:    l.staleHits.Load(),
+		NegativeHits: l.negativeHits.Load(),
+		Misses:       l.misses.Load(),
+		Loads:        l.loads.Load(),
+		LoadErrors:   l.loadErrors.Load(),
+	}
+}
+
+// cached returns the entry of cacheKey, if one can be read. Entries that do
+// not decode, such as ones written by an older version, count as misses.
+func (l *Loader[T]) cached(cacheKey string) (entry[T], bool) {
+	data, err := l.cache.Get(cacheKey)
+	if err != nil {
+		return entry[T]{}, false
+	}
+	var cached entry[T]
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return entry[T]{}, false
+	}
+	return cached, true
+}
+
+// refresh loads cacheKey again in the background, unless it already is.
+func (l *Loader[T]) refresh(ctx context.Context, cacheKey string, load func(context.Context) (T, error)) {
+	if _, running := l.refreshing.LoadOrStore(cacheKey, struct{}{}); running {
+		return
+	}
+
+	// The refresh outlives the request, so it only keeps its span, not what
+	// else the context of the request refers to.
+	ctx = trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	go func() {
+		defer l.refreshing.Delete(cacheKey)
+		// Failed refreshes keep serving the stale value until it expires.
+		l.group.Do(cacheKey, func() (any, error) {
+			return l.loadAndStore(ctx, cacheKey, load)
+		})
+	}()
+}
+
+// loadAndStore loads the value of cacheKey and caches the outcome.
+func (l *Loader[T]) loadAndStore(ctx context.Context, cacheKey string, load func(context.Context) (T, error)) (T, error) {
+	value, err := l.load(ctx, load)
+
+	var cached entry[T]
+	var ttl time.Duration
+	switch {
+	case err == nil:
+		cached = entry[T]{Value: value, FreshUntil: l.now().Add(l.options.TTL)}
+		ttl = l.options.TTL + l.options.Stale
+	case l.options.NotFound != nil && l.options.NegativeTTL > 0 && errors.Is(err, l.options.NotFound):
+		cached = entry[T]{NotFound: true, FreshUntil: l.now().Add(l.options.NegativeTTL)}
+		ttl = l.options.NegativeTTL
+	default:
+		return value, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	data, marshalErr := json.Marshal(cached)
+	if marshalErr == nil {
+		marshalErr = l.cache.Set(cacheKey, data, ttl)
+	}
+	if marshalErr != nil {
+		span.AddEvent("Failed to set cache", trace.WithAttributes(
+			attribute.String("cache.key", cacheKey),
+			attribute.String("error", marshalErr.Error()),
+		))
+	} else {
+		span.AddEvent("Data cached successfully", trace.WithAttributes(attribute.String("cache.key", cacheKey)))
+	}
+
+	return value, err
+}
+
+// load calls load and counts the call.
+func (l *Loader[T]) load(ctx context.Context, load func(context.Context) (T, error)) (T, error) {
+	l.loads.Add(1)
+	value, err := load(ctx)
+	if err != nil && !errors.Is(err, l.options.NotFound) {
+		l.loadErrors.Add(1)
+	}
+	return value, err
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errNoCar = errors.New("car not found")
+
+func TestLoaderSharesConcurrentMisses(t *testing.T) {
+	l := NewLoader[string](NewLRU(100), "cars", Options{TTL: time.Minute})
+
+	release := make(chan struct{})
+	var calls atomic.Int64
+	load := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "page", nil
+	}
+
+	const requests = 20
+	var wg sync.WaitGroup
+	results := make([]string, requests)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = l.Get(context.Background(), "available", load)
+		}()
+	}
+
+	// Give every request the time to join the load before it ends.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("got %d loads, want the concurrent misses to share one", calls.Load())
+	}
+	for _, result := range results {
+		if result != "page" {
+			t.Fatalf("got %q, want every request to get the page", result)
+		}
+	}
+
+	if got, _ := l.Get(context.Background(), "available", load); got != "page" || calls.Load() != 1 {
+		t.Fatalf("got %q after %d loads, want a hit", got, calls.Load())
+	}
+	stats := l.Stats()
+	if stats.Misses != requests || stats.Hits != 1 || stats.Loads != 1 {
+		t.Fatalf("got %+v, want %d misses, a hit and a load", stats, requests)
+	}
+}
+
+func TestLoaderServesStaleWhileRefreshing(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(100)
+	c.now = func() time.Time { return now }
+	l := NewLoader[int](c, "plans", Options{TTL: time.Minute, Stale: time.Minute})
+	l.now = c.now
+
+	var version atomic.Int64
+	refreshed := make(chan struct{}, 1)
+	load := func(ctx context.Context) (int, error) {
+		v := int(version.Add(1))
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+		return v, nil
+	}
+
+	if got, _ := l.Get(context.Background(), "on-sale", load); got != 1 {
+		t.Fatalf("got %d, want the first load", got)
+	}
+
+	now = now.Add(90 * time.Second)
+	if got, _ := l.Get(context.Background(), "on-sale", load); got != 1 {
+		t.Fatalf("got %d, want the stale value while it is refreshed", got)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the stale value was not refreshed")
+	}
+
+	// The refresh caches its value once the load returns.
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, _ := l.Get(context.Background(), "on-sale", load)
+		if got == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d, want the refreshed value", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if got, _ := l.Get(context.Background(), "on-sale", load); got != 3 {
+		t.Fatalf("got %d, want a load once the stale value expired", got)
+	}
+
+	stats := l.Stats()
+	if stats.StaleHits != 1 || stats.Misses != 2 || stats.Loads != 3 {
+		t.Fatalf("got %+v, want a stale hit, two misses and three loads", stats)
+	}
+}
+
+func TestLoaderRefreshKeepsOnlyTheSpan(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(100)
+	c.now = func() time.Time { return now }
+	l := NewLoader[int](c, "plans", Options{TTL: time.Minute, Stale: time.Minute})
+	l.now = c.now
+
+	type requestKey struct{}
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	})
+	ctx := context.WithValue(trace.ContextWithSpanContext(context.Background(), spanContext), requestKey{}, "request")
+
+	refreshed := make(chan context.Context, 1)
+	var loads atomic.Int64
+	load := func(ctx context.Context) (int, error) {
+		if loads.Add(1) > 1 {
+			refreshed <- ctx
+		}
+		return 1, nil
+	}
+
+	l.Get(ctx, "on-sale", load)
+	now = now.Add(90 * time.Second)
+	l.Get(ctx, "on-sale", load)
+
+	select {
+	case refreshCtx := <-refreshed:
+		if refreshCtx.Value(requestKey{}) != nil {
+			t.Fatal("the refresh reached the context of the request")
+		}
+		if got := trace.SpanContextFromContext(refreshCtx); !got.Equal(spanContext) {
+			t.Fatalf("got span %v, want the span of the request", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the stale value was not refreshed")
+	}
+}
+
+func TestLoaderCachesNotFound(t *testing.T) {
+	l := NewLoader[[]string](NewLRU(100), "reviews", Options{
+		TTL:         time.Minute,
+		NotFound:    errNoCar,
+		NegativeTTL: time.Minute,
+	})
+
+	var calls int
+	load := func(ctx context.Context) ([]string, error) {
+		calls++
+		return nil, errNoCar
+	}
+
+	for range 3 {
+		if _, err := l.Get(context.Background(), "car=XYZ9999", load); !errors.Is(err, errNoCar) {
+			t.Fatalf("got %v, want the car not found", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("got %d loads, want the missing car to be cached", calls)
+	}
+	if stats := l.Stats(); stats.NegativeHits != 2 || stats.LoadErrors != 0 {
+		t.Fatalf("got %+v, want two negative hits and no load errors", stats)
+	}
+}
+
+func TestLoaderDoesNotCacheErrors(t *testing.T) {
+	l := NewLoader[string](NewLRU(100), "cars", Options{TTL: time.Minute})
+
+	var calls int
+	failing := errors.New("database is down")
+	load := func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", failing
+		}
+		return "page", nil
+	}
+
+	if _, err := l.Get(context.Background(), "all", load); !errors.Is(err, failing) {
+		t.Fatalf("got %v, want the failure", err)
+	}
+	if got, err := l.Get(context.Background(), "all", load); err != nil || got != "page" {
+		t.Fatalf("got %q, %v, want the failure to be retried", got, err)
+	}
+	if stats := l.Stats(); stats.LoadErrors != 1 || stats.Loads != 2 {
+		t.Fatalf("got %+v, want a load error out of two loads", stats)
+	}
+}
+
+func TestLoaderInvalidate(t *testing.T) {
+	l := NewLoader[int](NewLRU(100), "cars", Options{TTL: time.Minute})
+
+	var calls int
+	load := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	l.Get(context.Background(), "all:page=1:size=5", load)
+	l.Get(context.Background(), "all:page=1:size=100", load)
+
+	time.Sleep(time.Millisecond)
+	if err := l.Invalidate(); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if got, _ := l.Get(context.Background(), "all:page=1:size=100", load); got != 3 {
+		t.Fatalf("got %d, want a load after invalidating", got)
+	}
+}
+
+func TestLoaderWithoutTTL(t *testing.T) {
+	c := NewLRU(100)
+	l := NewLoader[int](c, "cars", Options{})
+
+	var calls int
+	load := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	l.Get(context.Background(), "all", load)
+	if got, _ := l.Get(context.Background(), "all", load); got != 2 || c.Len() != 0 {
+		t.Fatalf("got %d with %d entries, want nothing cached", got, c.Len())
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// Memcached is a cache shared by every instance of the API.
+type Memcached struct {
+	client *memcache.Client
+}
+
+func NewMemcached(host, port string) *Memcached {
+	server := fmt.Sprintf("%s:%s", host, port)
+	mc := memcache.New(server)
+	mc.Timeout = 2 * time.Second
+	return &Memcached{client: mc}
+}
+
+func (c *Memcached) Get(key string) ([]byte, error) {
+	item, err := c.client.Get(key)
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, ErrMiss
+		}
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (c *Memcached) Set(key string, value []byte, ttl time.Duration) error {
+	// memcached counts expirations in whole seconds, and zero never expires.
+	expiration := int32(ttl / time.Second)
+	if ttl > 0 && expiration == 0 {
+		expiration = 1
+	}
+	return c.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      value,
+		Expiration: expiration,
+	})
+}
+
+func (c *Memcached) Delete(key string) error {
+	err := c.client.Delete(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
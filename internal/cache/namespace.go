@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Namespace groups keys that are invalidated together, such as every page
+// of every listing of the cars.
+//
+// Keys are prefixed with the current generation of the namespace, which is
+// itself kept in the cache. Invalidate starts a new generation: the keys of
+// the earlier one are never read again, and expire or are evicted on their
+// own. Since the generation lives in the cache, every instance of the API
+// sharing a memcached sees the invalidation.
+type Namespace struct {
+	cache Cache
+	name  string
+}
+
+// NewNamespace returns the namespace called name in c.
+func NewNamespace(c Cache, name string) *Namespace {
+	return &Namespace{cache: c, name: name}
+}
+
+func (n *Namespace) generationKey() string {
+	return n.name + ":generation"
+}
+
+// Key returns the key under which key is cached in the current generation.
+func (n *Namespace) Key(key string) (string, error) {
+	generation, err := n.cache.Get(n.generationKey())
+	if errors.Is(err, ErrMiss) {
+		// A generation that was never set, or was evicted, is replaced by a
+		// new one, which also invalidates whatever was cached under it.
+		generation, err = n.newGeneration()
+	}
+	if err != nil {
+		return "", err
+	}
+	return n.name + ":" + string(generation) + ":" + key, nil
+}
+
+// Invalidate starts a new generation of the namespace.
+func (n *Namespace) Invalidate() error {
+	_, err := n.newGeneration()
+	return err
+}
+
+// newGeneration stores a generation that differs from the earlier ones.
+func (n *Namespace) newGeneration() ([]byte, error) {
+	generation := []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := n.cache.Set(n.generationKey(), generation, 0); err != nil {
+		return nil, err
+	}
+	return generation, nil
+}
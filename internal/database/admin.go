@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+// BootstrapAdmin makes sure email can log in as an administrator with the
+// given bcrypt hash. The account is created on the first start and its
+// password and role are reset on every start after that.
+func BootstrapAdmin(ctx context.Context, db *Database, email, username, passwordHash string) error {
+	if _, err := bcrypt.Cost([]byte(passwordHash)); err != nil {
+		return fmt.Errorf("invalid admin password hash: %w", err)
+	}
+
+	_, err := db.UserDB.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		if _, err := db.UserDB.CreateUser(ctx, email, username, "Administrator", passwordHash); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if err := db.UserDB.UpdatePassword(ctx, email, passwordHash); err != nil {
+			return err
+		}
+	}
+
+	return db.RoleDB.SetUserRole(ctx, email, models.AdminRole)
+}
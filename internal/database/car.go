@@ -3,25 +3,32 @@ package database
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/go-sql-driver/mysql"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/trace"
 
-	"github.com/ntentasd/db-deliverable3/internal/memcached"
+	"github.com/ntentasd/db-deliverable3/internal/cache"
 	"github.com/ntentasd/db-deliverable3/internal/models"
 )
 
 type CarDB struct {
-	DB       *sql.DB
-	Cache    *memcached.Client
-	CacheTTL int32
+	DB *sql.DB
+
+	// listings caches every listing of the cars, so that a change to any car
+	// invalidates them all at once.
+	listings *cache.Loader[carPage]
+}
+
+// carPage is a cached page of a listing of the cars.
+type carPage struct {
+	Cars  []models.Car
+	Count int
 }
 
 var (
@@ -30,142 +37,140 @@ var (
 	ErrInvalidPageSize       = fmt.Errorf("invalid page size")
 	ErrDuplicateLicensePlate = fmt.Errorf("car with this license plate already exists")
 	ErrInvalidStatusChange   = fmt.Errorf("cannot change car's status to/from rented")
+	ErrCarStatusChanged      = fmt.Errorf("car status changed")
+	ErrInvalidCarSort        = fmt.Errorf("invalid sort field")
 )
 
-func NewCarDatabase(db *sql.DB, cache *memcached.Client, cacheTTL int32) *CarDB {
-	return &CarDB{DB: db, Cache: cache, CacheTTL: cacheTTL}
-}
-
-func (db *CarDB) GetAllCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
-	tracer := otel.Tracer("database")
-	_, span := tracer.Start(ctx, "GetAllCarsQuery")
-	defer span.End()
+const carColumns = `license_plate, make, model, status, cost_per_km, category, location,
+	ST_Latitude(position), ST_Longitude(position)`
 
-	cacheKey := fmt.Sprintf("cars:page=%d:size=%d", page, pageSize)
+// pointWKT is the WKT of a position in SRID 4326, latitude first.
+func pointWKT(latitude, longitude float64) string {
+	return "POINT(" + strconv.FormatFloat(latitude, 'f', -1, 64) + " " + strconv.FormatFloat(longitude, 'f', -1, 64) + ")"
+}
 
-	if cachedData, err := db.Cache.Get(cacheKey); err == nil {
-		var cachedResult struct {
-			Cars  []models.Car
-			Count int
-		}
-		if err := json.Unmarshal(cachedData, &cachedResult); err == nil {
-			return cachedResult.Cars, cachedResult.Count, nil
-		}
-		span.AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("cache.key", cacheKey),
-		))
-	} else {
-		span.AddEvent("Cache miss", trace.WithAttributes(
-			attribute.String("cache.key", cacheKey),
-		))
+// optionalPointWKT is the WKT of a position, or nil when it is not known.
+func optionalPointWKT(latitude, longitude *float64) any {
+	if latitude == nil || longitude == nil {
+		return nil
 	}
+	return pointWKT(*latitude, *longitude)
+}
 
-	offset := (page - 1) * pageSize
-
-	query := `
-		SELECT *,
-		COUNT(*) OVER() as total_cars
-		FROM Cars
-		LIMIT ? OFFSET ?
-	`
-
-	span.SetAttributes(
-		attribute.String("query", query),
-		attribute.Int("query.page", page),
-		attribute.Int("query.page_size", pageSize),
-	)
+func NewCarDatabase(db *sql.DB, c cache.Cache, options cache.Options) *CarDB {
+	return &CarDB{DB: db, listings: cache.NewLoader[carPage](c, "cars", options)}
+}
 
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
+// carSortColumns maps the fields the fleet can be sorted by to their columns.
+// Only these are written into the ORDER BY clause of a search.
+var carSortColumns = map[models.CarSortField]string{
+	models.SortByLicensePlate: "license_plate",
+	models.SortByMake:         "make",
+	models.SortByModel:        "model",
+	models.SortByStatus:       "status",
+	models.SortByCostPerKm:    "cost_per_km",
+	models.SortByCategory:     "category",
+	models.SortByLocation:     "location",
+}
 
-	rows, err := db.DB.QueryContext(ctx, query, pageSize, offset)
-	if err != nil {
-		span.RecordError(err)
-		return nil, 0, err
+// buildCarSearch returns the WHERE and ORDER BY clauses of search along with
+// the arguments of the WHERE clause. Every value is passed as an argument.
+func buildCarSearch(search models.CarSearch) (string, []any, error) {
+	var conditions []string
+	var args []any
+	filter := func(condition string, arg any) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
 	}
-	defer rows.Close()
 
-	var cars []models.Car
-	var count int
-	for rows.Next() {
-		var car models.Car
-		if err := rows.Scan(
-			&car.LicensePlate,
-			&car.Make,
-			&car.Model,
-			&car.Status,
-			&car.CostPerKm,
-			&car.Location,
-			&count,
-		); err != nil {
-			span.RecordError(err)
-			return nil, 0, err
+	if search.Status != "" {
+		filter("status = ?", search.Status)
+	}
+	if search.Category != "" {
+		filter("category = ?", search.Category)
+	}
+	if search.Make != "" {
+		filter("make = ?", search.Make)
+	}
+	if search.Model != "" {
+		filter("model = ?", search.Model)
+	}
+	if search.Location != "" {
+		filter("location = ?", strings.ToUpper(search.Location))
+	}
+	if search.MinCostPerKm != nil {
+		filter("cost_per_km >= ?", *search.MinCostPerKm)
+	}
+	if search.MaxCostPerKm != nil {
+		filter("cost_per_km <= ?", *search.MaxCostPerKm)
+	}
+	if terms := search.Terms(); len(terms) > 0 {
+		// In boolean mode, +term* requires a word starting with term. Words
+		// shorter than innodb_ft_min_token_size are not indexed.
+		for i, term := range terms {
+			terms[i] = "+" + term + "*"
 		}
-		cars = append(cars, car)
+		filter("MATCH (make, model, location) AGAINST (? IN BOOLEAN MODE)", strings.Join(terms, " "))
 	}
 
-	result := struct {
-		Cars  []models.Car
-		Count int
-	}{
-		Cars:  cars,
-		Count: count,
+	sort := search.Sort
+	if sort == "" {
+		sort = models.SortByLicensePlate
 	}
-	cachedData, _ := json.Marshal(result)
-	err = db.Cache.Set(cacheKey, cachedData, db.CacheTTL)
-	if err != nil {
-		span.AddEvent("Failed to set cache", trace.WithAttributes(attribute.String("error", err.Error())))
-	} else {
-		span.AddEvent("Data cached successfully")
+	column, ok := carSortColumns[sort]
+	if !ok {
+		return "", nil, ErrInvalidCarSort
+	}
+	direction := "ASC"
+	if search.Descending {
+		direction = "DESC"
 	}
 
-	return cars, count, nil
+	var clauses string
+	if len(conditions) > 0 {
+		clauses = "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	// The license plate breaks ties, so that pages do not overlap.
+	clauses += "ORDER BY " + column + " " + direction
+	if column != "license_plate" {
+		clauses += ", license_plate"
+	}
+
+	return clauses, args, nil
 }
 
-func (db *CarDB) GetAllAvailableCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+// SearchCars returns a page of the cars matching search, and how many cars
+// match it in total.
+func (db *CarDB) SearchCars(ctx context.Context, search models.CarSearch) ([]models.Car, int, error) {
 	tracer := otel.Tracer("database")
-	ctx, span := tracer.Start(ctx, "GetAllAvailableCarsQuery")
+	ctx, span := tracer.Start(ctx, "SearchCarsQuery")
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("availCars:page=%d:size=%d", page, pageSize)
-
-	if cachedData, err := db.Cache.Get(cacheKey); err == nil {
-		var cachedResult struct {
-			Cars  []models.Car
-			Count int
-		}
-		if err := json.Unmarshal(cachedData, &cachedResult); err == nil {
-			return cachedResult.Cars, cachedResult.Count, nil
-		}
-		span.AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("cache.key", cacheKey),
-		))
-	} else {
-		span.AddEvent("Cache miss", trace.WithAttributes(
-			attribute.String("cache.key", cacheKey),
-		))
+	clauses, args, err := buildCarSearch(search)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
 	}
 
-	offset := (page - 1) * pageSize
-
 	query := `
-		SELECT *,
-		COUNT(*) OVER() as total_available_cars
+		SELECT ` + carColumns + `,
+		COUNT(*) OVER() as total_cars
 		FROM Cars
-		WHERE status = 'AVAILABLE'
+		` + clauses + `
 		LIMIT ? OFFSET ?
 	`
+	args = append(args, search.PageSize, (search.Page-1)*search.PageSize)
 
 	span.SetAttributes(
 		attribute.String("query", query),
-		attribute.Int("query.page", page),
-		attribute.Int("query.page_size", pageSize),
+		attribute.Int("query.page", search.Page),
+		attribute.Int("query.page_size", search.PageSize),
 	)
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := db.DB.QueryContext(ctx, query, pageSize, offset)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		span.RecordError(err)
 		return nil, 0, err
@@ -182,7 +187,10 @@ func (db *CarDB) GetAllAvailableCars(ctx context.Context, page, pageSize int) ([
 			&car.Model,
 			&car.Status,
 			&car.CostPerKm,
+			&car.Category,
 			&car.Location,
+			&car.Latitude,
+			&car.Longitude,
 			&count,
 		); err != nil {
 			span.RecordError(err)
@@ -190,129 +198,167 @@ func (db *CarDB) GetAllAvailableCars(ctx context.Context, page, pageSize int) ([
 		}
 		cars = append(cars, car)
 	}
-
-	result := struct {
-		Cars  []models.Car
-		Count int
-	}{
-		Cars:  cars,
-		Count: count,
-	}
-	cachedData, _ := json.Marshal(result)
-	err = db.Cache.Set(cacheKey, cachedData, db.CacheTTL)
-	if err != nil {
-		span.AddEvent("Failed to set cache", trace.WithAttributes(attribute.String("error", err.Error())))
-	} else {
-		span.AddEvent("Data cached successfully", trace.WithAttributes(
-			attribute.String("cache.key", cacheKey),
-		))
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, 0, err
 	}
 
 	return cars, count, nil
 }
 
-func (db *CarDB) GetAllRentedCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+// nearbyBounds returns the WKT of a box around a position that holds every
+// point within radius km of it, for the spatial index to narrow a search
+// down to. The box is clamped to the valid coordinates.
+func nearbyBounds(latitude, longitude, radius float64) string {
+	const kmPerDegree = 111.32
+	latDelta := radius / kmPerDegree
+	lngDelta := 180.0
+	if cos := math.Cos(latitude * math.Pi / 180); cos > 0 {
+		lngDelta = math.Min(180, radius/(kmPerDegree*cos))
+	}
+
+	minLat, maxLat := math.Max(-90, latitude-latDelta), math.Min(90, latitude+latDelta)
+	minLng, maxLng := math.Max(-180, longitude-lngDelta), math.Min(180, longitude+lngDelta)
+
+	corner := func(lat, lng float64) string {
+		return strconv.FormatFloat(lat, 'f', -1, 64) + " " + strconv.FormatFloat(lng, 'f', -1, 64)
+	}
+	return "POLYGON((" + corner(minLat, minLng) + ", " + corner(maxLat, minLng) + ", " +
+		corner(maxLat, maxLng) + ", " + corner(minLat, maxLng) + ", " + corner(minLat, minLng) + "))"
+}
+
+// GetAvailableCarsNear returns up to limit available cars within radius km
+// of a position, the closest first.
+func (db *CarDB) GetAvailableCarsNear(ctx context.Context, latitude, longitude, radius float64, limit int) ([]models.NearbyCar, error) {
 	tracer := otel.Tracer("database")
-	ctx, span := tracer.Start(ctx, "GetAllRentedCarsQuery")
+	ctx, span := tracer.Start(ctx, "GetAvailableCarsNearQuery")
 	defer span.End()
 
-	offset := (page - 1) * pageSize
-
+	// MBRContains narrows the search down with the spatial index before the
+	// distances are computed.
 	query := `
-		SELECT *,
-		COUNT(*) OVER() as total_available_cars
+		SELECT ` + carColumns + `,
+		ST_Distance_Sphere(position, ST_PointFromText(?, 4326)) / 1000 AS distance
 		FROM Cars
-		WHERE status = 'RENTED'
-		LIMIT ? OFFSET ?
+		WHERE status = 'AVAILABLE'
+		AND MBRContains(ST_PolygonFromText(?, 4326), position)
+		HAVING distance <= ?
+		ORDER BY distance, license_plate
+		LIMIT ?
 	`
 
 	span.SetAttributes(
 		attribute.String("query", query),
-		attribute.Int("query.page", page),
-		attribute.Int("query.page_size", pageSize),
+		attribute.Float64("query.latitude", latitude),
+		attribute.Float64("query.longitude", longitude),
+		attribute.Float64("query.radius", radius),
 	)
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := db.DB.QueryContext(ctx, query, pageSize, offset)
+	rows, err := db.DB.QueryContext(ctx, query,
+		pointWKT(latitude, longitude), nearbyBounds(latitude, longitude, radius), radius, limit)
 	if err != nil {
 		span.RecordError(err)
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var cars []models.Car
-	var count int
+	var cars []models.NearbyCar
 	for rows.Next() {
-		var car models.Car
+		var car models.NearbyCar
 		if err := rows.Scan(
 			&car.LicensePlate,
 			&car.Make,
 			&car.Model,
 			&car.Status,
 			&car.CostPerKm,
+			&car.Category,
 			&car.Location,
-			&count,
+			&car.Latitude,
+			&car.Longitude,
+			&car.Distance,
 		); err != nil {
 			span.RecordError(err)
-			return nil, 0, err
+			return nil, err
 		}
 		cars = append(cars, car)
 	}
-	return cars, count, nil
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return cars, nil
 }
 
-func (db *CarDB) GetAllMaintenanceCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+// cachedCars serves the page of search from the cache under key, or
+// searches the cars and caches the page.
+func (db *CarDB) cachedCars(ctx context.Context, key string, search models.CarSearch) ([]models.Car, int, error) {
+	page, err := db.listings.Get(ctx, key, func(ctx context.Context) (carPage, error) {
+		cars, count, err := db.SearchCars(ctx, search)
+		return carPage{Cars: cars, Count: count}, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Cars, page.Count, nil
+}
+
+func (db *CarDB) GetAllCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
 	tracer := otel.Tracer("database")
-	ctx, span := tracer.Start(ctx, "GetAllMaintenanceCarsQuery")
+	ctx, span := tracer.Start(ctx, "GetAllCarsQuery")
 	defer span.End()
 
-	offset := (page - 1) * pageSize
+	key := fmt.Sprintf("all:page=%d:size=%d", page, pageSize)
+	return db.cachedCars(ctx, key, models.CarSearch{Page: page, PageSize: pageSize})
+}
 
-	query := `
-		SELECT *,
-		COUNT(*) OVER() as total_available_cars
-		FROM Cars
-		WHERE status = 'MAINTENANCE'
-		LIMIT ? OFFSET ?
-	`
+func (db *CarDB) GetAllAvailableCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	tracer := otel.Tracer("database")
+	ctx, span := tracer.Start(ctx, "GetAllAvailableCarsQuery")
+	defer span.End()
 
-	span.SetAttributes(
-		attribute.String("query", query),
-		attribute.Int("query.page", page),
-		attribute.Int("query.page_size", pageSize),
-	)
+	key := fmt.Sprintf("available:page=%d:size=%d", page, pageSize)
+	return db.cachedCars(ctx, key, models.CarSearch{Status: models.Available, Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) GetAllRentedCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Status: models.Rented, Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) GetAllMaintenanceCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Status: models.Maintenance, Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) CountCarsByStatus(ctx context.Context) (map[models.Status]int, error) {
+	tracer := otel.Tracer("database")
+	ctx, span := tracer.Start(ctx, "CountCarsByStatusQuery")
+	defer span.End()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := db.DB.QueryContext(ctx, query, pageSize, offset)
+	rows, err := db.DB.QueryContext(ctx, `SELECT status, COUNT(*) FROM Cars GROUP BY status`)
 	if err != nil {
 		span.RecordError(err)
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var cars []models.Car
-	var count int
+	counts := make(map[models.Status]int)
 	for rows.Next() {
-		var car models.Car
-		if err := rows.Scan(
-			&car.LicensePlate,
-			&car.Make,
-			&car.Model,
-			&car.Status,
-			&car.CostPerKm,
-			&car.Location,
-			&count,
-		); err != nil {
+		var status models.Status
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
 			span.RecordError(err)
-			return nil, 0, err
+			return nil, err
 		}
-		cars = append(cars, car)
+		counts[status] = count
 	}
-	return cars, count, nil
+
+	return counts, rows.Err()
 }
 
 func (db *CarDB) GetCarByLicensePlate(ctx context.Context, licensePlate string) (models.Car, error) {
@@ -321,7 +367,7 @@ func (db *CarDB) GetCarByLicensePlate(ctx context.Context, licensePlate string)
 	defer span.End()
 
 	query := `
-    SELECT *
+    SELECT ` + carColumns + `
     FROM Cars
     WHERE license_plate = ?
   `
@@ -338,7 +384,8 @@ func (db *CarDB) GetCarByLicensePlate(ctx context.Context, licensePlate string)
 
 	var car models.Car
 	if err := row.Scan(
-		&car.LicensePlate, &car.Make, &car.Model, &car.Status, &car.CostPerKm, &car.Location,
+		&car.LicensePlate, &car.Make, &car.Model, &car.Status, &car.CostPerKm, &car.Category, &car.Location,
+		&car.Latitude, &car.Longitude,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			span.RecordError(err)
@@ -357,22 +404,30 @@ func (db *CarDB) InsertCar(ctx context.Context, car models.Car) error {
 
 	query := `
 		INSERT INTO
-		Cars (license_plate, make, model, status, cost_per_km, location)
-		VALUES (?, ?, ?, ?, ?, ?)
+		Cars (license_plate, make, model, status, cost_per_km, category, location, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ST_PointFromText(?, 4326))
 	`
+	if car.Category == "" {
+		car.Category = models.Standard
+	}
+
 	span.SetAttributes(
 		attribute.String("car.license_plate", car.LicensePlate),
 		attribute.String("car.make", car.Make),
 		attribute.String("car.model", car.Model),
 		attribute.String("car.status", string(car.Status)),
-		attribute.Float64("car.cost_per_km", *car.CostPerKm),
+		attribute.String("car.category", string(car.Category)),
 		attribute.String("car.location", car.Location),
 	)
+	if car.CostPerKm != nil {
+		span.SetAttributes(attribute.String("car.cost_per_km", car.CostPerKm.String()))
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := db.DB.ExecContext(ctx, query, strings.ToUpper(car.LicensePlate), car.Make, car.Model, car.Status, car.CostPerKm, strings.ToUpper(car.Location))
+	_, err := db.DB.ExecContext(ctx, query, strings.ToUpper(car.LicensePlate), car.Make, car.Model, car.Status, car.CostPerKm, car.Category, strings.ToUpper(car.Location),
+		optionalPointWKT(car.Latitude, car.Longitude))
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
 			span.RecordError(err)
@@ -385,20 +440,24 @@ func (db *CarDB) InsertCar(ctx context.Context, car models.Car) error {
 	return nil
 }
 
-func (db *CarDB) UpdateCarStatus(ctx context.Context, tx *sql.Tx, licensePlate, status string) error {
+// ChangeCarStatus moves the car from one status to another. It fails with
+// ErrCarStatusChanged when the car is no longer in from, so that two
+// transactions cannot both take the car.
+func (db *CarDB) ChangeCarStatus(ctx context.Context, tx Tx, licensePlate string, from, to models.Status) error {
 	tracer := otel.Tracer("database")
-	ctx, span := tracer.Start(ctx, "UpdateCarStatusQuery")
+	ctx, span := tracer.Start(ctx, "ChangeCarStatusQuery")
 	defer span.End()
 
 	query := `
 		UPDATE Cars
 		SET status = ?
-		WHERE license_plate = ?
+		WHERE license_plate = ? AND status = ?
 	`
 
 	span.SetAttributes(
 		attribute.String("car.license_plate", licensePlate),
-		attribute.String("car.status", status),
+		attribute.String("car.status.from", string(from)),
+		attribute.String("car.status", string(to)),
 	)
 
 	span.SetAttributes(attribute.String("db.statement", query))
@@ -406,22 +465,77 @@ func (db *CarDB) UpdateCarStatus(ctx context.Context, tx *sql.Tx, licensePlate,
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if tx != nil {
-		_, err := tx.ExecContext(ctx, query, status, strings.ToUpper(licensePlate))
-		if err != nil {
-			span.RecordError(err)
-			return err
-		}
-		span.AddEvent("Car status updated in transaction")
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, to, strings.ToUpper(licensePlate), from)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, to, strings.ToUpper(licensePlate), from)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if affected > 0 {
+		span.AddEvent("Changed car status successfully")
 		return nil
 	}
 
-	_, err := db.DB.ExecContext(ctx, query, status, strings.ToUpper(licensePlate))
+	existsQuery := `SELECT EXISTS (SELECT 1 FROM Cars WHERE license_plate = ?)`
+	var exists bool
+	if tx := sqlTx(tx); tx != nil {
+		err = tx.QueryRowContext(ctx, existsQuery, strings.ToUpper(licensePlate)).Scan(&exists)
+	} else {
+		err = db.DB.QueryRowContext(ctx, existsQuery, strings.ToUpper(licensePlate)).Scan(&exists)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if !exists {
+		return ErrCarNotFound
+	}
+	return ErrCarStatusChanged
+}
+
+// MoveCar records where the car was parked.
+func (db *CarDB) MoveCar(ctx context.Context, tx Tx, licensePlate string, latitude, longitude float64) error {
+	tracer := otel.Tracer("database")
+	ctx, span := tracer.Start(ctx, "MoveCarQuery")
+	defer span.End()
+
+	query := `
+		UPDATE Cars
+		SET position = ST_PointFromText(?, 4326)
+		WHERE license_plate = ?
+	`
+
+	span.SetAttributes(
+		attribute.String("car.license_plate", licensePlate),
+		attribute.Float64("car.latitude", latitude),
+		attribute.Float64("car.longitude", longitude),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{pointWKT(latitude, longitude), strings.ToUpper(licensePlate)}
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		_, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		_, err = db.DB.ExecContext(ctx, query, args...)
+	}
 	if err != nil {
 		span.RecordError(err)
 		return err
 	}
-	span.AddEvent("Updated car status successfully")
 	return nil
 }
 
@@ -438,7 +552,9 @@ func (db *CarDB) UpdateCar(ctx context.Context, car models.Car) (models.Car, err
 
 	query := `
 		UPDATE Cars
-		SET make = ?, model = ?, status = ?, cost_per_km = ?, location = ?
+		SET make = ?, model = ?, status = ?, cost_per_km = ?,
+			category = COALESCE(NULLIF(?, ''), category), location = ?,
+			position = COALESCE(ST_PointFromText(?, 4326), position)
 		WHERE license_plate = ?
 	`
 
@@ -468,7 +584,9 @@ func (db *CarDB) UpdateCar(ctx context.Context, car models.Car) (models.Car, err
 		car.Model,
 		car.Status,
 		car.CostPerKm,
+		car.Category,
 		strings.ToUpper(car.Location),
+		optionalPointWKT(car.Latitude, car.Longitude),
 		strings.ToUpper(car.LicensePlate),
 	)
 	if err != nil {
@@ -483,7 +601,10 @@ func (db *CarDB) UpdateCar(ctx context.Context, car models.Car) (models.Car, err
 		Model:        car.Model,
 		Status:       car.Status,
 		CostPerKm:    car.CostPerKm,
+		Category:     car.Category,
 		Location:     car.Location,
+		Latitude:     car.Latitude,
+		Longitude:    car.Longitude,
 	}, err
 }
 
@@ -494,7 +615,7 @@ func (db *CarDB) DeleteCar(ctx context.Context, licensePlate string) (models.Car
 
 	var car models.Car
 	query := `
-		SELECT license_plate, make, model, cost_per_km, location
+		SELECT license_plate, make, model, cost_per_km, category, location
 		FROM Cars
 		WHERE license_plate = ?
 	`
@@ -502,7 +623,7 @@ func (db *CarDB) DeleteCar(ctx context.Context, licensePlate string) (models.Car
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := db.DB.QueryRowContext(ctx, query, strings.ToUpper(licensePlate)).Scan(&car.LicensePlate, &car.Make, &car.Model, &car.CostPerKm, &car.Location)
+	err := db.DB.QueryRowContext(ctx, query, strings.ToUpper(licensePlate)).Scan(&car.LicensePlate, &car.Make, &car.Model, &car.CostPerKm, &car.Category, &car.Location)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			span.RecordError(err)
@@ -516,7 +637,7 @@ func (db *CarDB) DeleteCar(ctx context.Context, licensePlate string) (models.Car
 		DELETE FROM Cars
 		WHERE license_plate = ?
 	`
-	_, err = db.DB.Exec(deleteQuery, strings.ToUpper(licensePlate))
+	_, err = db.DB.ExecContext(ctx, deleteQuery, strings.ToUpper(licensePlate))
 	if err != nil {
 		span.RecordError(err)
 		return models.Car{}, err
@@ -526,23 +647,8 @@ func (db *CarDB) DeleteCar(ctx context.Context, licensePlate string) (models.Car
 	return car, nil
 }
 
-func (db *CarDB) InvalidateCars(page, pageSize int) error {
-	cacheKeys := []string{
-		fmt.Sprintf("cars:page=%d:size=%d", page, pageSize),
-		fmt.Sprintf("availCars:page=%d:size=%d", page, pageSize),
-	}
-
-	for _, cacheKey := range cacheKeys {
-		err := db.Cache.Delete(cacheKey)
-		if err != nil {
-			if err == memcache.ErrCacheMiss {
-				fmt.Printf("Cache key %s not found\n", cacheKey)
-			} else {
-				return fmt.Errorf("failed to delete cache key %s: %v", cacheKey, err)
-			}
-		} else {
-			fmt.Printf("Cache invalidated for key: %s\n", cacheKey)
-		}
-	}
-	return nil
+// InvalidateCars drops every cached listing of the cars, however it was
+// paginated.
+func (db *CarDB) InvalidateCars() error {
+	return db.listings.Invalidate()
 }
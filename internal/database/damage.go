@@ -18,7 +18,7 @@ func NewDamageDB(db *sql.DB) *DamageDB {
 }
 
 // GetDamagesByLicensePlate retrieves all damages for a specific car
-func (db *DamageDB) GetDamages(licensePlate string, page, pageSize int) ([]models.Damage, int, error) {
+func (db *DamageDB) GetDamages(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Damage, int, error) {
 	offset := (page - 1) * pageSize
 
 	query := `
@@ -29,7 +29,7 @@ func (db *DamageDB) GetDamages(licensePlate string, page, pageSize int) ([]model
 		LIMIT ? OFFSET ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := db.DB.QueryContext(ctx, query, licensePlate, pageSize, offset)
@@ -63,7 +63,7 @@ func (db *DamageDB) GetDamages(licensePlate string, page, pageSize int) ([]model
 }
 
 // AddDamage adds a new damage entry to the database
-func (db *DamageDB) AddDamage(damage models.Damage) error {
+func (db *DamageDB) AddDamage(ctx context.Context, damage models.Damage) error {
 	query := `
 		INSERT INTO Damages
 		(car_license_plate, description, reported_date, repair_cost, repaired)
@@ -75,7 +75,7 @@ func (db *DamageDB) AddDamage(damage models.Damage) error {
 		repairedValue = 1
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query,
@@ -89,7 +89,7 @@ func (db *DamageDB) AddDamage(damage models.Damage) error {
 }
 
 // AddDamage adds a new damage entry to the database
-func (db *DamageDB) EditDamageState(license_plate string, repaired bool) error {
+func (db *DamageDB) EditDamageState(ctx context.Context, license_plate string, repaired bool) error {
 	query := `
 		UPDATE Damages
 		SET repaired = ?
@@ -103,7 +103,7 @@ func (db *DamageDB) EditDamageState(license_plate string, repaired bool) error {
 		repairedValue = []byte{0}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query, repairedValue, license_plate)
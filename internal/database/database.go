@@ -3,44 +3,103 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/ntentasd/db-deliverable3/config"
-	"github.com/ntentasd/db-deliverable3/internal/memcached"
+	"github.com/ntentasd/db-deliverable3/internal/cache"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+// Database groups every repository the server depends on. InitDB wires the
+// MySQL implementations; the memory package provides an in-process one.
 type Database struct {
-	UserDB         *UserDB
-	CarDB          *CarDB
-	DamageDB       *DamageDB
-	ServiceDB      *ServiceDB
-	TripDB         *TripDB
-	SettingDB      *SettingDB
-	ReviewDB       *ReviewDB
-	PaymentDB      *PaymentDB
-	SubscriptionDB *SubscriptionDB
-}
+	Transactor
+	UserDB         UserRepository
+	RoleDB         RoleRepository
+	SessionDB      SessionRepository
+	UserTokenDB    UserTokenRepository
+	IdempotencyDB  IdempotencyRepository
+	CarDB          CarRepository
+	DamageDB       DamageRepository
+	ServiceDB      ServiceRepository
+	TripDB         TripRepository
+	TelemetryDB    TelemetryRepository
+	ReservationDB  ReservationRepository
+	SettingDB      SettingRepository
+	ReviewDB       ReviewRepository
+	PaymentDB      PaymentRepository
+	DisputeDB      DisputeRepository
+	SubscriptionDB SubscriptionRepository
 
-func InitDB(config config.DatabaseConfig, client *memcached.Client, ttl int32) (*sql.DB, *Database, error) {
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		config.User, config.Password, config.Host, config.Port, config.Name,
-	)
+	// Caches are the read-through caches in front of the repositories, for
+	// metrics. Stores without a cache have none.
+	Caches []cache.Reporter
+}
 
-	db, err := sql.Open("mysql", connectionString)
+// InitDB wires the MySQL repositories, with c in front of the hot reads,
+// which are cached as options say. The repositories log to logger.
+func InitDB(config config.DatabaseConfig, c cache.Cache, options cache.Options, logger *slog.Logger) (*sql.DB, *Database, error) {
+	db, err := Open(config)
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+		return nil, nil, err
 	}
 
+	carDB := NewCarDatabase(db, c, options)
+	reviewDB := NewReviewDB(db, c, options, logger)
+	subscriptionDB := NewSubscriptionDB(db, c, options, logger)
+
 	return db, &Database{
+		Transactor:     SQLTransactor{DB: db},
 		UserDB:         NewUserDatabase(db),
-		CarDB:          NewCarDatabase(db, client, ttl),
+		RoleDB:         NewRoleDB(db),
+		SessionDB:      NewSessionDB(db),
+		UserTokenDB:    NewUserTokenDB(db),
+		IdempotencyDB:  NewIdempotencyDB(db, c),
+		CarDB:          carDB,
 		DamageDB:       NewDamageDB(db),
 		ServiceDB:      NewServiceDB(db),
 		TripDB:         NewTripDatabase(db),
+		TelemetryDB:    NewTelemetryDB(db),
+		ReservationDB:  NewReservationDB(db),
 		SettingDB:      NewSettingDB(db),
-		ReviewDB:       NewReviewDB(db),
+		ReviewDB:       reviewDB,
 		PaymentDB:      NewPaymentDB(db),
-		SubscriptionDB: NewSubscriptionDB(db),
+		DisputeDB:      NewDisputeDB(db),
+		SubscriptionDB: subscriptionDB,
+
+		Caches: []cache.Reporter{carDB.listings, reviewDB.pages, subscriptionDB.plans},
 	}, nil
 }
+
+// Open opens a connection pool without building the repositories, for tools
+// that only need a few of them. Statements and transactions are traced as
+// children of the span in the context they run with, so queries must be made
+// with the *Context methods to join the trace of their request.
+func Open(config config.DatabaseConfig) (*sql.DB, error) {
+	return otelsql.Open("mysql", connectionString(config, false),
+		otelsql.WithAttributes(semconv.DBSystemMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// OpenMigrationDB opens a separate pool for the migration runner. Migration
+// files hold several statements each, which the regular pool does not allow.
+func OpenMigrationDB(config config.DatabaseConfig) (*sql.DB, error) {
+	return sql.Open("mysql", connectionString(config, true))
+}
+
+func connectionString(config config.DatabaseConfig, multiStatements bool) string {
+	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		config.User, config.Password, config.Host, config.Port, config.Name,
+	)
+	if multiStatements {
+		connectionString += "&multiStatements=true"
+	}
+	return connectionString
+}
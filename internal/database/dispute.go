@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type DisputeDB struct {
+	DB *sql.DB
+}
+
+var (
+	ErrDisputeNotFound = fmt.Errorf("dispute not found")
+	ErrDisputeExists   = fmt.Errorf("the charge of this trip has already been disputed")
+	ErrDisputeNotOpen  = fmt.Errorf("dispute has already been resolved")
+)
+
+func NewDisputeDB(db *sql.DB) *DisputeDB {
+	return &DisputeDB{DB: db}
+}
+
+const disputeColumns = `id, trip_id, user_email, reason, status, COALESCE(resolution, ''), COALESCE(resolved_by, ''), created_at, resolved_at`
+
+func scanDispute(row interface{ Scan(...any) error }, extra ...any) (models.Dispute, error) {
+	var dispute models.Dispute
+	err := row.Scan(append([]any{
+		&dispute.ID,
+		&dispute.TripID,
+		&dispute.UserEmail,
+		&dispute.Reason,
+		&dispute.Status,
+		&dispute.Resolution,
+		&dispute.ResolvedBy,
+		&dispute.CreatedAt,
+		&dispute.ResolvedAt,
+	}, extra...)...)
+	return dispute, err
+}
+
+// CreateDispute opens a dispute on the payment of a trip, recording the
+// opening in its history. A trip has one open dispute at most, and is only
+// disputed again when its payment was partially refunded.
+func (db *DisputeDB) CreateDispute(ctx context.Context, dispute models.Dispute) (models.Dispute, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the payment keeps concurrent disputes of the trip apart.
+	var paymentStatus models.PaymentStatus
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM Payments WHERE trip_id = ? FOR UPDATE
+	`, dispute.TripID).Scan(&paymentStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Dispute{}, ErrPaymentNotFound
+		}
+		return models.Dispute{}, err
+	}
+
+	var disputed bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM Disputes
+			WHERE trip_id = ? AND (status = 'OPEN' OR ? <> 'PARTIALLY_REFUNDED')
+		)
+	`, dispute.TripID, paymentStatus).Scan(&disputed)
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	if disputed {
+		return models.Dispute{}, ErrDisputeExists
+	}
+
+	dispute.Status = models.DisputeOpen
+	dispute.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO Disputes (trip_id, user_email, reason, status, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, dispute.TripID, dispute.UserEmail, dispute.Reason, dispute.Status, dispute.CreatedAt)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+			switch mysqlErr.Number {
+			case 1062:
+				return models.Dispute{}, ErrDisputeExists
+			case 1452:
+				// Disputes.trip_id references Payments.trip_id
+				return models.Dispute{}, ErrPaymentNotFound
+			}
+		}
+		return models.Dispute{}, err
+	}
+
+	dispute.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.Dispute{}, err
+	}
+
+	event := models.DisputeEvent{Status: dispute.Status, Actor: dispute.UserEmail, Note: dispute.Reason, CreatedAt: dispute.CreatedAt}
+	if err := insertDisputeEvent(ctx, tx, dispute.ID, event); err != nil {
+		return models.Dispute{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Dispute{}, err
+	}
+
+	dispute.History = []models.DisputeEvent{event}
+	return dispute, nil
+}
+
+func insertDisputeEvent(ctx context.Context, tx *sql.Tx, disputeID int64, event models.DisputeEvent) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO DisputeEvents (dispute_id, status, actor, note, created_at)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?)
+	`, disputeID, event.Status, event.Actor, event.Note, event.CreatedAt)
+	return err
+}
+
+// GetDispute returns a dispute with its history.
+func (db *DisputeDB) GetDispute(ctx context.Context, id int64) (models.Dispute, error) {
+	return db.getDispute(ctx, `WHERE id = ?`, id)
+}
+
+// GetDisputeForTrip returns the latest dispute of a trip with its history.
+func (db *DisputeDB) GetDisputeForTrip(ctx context.Context, tripID int64) (models.Dispute, error) {
+	return db.getDispute(ctx, `WHERE trip_id = ? ORDER BY id DESC LIMIT 1`, tripID)
+}
+
+func (db *DisputeDB) getDispute(ctx context.Context, where string, arg any) (models.Dispute, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	dispute, err := scanDispute(db.DB.QueryRowContext(ctx, `
+		SELECT `+disputeColumns+`
+		FROM Disputes
+		`+where, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Dispute{}, ErrDisputeNotFound
+		}
+		return models.Dispute{}, err
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT status, actor, COALESCE(note, ''), created_at
+		FROM DisputeEvents
+		WHERE dispute_id = ?
+		ORDER BY id
+	`, dispute.ID)
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.DisputeEvent
+		if err := rows.Scan(&event.Status, &event.Actor, &event.Note, &event.CreatedAt); err != nil {
+			return models.Dispute{}, err
+		}
+		dispute.History = append(dispute.History, event)
+	}
+
+	return dispute, rows.Err()
+}
+
+// GetDisputes returns a page of the disputes in status, oldest first, so that
+// the open ones form a queue. An empty status returns every dispute.
+func (db *DisputeDB) GetDisputes(ctx context.Context, status models.DisputeStatus, page, pageSize int) ([]models.Dispute, int, error) {
+	offset := (page - 1) * pageSize
+
+	query := `
+		SELECT ` + disputeColumns + `,
+		COUNT(*) OVER() as total_disputes
+		FROM Disputes
+		WHERE ? = '' OR status = ?
+		ORDER BY created_at, id
+		LIMIT ? OFFSET ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, status, status, pageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var disputes []models.Dispute
+	var totalDisputes int
+	for rows.Next() {
+		dispute, err := scanDispute(rows, &totalDisputes)
+		if err != nil {
+			return nil, 0, err
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	return disputes, totalDisputes, rows.Err()
+}
+
+// ResolveDispute moves an open dispute to status, recording the resolution
+// in its history. Within tx, the dispute stays locked until tx ends, so a
+// dispute is only resolved once.
+func (db *DisputeDB) ResolveDispute(ctx context.Context, tx Tx, id int64, status models.DisputeStatus, resolvedBy, resolution string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	sqlTx := sqlTx(tx)
+	if sqlTx == nil {
+		var err error
+		sqlTx, err = db.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer sqlTx.Rollback()
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	result, err := sqlTx.ExecContext(ctx, `
+		UPDATE Disputes
+		SET status = ?, resolution = NULLIF(?, ''), resolved_by = ?, resolved_at = ?
+		WHERE id = ? AND status = 'OPEN'
+	`, status, resolution, resolvedBy, now, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var exists bool
+		err := sqlTx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM Disputes WHERE id = ?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrDisputeNotFound
+		}
+		return ErrDisputeNotOpen
+	}
+
+	event := models.DisputeEvent{Status: status, Actor: resolvedBy, Note: resolution, CreatedAt: now}
+	if err := insertDisputeEvent(ctx, sqlTx, id, event); err != nil {
+		return err
+	}
+
+	if tx == nil {
+		return sqlTx.Commit()
+	}
+	return nil
+}
+
+// ReopenDispute moves an approved dispute back to OPEN, when the refund it
+// was approved with could not be made, recording why in its history.
+func (db *DisputeDB) ReopenDispute(ctx context.Context, id int64, actor, note string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE Disputes
+		SET status = 'OPEN', resolution = NULL, resolved_by = NULL, resolved_at = NULL
+		WHERE id = ? AND status = 'APPROVED'
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDisputeNotFound
+	}
+
+	event := models.DisputeEvent{Status: models.DisputeOpen, Actor: actor, Note: note, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := insertDisputeEvent(ctx, tx, id, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
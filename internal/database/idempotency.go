@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/cache"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+// IdempotencyDB keeps idempotent requests in MySQL. When Cache is set,
+// completed requests are also kept in the cache, so that retries are
+// answered without a query.
+type IdempotencyDB struct {
+	DB    *sql.DB
+	Cache cache.Cache
+}
+
+var (
+	ErrIdempotencyKeyExists   = fmt.Errorf("idempotency key was already used")
+	ErrIdempotencyKeyNotFound = fmt.Errorf("idempotency key not found")
+)
+
+func NewIdempotencyDB(db *sql.DB, c cache.Cache) *IdempotencyDB {
+	return &IdempotencyDB{DB: db, Cache: c}
+}
+
+// idempotencyCacheKey hashes the user and key, which may hold characters
+// memcached does not allow in keys.
+func idempotencyCacheKey(email, key string) string {
+	sum := sha256.Sum256([]byte(email + "\n" + key))
+	return "idempotency:" + hex.EncodeToString(sum[:])
+}
+
+// ReserveIdempotencyKey records request as being handled. When its user
+// already used the key and it has not expired yet, the stored request is
+// returned with ErrIdempotencyKeyExists instead.
+func (db *IdempotencyDB) ReserveIdempotencyKey(ctx context.Context, request models.IdempotentRequest) (models.IdempotentRequest, error) {
+	if db.Cache != nil {
+		if cached, err := db.Cache.Get(idempotencyCacheKey(request.UserEmail, request.Key)); err == nil {
+			var stored models.IdempotentRequest
+			if err := json.Unmarshal(cached, &stored); err == nil && stored.ExpiresAt.After(time.Now()) {
+				return stored, ErrIdempotencyKeyExists
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// An expired key can be used again.
+	_, err := db.DB.ExecContext(ctx, `
+		DELETE FROM IdempotencyKeys
+		WHERE user_email = ? AND idempotency_key = ? AND expires_at <= ?
+	`, request.UserEmail, request.Key, time.Now().UTC())
+	if err != nil {
+		return models.IdempotentRequest{}, err
+	}
+
+	_, err = db.DB.ExecContext(ctx, `
+		INSERT INTO
+		IdempotencyKeys (user_email, idempotency_key, method, path, fingerprint, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, request.UserEmail, request.Key, request.Method, request.Path, request.Fingerprint,
+		request.CreatedAt.UTC(), request.ExpiresAt.UTC())
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+			switch mysqlErr.Number {
+			case 1062:
+				stored, err := db.getIdempotentRequest(ctx, request.UserEmail, request.Key)
+				if err != nil {
+					return models.IdempotentRequest{}, err
+				}
+				return stored, ErrIdempotencyKeyExists
+			case 1452:
+				// IdempotencyKeys.user_email references Users.email
+				return models.IdempotentRequest{}, ErrUserNotFound
+			}
+		}
+		return models.IdempotentRequest{}, err
+	}
+
+	return request, nil
+}
+
+func (db *IdempotencyDB) getIdempotentRequest(ctx context.Context, email, key string) (models.IdempotentRequest, error) {
+	var request models.IdempotentRequest
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT user_email, idempotency_key, method, path, fingerprint, created_at,
+			expires_at, completed_at, response_status, content_type, response_body
+		FROM IdempotencyKeys
+		WHERE user_email = ? AND idempotency_key = ?
+	`, email, key).Scan(
+		&request.UserEmail,
+		&request.Key,
+		&request.Method,
+		&request.Path,
+		&request.Fingerprint,
+		&request.CreatedAt,
+		&request.ExpiresAt,
+		&request.CompletedAt,
+		&status,
+		&contentType,
+		&request.ResponseBody,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.IdempotentRequest{}, ErrIdempotencyKeyNotFound
+		}
+		return models.IdempotentRequest{}, err
+	}
+
+	request.ResponseStatus = int(status.Int64)
+	request.ContentType = contentType.String
+
+	return request, nil
+}
+
+// CompleteIdempotencyKey stores the response of a reserved request, which
+// retries are answered with until the key expires.
+func (db *IdempotencyDB) CompleteIdempotencyKey(ctx context.Context, request models.IdempotentRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE IdempotencyKeys
+		SET completed_at = ?, response_status = ?, content_type = ?, response_body = ?
+		WHERE user_email = ? AND idempotency_key = ? AND completed_at IS NULL
+	`, request.CompletedAt.UTC(), request.ResponseStatus, request.ContentType, request.ResponseBody,
+		request.UserEmail, request.Key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	if db.Cache != nil {
+		if ttl := time.Until(request.ExpiresAt); ttl >= time.Second {
+			if encoded, err := json.Marshal(request); err == nil {
+				db.Cache.Set(idempotencyCacheKey(request.UserEmail, request.Key), encoded, ttl)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a request that is still being handled, so
+// that it can be retried with the same key.
+func (db *IdempotencyDB) ReleaseIdempotencyKey(ctx context.Context, email, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `
+		DELETE FROM IdempotencyKeys
+		WHERE user_email = ? AND idempotency_key = ? AND completed_at IS NULL
+	`, email, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys deletes the keys that expired before cutoff
+// and returns how many there were.
+func (db *IdempotencyDB) DeleteExpiredIdempotencyKeys(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		DELETE FROM IdempotencyKeys
+		WHERE expires_at <= ?
+	`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,353 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/telemetry"
+)
+
+type CarDB struct {
+	store *Store
+}
+
+func (db *CarDB) GetAllCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) GetAllAvailableCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Status: models.Available, Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) GetAllRentedCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Status: models.Rented, Page: page, PageSize: pageSize})
+}
+
+func (db *CarDB) GetAllMaintenanceCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error) {
+	return db.SearchCars(ctx, models.CarSearch{Status: models.Maintenance, Page: page, PageSize: pageSize})
+}
+
+// SearchCars sorts like MySQL: case-insensitively, with cars without a cost
+// per km first, and ties broken by license plate. Like the COUNT(*) OVER()
+// query, the total is zero when the requested page is empty.
+func (db *CarDB) SearchCars(ctx context.Context, search models.CarSearch) ([]models.Car, int, error) {
+	if search.Sort == "" {
+		search.Sort = models.SortByLicensePlate
+	}
+	if !search.Sort.Valid() {
+		return nil, 0, database.ErrInvalidCarSort
+	}
+
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.Car
+	for _, car := range db.store.cars {
+		if matchesSearch(car, search) {
+			matching = append(matching, car)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if c := compareCars(matching[i], matching[j], search.Sort); c != 0 {
+			return (c < 0) != search.Descending
+		}
+		return matching[i].LicensePlate < matching[j].LicensePlate
+	})
+
+	start, end := paginate(len(matching), search.Page, search.PageSize)
+	if start == end {
+		return nil, 0, nil
+	}
+
+	return matching[start:end], len(matching), nil
+}
+
+func matchesSearch(car models.Car, search models.CarSearch) bool {
+	if search.Status != "" && car.Status != search.Status {
+		return false
+	}
+	if search.Category != "" && car.Category != search.Category {
+		return false
+	}
+	if search.Make != "" && !strings.EqualFold(car.Make, search.Make) {
+		return false
+	}
+	if search.Model != "" && !strings.EqualFold(car.Model, search.Model) {
+		return false
+	}
+	if search.Location != "" && !strings.EqualFold(car.Location, search.Location) {
+		return false
+	}
+	if search.MinCostPerKm != nil && (car.CostPerKm == nil || *car.CostPerKm < *search.MinCostPerKm) {
+		return false
+	}
+	if search.MaxCostPerKm != nil && (car.CostPerKm == nil || *car.CostPerKm > *search.MaxCostPerKm) {
+		return false
+	}
+
+	words := models.CarSearch{Text: car.Make + " " + car.Model + " " + car.Location}.Terms()
+	for _, term := range search.Terms() {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(strings.ToUpper(word), strings.ToUpper(term)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// statusOrder and categoryOrder are the orders of the ENUM columns, which
+// MySQL sorts by.
+var (
+	statusOrder   = map[models.Status]int{models.Available: 0, models.Rented: 1, models.Maintenance: 2}
+	categoryOrder = map[models.Category]int{models.Economy: 0, models.Standard: 1, models.Premium: 2, models.Van: 3}
+)
+
+func compareCars(a, b models.Car, field models.CarSortField) int {
+	switch field {
+	case models.SortByMake:
+		return strings.Compare(strings.ToUpper(a.Make), strings.ToUpper(b.Make))
+	case models.SortByModel:
+		return strings.Compare(strings.ToUpper(a.Model), strings.ToUpper(b.Model))
+	case models.SortByStatus:
+		return cmp.Compare(statusOrder[a.Status], statusOrder[b.Status])
+	case models.SortByCategory:
+		return cmp.Compare(categoryOrder[a.Category], categoryOrder[b.Category])
+	case models.SortByLocation:
+		return strings.Compare(a.Location, b.Location)
+	case models.SortByCostPerKm:
+		switch {
+		case a.CostPerKm == nil && b.CostPerKm == nil:
+			return 0
+		case a.CostPerKm == nil:
+			return -1
+		case b.CostPerKm == nil:
+			return 1
+		}
+		return cmp.Compare(*a.CostPerKm, *b.CostPerKm)
+	}
+	return strings.Compare(a.LicensePlate, b.LicensePlate)
+}
+
+func (db *CarDB) CountCarsByStatus(ctx context.Context) (map[models.Status]int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	counts := make(map[models.Status]int)
+	for _, car := range db.store.cars {
+		counts[car.Status]++
+	}
+	return counts, nil
+}
+
+func (db *CarDB) GetCarByLicensePlate(ctx context.Context, licensePlate string) (models.Car, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	car, ok := db.store.cars[plateKey(licensePlate)]
+	if !ok {
+		return models.Car{}, database.ErrCarNotFound
+	}
+	return car, nil
+}
+
+func (db *CarDB) InsertCar(ctx context.Context, car models.Car) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(car.LicensePlate)
+	if _, ok := db.store.cars[key]; ok {
+		return database.ErrDuplicateLicensePlate
+	}
+
+	car.LicensePlate = key
+	car.Location = strings.ToUpper(car.Location)
+	if car.Category == "" {
+		car.Category = models.Standard
+	}
+	db.store.cars[key] = car
+	return nil
+}
+
+func (db *CarDB) ChangeCarStatus(ctx context.Context, tx database.Tx, licensePlate string, from, to models.Status) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(licensePlate)
+	car, ok := db.store.cars[key]
+	if !ok {
+		return database.ErrCarNotFound
+	}
+	if car.Status != from {
+		return database.ErrCarStatusChanged
+	}
+
+	car.Status = to
+	db.store.cars[key] = car
+
+	db.store.track(tx, func() {
+		car := db.store.cars[key]
+		car.Status = from
+		db.store.cars[key] = car
+	})
+
+	return nil
+}
+
+func (db *CarDB) MoveCar(ctx context.Context, tx database.Tx, licensePlate string, latitude, longitude float64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(licensePlate)
+	car, ok := db.store.cars[key]
+	if !ok {
+		return nil
+	}
+
+	previousLatitude, previousLongitude := car.Latitude, car.Longitude
+	car.Latitude, car.Longitude = &latitude, &longitude
+	db.store.cars[key] = car
+
+	db.store.track(tx, func() {
+		car := db.store.cars[key]
+		car.Latitude, car.Longitude = previousLatitude, previousLongitude
+		db.store.cars[key] = car
+	})
+
+	return nil
+}
+
+// GetAvailableCarsNear measures distances with the haversine formula, where
+// MySQL uses ST_Distance_Sphere; the two agree to a few metres.
+func (db *CarDB) GetAvailableCarsNear(ctx context.Context, latitude, longitude, radius float64, limit int) ([]models.NearbyCar, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var cars []models.NearbyCar
+	for _, car := range db.store.cars {
+		if car.Status != models.Available || car.Latitude == nil || car.Longitude == nil {
+			continue
+		}
+		distance := telemetry.Haversine(latitude, longitude, *car.Latitude, *car.Longitude)
+		if distance <= radius {
+			cars = append(cars, models.NearbyCar{Car: car, Distance: distance})
+		}
+	}
+	sort.Slice(cars, func(i, j int) bool {
+		if cars[i].Distance != cars[j].Distance {
+			return cars[i].Distance < cars[j].Distance
+		}
+		return cars[i].LicensePlate < cars[j].LicensePlate
+	})
+
+	if len(cars) > limit {
+		cars = cars[:limit]
+	}
+	return cars, nil
+}
+
+func (db *CarDB) UpdateCar(ctx context.Context, car models.Car) (models.Car, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(car.LicensePlate)
+	stored, ok := db.store.cars[key]
+	if !ok {
+		return models.Car{}, sql.ErrNoRows
+	}
+
+	if stored.Status == models.Rented || car.Status == models.Rented {
+		return models.Car{}, database.ErrInvalidStatusChange
+	}
+
+	stored.Make = car.Make
+	stored.Model = car.Model
+	stored.Status = car.Status
+	stored.CostPerKm = car.CostPerKm
+	if car.Category != "" {
+		stored.Category = car.Category
+	}
+	stored.Location = strings.ToUpper(car.Location)
+	if car.Latitude != nil && car.Longitude != nil {
+		stored.Latitude, stored.Longitude = car.Latitude, car.Longitude
+	}
+	db.store.cars[key] = stored
+
+	return models.Car{
+		LicensePlate: car.LicensePlate,
+		Make:         car.Make,
+		Model:        car.Model,
+		Status:       car.Status,
+		CostPerKm:    car.CostPerKm,
+		Category:     car.Category,
+		Location:     car.Location,
+		Latitude:     car.Latitude,
+		Longitude:    car.Longitude,
+	}, nil
+}
+
+func (db *CarDB) DeleteCar(ctx context.Context, licensePlate string) (models.Car, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(licensePlate)
+	car, ok := db.store.cars[key]
+	if !ok {
+		return models.Car{}, database.ErrCarNotFound
+	}
+
+	// Trips, Damages and Services reference Cars without ON DELETE CASCADE.
+	if db.store.carReferenced(key) {
+		return models.Car{}, ErrCarReferenced
+	}
+
+	delete(db.store.cars, key)
+	db.store.deleteReservations(func(reservation *models.Reservation) bool {
+		return plateKey(reservation.CarLicensePlate) == key
+	})
+
+	return models.Car{
+		LicensePlate: car.LicensePlate,
+		Make:         car.Make,
+		Model:        car.Model,
+		CostPerKm:    car.CostPerKm,
+		Category:     car.Category,
+		Location:     car.Location,
+		Latitude:     car.Latitude,
+		Longitude:    car.Longitude,
+	}, nil
+}
+
+// InvalidateCars is a no-op, the store has no cache in front of it.
+func (db *CarDB) InvalidateCars() error {
+	return nil
+}
+
+func (s *Store) carReferenced(key string) bool {
+	for _, trip := range s.trips {
+		if plateKey(trip.CarLicensePlate) == key {
+			return true
+		}
+	}
+	for _, damage := range s.damages {
+		if plateKey(damage.CarLicensePlate) == key {
+			return true
+		}
+	}
+	for _, service := range s.services {
+		if plateKey(service.CarLicensePlate) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type DamageDB struct {
+	store *Store
+}
+
+func (db *DamageDB) GetDamages(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Damage, int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.Damage
+	for _, damage := range db.store.damages {
+		if plateKey(damage.CarLicensePlate) == plateKey(licensePlate) {
+			matching = append(matching, damage)
+		}
+	}
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, 0, nil
+	}
+
+	damages := make([]models.Damage, 0, end-start)
+	for _, damage := range matching[start:end] {
+		// The MySQL query does not select the license plate.
+		damage.CarLicensePlate = ""
+		damages = append(damages, damage)
+	}
+
+	return damages, len(matching), nil
+}
+
+// AddDamage numbers damages per car, like the Damages_BEFORE_INSERT trigger.
+func (db *DamageDB) AddDamage(ctx context.Context, damage models.Damage) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(damage.CarLicensePlate)
+	if _, ok := db.store.cars[key]; !ok {
+		return database.ErrCarNotFound
+	}
+
+	reportedDate, err := scanDate(damage.ReportedDate)
+	if err != nil {
+		return err
+	}
+
+	var nextID int64 = 1
+	for _, existing := range db.store.damages {
+		if plateKey(existing.CarLicensePlate) == key && existing.ID >= nextID {
+			nextID = existing.ID + 1
+		}
+	}
+
+	damage.ID = nextID
+	damage.CarLicensePlate = key
+	damage.ReportedDate = reportedDate
+	db.store.damages = append(db.store.damages, damage)
+	return nil
+}
+
+func (db *DamageDB) EditDamageState(ctx context.Context, license_plate string, repaired bool) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.damages {
+		if plateKey(db.store.damages[i].CarLicensePlate) == plateKey(license_plate) {
+			db.store.damages[i].Repaired = repaired
+		}
+	}
+	return nil
+}
+
+// scanDate stores a DATE the way database/sql hands it back when a DATE
+// column is scanned into a string with parseTime enabled.
+func scanDate(value string) (string, error) {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "", err
+	}
+	return date.Format(time.RFC3339Nano), nil
+}
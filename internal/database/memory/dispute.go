@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type DisputeDB struct {
+	store *Store
+}
+
+// copyDispute keeps callers from sharing the history slice of the store.
+func copyDispute(dispute *models.Dispute) models.Dispute {
+	c := *dispute
+	c.History = append([]models.DisputeEvent(nil), dispute.History...)
+	return c
+}
+
+func (db *DisputeDB) CreateDispute(ctx context.Context, dispute models.Dispute) (models.Dispute, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	payment, ok := db.store.payments[dispute.TripID]
+	if !ok {
+		return models.Dispute{}, database.ErrPaymentNotFound
+	}
+	for _, existing := range db.store.disputes {
+		if existing.TripID == dispute.TripID &&
+			(existing.Status == models.DisputeOpen || payment.Status != models.PaymentPartiallyRefunded) {
+			return models.Dispute{}, database.ErrDisputeExists
+		}
+	}
+
+	dispute.ID = db.store.nextDisputeID
+	db.store.nextDisputeID++
+	dispute.Status = models.DisputeOpen
+	dispute.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	dispute.History = []models.DisputeEvent{{
+		Status:    dispute.Status,
+		Actor:     dispute.UserEmail,
+		Note:      dispute.Reason,
+		CreatedAt: dispute.CreatedAt,
+	}}
+
+	db.store.disputes = append(db.store.disputes, &dispute)
+	return copyDispute(&dispute), nil
+}
+
+func (db *DisputeDB) GetDispute(ctx context.Context, id int64) (models.Dispute, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, dispute := range db.store.disputes {
+		if dispute.ID == id {
+			return copyDispute(dispute), nil
+		}
+	}
+	return models.Dispute{}, database.ErrDisputeNotFound
+}
+
+func (db *DisputeDB) GetDisputeForTrip(ctx context.Context, tripID int64) (models.Dispute, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	// The latest dispute of the trip is the last one opened.
+	for i := len(db.store.disputes) - 1; i >= 0; i-- {
+		if dispute := db.store.disputes[i]; dispute.TripID == tripID {
+			return copyDispute(dispute), nil
+		}
+	}
+	return models.Dispute{}, database.ErrDisputeNotFound
+}
+
+func (db *DisputeDB) GetDisputes(ctx context.Context, status models.DisputeStatus, page, pageSize int) ([]models.Dispute, int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	// Disputes are kept in the order they were opened.
+	var matching []models.Dispute
+	for _, dispute := range db.store.disputes {
+		if status == "" || dispute.Status == status {
+			d := *dispute
+			d.History = nil
+			matching = append(matching, d)
+		}
+	}
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, 0, nil
+	}
+	return matching[start:end], len(matching), nil
+}
+
+func (db *DisputeDB) ResolveDispute(ctx context.Context, tx database.Tx, id int64, status models.DisputeStatus, resolvedBy, resolution string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var dispute *models.Dispute
+	for _, d := range db.store.disputes {
+		if d.ID == id {
+			dispute = d
+			break
+		}
+	}
+	if dispute == nil {
+		return database.ErrDisputeNotFound
+	}
+	if dispute.Status != models.DisputeOpen {
+		return database.ErrDisputeNotOpen
+	}
+
+	previous := copyDispute(dispute)
+	now := time.Now().UTC().Truncate(time.Second)
+	dispute.Status = status
+	dispute.Resolution = resolution
+	dispute.ResolvedBy = resolvedBy
+	dispute.ResolvedAt = &now
+	dispute.History = append(dispute.History, models.DisputeEvent{
+		Status:    status,
+		Actor:     resolvedBy,
+		Note:      resolution,
+		CreatedAt: now,
+	})
+
+	db.store.track(tx, func() {
+		*dispute = previous
+	})
+
+	return nil
+}
+
+func (db *DisputeDB) ReopenDispute(ctx context.Context, id int64, actor, note string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, dispute := range db.store.disputes {
+		if dispute.ID == id && dispute.Status == models.DisputeApproved {
+			dispute.Status = models.DisputeOpen
+			dispute.Resolution = ""
+			dispute.ResolvedBy = ""
+			dispute.ResolvedAt = nil
+			dispute.History = append(dispute.History, models.DisputeEvent{
+				Status:    models.DisputeOpen,
+				Actor:     actor,
+				Note:      note,
+				CreatedAt: time.Now().UTC().Truncate(time.Second),
+			})
+			return nil
+		}
+	}
+	return database.ErrDisputeNotFound
+}
+
+// deleteDisputes drops the disputes and refunds of a deleted trip, like the
+// ON DELETE CASCADE of their foreign keys.
+func (s *Store) deleteDisputes(tripID int64) {
+	disputes := s.disputes[:0]
+	for _, dispute := range s.disputes {
+		if dispute.TripID != tripID {
+			disputes = append(disputes, dispute)
+		}
+	}
+	s.disputes = disputes
+
+	refunds := s.refunds[:0]
+	for _, refund := range s.refunds {
+		if refund.TripID != tripID {
+			refunds = append(refunds, refund)
+		}
+	}
+	s.refunds = refunds
+}
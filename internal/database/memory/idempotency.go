@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type IdempotencyDB struct {
+	store *Store
+}
+
+func idempotencyKey(email, key string) string {
+	return emailKey(email) + "\n" + key
+}
+
+func (db *IdempotencyDB) ReserveIdempotencyKey(ctx context.Context, request models.IdempotentRequest) (models.IdempotentRequest, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.users[emailKey(request.UserEmail)]; !ok {
+		return models.IdempotentRequest{}, database.ErrUserNotFound
+	}
+
+	key := idempotencyKey(request.UserEmail, request.Key)
+	if stored, ok := db.store.idempotentRequests[key]; ok && stored.ExpiresAt.After(time.Now()) {
+		return copyIdempotentRequest(stored), database.ErrIdempotencyKeyExists
+	}
+
+	db.store.idempotentRequests[key] = copyIdempotentRequest(request)
+	return request, nil
+}
+
+func (db *IdempotencyDB) CompleteIdempotencyKey(ctx context.Context, request models.IdempotentRequest) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := idempotencyKey(request.UserEmail, request.Key)
+	stored, ok := db.store.idempotentRequests[key]
+	if !ok || stored.Completed() {
+		return database.ErrIdempotencyKeyNotFound
+	}
+
+	completedAt := *request.CompletedAt
+	stored.CompletedAt = &completedAt
+	stored.ResponseStatus = request.ResponseStatus
+	stored.ContentType = request.ContentType
+	stored.ResponseBody = append([]byte(nil), request.ResponseBody...)
+	db.store.idempotentRequests[key] = stored
+	return nil
+}
+
+func (db *IdempotencyDB) ReleaseIdempotencyKey(ctx context.Context, email, key string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if stored, ok := db.store.idempotentRequests[idempotencyKey(email, key)]; ok && !stored.Completed() {
+		delete(db.store.idempotentRequests, idempotencyKey(email, key))
+	}
+	return nil
+}
+
+func (db *IdempotencyDB) DeleteExpiredIdempotencyKeys(ctx context.Context, cutoff time.Time) (int64, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var deleted int64
+	for key, stored := range db.store.idempotentRequests {
+		if !stored.ExpiresAt.After(cutoff) {
+			delete(db.store.idempotentRequests, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// copyIdempotentRequest keeps callers from sharing the stored response body.
+func copyIdempotentRequest(request models.IdempotentRequest) models.IdempotentRequest {
+	request.ResponseBody = append([]byte(nil), request.ResponseBody...)
+	return request
+}
+
+// deleteIdempotentRequests drops the requests of a deleted user, like the
+// ON DELETE CASCADE on IdempotencyKeys.user_email.
+func (s *Store) deleteIdempotentRequests(key string) {
+	for requestKey, request := range s.idempotentRequests {
+		if emailKey(request.UserEmail) == key {
+			delete(s.idempotentRequests, requestKey)
+		}
+	}
+}
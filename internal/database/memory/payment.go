@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+type PaymentDB struct {
+	store *Store
+}
+
+func (db *PaymentDB) CreatePayment(ctx context.Context, tx database.Tx, tripID int, amount money.Amount, payment_method string, status models.PaymentStatus) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	id := int64(tripID)
+	if !db.store.tripExists(id) {
+		return ErrTripNotFound
+	}
+	if _, ok := db.store.payments[id]; ok {
+		return ErrDuplicateEntry
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	db.store.payments[id] = models.Payment{
+		TripID:        tripID,
+		Amount:        amount,
+		PaymentTime:   now,
+		PaymentMethod: models.PaymentMethod(payment_method),
+		Status:        status,
+		UpdatedAt:     now,
+	}
+
+	db.store.track(tx, func() {
+		delete(db.store.payments, id)
+	})
+
+	return nil
+}
+
+func (db *PaymentDB) GetPayment(ctx context.Context, tripID int) (models.Payment, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	payment, ok := db.store.payments[int64(tripID)]
+	if !ok {
+		return models.Payment{}, database.ErrPaymentNotFound
+	}
+	return payment, nil
+}
+
+func (db *PaymentDB) UpdatePaymentStatus(ctx context.Context, tx database.Tx, tripID int, status models.PaymentStatus, reference, reason string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	id := int64(tripID)
+	payment, ok := db.store.payments[id]
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+	if !payment.Status.CanTransitionTo(status) {
+		return database.ErrInvalidPaymentTransition
+	}
+
+	previous := payment
+	payment.Status = status
+	if reference != "" {
+		payment.ProviderReference = reference
+	}
+	payment.FailureReason = reason
+	payment.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	db.store.payments[id] = payment
+
+	db.store.track(tx, func() {
+		db.store.payments[id] = previous
+	})
+
+	return nil
+}
+
+func (db *PaymentDB) CreateRefund(ctx context.Context, tx database.Tx, refund models.Refund) (models.Refund, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.payments[refund.TripID]; !ok {
+		return models.Refund{}, database.ErrPaymentNotFound
+	}
+
+	refund.ID = db.store.nextRefundID
+	db.store.nextRefundID++
+	refund.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	db.store.refunds = append(db.store.refunds, refund)
+
+	db.store.track(tx, func() {
+		for i, r := range db.store.refunds {
+			if r.ID == refund.ID {
+				db.store.refunds = append(db.store.refunds[:i], db.store.refunds[i+1:]...)
+				break
+			}
+		}
+	})
+
+	return refund, nil
+}
+
+func (db *PaymentDB) UpdateRefundStatus(ctx context.Context, tx database.Tx, id int64, status models.RefundStatus) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.refunds {
+		refund := &db.store.refunds[i]
+		if refund.ID != id || refund.Status != models.RefundPending {
+			continue
+		}
+
+		refund.Status = status
+		db.store.track(tx, func() {
+			for i := range db.store.refunds {
+				if db.store.refunds[i].ID == id {
+					db.store.refunds[i].Status = models.RefundPending
+				}
+			}
+		})
+		return nil
+	}
+	return database.ErrRefundNotPending
+}
+
+func (db *PaymentDB) GetRefunds(ctx context.Context, tripID int64) ([]models.Refund, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var refunds []models.Refund
+	for _, refund := range db.store.refunds {
+		if refund.TripID == tripID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type ReservationDB struct {
+	store *Store
+}
+
+func (db *ReservationDB) CreateReservation(ctx context.Context, reservation models.Reservation) (models.Reservation, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	car, ok := db.store.cars[plateKey(reservation.CarLicensePlate)]
+	if !ok {
+		return models.Reservation{}, database.ErrCarNotFound
+	}
+	if car.Status == models.Maintenance {
+		return models.Reservation{}, database.ErrCarNotReservable
+	}
+	if _, ok := db.store.users[emailKey(reservation.UserEmail)]; !ok {
+		return models.Reservation{}, database.ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	cutoff := now.Add(-models.ReservationNoShowGrace)
+	for _, existing := range db.store.reservations {
+		if existing.CarLicensePlate != car.LicensePlate || existing.Status != models.ReservationActive {
+			continue
+		}
+		if existing.StartTime.Before(cutoff) {
+			continue
+		}
+		if existing.StartTime.Before(reservation.EndTime) && existing.EndTime.After(reservation.StartTime) {
+			return models.Reservation{}, database.ErrReservationOverlap
+		}
+	}
+
+	reservation.ID = db.store.nextReservationID
+	db.store.nextReservationID++
+	reservation.CarLicensePlate = car.LicensePlate
+	reservation.StartTime = reservation.StartTime.UTC()
+	reservation.EndTime = reservation.EndTime.UTC()
+	reservation.Status = models.ReservationActive
+	reservation.TripID = nil
+	reservation.CreatedAt = now.Truncate(time.Second)
+
+	stored := reservation
+	db.store.reservations = append(db.store.reservations, &stored)
+
+	return reservation, nil
+}
+
+func (db *ReservationDB) GetReservationsForUser(ctx context.Context, email string, page, pageSize int) ([]models.Reservation, int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.Reservation
+	for _, reservation := range db.store.reservations {
+		if emailKey(reservation.UserEmail) == emailKey(email) {
+			matching = append(matching, *reservation)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].StartTime.After(matching[j].StartTime)
+	})
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, 0, nil
+	}
+
+	return matching[start:end], len(matching), nil
+}
+
+func (db *ReservationDB) CancelReservation(ctx context.Context, email string, id int64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, reservation := range db.store.reservations {
+		if reservation.ID != id || emailKey(reservation.UserEmail) != emailKey(email) {
+			continue
+		}
+		if reservation.Status != models.ReservationActive {
+			return database.ErrReservationNotActive
+		}
+		reservation.Status = models.ReservationCancelled
+		return nil
+	}
+
+	return database.ErrReservationNotFound
+}
+
+func (db *ReservationDB) GetHeldReservation(ctx context.Context, licensePlate string, t time.Time) (models.Reservation, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var held *models.Reservation
+	for _, reservation := range db.store.reservations {
+		if plateKey(reservation.CarLicensePlate) != plateKey(licensePlate) || !reservation.HeldAt(t) {
+			continue
+		}
+		if held == nil || reservation.StartTime.Before(held.StartTime) {
+			held = reservation
+		}
+	}
+	if held == nil {
+		return models.Reservation{}, database.ErrReservationNotFound
+	}
+
+	return *held, nil
+}
+
+func (db *ReservationDB) FulfillReservation(ctx context.Context, tx database.Tx, id int64, email string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, reservation := range db.store.reservations {
+		if reservation.ID != id {
+			continue
+		}
+		if reservation.Status != models.ReservationActive {
+			return database.ErrReservationNotActive
+		}
+
+		var tripID *int64
+		if index, ok := db.store.activeTrip(email); ok {
+			id := db.store.trips[index].ID
+			tripID = &id
+		}
+
+		reservation.Status = models.ReservationFulfilled
+		reservation.TripID = tripID
+
+		record := reservation
+		db.store.track(tx, func() {
+			record.Status = models.ReservationActive
+			record.TripID = nil
+		})
+		return nil
+	}
+
+	return database.ErrReservationNotActive
+}
+
+func (db *ReservationDB) ExpireReservations(ctx context.Context, cutoff time.Time) (int64, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var expired int64
+	for _, reservation := range db.store.reservations {
+		if reservation.Status == models.ReservationActive && reservation.StartTime.Before(cutoff) {
+			reservation.Status = models.ReservationExpired
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+// deleteReservations drops the reservations of a deleted user or car, like
+// the ON DELETE CASCADE on Reservations.user_email and car_license_plate.
+func (s *Store) deleteReservations(match func(*models.Reservation) bool) {
+	reservations := s.reservations[:0]
+	for _, reservation := range s.reservations {
+		if !match(reservation) {
+			reservations = append(reservations, reservation)
+		}
+	}
+	s.reservations = reservations
+}
+
+// unlinkReservations clears the trip of the reservations that point to a
+// deleted trip, like the ON DELETE SET NULL on Reservations.trip_id.
+func (s *Store) unlinkReservations(tripID int64) {
+	for _, reservation := range s.reservations {
+		if reservation.TripID != nil && *reservation.TripID == tripID {
+			reservation.TripID = nil
+		}
+	}
+}
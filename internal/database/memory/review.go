@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type ReviewDB struct {
+	store *Store
+}
+
+func (db *ReviewDB) GetAllReviewsForCar(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Review, []string, int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.cars[plateKey(licensePlate)]; !ok {
+		return nil, nil, 0, database.ErrCarNotFound
+	}
+
+	var matching []reviewRecord
+	for _, review := range db.store.reviews {
+		for _, trip := range db.store.trips {
+			if trip.ID == review.TripID && plateKey(trip.CarLicensePlate) == plateKey(licensePlate) {
+				matching = append(matching, reviewRecord{Review: review.Review, email: trip.UserEmail})
+			}
+		}
+	}
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, nil, 0, nil
+	}
+
+	var reviews []models.Review
+	var emails []string
+	for _, review := range matching[start:end] {
+		reviews = append(reviews, review.Review)
+		emails = append(emails, review.email)
+	}
+
+	return reviews, emails, len(matching), nil
+}
+
+func (db *ReviewDB) CreateReview(ctx context.Context, tripID, rating int, comment, email string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if !db.store.tripExists(int64(tripID)) {
+		return ErrTripNotFound
+	}
+	for _, review := range db.store.reviews {
+		if review.TripID == int64(tripID) {
+			return ErrDuplicateEntry
+		}
+	}
+
+	db.store.reviews = append(db.store.reviews, reviewRecord{
+		Review: models.Review{
+			TripID:    int64(tripID),
+			Rating:    rating,
+			Comment:   comment,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		},
+	})
+	return nil
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type RoleDB struct {
+	store *Store
+}
+
+// defaultRoles mirrors the rows inserted by the roles migration.
+func defaultRoles() map[string]map[string]bool {
+	client := []string{
+		models.PermissionUsersSelf,
+		models.PermissionTripsRead,
+		models.PermissionTripsWrite,
+		models.PermissionReviewsWrite,
+		models.PermissionSubscriptionsRead,
+		models.PermissionSubscriptionsWrite,
+	}
+	admin := append([]string{
+		models.PermissionCarsRead,
+		models.PermissionCarsWrite,
+		models.PermissionDisputesManage,
+		models.PermissionSubscriptionsManage,
+	}, client...)
+
+	roles := map[string]map[string]bool{
+		models.AdminRole:  {},
+		models.ClientRole: {},
+	}
+	for _, permission := range admin {
+		roles[models.AdminRole][permission] = true
+	}
+	for _, permission := range client {
+		roles[models.ClientRole][permission] = true
+	}
+	return roles
+}
+
+func (db *RoleDB) GetPermissions(ctx context.Context, role string) ([]string, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var permissions []string
+	for permission := range db.store.roles[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+func (db *RoleDB) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	return db.store.roles[role][permission], nil
+}
+
+func (db *RoleDB) SetUserRole(ctx context.Context, email, role string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.roles[role]; !ok {
+		return database.ErrRoleNotFound
+	}
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+
+	user.Role = role
+	db.store.users[emailKey(email)] = user
+	return nil
+}
+
+func (db *RoleDB) GetUsersWithPermission(ctx context.Context, permission string) ([]string, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var emails []string
+	for _, user := range db.store.users {
+		if db.store.roles[user.Role][permission] {
+			emails = append(emails, user.Email)
+		}
+	}
+	sort.Strings(emails)
+
+	return emails, nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type ServiceDB struct {
+	store *Store
+}
+
+func (db *ServiceDB) GetServices(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Service, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.Service
+	for _, service := range db.store.services {
+		if plateKey(service.CarLicensePlate) == plateKey(licensePlate) {
+			matching = append(matching, service)
+		}
+	}
+
+	start, end := paginate(len(matching), page, pageSize)
+
+	var services []models.Service
+	for _, service := range matching[start:end] {
+		// The MySQL query does not select the license plate.
+		service.CarLicensePlate = ""
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (db *ServiceDB) GetTotalServices(ctx context.Context, license_plate string) (int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var count int
+	for _, service := range db.store.services {
+		if plateKey(service.CarLicensePlate) == plateKey(license_plate) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AddService numbers services per car, like the Services_BEFORE_INSERT trigger.
+func (db *ServiceDB) AddService(ctx context.Context, service models.Service) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := plateKey(service.CarLicensePlate)
+	if _, ok := db.store.cars[key]; !ok {
+		return database.ErrCarNotFound
+	}
+
+	serviceDate, err := scanDate(service.ServiceDate)
+	if err != nil {
+		return err
+	}
+
+	var nextID int64 = 1
+	for _, existing := range db.store.services {
+		if plateKey(existing.CarLicensePlate) == key && existing.ID >= nextID {
+			nextID = existing.ID + 1
+		}
+	}
+
+	service.ID = nextID
+	service.CarLicensePlate = key
+	service.ServiceDate = serviceDate
+	db.store.services = append(db.store.services, service)
+	return nil
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type SessionDB struct {
+	store *Store
+}
+
+type sessionRecord struct {
+	models.Session
+	refreshTokenHash string
+}
+
+func (db *SessionDB) CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.users[emailKey(session.UserEmail)]; !ok {
+		return database.ErrUserNotFound
+	}
+	for _, record := range db.store.sessions {
+		if record.ID == session.ID || record.refreshTokenHash == refreshTokenHash {
+			return ErrDuplicateEntry
+		}
+	}
+
+	db.store.sessions = append(db.store.sessions, &sessionRecord{
+		Session:          session,
+		refreshTokenHash: refreshTokenHash,
+	})
+	return nil
+}
+
+func (db *SessionDB) RotateRefreshToken(ctx context.Context, oldHash, newHash string) (models.Session, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, record := range db.store.sessions {
+		if record.refreshTokenHash != oldHash {
+			continue
+		}
+		if !record.activeAt(now) {
+			break
+		}
+		record.refreshTokenHash = newHash
+		record.LastUsedAt = now.Truncate(time.Second)
+		return record.Session, nil
+	}
+
+	return models.Session{}, database.ErrSessionExpired
+}
+
+func (db *SessionDB) GetSessions(ctx context.Context, email string) ([]models.Session, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	now := time.Now().UTC()
+	var sessions []models.Session
+	for _, record := range db.store.sessions {
+		if emailKey(record.UserEmail) == emailKey(email) && record.activeAt(now) {
+			sessions = append(sessions, record.Session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+func (db *SessionDB) RevokeSession(ctx context.Context, email, id string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, record := range db.store.sessions {
+		if record.ID == id && emailKey(record.UserEmail) == emailKey(email) && record.RevokedAt == nil {
+			revokedAt := time.Now().UTC().Truncate(time.Second)
+			record.RevokedAt = &revokedAt
+			return nil
+		}
+	}
+
+	return database.ErrSessionNotFound
+}
+
+func (db *SessionDB) RevokeAllSessions(ctx context.Context, email, exceptID string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	revokedAt := time.Now().UTC().Truncate(time.Second)
+	for _, record := range db.store.sessions {
+		if emailKey(record.UserEmail) == emailKey(email) && record.ID != exceptID && record.RevokedAt == nil {
+			record.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+func (db *SessionDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	now := time.Now()
+	for revoked, expiry := range db.store.revokedTokens {
+		if expiry.Before(now) {
+			delete(db.store.revokedTokens, revoked)
+		}
+	}
+	if _, ok := db.store.revokedTokens[jti]; !ok {
+		db.store.revokedTokens[jti] = expiresAt
+	}
+
+	return nil
+}
+
+func (db *SessionDB) SessionActive(ctx context.Context, sessionID, jti string) (bool, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.revokedTokens[jti]; ok {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	for _, record := range db.store.sessions {
+		if record.ID == sessionID {
+			return record.activeAt(now), nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *sessionRecord) activeAt(now time.Time) bool {
+	return r.RevokedAt == nil && r.ExpiresAt.After(now)
+}
+
+// deleteSessions drops the sessions of a deleted user, like the
+// ON DELETE CASCADE on Sessions.user_email.
+func (s *Store) deleteSessions(key string) {
+	sessions := s.sessions[:0]
+	for _, record := range s.sessions {
+		if emailKey(record.UserEmail) != key {
+			sessions = append(sessions, record)
+		}
+	}
+	s.sessions = sessions
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type SettingDB struct {
+	store *Store
+}
+
+func (db *SettingDB) GetSettings(ctx context.Context, email string) (models.Settings, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	settings, ok := db.store.settings[emailKey(email)]
+	if !ok {
+		return models.Settings{}, database.ErrSettingsNotFound
+	}
+
+	// The bit columns are always read back, defaulting to false.
+	engineStartStop := settings.EngineStartStop != nil && *settings.EngineStartStop
+	settings.EngineStartStop = &engineStartStop
+	cruiseControl := settings.CruiseControl != nil && *settings.CruiseControl
+	settings.CruiseControl = &cruiseControl
+
+	return settings, nil
+}
+
+func (db *SettingDB) CreateSettings(ctx context.Context, email string, settings models.Settings) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := emailKey(email)
+	if _, ok := db.store.users[key]; !ok {
+		return database.ErrUserNotFound
+	}
+	if _, ok := db.store.settings[key]; ok {
+		return ErrDuplicateEntry
+	}
+
+	settings.UserEmail = email
+	db.store.settings[key] = settings
+	return nil
+}
+
+// UpdateSetting overwrites every field set in settings, skipping the ones
+// left nil, the same way the MySQL backend builds its UPDATE statement.
+func (db *SettingDB) UpdateSetting(ctx context.Context, email string, settings models.Settings) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	stored, exists := db.store.settings[emailKey(email)]
+
+	current := reflect.ValueOf(&stored).Elem()
+	update := reflect.ValueOf(settings)
+	typ := update.Type()
+
+	var updated int
+	for i := 0; i < update.NumField(); i++ {
+		if typ.Field(i).Name == "UserEmail" {
+			continue
+		}
+		field := update.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		current.Field(i).Set(field)
+		updated++
+	}
+
+	if updated == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+
+	if exists {
+		db.store.settings[emailKey(email)] = stored
+	}
+	return nil
+}
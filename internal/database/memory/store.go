@@ -0,0 +1,210 @@
+// Package memory is an in-process implementation of the database
+// repositories. It mirrors the behaviour of the MySQL backend, including the
+// triggers and views, so that handlers can be exercised without a server.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+// The MySQL backend reports these as constraint violations.
+var (
+	ErrCarReferenced  = fmt.Errorf("car is referenced by trips, damages or services")
+	ErrTripNotFound   = fmt.Errorf("referenced trip does not exist")
+	ErrDuplicateEntry = fmt.Errorf("duplicate entry")
+)
+
+type Store struct {
+	mu sync.Mutex
+
+	users               map[string]models.User
+	roles               map[string]map[string]bool
+	sessions            []*sessionRecord
+	revokedTokens       map[string]time.Time
+	userTokens          []*userToken
+	idempotentRequests  map[string]models.IdempotentRequest
+	cars                map[string]models.Car
+	damages             []models.Damage
+	services            []models.Service
+	trips               []models.Trip
+	telemetry           map[int64][]models.TelemetryPoint
+	reservations        []*models.Reservation
+	payments            map[int64]models.Payment
+	refunds             []models.Refund
+	disputes            []*models.Dispute
+	reviews             []reviewRecord
+	settings            map[string]models.Settings
+	plans               []models.SubscriptionPlan
+	userSubscriptions   []models.UserSubscription
+	subscriptionCharges []models.SubscriptionCharge
+	tripUsage           []models.TripUsage
+
+	nextTripID               int64
+	nextReservationID        int64
+	nextDisputeID            int64
+	nextRefundID             int64
+	nextUserSubscriptionID   int64
+	nextPlanID               int64
+	nextSubscriptionChargeID int64
+
+	// uncommittedEnds holds the trips ended by a transaction that has not
+	// been committed yet, which other readers must not see as finished.
+	uncommittedEnds map[int64]bool
+}
+
+type reviewRecord struct {
+	models.Review
+	email string
+}
+
+func New() *Store {
+	return &Store{
+		users:                    make(map[string]models.User),
+		roles:                    defaultRoles(),
+		revokedTokens:            make(map[string]time.Time),
+		idempotentRequests:       make(map[string]models.IdempotentRequest),
+		cars:                     make(map[string]models.Car),
+		payments:                 make(map[int64]models.Payment),
+		telemetry:                make(map[int64][]models.TelemetryPoint),
+		settings:                 make(map[string]models.Settings),
+		nextTripID:               1,
+		nextReservationID:        1,
+		nextDisputeID:            1,
+		nextRefundID:             1,
+		nextUserSubscriptionID:   1,
+		nextPlanID:               1,
+		nextSubscriptionChargeID: 1,
+		uncommittedEnds:          make(map[int64]bool),
+	}
+}
+
+// Database returns the repositories backed by this store.
+func (s *Store) Database() *database.Database {
+	return &database.Database{
+		Transactor:     s,
+		UserDB:         &UserDB{store: s},
+		RoleDB:         &RoleDB{store: s},
+		SessionDB:      &SessionDB{store: s},
+		UserTokenDB:    &UserTokenDB{store: s},
+		IdempotencyDB:  &IdempotencyDB{store: s},
+		CarDB:          &CarDB{store: s},
+		DamageDB:       &DamageDB{store: s},
+		ServiceDB:      &ServiceDB{store: s},
+		TripDB:         &TripDB{store: s},
+		TelemetryDB:    &TelemetryDB{store: s},
+		ReservationDB:  &ReservationDB{store: s},
+		SettingDB:      &SettingDB{store: s},
+		ReviewDB:       &ReviewDB{store: s},
+		PaymentDB:      &PaymentDB{store: s},
+		DisputeDB:      &DisputeDB{store: s},
+		SubscriptionDB: &SubscriptionDB{store: s},
+	}
+}
+
+// AddSubscriptionPlan registers the first version of a subscription plan.
+// The MySQL backend gets the original plans from the migrations.
+func (s *Store) AddSubscriptionPlan(plan models.SubscriptionPlan) models.SubscriptionPlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan.Version = 1
+	if plan.CreatedAt.IsZero() {
+		plan.CreatedAt = time.Now()
+	}
+	return s.insertPlan(plan)
+}
+
+// Tx applies changes to the store immediately and keeps the steps needed to
+// undo them, which Rollback replays in reverse order.
+type Tx struct {
+	store      *Store
+	undo       []func()
+	endedTrips []int64
+	done       bool
+}
+
+func (s *Store) Begin(ctx context.Context) (database.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Tx{store: s}, nil
+}
+
+func (tx *Tx) Commit() error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	tx.release()
+	return nil
+}
+
+func (tx *Tx) Rollback() error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.release()
+	return nil
+}
+
+func (tx *Tx) release() {
+	for _, id := range tx.endedTrips {
+		delete(tx.store.uncommittedEnds, id)
+	}
+	tx.undo = nil
+	tx.endedTrips = nil
+}
+
+// track registers how to undo a change made inside tx. It must be called
+// with the store lock held. A nil tx means the change is final.
+func (s *Store) track(tx database.Tx, undo func()) *Tx {
+	if tx == nil {
+		return nil
+	}
+	memTx, ok := tx.(*Tx)
+	if !ok {
+		panic("memory: repository used with a transaction from another backend")
+	}
+	memTx.undo = append(memTx.undo, undo)
+	return memTx
+}
+
+// MySQL compares the latin1 primary keys case-insensitively.
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+func plateKey(licensePlate string) string {
+	return strings.ToUpper(licensePlate)
+}
+
+// paginate returns the bounds of the requested page within n items.
+func paginate(n, page, pageSize int) (int, int) {
+	start := (page - 1) * pageSize
+	if start > n {
+		start = n
+	}
+	end := start + pageSize
+	if end > n {
+		end = n
+	}
+	return start, end
+}
@@ -0,0 +1,507 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type SubscriptionDB struct {
+	store *Store
+}
+
+func (db *SubscriptionDB) GetAllSubscriptions(ctx context.Context) ([]models.SubscriptionPlan, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var plans []models.SubscriptionPlan
+	for _, plan := range db.store.latestPlans() {
+		if plan.Purchasable(time.Now()) {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+func (db *SubscriptionDB) GetPlans(ctx context.Context) ([]models.SubscriptionPlan, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	return db.store.latestPlans(), nil
+}
+
+func (db *SubscriptionDB) GetPlanVersions(ctx context.Context, name string) ([]models.SubscriptionPlan, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var plans []models.SubscriptionPlan
+	for i := len(db.store.plans) - 1; i >= 0; i-- {
+		if db.store.plans[i].Name == models.SubscriptionName(name) {
+			plans = append(plans, copyPlan(db.store.plans[i]))
+		}
+	}
+	if len(plans) == 0 {
+		return nil, database.ErrPlanNotFound
+	}
+	return plans, nil
+}
+
+func (db *SubscriptionDB) CreatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.latestPlan(plan.Name); ok {
+		return models.SubscriptionPlan{}, database.ErrPlanExists
+	}
+
+	plan.Version = 1
+	plan.RetiredAt = nil
+	return db.store.insertPlan(plan), nil
+}
+
+func (db *SubscriptionDB) UpdatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	latest, ok := db.store.latestPlan(plan.Name)
+	if !ok {
+		return models.SubscriptionPlan{}, database.ErrPlanNotFound
+	}
+	if latest.RetiredAt != nil {
+		return models.SubscriptionPlan{}, database.ErrPlanRetired
+	}
+
+	plan.Version = latest.Version + 1
+	plan.RetiredAt = nil
+	return db.store.insertPlan(plan), nil
+}
+
+func (db *SubscriptionDB) RetirePlan(ctx context.Context, name string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	found, retired := false, false
+	for i := range db.store.plans {
+		if db.store.plans[i].Name != models.SubscriptionName(name) {
+			continue
+		}
+		found = true
+		if db.store.plans[i].RetiredAt == nil {
+			db.store.plans[i].RetiredAt = &now
+			retired = true
+		}
+	}
+	switch {
+	case !found:
+		return database.ErrPlanNotFound
+	case !retired:
+		return database.ErrPlanRetired
+	}
+	return nil
+}
+
+func (db *SubscriptionDB) CountActiveSubscriptions(ctx context.Context) (int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	now := time.Now()
+	var count int
+	for _, subscription := range db.store.userSubscriptions {
+		if subscription.Active(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (db *SubscriptionDB) GetActiveSubscription(ctx context.Context, email string) (models.UserSubscription, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	index, ok := db.store.activeSubscription(email)
+	if !ok {
+		return models.UserSubscription{}, database.ErrUserSubscriptionNotFound
+	}
+	return db.store.withPlan(db.store.userSubscriptions[index]), nil
+}
+
+func (db *SubscriptionDB) BuySubscription(ctx context.Context, subscription models.UserSubscription) (models.UserSubscription, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(subscription.UserEmail)]
+	if !ok {
+		return models.UserSubscription{}, database.ErrUserNotFound
+	}
+	subscription.UserEmail = user.Email
+
+	if _, ok := db.store.activeSubscription(subscription.UserEmail); ok {
+		return models.UserSubscription{}, database.ErrAlreadyActibeSubscriptionError
+	}
+
+	plan, ok := db.store.latestPlan(subscription.SubscriptionName)
+	if !ok || !plan.Purchasable(time.Now()) {
+		return models.UserSubscription{}, database.ErrInvalidSubscriptionName
+	}
+
+	subscription.ID = db.store.nextUserSubscriptionID
+	db.store.nextUserSubscriptionID++
+	subscription.SubscriptionName = plan.Name
+	subscription.PlanID = plan.ID
+	subscription.StartDate = time.Now().UTC().Truncate(24 * time.Hour)
+	subscription.EndDate = subscription.StartDate.AddDate(0, plan.DurationMonths, 0)
+	subscription.IsCancelled = false
+	subscription.CancelAtPeriodEnd = false
+	subscription.CancelledAt = nil
+	subscription.GraceUntil = nil
+	subscription.NextRenewalAttempt = nil
+	subscription.Plan = nil
+	subscription.Charges = nil
+	db.store.userSubscriptions = append(db.store.userSubscriptions, subscription)
+
+	charge := db.store.insertCharge(models.SubscriptionCharge{
+		UserSubscriptionID: subscription.ID,
+		Kind:               models.ChargePurchase,
+		PlanID:             plan.ID,
+		Amount:             plan.Price(),
+		PaymentMethod:      subscription.PaymentMethod,
+		PeriodEnd:          subscription.EndDate,
+	})
+
+	subscription = db.store.withPlan(subscription)
+	subscription.Charges = []models.SubscriptionCharge{charge}
+	return subscription, nil
+}
+
+func (db *SubscriptionDB) CancelSubscription(ctx context.Context, email string, mode models.CancellationMode) (models.UserSubscription, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	index, ok := db.store.activeSubscription(email)
+	if !ok {
+		return models.UserSubscription{}, database.ErrActiveSubscriptionNotFound
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	subscription := &db.store.userSubscriptions[index]
+	subscription.AutoRenew = false
+	subscription.CancelledAt = &now
+	subscription.NextRenewalAttempt = nil
+	if mode == models.CancelAtPeriodEnd {
+		subscription.CancelAtPeriodEnd = true
+		subscription.GraceUntil = nil
+	} else {
+		subscription.IsCancelled = true
+	}
+
+	return db.store.withPlan(*subscription), nil
+}
+
+func (db *SubscriptionDB) GetSubscriptionHistory(ctx context.Context, email string) ([]models.UserSubscription, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var subscriptions []models.UserSubscription
+	for _, subscription := range db.store.userSubscriptions {
+		if emailKey(subscription.UserEmail) != emailKey(email) {
+			continue
+		}
+		subscription = db.store.withPlan(subscription)
+		for _, charge := range db.store.subscriptionCharges {
+			if charge.UserSubscriptionID == subscription.ID {
+				subscription.Charges = append(subscription.Charges, charge)
+			}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].StartDate.Equal(subscriptions[j].StartDate) {
+			return subscriptions[i].StartDate.After(subscriptions[j].StartDate)
+		}
+		return subscriptions[i].ID > subscriptions[j].ID
+	})
+	return subscriptions, nil
+}
+
+func (db *SubscriptionDB) GetDueRenewals(ctx context.Context, dueBefore, now time.Time) ([]models.UserSubscription, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var subscriptions []models.UserSubscription
+	for _, subscription := range db.store.userSubscriptions {
+		if !subscription.AutoRenew || subscription.IsCancelled || subscription.CancelAtPeriodEnd ||
+			!subscription.EndDate.Before(dueBefore) {
+			continue
+		}
+		if subscription.NextRenewalAttempt != nil && subscription.NextRenewalAttempt.After(now) {
+			continue
+		}
+		if subscription.GraceUntil != nil && !subscription.GraceUntil.After(now) {
+			continue
+		}
+		subscriptions = append(subscriptions, db.store.withPlan(subscription))
+	}
+
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].EndDate.Before(subscriptions[j].EndDate)
+	})
+	return subscriptions, nil
+}
+
+func (db *SubscriptionDB) ClaimRenewal(ctx context.Context, id int64, endDate, now, until time.Time) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.userSubscriptions {
+		subscription := &db.store.userSubscriptions[i]
+		if subscription.ID != id {
+			continue
+		}
+		if !subscription.EndDate.Equal(endDate) || !subscription.AutoRenew || subscription.IsCancelled ||
+			subscription.CancelAtPeriodEnd ||
+			(subscription.NextRenewalAttempt != nil && subscription.NextRenewalAttempt.After(now)) {
+			return database.ErrSubscriptionChanged
+		}
+		claimed := until.UTC()
+		subscription.NextRenewalAttempt = &claimed
+		return nil
+	}
+	return database.ErrSubscriptionChanged
+}
+
+func (db *SubscriptionDB) ExtendSubscription(ctx context.Context, id int64, from, to time.Time, planID int64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.userSubscriptions {
+		subscription := &db.store.userSubscriptions[i]
+		if subscription.ID != id {
+			continue
+		}
+		if !subscription.EndDate.Equal(from) || subscription.IsCancelled {
+			return database.ErrSubscriptionChanged
+		}
+		subscription.EndDate = to
+		subscription.PlanID = planID
+		subscription.GraceUntil = nil
+		subscription.NextRenewalAttempt = nil
+		return nil
+	}
+	return database.ErrSubscriptionChanged
+}
+
+func (db *SubscriptionDB) DeferRenewal(ctx context.Context, id int64, graceUntil time.Time, retryAt *time.Time) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.userSubscriptions {
+		subscription := &db.store.userSubscriptions[i]
+		if subscription.ID == id {
+			grace := graceUntil.UTC()
+			subscription.GraceUntil = &grace
+			subscription.NextRenewalAttempt = retryAt
+			subscription.AutoRenew = retryAt != nil
+		}
+	}
+	return nil
+}
+
+func (db *SubscriptionDB) DisableAutoRenew(ctx context.Context, id int64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.userSubscriptions {
+		if db.store.userSubscriptions[i].ID == id {
+			db.store.userSubscriptions[i].AutoRenew = false
+			db.store.userSubscriptions[i].NextRenewalAttempt = nil
+		}
+	}
+	return nil
+}
+
+func (db *SubscriptionDB) CreateSubscriptionCharge(ctx context.Context, charge models.SubscriptionCharge) (models.SubscriptionCharge, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, subscription := range db.store.userSubscriptions {
+		if subscription.ID == charge.UserSubscriptionID {
+			return db.store.insertCharge(charge), nil
+		}
+	}
+	return models.SubscriptionCharge{}, database.ErrUserSubscriptionNotFound
+}
+
+func (db *SubscriptionDB) UpdateSubscriptionCharge(ctx context.Context, id int64, status models.PaymentStatus, reference, reason string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for i := range db.store.subscriptionCharges {
+		charge := &db.store.subscriptionCharges[i]
+		if charge.ID != id {
+			continue
+		}
+		if !charge.Status.CanTransitionTo(status) {
+			return database.ErrInvalidPaymentTransition
+		}
+		charge.Status = status
+		if reference != "" {
+			charge.ProviderReference = reference
+		}
+		charge.FailureReason = reason
+		charge.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		return nil
+	}
+	return database.ErrSubscriptionChargeNotFound
+}
+
+func (db *SubscriptionDB) RecordTripUsage(ctx context.Context, tx database.Tx, usage models.TripUsage) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if !db.store.tripExists(usage.TripID) {
+		return ErrTripNotFound
+	}
+	for _, recorded := range db.store.tripUsage {
+		if recorded.TripID == usage.TripID {
+			return ErrDuplicateEntry
+		}
+	}
+
+	usage.RecordedAt = usage.RecordedAt.UTC().Truncate(time.Second)
+	db.store.tripUsage = append(db.store.tripUsage, usage)
+
+	db.store.track(tx, func() {
+		db.store.deleteTripUsage(func(recorded models.TripUsage) bool {
+			return recorded.TripID == usage.TripID
+		})
+	})
+
+	return nil
+}
+
+func (db *SubscriptionDB) GetUsage(ctx context.Context, subscriptionID int64, from, to time.Time) (models.UsageTotals, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var totals models.UsageTotals
+	for _, usage := range db.store.tripUsage {
+		if usage.UserSubscriptionID != subscriptionID || usage.RecordedAt.Before(from) || !usage.RecordedAt.Before(to) {
+			continue
+		}
+		totals.Km += usage.Km
+		totals.Minutes += usage.Minutes
+		totals.OverageKm += usage.OverageKm
+		totals.OverageMinutes += usage.OverageMinutes
+		totals.OverageAmount = totals.OverageAmount.Add(usage.OverageAmount)
+		totals.Trips++
+	}
+	return totals, nil
+}
+
+func (s *Store) activeSubscription(email string) (int, bool) {
+	now := time.Now()
+	for i, subscription := range s.userSubscriptions {
+		if emailKey(subscription.UserEmail) == emailKey(email) && subscription.Active(now) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// withPlan returns subscription with the version of the plan it is on.
+func (s *Store) withPlan(subscription models.UserSubscription) models.UserSubscription {
+	if plan, ok := s.plan(subscription.PlanID); ok {
+		subscription.Plan = &plan
+	}
+	return subscription
+}
+
+func (s *Store) insertCharge(charge models.SubscriptionCharge) models.SubscriptionCharge {
+	charge.ID = s.nextSubscriptionChargeID
+	s.nextSubscriptionChargeID++
+	charge.Status = models.PaymentPending
+	charge.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	charge.UpdatedAt = charge.CreatedAt
+	s.subscriptionCharges = append(s.subscriptionCharges, charge)
+	return charge
+}
+
+func (s *Store) deleteSubscriptionCharges(subscriptionID int64) {
+	charges := s.subscriptionCharges[:0]
+	for _, charge := range s.subscriptionCharges {
+		if charge.UserSubscriptionID != subscriptionID {
+			charges = append(charges, charge)
+		}
+	}
+	s.subscriptionCharges = charges
+	s.deleteTripUsage(func(usage models.TripUsage) bool {
+		return usage.UserSubscriptionID == subscriptionID
+	})
+}
+
+func (s *Store) deleteTripUsage(match func(models.TripUsage) bool) {
+	kept := s.tripUsage[:0]
+	for _, usage := range s.tripUsage {
+		if !match(usage) {
+			kept = append(kept, usage)
+		}
+	}
+	s.tripUsage = kept
+}
+
+func (s *Store) insertPlan(plan models.SubscriptionPlan) models.SubscriptionPlan {
+	plan.ID = s.nextPlanID
+	s.nextPlanID++
+	plan.CreatedAt = plan.CreatedAt.UTC().Truncate(time.Second)
+	s.plans = append(s.plans, copyPlan(plan))
+	return plan
+}
+
+func (s *Store) plan(id int64) (models.SubscriptionPlan, bool) {
+	for _, plan := range s.plans {
+		if plan.ID == id {
+			return copyPlan(plan), true
+		}
+	}
+	return models.SubscriptionPlan{}, false
+}
+
+func (s *Store) latestPlan(name models.SubscriptionName) (models.SubscriptionPlan, bool) {
+	for i := len(s.plans) - 1; i >= 0; i-- {
+		if s.plans[i].Name == name {
+			return copyPlan(s.plans[i]), true
+		}
+	}
+	return models.SubscriptionPlan{}, false
+}
+
+// latestPlans returns the latest version of every plan, ordered like the
+// MySQL backend orders them.
+func (s *Store) latestPlans() []models.SubscriptionPlan {
+	seen := make(map[models.SubscriptionName]bool)
+	var plans []models.SubscriptionPlan
+	for i := len(s.plans) - 1; i >= 0; i-- {
+		if !seen[s.plans[i].Name] {
+			seen[s.plans[i].Name] = true
+			plans = append(plans, copyPlan(s.plans[i]))
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].DurationMonths != plans[j].DurationMonths {
+			return plans[i].DurationMonths < plans[j].DurationMonths
+		}
+		return plans[i].Name < plans[j].Name
+	})
+	return plans
+}
+
+// copyPlan keeps callers from sharing the stored categories.
+func copyPlan(plan models.SubscriptionPlan) models.SubscriptionPlan {
+	plan.Categories = append([]models.Category(nil), plan.Categories...)
+	return plan
+}
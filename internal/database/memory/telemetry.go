@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type TelemetryDB struct {
+	store *Store
+}
+
+// RecordTelemetry ignores points whose timestamp the trip already has, like
+// the INSERT IGNORE on the (trip_id, recorded_at) primary key.
+func (db *TelemetryDB) RecordTelemetry(ctx context.Context, tripID int64, points []models.TelemetryPoint) (int64, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	stored := db.store.telemetry[tripID]
+	seen := make(map[time.Time]bool, len(stored))
+	for _, point := range stored {
+		seen[point.RecordedAt] = true
+	}
+
+	var inserted int64
+	for _, point := range points {
+		// recorded_at is a timestamp(3) column.
+		point.RecordedAt = point.RecordedAt.UTC().Truncate(time.Millisecond)
+		if seen[point.RecordedAt] {
+			continue
+		}
+		seen[point.RecordedAt] = true
+		stored = append(stored, point)
+		inserted++
+	}
+
+	sort.SliceStable(stored, func(i, j int) bool {
+		return stored[i].RecordedAt.Before(stored[j].RecordedAt)
+	})
+	db.store.telemetry[tripID] = stored
+
+	return inserted, nil
+}
+
+func (db *TelemetryDB) GetTelemetry(ctx context.Context, tripID int64) ([]models.TelemetryPoint, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	stored := db.store.telemetry[tripID]
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	points := make([]models.TelemetryPoint, len(stored))
+	copy(points, stored)
+	return points, nil
+}
@@ -0,0 +1,299 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+type TripDB struct {
+	store *Store
+}
+
+func (db *TripDB) GetAllTripsForCar(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Trip, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.Trip
+	for _, trip := range db.store.trips {
+		if plateKey(trip.CarLicensePlate) == plateKey(licensePlate) {
+			matching = append(matching, trip)
+		}
+	}
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, nil
+	}
+
+	return matching[start:end], nil
+}
+
+func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pageSize int) ([]models.PayloadTrip, int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var matching []models.PayloadTrip
+	for _, trip := range db.store.trips {
+		if emailKey(trip.UserEmail) != emailKey(email) {
+			continue
+		}
+
+		payloadTrip := models.PayloadTrip{
+			ID:              trip.ID,
+			UserEmail:       trip.UserEmail,
+			CarLicensePlate: trip.CarLicensePlate,
+			StartTime:       trip.StartTime,
+			EndTime:         trip.EndTime,
+			DrivingBehavior: trip.DrivingBehavior,
+		}
+		if trip.Distance != nil {
+			payloadTrip.Distance = *trip.Distance
+		}
+		if payment, ok := db.store.payments[trip.ID]; ok {
+			payloadTrip.Amount = payment.Amount
+			payloadTrip.PaymentMethod = payment.PaymentMethod
+			payloadTrip.PaymentStatus = payment.Status
+		}
+		matching = append(matching, payloadTrip)
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].StartTime.After(matching[j].StartTime)
+	})
+
+	start, end := paginate(len(matching), page, pageSize)
+	if start == end {
+		return nil, 0, nil
+	}
+
+	return matching[start:end], len(matching), nil
+}
+
+func (db *TripDB) CountActiveTrips(ctx context.Context) (int, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	var count int
+	for _, trip := range db.store.trips {
+		if trip.EndTime == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (db *TripDB) GetActiveTrip(ctx context.Context, email string) (models.Trip, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	index, ok := db.store.activeTrip(email)
+	if !ok {
+		return models.Trip{}, database.ErrTripNotFound
+	}
+	return db.store.trips[index], nil
+}
+
+func (db *TripDB) CreateTrip(ctx context.Context, tx database.Tx, email, licensePlate string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.users[emailKey(email)]; !ok {
+		return database.ErrUserNotFound
+	}
+	if _, ok := db.store.cars[plateKey(licensePlate)]; !ok {
+		return database.ErrCarNotFound
+	}
+	// The unique keys on the active trips of Trips, which wait for the
+	// transactions ending trips to commit.
+	for _, trip := range db.store.trips {
+		if trip.EndTime != nil && !db.store.uncommittedEnds[trip.ID] {
+			continue
+		}
+		if emailKey(trip.UserEmail) == emailKey(email) {
+			return database.ErrActiveTripExists
+		}
+		if plateKey(trip.CarLicensePlate) == plateKey(licensePlate) {
+			return database.ErrCarOnTrip
+		}
+	}
+
+	id := db.store.nextTripID
+	db.store.nextTripID++
+	db.store.trips = append(db.store.trips, models.Trip{
+		ID:              id,
+		UserEmail:       email,
+		CarLicensePlate: licensePlate,
+		StartTime:       time.Now().UTC().Truncate(time.Second),
+	})
+
+	db.store.track(tx, func() {
+		db.store.removeTrip(id)
+	})
+
+	return nil
+}
+
+func (db *TripDB) EndTrip(ctx context.Context, tx database.Tx, tripID int64, endTime time.Time, distance, driving_behavior float64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	index := -1
+	for i, trip := range db.store.trips {
+		if trip.ID == tripID && trip.EndTime == nil {
+			index = i
+		}
+	}
+	if index < 0 {
+		return database.ErrTripNotFound
+	}
+
+	trip := &db.store.trips[index]
+	id := trip.ID
+	endTime = endTime.UTC().Truncate(time.Second)
+	trip.EndTime = &endTime
+	trip.Distance = &distance
+	trip.DrivingBehavior = &driving_behavior
+
+	if memTx := db.store.track(tx, func() {
+		for i := range db.store.trips {
+			if db.store.trips[i].ID == id {
+				db.store.trips[i].EndTime = nil
+				db.store.trips[i].Distance = nil
+				db.store.trips[i].DrivingBehavior = nil
+			}
+		}
+	}); memTx != nil {
+		memTx.endedTrips = append(memTx.endedTrips, id)
+		db.store.uncommittedEnds[id] = true
+	}
+
+	return nil
+}
+
+// FindActiveTripCar reads the active trip through the same joins as the
+// UserCarTrip view.
+func (db *TripDB) FindActiveTripCar(ctx context.Context, email string) (int, string, money.Amount, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	index, ok := db.store.activeTrip(email)
+	if !ok {
+		return 0, "", 0, database.ErrCarNotFound
+	}
+	trip := db.store.trips[index]
+
+	car, ok := db.store.cars[plateKey(trip.CarLicensePlate)]
+	if !ok {
+		return 0, "", 0, database.ErrCarNotFound
+	}
+
+	var costPerKm money.Amount
+	if car.CostPerKm != nil {
+		costPerKm = *car.CostPerKm
+	}
+
+	return int(trip.ID), car.LicensePlate, costPerKm, nil
+}
+
+func (db *TripDB) GetTripByID(ctx context.Context, id, email string) (models.PayloadTrip, models.Car, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	tripID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return models.PayloadTrip{}, models.Car{}, database.ErrTripNotFound
+	}
+
+	for _, trip := range db.store.trips {
+		if trip.ID != tripID || emailKey(trip.UserEmail) != emailKey(email) {
+			continue
+		}
+
+		car, ok := db.store.cars[plateKey(trip.CarLicensePlate)]
+		if !ok {
+			return models.PayloadTrip{}, models.Car{}, database.ErrTripNotFound
+		}
+
+		var distance float64
+		if trip.Distance != nil {
+			distance = *trip.Distance
+		}
+
+		payloadTrip := models.PayloadTrip{
+			ID:              trip.ID,
+			UserEmail:       trip.UserEmail,
+			CarLicensePlate: trip.CarLicensePlate,
+			StartTime:       trip.StartTime,
+			EndTime:         trip.EndTime,
+			DrivingBehavior: trip.DrivingBehavior,
+			Distance:        distance,
+		}
+		if payment, ok := db.store.payments[trip.ID]; ok {
+			payloadTrip.Amount = payment.Amount
+			payloadTrip.PaymentMethod = payment.PaymentMethod
+			payloadTrip.PaymentStatus = payment.Status
+		}
+
+		return payloadTrip, models.Car{
+			LicensePlate: car.LicensePlate,
+			CostPerKm:    car.CostPerKm,
+			Category:     car.Category,
+		}, nil
+	}
+
+	return models.PayloadTrip{}, models.Car{}, database.ErrTripNotFound
+}
+
+func (s *Store) activeTrip(email string) (int, bool) {
+	for i, trip := range s.trips {
+		if emailKey(trip.UserEmail) == emailKey(email) && trip.EndTime == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Store) tripExists(id int64) bool {
+	for _, trip := range s.trips {
+		if trip.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) removeTrip(id int64) {
+	for i, trip := range s.trips {
+		if trip.ID == id {
+			s.trips = append(s.trips[:i], s.trips[i+1:]...)
+			s.deleteTripDependents(id)
+			return
+		}
+	}
+}
+
+// deleteTripDependents drops the rows that reference a trip with
+// ON DELETE CASCADE, and its telemetry.
+func (s *Store) deleteTripDependents(id int64) {
+	delete(s.payments, id)
+	delete(s.telemetry, id)
+	s.deleteDisputes(id)
+	s.unlinkReservations(id)
+	s.deleteTripUsage(func(usage models.TripUsage) bool {
+		return usage.TripID == id
+	})
+
+	reviews := s.reviews[:0]
+	for _, review := range s.reviews {
+		if review.TripID != id {
+			reviews = append(reviews, review)
+		}
+	}
+	s.reviews = reviews
+}
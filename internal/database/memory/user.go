@@ -0,0 +1,224 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type UserDB struct {
+	store *Store
+}
+
+func (db *UserDB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return models.User{}, database.ErrUserNotFound
+	}
+
+	return models.User{Email: user.Email, Password: user.Password, Role: user.Role}, nil
+}
+
+func (db *UserDB) GetUserDetails(ctx context.Context, email string) (models.User, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return models.User{
+		Email:           user.Email,
+		UserName:        user.UserName,
+		FullName:        user.FullName,
+		Role:            user.Role,
+		DrivingBehavior: user.DrivingBehavior,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+	}, nil
+}
+
+func (db *UserDB) UpdateUsername(ctx context.Context, email, username string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return nil
+	}
+
+	if db.store.usernameTaken(username, email) {
+		return database.ErrDuplicateUsername
+	}
+
+	user.UserName = username
+	db.store.users[emailKey(email)] = user
+	return nil
+}
+
+func (db *UserDB) UpdateFullname(ctx context.Context, email, full_name string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return nil
+	}
+
+	user.FullName = full_name
+	db.store.users[emailKey(email)] = user
+	return nil
+}
+
+func (db *UserDB) UpdatePassword(ctx context.Context, email, password string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+
+	user.Password = password
+	db.store.users[emailKey(email)] = user
+	return nil
+}
+
+func (db *UserDB) MarkEmailVerified(ctx context.Context, email string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	user, ok := db.store.users[emailKey(email)]
+	if !ok || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	verifiedAt := time.Now().UTC().Truncate(time.Second)
+	user.EmailVerifiedAt = &verifiedAt
+	db.store.users[emailKey(email)] = user
+	return nil
+}
+
+func (db *UserDB) UpdateDrivingBehavior(ctx context.Context, tx database.Tx, email string, drivingBehavior float64) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := emailKey(email)
+	user, ok := db.store.users[key]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+
+	// The MySQL backend counts the finished trips outside of the transaction,
+	// so a trip ended by a pending transaction is not part of the average yet.
+	var count int
+	for _, trip := range db.store.trips {
+		if emailKey(trip.UserEmail) == key && trip.EndTime != nil && !db.store.uncommittedEnds[trip.ID] {
+			count++
+		}
+	}
+
+	updatedDrivingBehavior := drivingBehavior
+	if user.DrivingBehavior != nil {
+		updatedDrivingBehavior = (*user.DrivingBehavior*float64(count) + drivingBehavior) / float64(count+1)
+	}
+
+	previous := user.DrivingBehavior
+	user.DrivingBehavior = &updatedDrivingBehavior
+	db.store.users[key] = user
+
+	db.store.track(tx, func() {
+		user := db.store.users[key]
+		user.DrivingBehavior = previous
+		db.store.users[key] = user
+	})
+
+	return nil
+}
+
+func (db *UserDB) CreateUser(ctx context.Context, email, username, full_name, password string) (models.User, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.users[emailKey(email)]; ok {
+		return models.User{}, database.ErrDuplicateEmail
+	}
+
+	if db.store.usernameTaken(username, "") {
+		return models.User{}, database.ErrDuplicateUsername
+	}
+
+	db.store.users[emailKey(email)] = models.User{
+		Email:     email,
+		UserName:  username,
+		FullName:  full_name,
+		Password:  password,
+		Role:      models.ClientRole,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	return models.User{
+		Email:    email,
+		UserName: username,
+		FullName: full_name,
+	}, nil
+}
+
+// DeleteUser removes the user along with every row that references it with
+// ON DELETE CASCADE in the MySQL schema.
+func (db *UserDB) DeleteUser(ctx context.Context, email string) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	key := emailKey(email)
+	if _, ok := db.store.users[key]; !ok {
+		return nil
+	}
+	delete(db.store.users, key)
+	delete(db.store.settings, key)
+	db.store.deleteSessions(key)
+	db.store.deleteUserTokens(key)
+	db.store.deleteIdempotentRequests(key)
+	db.store.deleteReservations(func(reservation *models.Reservation) bool {
+		return emailKey(reservation.UserEmail) == key
+	})
+
+	trips := db.store.trips[:0]
+	for _, trip := range db.store.trips {
+		if emailKey(trip.UserEmail) == key {
+			db.store.deleteTripDependents(trip.ID)
+			continue
+		}
+		trips = append(trips, trip)
+	}
+	db.store.trips = trips
+
+	subscriptions := db.store.userSubscriptions[:0]
+	for _, subscription := range db.store.userSubscriptions {
+		if emailKey(subscription.UserEmail) == key {
+			db.store.deleteSubscriptionCharges(subscription.ID)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	db.store.userSubscriptions = subscriptions
+
+	return nil
+}
+
+func (s *Store) usernameTaken(username, exceptEmail string) bool {
+	for key, user := range s.users {
+		if strings.EqualFold(user.UserName, username) && key != emailKey(exceptEmail) {
+			return true
+		}
+	}
+	return false
+}
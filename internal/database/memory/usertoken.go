@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type UserTokenDB struct {
+	store *Store
+}
+
+type userToken struct {
+	hash      string
+	email     string
+	purpose   models.TokenPurpose
+	expiresAt time.Time
+	used      bool
+}
+
+func (db *UserTokenDB) CreateToken(ctx context.Context, email string, purpose models.TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if _, ok := db.store.users[emailKey(email)]; !ok {
+		return database.ErrUserNotFound
+	}
+
+	for _, token := range db.store.userTokens {
+		if token.hash == tokenHash {
+			return ErrDuplicateEntry
+		}
+	}
+	for _, token := range db.store.userTokens {
+		if emailKey(token.email) == emailKey(email) && token.purpose == purpose {
+			token.used = true
+		}
+	}
+
+	db.store.userTokens = append(db.store.userTokens, &userToken{
+		hash:      tokenHash,
+		email:     email,
+		purpose:   purpose,
+		expiresAt: expiresAt,
+	})
+	return nil
+}
+
+func (db *UserTokenDB) ConsumeToken(ctx context.Context, purpose models.TokenPurpose, tokenHash string) (string, error) {
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	for _, token := range db.store.userTokens {
+		if token.hash != tokenHash || token.purpose != purpose {
+			continue
+		}
+		if token.used || !token.expiresAt.After(time.Now()) {
+			break
+		}
+		token.used = true
+		return token.email, nil
+	}
+
+	return "", database.ErrInvalidToken
+}
+
+// deleteUserTokens drops the tokens of a deleted user, like the
+// ON DELETE CASCADE on UserTokens.user_email.
+func (s *Store) deleteUserTokens(key string) {
+	tokens := s.userTokens[:0]
+	for _, token := range s.userTokens {
+		if emailKey(token.email) != key {
+			tokens = append(tokens, token)
+		}
+	}
+	s.userTokens = tokens
+}
@@ -3,31 +3,245 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type PaymentDB struct {
 	DB *sql.DB
 }
 
+var (
+	ErrPaymentNotFound          = fmt.Errorf("payment not found")
+	ErrInvalidPaymentTransition = fmt.Errorf("invalid payment status transition")
+	ErrRefundNotPending         = fmt.Errorf("refund is not pending")
+)
+
 func NewPaymentDB(db *sql.DB) *PaymentDB {
 	return &PaymentDB{DB: db}
 }
 
-func (db *PaymentDB) CreatePayment(tx *sql.Tx, tripID int, amount float64, payment_method string) error {
+func (db *PaymentDB) CreatePayment(ctx context.Context, tx Tx, tripID int, amount money.Amount, payment_method string, status models.PaymentStatus) error {
 	query := `
-		INSERT INTO Payments (trip_id, amount, payment_method, payment_time)
-		VALUES (?, ?, ?, NOW())
+		INSERT INTO Payments (trip_id, amount, payment_method, status, payment_time)
+		VALUES (?, ?, ?, ?, NOW())
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if tx != nil {
-		_, err := tx.ExecContext(ctx, query, tripID, amount, payment_method)
+	if tx := sqlTx(tx); tx != nil {
+		_, err := tx.ExecContext(ctx, query, tripID, amount, payment_method, status)
 		return err
 	}
 
-	_, err := db.DB.ExecContext(ctx, query, tripID, amount, payment_method)
+	_, err := db.DB.ExecContext(ctx, query, tripID, amount, payment_method, status)
 	return err
 }
+
+func (db *PaymentDB) GetPayment(ctx context.Context, tripID int) (models.Payment, error) {
+	query := `
+		SELECT trip_id, amount, payment_time, payment_method, status,
+			COALESCE(provider_reference, ''), COALESCE(failure_reason, ''), updated_at
+		FROM Payments
+		WHERE trip_id = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var payment models.Payment
+	err := db.DB.QueryRowContext(ctx, query, tripID).Scan(
+		&payment.TripID,
+		&payment.Amount,
+		&payment.PaymentTime,
+		&payment.PaymentMethod,
+		&payment.Status,
+		&payment.ProviderReference,
+		&payment.FailureReason,
+		&payment.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Payment{}, ErrPaymentNotFound
+		}
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// UpdatePaymentStatus moves the payment of a trip to status, provided that
+// its current status allows it. An empty reference keeps the provider
+// reference the payment has, and reason is only kept for failed payments.
+func (db *PaymentDB) UpdatePaymentStatus(ctx context.Context, tx Tx, tripID int, status models.PaymentStatus, reference, reason string) error {
+	from := models.PaymentStatusesBefore(status)
+	if len(from) == 0 {
+		return ErrInvalidPaymentTransition
+	}
+
+	args := []any{status, reference, reason, tripID}
+	for _, s := range from {
+		args = append(args, s)
+	}
+
+	query := `
+		UPDATE Payments
+		SET
+			status = ?,
+			provider_reference = COALESCE(NULLIF(?, ''), provider_reference),
+			failure_reason = NULLIF(?, '')
+		WHERE trip_id = ? AND status IN (?` + strings.Repeat(", ?", len(from)-1) + `)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	existsQuery := `SELECT EXISTS (SELECT 1 FROM Payments WHERE trip_id = ?)`
+	var exists bool
+	if tx := sqlTx(tx); tx != nil {
+		err = tx.QueryRowContext(ctx, existsQuery, tripID).Scan(&exists)
+	} else {
+		err = db.DB.QueryRowContext(ctx, existsQuery, tripID).Scan(&exists)
+	}
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrPaymentNotFound
+	}
+	return ErrInvalidPaymentTransition
+}
+
+// CreateRefund records a refund in the ledger.
+func (db *PaymentDB) CreateRefund(ctx context.Context, tx Tx, refund models.Refund) (models.Refund, error) {
+	query := `
+		INSERT INTO Refunds (trip_id, dispute_id, amount, status, provider_reference, created_by, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	refund.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	args := []any{refund.TripID, refund.DisputeID, refund.Amount, refund.Status, refund.ProviderReference, refund.CreatedBy, refund.CreatedAt}
+
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, args...)
+	}
+	if err != nil {
+		// Refunds.trip_id references Payments.trip_id
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return models.Refund{}, ErrPaymentNotFound
+		}
+		return models.Refund{}, err
+	}
+
+	refund.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	return refund, nil
+}
+
+// UpdateRefundStatus settles a pending refund once the provider answered.
+func (db *PaymentDB) UpdateRefundStatus(ctx context.Context, tx Tx, id int64, status models.RefundStatus) error {
+	query := `
+		UPDATE Refunds
+		SET status = ?
+		WHERE id = ? AND status = 'PENDING'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, status, id)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, status, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRefundNotPending
+	}
+
+	return nil
+}
+
+// GetRefunds returns the ledger entries of a trip's payment, oldest first.
+func (db *PaymentDB) GetRefunds(ctx context.Context, tripID int64) ([]models.Refund, error) {
+	query := `
+		SELECT id, trip_id, dispute_id, amount, status, COALESCE(provider_reference, ''), created_by, created_at
+		FROM Refunds
+		WHERE trip_id = ?
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []models.Refund
+	for rows.Next() {
+		var refund models.Refund
+		if err := rows.Scan(
+			&refund.ID,
+			&refund.TripID,
+			&refund.DisputeID,
+			&refund.Amount,
+			&refund.Status,
+			&refund.ProviderReference,
+			&refund.CreatedBy,
+			&refund.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// Tx is a unit of work shared by several repository calls. *sql.Tx satisfies
+// it, so the MySQL repositories can use the transaction they are handed
+// directly; other backends provide their own implementation.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+type Transactor interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+type UserRepository interface {
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	GetUserDetails(ctx context.Context, email string) (models.User, error)
+	UpdateUsername(ctx context.Context, email, username string) error
+	UpdateFullname(ctx context.Context, email, full_name string) error
+	UpdatePassword(ctx context.Context, email, password string) error
+	MarkEmailVerified(ctx context.Context, email string) error
+	UpdateDrivingBehavior(ctx context.Context, tx Tx, email string, drivingBehavior float64) error
+	CreateUser(ctx context.Context, email, username, full_name, password string) (models.User, error)
+	DeleteUser(ctx context.Context, email string) error
+}
+
+type RoleRepository interface {
+	GetPermissions(ctx context.Context, role string) ([]string, error)
+	HasPermission(ctx context.Context, role, permission string) (bool, error)
+	SetUserRole(ctx context.Context, email, role string) error
+	GetUsersWithPermission(ctx context.Context, permission string) ([]string, error)
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string) (models.Session, error)
+	GetSessions(ctx context.Context, email string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, email, id string) error
+	RevokeAllSessions(ctx context.Context, email, exceptID string) error
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	SessionActive(ctx context.Context, sessionID, jti string) (bool, error)
+}
+
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, email string, purpose models.TokenPurpose, tokenHash string, expiresAt time.Time) error
+	ConsumeToken(ctx context.Context, purpose models.TokenPurpose, tokenHash string) (string, error)
+}
+
+type IdempotencyRepository interface {
+	ReserveIdempotencyKey(ctx context.Context, request models.IdempotentRequest) (models.IdempotentRequest, error)
+	CompleteIdempotencyKey(ctx context.Context, request models.IdempotentRequest) error
+	ReleaseIdempotencyKey(ctx context.Context, email, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type CarRepository interface {
+	GetAllCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error)
+	GetAllAvailableCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error)
+	GetAllRentedCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error)
+	GetAllMaintenanceCars(ctx context.Context, page, pageSize int) ([]models.Car, int, error)
+	// SearchCars returns a page of the cars matching search, and how many
+	// match it in total. It fails with ErrInvalidCarSort for a sort field
+	// that is not whitelisted.
+	SearchCars(ctx context.Context, search models.CarSearch) ([]models.Car, int, error)
+	// GetAvailableCarsNear returns up to limit available cars within radius
+	// km of a position, the closest first.
+	GetAvailableCarsNear(ctx context.Context, latitude, longitude, radius float64, limit int) ([]models.NearbyCar, error)
+	GetCarByLicensePlate(ctx context.Context, licensePlate string) (models.Car, error)
+	// CountCarsByStatus returns how many cars there are in each status.
+	CountCarsByStatus(ctx context.Context) (map[models.Status]int, error)
+	InsertCar(ctx context.Context, car models.Car) error
+	ChangeCarStatus(ctx context.Context, tx Tx, licensePlate string, from, to models.Status) error
+	MoveCar(ctx context.Context, tx Tx, licensePlate string, latitude, longitude float64) error
+	UpdateCar(ctx context.Context, car models.Car) (models.Car, error)
+	DeleteCar(ctx context.Context, licensePlate string) (models.Car, error)
+	// InvalidateCars drops every cached listing of the cars.
+	InvalidateCars() error
+}
+
+type DamageRepository interface {
+	GetDamages(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Damage, int, error)
+	AddDamage(ctx context.Context, damage models.Damage) error
+	EditDamageState(ctx context.Context, license_plate string, repaired bool) error
+}
+
+type ServiceRepository interface {
+	GetServices(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Service, error)
+	GetTotalServices(ctx context.Context, license_plate string) (int, error)
+	AddService(ctx context.Context, service models.Service) error
+}
+
+type TripRepository interface {
+	GetAllTripsForCar(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Trip, error)
+	GetAllTripsForUser(ctx context.Context, email string, page, pageSize int) ([]models.PayloadTrip, int, error)
+	GetActiveTrip(ctx context.Context, email string) (models.Trip, error)
+	CountActiveTrips(ctx context.Context) (int, error)
+	CreateTrip(ctx context.Context, tx Tx, email, licensePlate string) error
+	EndTrip(ctx context.Context, tx Tx, tripID int64, endTime time.Time, distance, driving_behavior float64) error
+	FindActiveTripCar(ctx context.Context, email string) (int, string, money.Amount, error)
+	GetTripByID(ctx context.Context, id, email string) (models.PayloadTrip, models.Car, error)
+}
+
+type TelemetryRepository interface {
+	RecordTelemetry(ctx context.Context, tripID int64, points []models.TelemetryPoint) (int64, error)
+	GetTelemetry(ctx context.Context, tripID int64) ([]models.TelemetryPoint, error)
+}
+
+type ReservationRepository interface {
+	CreateReservation(ctx context.Context, reservation models.Reservation) (models.Reservation, error)
+	GetReservationsForUser(ctx context.Context, email string, page, pageSize int) ([]models.Reservation, int, error)
+	CancelReservation(ctx context.Context, email string, id int64) error
+	GetHeldReservation(ctx context.Context, licensePlate string, t time.Time) (models.Reservation, error)
+	FulfillReservation(ctx context.Context, tx Tx, id int64, email string) error
+	ExpireReservations(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type SettingRepository interface {
+	GetSettings(ctx context.Context, email string) (models.Settings, error)
+	CreateSettings(ctx context.Context, email string, settings models.Settings) error
+	UpdateSetting(ctx context.Context, email string, settings models.Settings) error
+}
+
+type ReviewRepository interface {
+	GetAllReviewsForCar(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Review, []string, int, error)
+	CreateReview(ctx context.Context, tripID, rating int, comment, email string) error
+}
+
+type PaymentRepository interface {
+	CreatePayment(ctx context.Context, tx Tx, tripID int, amount money.Amount, payment_method string, status models.PaymentStatus) error
+	GetPayment(ctx context.Context, tripID int) (models.Payment, error)
+	UpdatePaymentStatus(ctx context.Context, tx Tx, tripID int, status models.PaymentStatus, reference, reason string) error
+	CreateRefund(ctx context.Context, tx Tx, refund models.Refund) (models.Refund, error)
+	UpdateRefundStatus(ctx context.Context, tx Tx, id int64, status models.RefundStatus) error
+	GetRefunds(ctx context.Context, tripID int64) ([]models.Refund, error)
+}
+
+type DisputeRepository interface {
+	CreateDispute(ctx context.Context, dispute models.Dispute) (models.Dispute, error)
+	GetDispute(ctx context.Context, id int64) (models.Dispute, error)
+	GetDisputeForTrip(ctx context.Context, tripID int64) (models.Dispute, error)
+	GetDisputes(ctx context.Context, status models.DisputeStatus, page, pageSize int) ([]models.Dispute, int, error)
+	ResolveDispute(ctx context.Context, tx Tx, id int64, status models.DisputeStatus, resolvedBy, resolution string) error
+	// ReopenDispute moves an APPROVED dispute back to OPEN.
+	ReopenDispute(ctx context.Context, id int64, actor, note string) error
+}
+
+type SubscriptionRepository interface {
+	GetAllSubscriptions(ctx context.Context) ([]models.SubscriptionPlan, error)
+	GetActiveSubscription(ctx context.Context, email string) (models.UserSubscription, error)
+	CountActiveSubscriptions(ctx context.Context) (int, error)
+	// BuySubscription starts a subscription to the latest version of a plan
+	// along with its PENDING purchase charge.
+	BuySubscription(ctx context.Context, subscription models.UserSubscription) (models.UserSubscription, error)
+	CancelSubscription(ctx context.Context, email string, mode models.CancellationMode) (models.UserSubscription, error)
+	GetSubscriptionHistory(ctx context.Context, email string) ([]models.UserSubscription, error)
+	// GetDueRenewals returns the auto-renewing subscriptions that end before
+	// dueBefore and whose renewal may be attempted at now.
+	GetDueRenewals(ctx context.Context, dueBefore, now time.Time) ([]models.UserSubscription, error)
+	// ClaimRenewal defers the next renewal attempt of a subscription that
+	// ends at endDate and is due at now to until, or returns
+	// ErrSubscriptionChanged when it is no longer due.
+	ClaimRenewal(ctx context.Context, id int64, endDate, now, until time.Time) error
+	// ExtendSubscription moves the end of a subscription from from to to,
+	// on the plan version planID, and clears its grace period.
+	ExtendSubscription(ctx context.Context, id int64, from, to time.Time, planID int64) error
+	// DeferRenewal keeps a subscription whose renewal failed active until
+	// graceUntil and retries the renewal at retryAt, or stops renewing it
+	// when retryAt is nil.
+	DeferRenewal(ctx context.Context, id int64, graceUntil time.Time, retryAt *time.Time) error
+	DisableAutoRenew(ctx context.Context, id int64) error
+	CreateSubscriptionCharge(ctx context.Context, charge models.SubscriptionCharge) (models.SubscriptionCharge, error)
+	UpdateSubscriptionCharge(ctx context.Context, id int64, status models.PaymentStatus, reference, reason string) error
+	RecordTripUsage(ctx context.Context, tx Tx, usage models.TripUsage) error
+	// GetUsage sums the usage of a subscription recorded in [from, to).
+	GetUsage(ctx context.Context, subscriptionID int64, from, to time.Time) (models.UsageTotals, error)
+	GetPlans(ctx context.Context) ([]models.SubscriptionPlan, error)
+	GetPlanVersions(ctx context.Context, name string) ([]models.SubscriptionPlan, error)
+	CreatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error)
+	UpdatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error)
+	RetirePlan(ctx context.Context, name string) error
+}
+
+type SQLTransactor struct {
+	DB *sql.DB
+}
+
+func (t SQLTransactor) Begin(ctx context.Context) (Tx, error) {
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// sqlTx unwraps a Tx handed to one of the MySQL repositories. A nil Tx means
+// the statement runs outside of a transaction.
+func sqlTx(tx Tx) *sql.Tx {
+	if tx == nil {
+		return nil
+	}
+	sqlTx, ok := tx.(*sql.Tx)
+	if !ok {
+		panic("database: MySQL repository used with a transaction from another backend")
+	}
+	return sqlTx
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type ReservationDB struct {
+	DB *sql.DB
+}
+
+var (
+	ErrReservationNotFound  = fmt.Errorf("reservation not found")
+	ErrReservationOverlap   = fmt.Errorf("car is already reserved for part of this time window")
+	ErrReservationNotActive = fmt.Errorf("reservation is no longer active")
+	ErrCarNotReservable     = fmt.Errorf("car is under maintenance")
+)
+
+func NewReservationDB(db *sql.DB) *ReservationDB {
+	return &ReservationDB{DB: db}
+}
+
+const reservationColumns = `id, user_email, car_license_plate, start_time, end_time, status, trip_id, created_at`
+
+func scanReservation(row interface{ Scan(...any) error }) (models.Reservation, error) {
+	var reservation models.Reservation
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.UserEmail,
+		&reservation.CarLicensePlate,
+		&reservation.StartTime,
+		&reservation.EndTime,
+		&reservation.Status,
+		&reservation.TripID,
+		&reservation.CreatedAt,
+	)
+	return reservation, err
+}
+
+// CreateReservation books the car for the reservation's window. The car row
+// is locked while checking for overlaps, so concurrent bookings of the same
+// car cannot both succeed.
+func (db *ReservationDB) CreateReservation(ctx context.Context, reservation models.Reservation) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	var status models.Status
+	err = tx.QueryRowContext(ctx, `
+		SELECT license_plate, status
+		FROM Cars
+		WHERE license_plate = ?
+		FOR UPDATE
+	`, reservation.CarLicensePlate).Scan(&reservation.CarLicensePlate, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Reservation{}, ErrCarNotFound
+		}
+		return models.Reservation{}, err
+	}
+	// A car in use now may still be booked for later: the overlap check
+	// below protects the window. Cars under maintenance cannot be booked.
+	if status == models.Maintenance {
+		return models.Reservation{}, ErrCarNotReservable
+	}
+
+	now := time.Now().UTC()
+
+	// Active reservations past their no-show grace period no longer count,
+	// even if they have not been marked as expired yet.
+	var overlapping bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM Reservations
+			WHERE car_license_plate = ? AND status = 'ACTIVE' AND start_time >= ?
+			AND start_time < ? AND end_time > ?
+		)
+	`,
+		reservation.CarLicensePlate,
+		now.Add(-models.ReservationNoShowGrace),
+		reservation.EndTime.UTC(),
+		reservation.StartTime.UTC(),
+	).Scan(&overlapping)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+	if overlapping {
+		return models.Reservation{}, ErrReservationOverlap
+	}
+
+	reservation.Status = models.ReservationActive
+	reservation.CreatedAt = now.Truncate(time.Second)
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO
+		Reservations (user_email, car_license_plate, start_time, end_time, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		reservation.UserEmail,
+		reservation.CarLicensePlate,
+		reservation.StartTime.UTC(),
+		reservation.EndTime.UTC(),
+		reservation.Status,
+		reservation.CreatedAt,
+	)
+	if err != nil {
+		// Reservations.user_email references Users.email
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return models.Reservation{}, ErrUserNotFound
+		}
+		return models.Reservation{}, err
+	}
+
+	reservation.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	return reservation, nil
+}
+
+func (db *ReservationDB) GetReservationsForUser(ctx context.Context, email string, page, pageSize int) ([]models.Reservation, int, error) {
+	offset := (page - 1) * pageSize
+
+	query := `
+		SELECT ` + reservationColumns + `,
+		COUNT(*) OVER() as total_reservations
+		FROM Reservations
+		WHERE user_email = ?
+		ORDER BY start_time DESC
+		LIMIT ? OFFSET ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, email, pageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var reservations []models.Reservation
+	var totalReservations int
+	for rows.Next() {
+		var reservation models.Reservation
+		if err := rows.Scan(
+			&reservation.ID,
+			&reservation.UserEmail,
+			&reservation.CarLicensePlate,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.Status,
+			&reservation.TripID,
+			&reservation.CreatedAt,
+			&totalReservations,
+		); err != nil {
+			return nil, 0, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	return reservations, totalReservations, rows.Err()
+}
+
+func (db *ReservationDB) CancelReservation(ctx context.Context, email string, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE Reservations
+		SET status = 'CANCELLED'
+		WHERE id = ? AND user_email = ? AND status = 'ACTIVE'
+	`, id, email)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = db.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM Reservations WHERE id = ? AND user_email = ?)
+	`, id, email).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrReservationNotFound
+	}
+	return ErrReservationNotActive
+}
+
+// GetHeldReservation returns the active reservation that holds the car at t,
+// see models.Reservation.HeldAt.
+func (db *ReservationDB) GetHeldReservation(ctx context.Context, licensePlate string, t time.Time) (models.Reservation, error) {
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM Reservations
+		WHERE car_license_plate = ? AND status = 'ACTIVE' AND start_time <= ? AND start_time > ?
+		ORDER BY start_time
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	reservation, err := scanReservation(db.DB.QueryRowContext(ctx, query,
+		licensePlate,
+		t.UTC().Add(models.ReservationHoldLead),
+		t.UTC().Add(-models.ReservationNoShowGrace),
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Reservation{}, ErrReservationNotFound
+		}
+		return models.Reservation{}, err
+	}
+
+	return reservation, nil
+}
+
+// FulfillReservation links the reservation to the active trip of email,
+// which must have been created in tx.
+func (db *ReservationDB) FulfillReservation(ctx context.Context, tx Tx, id int64, email string) error {
+	query := `
+		UPDATE Reservations
+		SET status = 'FULFILLED', trip_id = (
+			SELECT id
+			FROM Trips
+			WHERE user_email = ? AND end_time IS NULL
+			ORDER BY id DESC
+			LIMIT 1
+		)
+		WHERE id = ? AND status = 'ACTIVE'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, email, id)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, email, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReservationNotActive
+	}
+
+	return nil
+}
+
+// ExpireReservations marks the active reservations that started before
+// cutoff as expired and returns how many there were.
+func (db *ReservationDB) ExpireReservations(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE Reservations
+		SET status = 'EXPIRED'
+		WHERE status = 'ACTIVE' AND start_time < ?
+	`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
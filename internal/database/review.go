@@ -3,70 +3,126 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/ntentasd/db-deliverable3/internal/cache"
 	"github.com/ntentasd/db-deliverable3/internal/models"
 )
 
 type ReviewDB struct {
 	DB *sql.DB
+
+	// pages caches the pages of reviews of every car, which a new review
+	// invalidates.
+	pages *cache.Loader[reviewPage]
+	// logger logs the failures that do not fail the calls.
+	logger *slog.Logger
+}
+
+// reviewPage is a cached page of the reviews of a car.
+type reviewPage struct {
+	Reviews []models.Review
+	Emails  []string
+	Count   int
+}
+
+// reviewNegativeTTL is how long a car is known not to exist. A car added in
+// the meantime gets its reviews listed once it runs out.
+const reviewNegativeTTL = 30 * time.Second
+
+func NewReviewDB(db *sql.DB, c cache.Cache, options cache.Options, logger *slog.Logger) *ReviewDB {
+	options.NotFound = ErrCarNotFound
+	options.NegativeTTL = reviewNegativeTTL
+	return &ReviewDB{DB: db, pages: cache.NewLoader[reviewPage](c, "reviews", options), logger: logger}
 }
 
-func NewReviewDB(db *sql.DB) *ReviewDB {
-	return &ReviewDB{DB: db}
+func (db *ReviewDB) GetAllReviewsForCar(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Review, []string, int, error) {
+	key := fmt.Sprintf("car=%s:page=%d:size=%d", strings.ToUpper(licensePlate), page, pageSize)
+	reviews, err := db.pages.Get(ctx, key, func(ctx context.Context) (reviewPage, error) {
+		return db.queryReviewsForCar(ctx, licensePlate, page, pageSize)
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return reviews.Reviews, reviews.Emails, reviews.Count, nil
 }
 
-func (db *ReviewDB) GetAllReviewsForCar(licensePlate string, page, pageSize int) ([]models.Review, []string, int, error) {
+// queryReviewsForCar reads a page of the reviews of the car, or
+// ErrCarNotFound if there is no such car.
+func (db *ReviewDB) queryReviewsForCar(ctx context.Context, licensePlate string, page, pageSize int) (reviewPage, error) {
 	var count int
 	offset := (page - 1) * pageSize
 
 	query := `
-		SELECT r.trip_id, r.rating, r.comment, r.created_at, t.user_email, COUNT(*) as review_count
+		SELECT r.trip_id, r.rating, r.comment, r.created_at, t.user_email,
+		COUNT(*) OVER() as review_count
 		FROM Reviews r
 		LEFT JOIN Trips t
 		ON r.trip_id = t.id
 		WHERE t.car_license_plate = ?
-		GROUP BY r.trip_id, r.rating, r.comment, r.created_at, t.user_email
 		LIMIT ? OFFSET ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := db.DB.QueryContext(ctx, query, licensePlate, pageSize, offset)
 	if err != nil {
-		return nil, nil, 0, err
+		return reviewPage{}, err
 	}
 	defer rows.Close()
 
-	var reviews []models.Review
-	var emails []string
+	var reviews reviewPage
 	for rows.Next() {
 		var review models.Review
 		var email string
 		if err := rows.Scan(
 			&review.TripID, &review.Rating, &review.Comment, &review.CreatedAt, &email, &count,
 		); err != nil {
-			if err == sql.ErrNoRows {
-				return nil, nil, 0, ErrCarNotFound
-			}
-			return nil, nil, 0, err
+			return reviewPage{}, err
 		}
-		reviews = append(reviews, review)
-		emails = append(emails, email)
+		reviews.Reviews = append(reviews.Reviews, review)
+		reviews.Emails = append(reviews.Emails, email)
 	}
-	return reviews, emails, count, nil
+	if err := rows.Err(); err != nil {
+		return reviewPage{}, err
+	}
+	reviews.Count = count
+
+	if len(reviews.Reviews) == 0 {
+		var exists bool
+		err := db.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM Cars WHERE license_plate = ?)`, licensePlate).Scan(&exists)
+		if err != nil {
+			return reviewPage{}, err
+		}
+		if !exists {
+			return reviewPage{}, ErrCarNotFound
+		}
+	}
+
+	return reviews, nil
 }
 
-func (db *ReviewDB) CreateReview(tripID, rating int, comment, email string) error {
+func (db *ReviewDB) CreateReview(ctx context.Context, tripID, rating int, comment, email string) error {
 	reviewQuery := `
 		INSERT INTO Reviews (trip_id, rating, comment, created_at)
 		VALUES (?, ?, ?, NOW())
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := db.DB.ExecContext(ctx, reviewQuery, tripID, rating, comment)
-	return err
+	if _, err := db.DB.ExecContext(ctx, reviewQuery, tripID, rating, comment); err != nil {
+		return err
+	}
+
+	// Failing to invalidate leaves the review out of the cached pages until
+	// they expire, which does not undo it.
+	if err := db.pages.Invalidate(); err != nil {
+		db.logger.ErrorContext(ctx, "Failed to invalidate the cached reviews", "error", err)
+	}
+	return nil
 }
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type RoleDB struct {
+	DB *sql.DB
+}
+
+var (
+	ErrRoleNotFound = fmt.Errorf("role not found")
+)
+
+func NewRoleDB(db *sql.DB) *RoleDB {
+	return &RoleDB{DB: db}
+}
+
+func (db *RoleDB) GetPermissions(ctx context.Context, role string) ([]string, error) {
+	query := `
+		SELECT permission_name
+		FROM RolePermissions
+		WHERE role_name = ?
+		ORDER BY permission_name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (db *RoleDB) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM RolePermissions
+			WHERE role_name = ? AND permission_name = ?
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var allowed bool
+	if err := db.DB.QueryRowContext(ctx, query, role, permission).Scan(&allowed); err != nil {
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+func (db *RoleDB) SetUserRole(ctx context.Context, email, role string) error {
+	query := `
+		UPDATE Users
+		SET role_name = ?
+		WHERE email = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, query, role, email)
+	if err != nil {
+		// Users.role_name references Roles.name
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		err := db.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM Users WHERE email = ?)`, email).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+	}
+
+	return nil
+}
+
+// GetUsersWithPermission returns the emails of the users whose role holds
+// permission.
+func (db *RoleDB) GetUsersWithPermission(ctx context.Context, permission string) ([]string, error) {
+	query := `
+		SELECT u.email
+		FROM Users u
+		JOIN RolePermissions rp
+		ON rp.role_name = u.role_name
+		WHERE rp.permission_name = ?
+		ORDER BY u.email
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, permission)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
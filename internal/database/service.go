@@ -18,7 +18,7 @@ func NewServiceDB(db *sql.DB) *ServiceDB {
 }
 
 // GetServicesByLicensePlate retrieves all services for a specific car
-func (db *ServiceDB) GetServices(licensePlate string, page, pageSize int) ([]models.Service, error) {
+func (db *ServiceDB) GetServices(ctx context.Context, licensePlate string, page, pageSize int) ([]models.Service, error) {
 	offset := (page - 1) * pageSize
 
 	query := `
@@ -28,7 +28,7 @@ func (db *ServiceDB) GetServices(licensePlate string, page, pageSize int) ([]mod
 		LIMIT ? OFFSET ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := db.DB.QueryContext(ctx, query, licensePlate, pageSize, offset)
@@ -54,7 +54,7 @@ func (db *ServiceDB) GetServices(licensePlate string, page, pageSize int) ([]mod
 	return services, nil
 }
 
-func (db *ServiceDB) GetTotalServices(license_plate string) (int, error) {
+func (db *ServiceDB) GetTotalServices(ctx context.Context, license_plate string) (int, error) {
 	var count int
 	query := `
 		SELECT COUNT(*)
@@ -62,7 +62,7 @@ func (db *ServiceDB) GetTotalServices(license_plate string) (int, error) {
 		WHERE car_license_plate = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := db.DB.QueryRowContext(ctx, query, license_plate).Scan(&count)
@@ -73,13 +73,16 @@ func (db *ServiceDB) GetTotalServices(license_plate string) (int, error) {
 }
 
 // AddService adds a new service entry to the database
-func (db *ServiceDB) AddService(service models.Service) error {
+func (db *ServiceDB) AddService(ctx context.Context, service models.Service) error {
 	query := `
 		INSERT INTO Services (car_license_plate, description, service_date, service_cost) 
 		VALUES (?, ?, ?, ?)
 	`
 
-	_, err := db.DB.Exec(query,
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, query,
 		service.CarLicensePlate,
 		service.Description,
 		service.ServiceDate,
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type SessionDB struct {
+	DB *sql.DB
+}
+
+var (
+	ErrSessionNotFound = fmt.Errorf("session not found")
+	ErrSessionExpired  = fmt.Errorf("session has expired or has been revoked")
+)
+
+func NewSessionDB(db *sql.DB) *SessionDB {
+	return &SessionDB{DB: db}
+}
+
+func (db *SessionDB) CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error {
+	query := `
+		INSERT INTO
+		Sessions (id, user_email, refresh_token_hash, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, query,
+		session.ID,
+		session.UserEmail,
+		refreshTokenHash,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		// Sessions.user_email references Users.email
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RotateRefreshToken replaces the refresh token of the session it belongs to
+// and returns that session. The old token stops working even if the caller
+// fails to deliver the new one.
+func (db *SessionDB) RotateRefreshToken(ctx context.Context, oldHash, newHash string) (models.Session, error) {
+	now := time.Now().UTC()
+
+	query := `
+		UPDATE Sessions
+		SET refresh_token_hash = ?, last_used_at = ?
+		WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, query, newHash, now, oldHash, now)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return models.Session{}, err
+	}
+	if affected == 0 {
+		return models.Session{}, ErrSessionExpired
+	}
+
+	var session models.Session
+	err = db.DB.QueryRowContext(ctx, `
+		SELECT id, user_email, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM Sessions
+		WHERE refresh_token_hash = ?
+	`, newHash).Scan(
+		&session.ID,
+		&session.UserEmail,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// GetSessions returns the sessions of email that can still be refreshed,
+// most recently used first.
+func (db *SessionDB) GetSessions(ctx context.Context, email string) ([]models.Session, error) {
+	query := `
+		SELECT id, user_email, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM Sessions
+		WHERE user_email = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, email, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserEmail,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the session with id if it belongs to email. Access
+// tokens issued for it are rejected from then on.
+func (db *SessionDB) RevokeSession(ctx context.Context, email, id string) error {
+	query := `
+		UPDATE Sessions
+		SET revoked_at = ?
+		WHERE id = ? AND user_email = ? AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, query, time.Now().UTC(), id, email)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeAllSessions revokes every session of email except the one with
+// exceptID, which may be empty.
+func (db *SessionDB) RevokeAllSessions(ctx context.Context, email, exceptID string) error {
+	query := `
+		UPDATE Sessions
+		SET revoked_at = ?
+		WHERE user_email = ? AND id <> ? AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, query, time.Now().UTC(), email, exceptID)
+	return err
+}
+
+// RevokeToken rejects the access token with jti until it expires on its own.
+func (db *SessionDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Tokens past their expiry are rejected anyway, so forget about them.
+	_, err := db.DB.ExecContext(ctx, `DELETE FROM RevokedTokens WHERE expires_at < ?`, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.ExecContext(ctx, `
+		INSERT IGNORE INTO
+		RevokedTokens (jti, expires_at)
+		VALUES (?, ?)
+	`, jti, expiresAt.UTC())
+	return err
+}
+
+// SessionActive reports whether an access token with jti, issued for the
+// session with sessionID, may still be used.
+func (db *SessionDB) SessionActive(ctx context.Context, sessionID, jti string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM Sessions s
+			WHERE s.id = ? AND s.revoked_at IS NULL AND s.expires_at > ?
+			AND NOT EXISTS (SELECT 1 FROM RevokedTokens r WHERE r.jti = ?)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var active bool
+	if err := db.DB.QueryRowContext(ctx, query, sessionID, time.Now().UTC(), jti).Scan(&active); err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
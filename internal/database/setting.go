@@ -23,7 +23,7 @@ var (
 	ErrSettingsNotFound = fmt.Errorf("settings not found")
 )
 
-func (db *SettingDB) GetSettings(email string) (models.Settings, error) {
+func (db *SettingDB) GetSettings(ctx context.Context, email string) (models.Settings, error) {
 	var settings models.Settings
 
 	query := `
@@ -32,7 +32,7 @@ func (db *SettingDB) GetSettings(email string) (models.Settings, error) {
 		WHERE user_email = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var engineStartStop []byte
@@ -68,7 +68,7 @@ func (db *SettingDB) GetSettings(email string) (models.Settings, error) {
 	return settings, nil
 }
 
-func (db *SettingDB) CreateSettings(email string, settings models.Settings) error {
+func (db *SettingDB) CreateSettings(ctx context.Context, email string, settings models.Settings) error {
 	query := `
 		INSERT INTO UserSettings (
 			user_email, seat_position_horizontal, seat_position_vertical,
@@ -80,7 +80,7 @@ func (db *SettingDB) CreateSettings(email string, settings models.Settings) erro
 	engine_start_stop := boolToInt(settings.EngineStartStop)
 	cruise_control := boolToInt(settings.CruiseControl)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query, email, settings.SeatPositionHorizontal, settings.SeatPositionVertical,
@@ -90,7 +90,7 @@ func (db *SettingDB) CreateSettings(email string, settings models.Settings) erro
 	return err
 }
 
-func (db *SettingDB) UpdateSetting(email string, settings models.Settings) error {
+func (db *SettingDB) UpdateSetting(ctx context.Context, email string, settings models.Settings) error {
 	queryBuilder := strings.Builder{}
 	queryBuilder.WriteString("UPDATE usersettings SET ")
 
@@ -128,7 +128,7 @@ func (db *SettingDB) UpdateSetting(email string, settings models.Settings) error
 	query += " WHERE user_email = ?"
 	params = append(params, email)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query, params...)
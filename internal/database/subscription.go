@@ -4,13 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/cache"
 	"github.com/ntentasd/db-deliverable3/internal/models"
 )
 
 type SubscriptionDB struct {
 	DB *sql.DB
+
+	// plans caches the plans on sale, which a change to any plan
+	// invalidates.
+	plans *cache.Loader[[]models.SubscriptionPlan]
+	// logger logs the failures that do not fail the calls.
+	logger *slog.Logger
 }
 
 var (
@@ -18,156 +29,876 @@ var (
 	ErrUserSubscriptionNotFound       = fmt.Errorf("no subscription found")
 	ErrAlreadyActibeSubscriptionError = fmt.Errorf("there is an already active subscription")
 	ErrActiveSubscriptionNotFound     = fmt.Errorf("there is no active subscription")
+	ErrPlanNotFound                   = fmt.Errorf("subscription plan not found")
+	ErrPlanExists                     = fmt.Errorf("subscription plan already exists")
+	ErrPlanRetired                    = fmt.Errorf("subscription plan is retired")
+	ErrSubscriptionChanged            = fmt.Errorf("subscription changed")
+	ErrSubscriptionChargeNotFound     = fmt.Errorf("subscription charge not found")
 )
 
-func NewSubscriptionDB(db *sql.DB) *SubscriptionDB {
-	return &SubscriptionDB{DB: db}
+const planColumns = `id, name, version, description, duration_months, price_per_month,
+	included_km, included_minutes, km_discount, overage_per_km, overage_per_minute,
+	categories, visible_from, visible_until, retired_at, created_by, created_at`
+
+// latestPlans keeps the latest version of every plan.
+const latestPlans = `
+	version = (SELECT MAX(v.version) FROM SubscriptionPlans v WHERE v.name = SubscriptionPlans.name)
+`
+
+func NewSubscriptionDB(db *sql.DB, c cache.Cache, options cache.Options, logger *slog.Logger) *SubscriptionDB {
+	return &SubscriptionDB{DB: db, plans: cache.NewLoader[[]models.SubscriptionPlan](c, "plans", options), logger: logger}
 }
 
-func (db *SubscriptionDB) GetAllSubscriptions() ([]models.Subscription, error) {
-	query := `
-		SELECT *
-		FROM Subscriptions
-	`
+// plansChanged drops the cached plans on sale. A failure leaves them stale
+// until they expire, which does not undo the change.
+func (db *SubscriptionDB) plansChanged(ctx context.Context) {
+	if err := db.plans.Invalidate(); err != nil {
+		db.logger.ErrorContext(ctx, "Failed to invalidate the cached plans", "error", err)
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	rows, err := db.DB.QueryContext(ctx, query)
+func scanPlan(row rowScanner) (models.SubscriptionPlan, error) {
+	var plan models.SubscriptionPlan
+	var description, createdBy sql.NullString
+	var categories string
+	err := row.Scan(
+		&plan.ID,
+		&plan.Name,
+		&plan.Version,
+		&description,
+		&plan.DurationMonths,
+		&plan.PricePerMonth,
+		&plan.IncludedKm,
+		&plan.IncludedMinutes,
+		&plan.KmDiscount,
+		&plan.OveragePerKm,
+		&plan.OveragePerMinute,
+		&categories,
+		&plan.VisibleFrom,
+		&plan.VisibleUntil,
+		&plan.RetiredAt,
+		&createdBy,
+		&plan.CreatedAt,
+	)
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	plan.Description = description.String
+	plan.CreatedBy = createdBy.String
+	for _, category := range strings.Split(categories, ",") {
+		if category != "" {
+			plan.Categories = append(plan.Categories, models.Category(category))
+		}
+	}
+
+	return plan, nil
+}
+
+func (db *SubscriptionDB) queryPlans(ctx context.Context, query string, args ...any) ([]models.SubscriptionPlan, error) {
+	rows, err := db.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var subscriptions []models.Subscription
+	var plans []models.SubscriptionPlan
 	for rows.Next() {
-		var subscription models.Subscription
-		if err := rows.Scan(
-			&subscription.Name,
-			&subscription.PricePerMonth,
-			&subscription.Description,
-		); err != nil {
+		plan, err := scanPlan(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		subscriptions = append(subscriptions, subscription)
+		plans = append(plans, plan)
 	}
 
-	return subscriptions, nil
+	return plans, rows.Err()
+}
+
+// GetAllSubscriptions returns the plans that can be bought now, in their
+// latest version. They are cached, so a plan whose visibility window opens
+// or closes is listed, or not, until the cached plans are refreshed.
+func (db *SubscriptionDB) GetAllSubscriptions(ctx context.Context) ([]models.SubscriptionPlan, error) {
+	return db.plans.Get(ctx, "on-sale", db.queryPlansOnSale)
 }
 
-func (db *SubscriptionDB) GetActiveSubscription(email string) (models.UserSubscription, error) {
+func (db *SubscriptionDB) queryPlansOnSale(ctx context.Context) ([]models.SubscriptionPlan, error) {
 	query := `
-		SELECT id, subscription_name, start_date, end_date, is_cancelled
-		FROM UserSubscriptions
-		WHERE user_email = ?
-		AND is_cancelled = 0
-		AND end_date > NOW()
+		SELECT ` + planColumns + `
+		FROM SubscriptionPlans
+		WHERE ` + latestPlans + `
+		AND retired_at IS NULL
+		AND (visible_from IS NULL OR visible_from <= ?)
+		AND (visible_until IS NULL OR visible_until > ?)
+		ORDER BY duration_months, name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	return db.queryPlans(ctx, query, now, now)
+}
+
+// GetPlans returns the latest version of every plan, retired ones included.
+func (db *SubscriptionDB) GetPlans(ctx context.Context) ([]models.SubscriptionPlan, error) {
+	query := `
+		SELECT ` + planColumns + `
+		FROM SubscriptionPlans
+		WHERE ` + latestPlans + `
+		ORDER BY duration_months, name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return db.queryPlans(ctx, query)
+}
+
+// GetPlanVersions returns every version of the plan, the latest first.
+func (db *SubscriptionDB) GetPlanVersions(ctx context.Context, name string) ([]models.SubscriptionPlan, error) {
+	query := `
+		SELECT ` + planColumns + `
+		FROM SubscriptionPlans
+		WHERE name = ?
+		ORDER BY version DESC
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	plans, err := db.queryPlans(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, ErrPlanNotFound
+	}
+
+	return plans, nil
+}
+
+func (db *SubscriptionDB) insertPlan(ctx context.Context, tx *sql.Tx, plan models.SubscriptionPlan) (models.SubscriptionPlan, error) {
+	categories := make([]string, len(plan.Categories))
+	for i, category := range plan.Categories {
+		categories[i] = string(category)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO
+		SubscriptionPlans (name, version, description, duration_months, price_per_month,
+			included_km, included_minutes, km_discount, overage_per_km, overage_per_minute,
+			categories, visible_from, visible_until, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, plan.Name, plan.Version, plan.Description, plan.DurationMonths, plan.PricePerMonth,
+		plan.IncludedKm, plan.IncludedMinutes, plan.KmDiscount, plan.OveragePerKm, plan.OveragePerMinute,
+		strings.Join(categories, ","),
+		plan.VisibleFrom, plan.VisibleUntil, plan.CreatedBy, plan.CreatedAt.UTC())
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	plan.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	return plan, nil
+}
+
+// CreatePlan adds the first version of a plan.
+func (db *SubscriptionDB) CreatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	defer tx.Rollback()
+
+	plan.Version = 1
+	plan.RetiredAt = nil
+	plan, err = db.insertPlan(ctx, tx, plan)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			return models.SubscriptionPlan{}, ErrPlanExists
+		}
+		return models.SubscriptionPlan{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	db.plansChanged(ctx)
+	return plan, nil
+}
+
+// UpdatePlan adds a new version of the plan with the terms of plan. The
+// versions bought before keep their terms.
+func (db *SubscriptionDB) UpdatePlan(ctx context.Context, plan models.SubscriptionPlan) (models.SubscriptionPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the latest version makes concurrent edits wait for each other.
+	var version int
+	var retiredAt *time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT version, retired_at
+		FROM SubscriptionPlans
+		WHERE name = ?
+		ORDER BY version DESC
+		LIMIT 1
+		FOR UPDATE
+	`, plan.Name).Scan(&version, &retiredAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.SubscriptionPlan{}, ErrPlanNotFound
+		}
+		return models.SubscriptionPlan{}, err
+	}
+	if retiredAt != nil {
+		return models.SubscriptionPlan{}, ErrPlanRetired
+	}
+
+	plan.Version = version + 1
+	plan.RetiredAt = nil
+	plan, err = db.insertPlan(ctx, tx, plan)
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	db.plansChanged(ctx)
+	return plan, nil
+}
+
+// RetirePlan stops the plan from being sold. Existing subscriptions to it
+// run until they end.
+func (db *SubscriptionDB) RetirePlan(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE SubscriptionPlans
+		SET retired_at = ?
+		WHERE name = ? AND retired_at IS NULL
+	`, time.Now().UTC(), name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		db.plansChanged(ctx)
+		return nil
+	}
+
+	var exists bool
+	err = db.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM SubscriptionPlans WHERE name = ?)`, name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrPlanNotFound
+	}
+	return ErrPlanRetired
+}
+
+const userSubscriptionColumns = `id, user_email, subscription_name, plan_id, start_date,
+	end_date, is_cancelled, auto_renew, cancel_at_period_end, cancelled_at, payment_method,
+	grace_until, next_renewal_attempt`
+
+// activeSubscription matches the subscriptions that cover trips: those not
+// cancelled that have not ended yet or are in their grace period.
+const activeSubscription = `is_cancelled = 0 AND (end_date > NOW() OR grace_until > NOW())`
+
+const subscriptionChargeColumns = `id, user_subscription_id, kind, plan_id, amount, payment_method,
+	status, provider_reference, failure_reason, period_end, created_at, updated_at`
+
+func scanUserSubscription(row rowScanner) (models.UserSubscription, error) {
 	var subscription models.UserSubscription
-	var isCancelled []byte
-	err := db.DB.QueryRowContext(ctx, query, email).Scan(
+	var isCancelled, autoRenew, cancelAtPeriodEnd []byte
+	err := row.Scan(
 		&subscription.ID,
+		&subscription.UserEmail,
 		&subscription.SubscriptionName,
+		&subscription.PlanID,
 		&subscription.StartDate,
 		&subscription.EndDate,
 		&isCancelled,
+		&autoRenew,
+		&cancelAtPeriodEnd,
+		&subscription.CancelledAt,
+		&subscription.PaymentMethod,
+		&subscription.GraceUntil,
+		&subscription.NextRenewalAttempt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.UserSubscription{}, ErrUserSubscriptionNotFound
-		}
 		return models.UserSubscription{}, err
 	}
 
 	subscription.IsCancelled = isCancelled[0] == 1
+	subscription.AutoRenew = autoRenew[0] == 1
+	subscription.CancelAtPeriodEnd = cancelAtPeriodEnd[0] == 1
 
 	return subscription, nil
 }
 
-func (db *SubscriptionDB) BuySubscription(email, subscription_name string) (time.Time, error) {
-	checkActiveQuery := `
-		SELECT COUNT(*)
+func scanSubscriptionCharge(row rowScanner) (models.SubscriptionCharge, error) {
+	var charge models.SubscriptionCharge
+	var reference, reason sql.NullString
+	err := row.Scan(
+		&charge.ID,
+		&charge.UserSubscriptionID,
+		&charge.Kind,
+		&charge.PlanID,
+		&charge.Amount,
+		&charge.PaymentMethod,
+		&charge.Status,
+		&reference,
+		&reason,
+		&charge.PeriodEnd,
+		&charge.CreatedAt,
+		&charge.UpdatedAt,
+	)
+	if err != nil {
+		return models.SubscriptionCharge{}, err
+	}
+
+	charge.ProviderReference = reference.String
+	charge.FailureReason = reason.String
+
+	return charge, nil
+}
+
+// withPlans fills in the plan version of every subscription.
+func (db *SubscriptionDB) withPlans(ctx context.Context, subscriptions []models.UserSubscription) error {
+	plans := make(map[int64]*models.SubscriptionPlan)
+	for i := range subscriptions {
+		id := subscriptions[i].PlanID
+		if plans[id] == nil {
+			plan, err := scanPlan(db.DB.QueryRowContext(ctx, `
+				SELECT `+planColumns+`
+				FROM SubscriptionPlans
+				WHERE id = ?
+			`, id))
+			if err != nil {
+				return err
+			}
+			plans[id] = &plan
+		}
+		subscriptions[i].Plan = plans[id]
+	}
+	return nil
+}
+
+func (db *SubscriptionDB) querySubscriptions(ctx context.Context, query string, args ...any) ([]models.UserSubscription, error) {
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.UserSubscription
+	for rows.Next() {
+		subscription, err := scanUserSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, db.withPlans(ctx, subscriptions)
+}
+
+func (db *SubscriptionDB) CountActiveSubscriptions(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM UserSubscriptions WHERE `+activeSubscription).Scan(&count)
+	return count, err
+}
+
+func (db *SubscriptionDB) GetActiveSubscription(ctx context.Context, email string) (models.UserSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	subscriptions, err := db.querySubscriptions(ctx, `
+		SELECT `+userSubscriptionColumns+`
 		FROM UserSubscriptions
-		WHERE user_email = ?
-		AND is_cancelled = 0
-		AND end_date > NOW()
-	`
+		WHERE user_email = ? AND `+activeSubscription+`
+		ORDER BY end_date DESC
+		LIMIT 1
+	`, email)
+	if err != nil {
+		return models.UserSubscription{}, err
+	}
+	if len(subscriptions) == 0 {
+		return models.UserSubscription{}, ErrUserSubscriptionNotFound
+	}
 
-	query := `
-		INSERT INTO
-		UserSubscriptions (user_email, start_date, end_date, is_cancelled)
-		VALUES (?, ?, ?, ?)
-	`
+	return subscriptions[0], nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (db *SubscriptionDB) BuySubscription(ctx context.Context, subscription models.UserSubscription) (models.UserSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	var activeCount int
-	err := db.DB.QueryRowContext(ctx, checkActiveQuery, email).Scan(&activeCount)
+	tx, err := db.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return time.Time{}, err
+		return models.UserSubscription{}, err
 	}
+	defer tx.Rollback()
 
-	if activeCount > 0 {
-		return time.Time{}, ErrAlreadyActibeSubscriptionError
+	// Locking the user makes concurrent purchases wait for each other, so
+	// that only one of them finds no active subscription.
+	err = tx.QueryRowContext(ctx, `
+		SELECT email
+		FROM Users
+		WHERE email = ?
+		FOR UPDATE
+	`, subscription.UserEmail).Scan(&subscription.UserEmail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.UserSubscription{}, ErrUserNotFound
+		}
+		return models.UserSubscription{}, err
 	}
 
-	startDate := time.Now().UTC().Truncate(24 * time.Hour)
+	var active bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM UserSubscriptions
+			WHERE user_email = ? AND `+activeSubscription+`
+		)
+	`, subscription.UserEmail).Scan(&active)
+	if err != nil {
+		return models.UserSubscription{}, err
+	}
+	if active {
+		return models.UserSubscription{}, ErrAlreadyActibeSubscriptionError
+	}
 
-	var endDate time.Time
-	switch subscription_name {
-	case string(models.OneMonth):
-		endDate = startDate.AddDate(0, 1, 0)
-	case string(models.ThreeMonths):
-		endDate = startDate.AddDate(0, 3, 0)
-	case string(models.OneYear):
-		endDate = startDate.AddDate(1, 0, 0)
-	default:
-		return time.Time{}, ErrInvalidSubscriptionName
+	// The subscription is tied to the version of the plan sold now.
+	plan, err := scanPlan(tx.QueryRowContext(ctx, `
+		SELECT `+planColumns+`
+		FROM SubscriptionPlans
+		WHERE name = ?
+		ORDER BY version DESC
+		LIMIT 1
+	`, subscription.SubscriptionName))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.UserSubscription{}, ErrInvalidSubscriptionName
+		}
+		return models.UserSubscription{}, err
+	}
+	if !plan.Purchasable(time.Now()) {
+		return models.UserSubscription{}, ErrInvalidSubscriptionName
+	}
+
+	subscription.SubscriptionName = plan.Name
+	subscription.PlanID = plan.ID
+	subscription.Plan = &plan
+	subscription.StartDate = time.Now().UTC().Truncate(24 * time.Hour)
+	subscription.EndDate = subscription.StartDate.AddDate(0, plan.DurationMonths, 0)
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO
+		UserSubscriptions (user_email, subscription_name, plan_id, start_date, end_date,
+			is_cancelled, auto_renew, payment_method)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, subscription.UserEmail, subscription.SubscriptionName, subscription.PlanID,
+		subscription.StartDate, subscription.EndDate, false, subscription.AutoRenew,
+		subscription.PaymentMethod)
+	if err != nil {
+		return models.UserSubscription{}, err
+	}
+
+	subscription.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.UserSubscription{}, err
+	}
+
+	charge, err := db.insertCharge(ctx, tx, models.SubscriptionCharge{
+		UserSubscriptionID: subscription.ID,
+		Kind:               models.ChargePurchase,
+		PlanID:             plan.ID,
+		Amount:             plan.Price(),
+		PaymentMethod:      subscription.PaymentMethod,
+		PeriodEnd:          subscription.EndDate,
+	})
+	if err != nil {
+		return models.UserSubscription{}, err
+	}
+	subscription.Charges = []models.SubscriptionCharge{charge}
+
+	return subscription, tx.Commit()
+}
+
+// CancelSubscription cancels the active subscription of the user. Cancelling
+// at the end of the period stops the renewals, including those retried in a
+// grace period, and keeps the subscription until the end of the period.
+func (db *SubscriptionDB) CancelSubscription(ctx context.Context, email string, mode models.CancellationMode) (models.UserSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	active, err := db.GetActiveSubscription(ctx, email)
+	if err != nil {
+		if err == ErrUserSubscriptionNotFound {
+			return models.UserSubscription{}, ErrActiveSubscriptionNotFound
+		}
+		return models.UserSubscription{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	query := `
+		UPDATE UserSubscriptions
+		SET is_cancelled = 1, auto_renew = 0, cancelled_at = ?, next_renewal_attempt = NULL
+		WHERE id = ? AND ` + activeSubscription
+	if mode == models.CancelAtPeriodEnd {
+		query = `
+			UPDATE UserSubscriptions
+			SET cancel_at_period_end = 1, auto_renew = 0, cancelled_at = ?, grace_until = NULL,
+				next_renewal_attempt = NULL
+			WHERE id = ? AND ` + activeSubscription
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, now, active.ID)
+	if err != nil {
+		return models.UserSubscription{}, err
 	}
 
-	isCancelled := []byte{0}
-	_, err = db.DB.ExecContext(ctx, query, email, startDate, endDate, isCancelled)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return time.Time{}, err
+		return models.UserSubscription{}, err
+	}
+	if affected == 0 {
+		return models.UserSubscription{}, ErrActiveSubscriptionNotFound
+	}
+
+	active.AutoRenew = false
+	active.CancelledAt = &now
+	active.NextRenewalAttempt = nil
+	if mode == models.CancelAtPeriodEnd {
+		active.CancelAtPeriodEnd = true
+		active.GraceUntil = nil
+	} else {
+		active.IsCancelled = true
 	}
 
-	return endDate, nil
+	return active, nil
 }
 
-func (db *SubscriptionDB) CancelSubscription(email string) error {
-	checkActiveQuery := `
-		SELECT COUNT(*)
+// GetSubscriptionHistory returns every subscription of the user, the latest
+// first, with its charges.
+func (db *SubscriptionDB) GetSubscriptionHistory(ctx context.Context, email string) ([]models.UserSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	subscriptions, err := db.querySubscriptions(ctx, `
+		SELECT `+userSubscriptionColumns+`
 		FROM UserSubscriptions
 		WHERE user_email = ?
-		AND is_cancelled = 0
-		AND end_date > NOW()
+		ORDER BY start_date DESC, id DESC
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT `+subscriptionChargeColumns+`
+		FROM SubscriptionCharges
+		WHERE user_subscription_id IN (SELECT id FROM UserSubscriptions WHERE user_email = ?)
+		ORDER BY id
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	charges := make(map[int64][]models.SubscriptionCharge)
+	for rows.Next() {
+		charge, err := scanSubscriptionCharge(rows)
+		if err != nil {
+			return nil, err
+		}
+		charges[charge.UserSubscriptionID] = append(charges[charge.UserSubscriptionID], charge)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Charges = charges[subscriptions[i].ID]
+	}
+
+	return subscriptions, nil
+}
+
+func (db *SubscriptionDB) GetDueRenewals(ctx context.Context, dueBefore, now time.Time) ([]models.UserSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return db.querySubscriptions(ctx, `
+		SELECT `+userSubscriptionColumns+`
+		FROM UserSubscriptions
+		WHERE auto_renew = 1 AND is_cancelled = 0 AND cancel_at_period_end = 0
+		AND end_date < ?
+		AND (next_renewal_attempt IS NULL OR next_renewal_attempt <= ?)
+		AND (grace_until IS NULL OR grace_until > ?)
+		ORDER BY end_date, id
+	`, dueBefore.UTC(), now.UTC(), now.UTC())
+}
+
+// ClaimRenewal only claims the renewal while it is still due, so that of two
+// runs listing it, only one charges it.
+func (db *SubscriptionDB) ClaimRenewal(ctx context.Context, id int64, endDate, now, until time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE UserSubscriptions
+		SET next_renewal_attempt = ?
+		WHERE id = ? AND end_date = ?
+		AND auto_renew = 1 AND is_cancelled = 0 AND cancel_at_period_end = 0
+		AND (next_renewal_attempt IS NULL OR next_renewal_attempt <= ?)
+	`, until.UTC(), id, endDate, now.UTC())
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSubscriptionChanged
+	}
+	return nil
+}
+
+// ExtendSubscription only extends the subscription while it still ends at
+// from, so that a period is never added twice.
+func (db *SubscriptionDB) ExtendSubscription(ctx context.Context, id int64, from, to time.Time, planID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE UserSubscriptions
+		SET end_date = ?, plan_id = ?, grace_until = NULL, next_renewal_attempt = NULL
+		WHERE id = ? AND end_date = ? AND is_cancelled = 0
+	`, to, planID, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSubscriptionChanged
+	}
+	return nil
+}
+
+func (db *SubscriptionDB) DeferRenewal(ctx context.Context, id int64, graceUntil time.Time, retryAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var next *time.Time
+	if retryAt != nil {
+		utc := retryAt.UTC()
+		next = &utc
+	}
+
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE UserSubscriptions
+		SET grace_until = ?, next_renewal_attempt = ?, auto_renew = ?
+		WHERE id = ?
+	`, graceUntil.UTC(), next, retryAt != nil, id)
+	return err
+}
+
+func (db *SubscriptionDB) DisableAutoRenew(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE UserSubscriptions
+		SET auto_renew = 0, next_renewal_attempt = NULL
+		WHERE id = ?
+	`, id)
+	return err
+}
+
+func (db *SubscriptionDB) insertCharge(ctx context.Context, tx *sql.Tx, charge models.SubscriptionCharge) (models.SubscriptionCharge, error) {
+	charge.Status = models.PaymentPending
+	charge.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	charge.UpdatedAt = charge.CreatedAt
+
+	query := `
+		INSERT INTO
+		SubscriptionCharges (user_subscription_id, kind, plan_id, amount, payment_method,
+			status, period_end, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	args := []any{charge.UserSubscriptionID, charge.Kind, charge.PlanID, charge.Amount,
+		charge.PaymentMethod, charge.Status, charge.PeriodEnd, charge.CreatedAt, charge.UpdatedAt}
+
+	var result sql.Result
+	var err error
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, args...)
+	}
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return models.SubscriptionCharge{}, ErrUserSubscriptionNotFound
+		}
+		return models.SubscriptionCharge{}, err
+	}
+
+	charge.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.SubscriptionCharge{}, err
+	}
+
+	return charge, nil
+}
+
+// CreateSubscriptionCharge records a PENDING charge.
+func (db *SubscriptionDB) CreateSubscriptionCharge(ctx context.Context, charge models.SubscriptionCharge) (models.SubscriptionCharge, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return db.insertCharge(ctx, nil, charge)
+}
+
+// UpdateSubscriptionCharge moves a charge to status, following the same
+// transitions as the payments of trips.
+func (db *SubscriptionDB) UpdateSubscriptionCharge(ctx context.Context, id int64, status models.PaymentStatus, reference, reason string) error {
+	from := models.PaymentStatusesBefore(status)
+	if len(from) == 0 {
+		return ErrInvalidPaymentTransition
+	}
+
+	args := []any{status, reference, reason, id}
+	for _, s := range from {
+		args = append(args, s)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE SubscriptionCharges
+		SET
+			status = ?,
+			provider_reference = COALESCE(NULLIF(?, ''), provider_reference),
+			failure_reason = NULLIF(?, '')
+		WHERE id = ? AND status IN (?`+strings.Repeat(", ?", len(from)-1)+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
 
+	var exists bool
+	err = db.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM SubscriptionCharges WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSubscriptionChargeNotFound
+	}
+	return ErrInvalidPaymentTransition
+}
+
+// RecordTripUsage records what a trip took from the allowance of a
+// subscription.
+func (db *SubscriptionDB) RecordTripUsage(ctx context.Context, tx Tx, usage models.TripUsage) error {
 	query := `
-		UPDATE UserSubscriptions
-		SET is_cancelled = 1
-		WHERE user_email = ?
+		INSERT INTO
+		SubscriptionUsage (trip_id, user_subscription_id, km, minutes, overage_km,
+			overage_minutes, overage_amount, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	args := []any{usage.TripID, usage.UserSubscriptionID, usage.Km, usage.Minutes, usage.OverageKm,
+		usage.OverageMinutes, usage.OverageAmount, usage.RecordedAt.UTC()}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	var activeCount int
-	err := db.DB.QueryRowContext(ctx, checkActiveQuery, email).Scan(&activeCount)
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		_, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		_, err = db.DB.ExecContext(ctx, query, args...)
+	}
 	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return ErrUserSubscriptionNotFound
+		}
 		return err
 	}
+	return nil
+}
+
+// GetUsage sums the usage of a subscription recorded in [from, to).
+func (db *SubscriptionDB) GetUsage(ctx context.Context, subscriptionID int64, from, to time.Time) (models.UsageTotals, error) {
+	query := `
+		SELECT COALESCE(SUM(km), 0), COALESCE(SUM(minutes), 0), COALESCE(SUM(overage_km), 0),
+			COALESCE(SUM(overage_minutes), 0), COALESCE(SUM(overage_amount), 0), COUNT(*)
+		FROM SubscriptionUsage
+		WHERE user_subscription_id = ? AND recorded_at >= ? AND recorded_at < ?
+	`
 
-	if activeCount == 0 {
-		return ErrActiveSubscriptionNotFound
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var totals models.UsageTotals
+	err := db.DB.QueryRowContext(ctx, query, subscriptionID, from.UTC(), to.UTC()).Scan(
+		&totals.Km,
+		&totals.Minutes,
+		&totals.OverageKm,
+		&totals.OverageMinutes,
+		&totals.OverageAmount,
+		&totals.Trips,
+	)
+	if err != nil {
+		return models.UsageTotals{}, err
 	}
 
-	_, err = db.DB.ExecContext(ctx, query, email)
-	return err
+	return totals, nil
 }
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type TelemetryDB struct {
+	DB *sql.DB
+}
+
+func NewTelemetryDB(db *sql.DB) *TelemetryDB {
+	return &TelemetryDB{DB: db}
+}
+
+// RecordTelemetry stores the points of a trip and returns how many were new.
+// Points are keyed by their timestamp, so a batch that is sent again is not
+// stored twice.
+func (db *TelemetryDB) RecordTelemetry(ctx context.Context, tripID int64, points []models.TelemetryPoint) (int64, error) {
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	placeholders := make([]string, 0, len(points))
+	args := make([]any, 0, len(points)*8)
+	for _, point := range points {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args,
+			tripID,
+			point.RecordedAt.UTC(),
+			point.Latitude,
+			point.Longitude,
+			point.Speed,
+			point.Acceleration,
+			point.HarshBraking,
+			point.Odometer,
+		)
+	}
+
+	query := `
+		INSERT IGNORE INTO
+		TripTelemetry (trip_id, recorded_at, latitude, longitude, speed, acceleration, harsh_braking, odometer)
+		VALUES ` + strings.Join(placeholders, ", ")
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetTelemetry returns the points of a trip in the order they were recorded.
+func (db *TelemetryDB) GetTelemetry(ctx context.Context, tripID int64) ([]models.TelemetryPoint, error) {
+	query := `
+		SELECT recorded_at, latitude, longitude, speed, acceleration, harsh_braking, odometer
+		FROM TripTelemetry
+		WHERE trip_id = ?
+		ORDER BY recorded_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []models.TelemetryPoint
+	for rows.Next() {
+		var point models.TelemetryPoint
+		if err := rows.Scan(
+			&point.RecordedAt,
+			&point.Latitude,
+			&point.Longitude,
+			&point.Speed,
+			&point.Acceleration,
+			&point.HarshBraking,
+			&point.Odometer,
+		); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
@@ -4,19 +4,26 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type TripDB struct {
 	DB *sql.DB
 }
 
-var ErrTripNotFound = fmt.Errorf("trip not found")
+var (
+	ErrTripNotFound     = fmt.Errorf("trip not found")
+	ErrActiveTripExists = fmt.Errorf("user already has an active trip")
+	ErrCarOnTrip        = fmt.Errorf("car is already on a trip")
+)
 
 func NewTripDatabase(db *sql.DB) *TripDB {
 	return &TripDB{DB: db}
@@ -83,6 +90,7 @@ func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pa
 			COALESCE(t.distance, 0) as distance,
 			COALESCE(p.amount, 0) as amount,
 			COALESCE(p.payment_method, '') as payment_method,
+			COALESCE(p.status, '') as payment_status,
 			COUNT(*) OVER() as trip_count
 		FROM Trips t
 		LEFT JOIN Payments p
@@ -92,7 +100,7 @@ func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pa
 		LIMIT ? OFFSET ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := db.DB.QueryContext(ctx, query, email, pageSize, offset)
@@ -103,7 +111,6 @@ func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pa
 
 	var trips []models.PayloadTrip
 	var distance sql.NullFloat64
-	var amount sql.NullFloat64
 	var count int
 	for rows.Next() {
 		var trip models.PayloadTrip
@@ -115,8 +122,9 @@ func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pa
 			&trip.EndTime,
 			&trip.DrivingBehavior,
 			&distance,
-			&amount,
+			&trip.Amount,
 			&trip.PaymentMethod,
+			&trip.PaymentStatus,
 			&count,
 		); err != nil {
 			return nil, 0, err
@@ -128,18 +136,21 @@ func (db *TripDB) GetAllTripsForUser(ctx context.Context, email string, page, pa
 			trip.Distance = 0
 		}
 
-		if amount.Valid {
-			trip.Amount = amount.Float64
-		} else {
-			trip.Amount = 0
-		}
-
 		trips = append(trips, trip)
 	}
 
 	return trips, count, nil
 }
 
+func (db *TripDB) CountActiveTrips(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM Trips WHERE end_time IS NULL`).Scan(&count)
+	return count, err
+}
+
 func (db *TripDB) GetActiveTrip(ctx context.Context, email string) (models.Trip, error) {
 	query := `
 		SELECT *
@@ -147,7 +158,7 @@ func (db *TripDB) GetActiveTrip(ctx context.Context, email string) (models.Trip,
 		WHERE user_email = ? AND end_time IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var trip models.Trip
@@ -171,48 +182,71 @@ func (db *TripDB) GetActiveTrip(ctx context.Context, email string) (models.Trip,
 	return trip, nil
 }
 
-func (db *TripDB) CreateTrip(ctx context.Context, tx *sql.Tx, email, licensePlate string) error {
+// CreateTrip starts a trip for email on the car. The unique keys on the
+// active trips reject a second active trip of the user, with
+// ErrActiveTripExists, or of the car, with ErrCarOnTrip.
+func (db *TripDB) CreateTrip(ctx context.Context, tx Tx, email, licensePlate string) error {
 	query := `
 		INSERT INTO
 		Trips (user_email, car_license_plate, start_time)
 		VALUES (?, ?, NOW())
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if tx != nil {
-		_, err := tx.ExecContext(ctx, query, email, licensePlate)
-		return err
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		_, err = tx.ExecContext(ctx, query, email, licensePlate)
+	} else {
+		_, err = db.DB.ExecContext(ctx, query, email, licensePlate)
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		if strings.Contains(mysqlErr.Message, "one_active_trip_per_car") {
+			return ErrCarOnTrip
+		}
+		return ErrActiveTripExists
 	}
-
-	_, err := db.DB.ExecContext(ctx, query, email, licensePlate)
 	return err
 }
 
-func (db *TripDB) EndTrip(ctx context.Context, tx *sql.Tx, email string, distance, driving_behavior float64) error {
+// EndTrip ends the trip, failing with ErrTripNotFound when it is not active,
+// such as when another request ended it first.
+func (db *TripDB) EndTrip(ctx context.Context, tx Tx, tripID int64, endTime time.Time, distance, driving_behavior float64) error {
 	query := `
 		UPDATE Trips
 		SET
-			end_time = NOW(),
+			end_time = ?,
 			distance = ?,
 			driving_behavior = ?
-		WHERE user_email = ? AND end_time IS NULL
+		WHERE id = ? AND end_time IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if tx != nil {
-		_, err := tx.ExecContext(ctx, query, distance, driving_behavior, email)
+	var result sql.Result
+	var err error
+	if tx := sqlTx(tx); tx != nil {
+		result, err = tx.ExecContext(ctx, query, endTime.UTC(), distance, driving_behavior, tripID)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, endTime.UTC(), distance, driving_behavior, tripID)
+	}
+	if err != nil {
 		return err
 	}
 
-	_, err := db.DB.ExecContext(ctx, query, distance, driving_behavior, email)
-	return err
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTripNotFound
+	}
+	return nil
 }
 
-func (db *TripDB) FindActiveTripCar(ctx context.Context, email string) (int, string, float64, error) {
+func (db *TripDB) FindActiveTripCar(ctx context.Context, email string) (int, string, money.Amount, error) {
 	query := `
 		SELECT trip_id, license_plate, cost_per_km
 		FROM UserCarTrip
@@ -220,12 +254,12 @@ func (db *TripDB) FindActiveTripCar(ctx context.Context, email string) (int, str
 		AND end_time IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var tripID int
 	var licensePlate string
-	var costPerKm float64
+	var costPerKm money.Amount
 	err := db.DB.QueryRowContext(ctx, query, email).Scan(
 		&tripID,
 		&licensePlate,
@@ -241,28 +275,25 @@ func (db *TripDB) FindActiveTripCar(ctx context.Context, email string) (int, str
 	return tripID, licensePlate, costPerKm, nil
 }
 
-func (db *TripDB) GetTripByID(ctx context.Context, id, email string) (models.PayloadTrip, float64, error) {
+func (db *TripDB) GetTripByID(ctx context.Context, id, email string) (models.PayloadTrip, models.Car, error) {
 	query := `
 			SELECT t.id, t.user_email, t.car_license_plate, t.start_time,
-				t.end_time, t.driving_behavior, p.payment_method, c.cost_per_km,
-        COALESCE(t.distance, 0)
+				t.end_time, t.driving_behavior, p.payment_method, COALESCE(p.amount, 0),
+				COALESCE(p.status, ''), c.cost_per_km, c.category, COALESCE(t.distance, 0)
 			FROM Trips t
-			LEFT JOIN Cars c
+			JOIN Cars c
 			ON t.car_license_plate = c.license_plate
-      LEFT JOIN Payments p
-      ON p.trip_id = t.id
+			LEFT JOIN Payments p
+			ON p.trip_id = t.id
 			WHERE t.id = ?
 			AND t.user_email = ?
-			GROUP BY t.id, t.user_email, t.car_license_plate, t.start_time,
-				t.end_time, t.driving_behavior, p.payment_method, c.cost_per_km, t.distance
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var trip models.PayloadTrip
-	var costPerKm float64
-	var distance float64
+	var car models.Car
 	var paymentMethod sql.NullString
 	err := db.DB.QueryRowContext(ctx, query, id, email).Scan(
 		&trip.ID,
@@ -272,14 +303,17 @@ func (db *TripDB) GetTripByID(ctx context.Context, id, email string) (models.Pay
 		&trip.EndTime,
 		&trip.DrivingBehavior,
 		&paymentMethod,
-		&costPerKm,
-		&distance,
+		&trip.Amount,
+		&trip.PaymentStatus,
+		&car.CostPerKm,
+		&car.Category,
+		&trip.Distance,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return models.PayloadTrip{}, 0, ErrTripNotFound
+			return models.PayloadTrip{}, models.Car{}, ErrTripNotFound
 		}
-		return models.PayloadTrip{}, 0, err
+		return models.PayloadTrip{}, models.Car{}, err
 	}
 
 	if paymentMethod.Valid {
@@ -288,8 +322,7 @@ func (db *TripDB) GetTripByID(ctx context.Context, id, email string) (models.Pay
 		trip.PaymentMethod = ""
 	}
 
-	trip.Amount = costPerKm * distance
-	trip.Distance = distance
+	car.LicensePlate = trip.CarLicensePlate
 
-	return trip, costPerKm, nil
+	return trip, car, nil
 }
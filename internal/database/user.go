@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -26,19 +25,19 @@ func NewUserDatabase(db *sql.DB) *UserDB {
 	return &UserDB{db}
 }
 
-func (db *UserDB) GetUserByEmail(email string) (models.User, error) {
+func (db *UserDB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	var user models.User
 
 	query := `
-		SELECT email, password
+		SELECT email, password, role_name
 		FROM Users
 		WHERE email = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := db.DB.QueryRowContext(ctx, query, email).Scan(&user.Email, &user.Password)
+	err := db.DB.QueryRowContext(ctx, query, email).Scan(&user.Email, &user.Password, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, ErrUserNotFound
@@ -49,23 +48,25 @@ func (db *UserDB) GetUserByEmail(email string) (models.User, error) {
 	return user, nil
 }
 
-func (db *UserDB) GetUserDetails(email string) (models.User, error) {
+func (db *UserDB) GetUserDetails(ctx context.Context, email string) (models.User, error) {
 	var user models.User
 
 	query := `
-		SELECT email, username, full_name, driving_behavior, created_at
+		SELECT email, username, full_name, role_name, driving_behavior, email_verified_at, created_at
 		FROM Users
 		WHERE email = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := db.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.Email,
 		&user.UserName,
 		&user.FullName,
+		&user.Role,
 		&user.DrivingBehavior,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -75,14 +76,14 @@ func (db *UserDB) GetUserDetails(email string) (models.User, error) {
 	return user, nil
 }
 
-func (db *UserDB) UpdateUsername(email, username string) error {
+func (db *UserDB) UpdateUsername(ctx context.Context, email, username string) error {
 	query := `
 		UPDATE Users
 		SET username = ?
 		WHERE email = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query, username, email)
@@ -93,14 +94,14 @@ func (db *UserDB) UpdateUsername(email, username string) error {
 	return nil
 }
 
-func (db *UserDB) UpdateFullname(email, full_name string) error {
+func (db *UserDB) UpdateFullname(ctx context.Context, email, full_name string) error {
 	query := `
 		UPDATE Users
 		SET full_name = ?
 		WHERE email = ?
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := db.DB.ExecContext(ctx, query, full_name, email)
@@ -111,7 +112,46 @@ func (db *UserDB) UpdateFullname(email, full_name string) error {
 	return nil
 }
 
-func (db *UserDB) UpdateDrivingBehavior(tx *sql.Tx, email string, drivingBehavior float64) error {
+func (db *UserDB) UpdatePassword(ctx context.Context, email, password string) error {
+	query := `
+		UPDATE Users
+		SET password = ?
+		WHERE email = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := db.DB.ExecContext(ctx, query, password, email)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports zero affected rows when the hash does not change either.
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if _, err := db.GetUserByEmail(ctx, email); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *UserDB) MarkEmailVerified(ctx context.Context, email string) error {
+	query := `
+		UPDATE Users
+		SET email_verified_at = COALESCE(email_verified_at, ?)
+		WHERE email = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, query, time.Now().UTC(), email)
+	return err
+}
+
+func (db *UserDB) UpdateDrivingBehavior(ctx context.Context, tx Tx, email string, drivingBehavior float64) error {
 	var currentDrivingBehavior sql.NullFloat64
 	var count int
 
@@ -123,7 +163,7 @@ func (db *UserDB) UpdateDrivingBehavior(tx *sql.Tx, email string, drivingBehavio
 		GROUP BY u.email, u.driving_behavior
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := db.DB.QueryRowContext(ctx, query, email).Scan(&currentDrivingBehavior, &count)
@@ -131,7 +171,6 @@ func (db *UserDB) UpdateDrivingBehavior(tx *sql.Tx, email string, drivingBehavio
 		if err == sql.ErrNoRows {
 			return ErrUserNotFound
 		}
-		log.Printf("Query error: %v", err)
 		return err
 	}
 
@@ -148,7 +187,7 @@ func (db *UserDB) UpdateDrivingBehavior(tx *sql.Tx, email string, drivingBehavio
 		WHERE email = ?
 	`
 
-	if tx != nil {
+	if tx := sqlTx(tx); tx != nil {
 		_, err := tx.ExecContext(ctx, updateQuery, updatedDrivingBehavior, email)
 		return err
 	}
@@ -157,12 +196,15 @@ func (db *UserDB) UpdateDrivingBehavior(tx *sql.Tx, email string, drivingBehavio
 	return err
 }
 
-func (db *UserDB) CreateUser(email, username, full_name, password string) (models.User, error) {
+func (db *UserDB) CreateUser(ctx context.Context, email, username, full_name, password string) (models.User, error) {
 	var user models.User
 
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
 	// Check if email is already taken
 	emailCheckQuery := `SELECT email FROM Users WHERE email = ?`
-	err := db.DB.QueryRow(emailCheckQuery, email).Scan(&user.Email)
+	err := db.DB.QueryRowContext(ctx, emailCheckQuery, email).Scan(&user.Email)
 	if err == nil {
 		return models.User{}, ErrDuplicateEmail
 	} else if err != sql.ErrNoRows {
@@ -171,7 +213,7 @@ func (db *UserDB) CreateUser(email, username, full_name, password string) (model
 
 	// Check if username is already taken
 	usernameCheckQuery := `SELECT username FROM Users WHERE username = ?`
-	err = db.DB.QueryRow(usernameCheckQuery, username).Scan(&user.UserName)
+	err = db.DB.QueryRowContext(ctx, usernameCheckQuery, username).Scan(&user.UserName)
 	if err == nil {
 		return models.User{}, ErrDuplicateUsername
 	} else if err != sql.ErrNoRows {
@@ -184,9 +226,6 @@ func (db *UserDB) CreateUser(email, username, full_name, password string) (model
 		VALUES (?, ?, ?, ?, NULL, NOW())
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	_, err = db.DB.ExecContext(ctx, query, email, username, full_name, password)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
@@ -202,19 +241,35 @@ func (db *UserDB) CreateUser(email, username, full_name, password string) (model
 	}, nil
 }
 
-func (db *UserDB) DeleteUser(email string) error {
-	query := `
-		DELETE FROM Users
-		WHERE email = ?
-	`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (db *UserDB) DeleteUser(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := db.DB.ExecContext(ctx, query, email)
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// TripTelemetry is partitioned and cannot reference Trips, so the
+	// ON DELETE CASCADE from Users does not reach it.
+	_, err = tx.ExecContext(ctx, `
+		DELETE tt
+		FROM TripTelemetry tt
+		JOIN Trips t ON t.id = tt.trip_id
+		WHERE t.user_email = ?
+	`, email)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM Users
+		WHERE email = ?
+	`, email)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+type UserTokenDB struct {
+	DB *sql.DB
+}
+
+var (
+	ErrInvalidToken = fmt.Errorf("invalid or expired token")
+)
+
+func NewUserTokenDB(db *sql.DB) *UserTokenDB {
+	return &UserTokenDB{DB: db}
+}
+
+// CreateToken stores a token for email. Tokens issued earlier for the same
+// purpose can no longer be used.
+func (db *UserTokenDB) CreateToken(ctx context.Context, email string, purpose models.TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE UserTokens
+		SET used_at = ?
+		WHERE user_email = ? AND purpose = ? AND used_at IS NULL
+	`, now, email, purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO
+		UserTokens (token_hash, user_email, purpose, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, tokenHash, email, purpose, now, expiresAt.UTC())
+	if err != nil {
+		// UserTokens.user_email references Users.email
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1452 {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeToken marks the token as used and returns the email it was issued
+// for. Each token can be consumed once, before it expires.
+func (db *UserTokenDB) ConsumeToken(ctx context.Context, purpose models.TokenPurpose, tokenHash string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	result, err := db.DB.ExecContext(ctx, `
+		UPDATE UserTokens
+		SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, now, tokenHash, purpose, now)
+	if err != nil {
+		return "", err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", ErrInvalidToken
+	}
+
+	var email string
+	err = db.DB.QueryRowContext(ctx, `
+		SELECT user_email
+		FROM UserTokens
+		WHERE token_hash = ?
+	`, tokenHash).Scan(&email)
+	if err != nil {
+		return "", err
+	}
+
+	return email, nil
+}
@@ -0,0 +1,73 @@
+// Package logging builds the structured logger of the API, on top of
+// log/slog.
+//
+// Lines logged with a context carry the attributes attached to it with With,
+// such as the correlation ID, route and user of a request, and the trace and
+// span IDs of the span in it. Attributes whose keys name secrets are
+// redacted, and those holding email addresses are hashed, so that a line
+// written carelessly still does not leak them.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ntentasd/db-deliverable3/config"
+)
+
+// New returns a logger writing to w in the format and from the level of
+// cfg: JSON, or text when cfg.Format is text.
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx whose lines carry attrs, after those already
+// attached to ctx.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, attrsKey{}, append(slices.Clip(existing), attrs...))
+}
+
+// contextHandler adds the attributes and the trace of the context of each
+// line to it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
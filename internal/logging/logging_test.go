@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ntentasd/db-deliverable3/config"
+)
+
+// decode returns the single JSON line in buf.
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("failed to decode log line %q: %v", buf, err)
+	}
+	return line
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Format: "json", Level: slog.LevelInfo}, &buf)
+
+	logger.Info("Signed up",
+		"password", "supersecret",
+		"refresh_token", "abc",
+		slog.Group("request", "Authorization", "Bearer abc"),
+		"email", "Driver@Example.com",
+		"recipient_email", "driver@example.com",
+		"trip_id", 7,
+	)
+
+	line := decode(t, &buf)
+	if line["password"] != Redacted || line["refresh_token"] != Redacted {
+		t.Errorf("got password %v and token %v, want them redacted", line["password"], line["refresh_token"])
+	}
+	if request, _ := line["request"].(map[string]any); request["Authorization"] != Redacted {
+		t.Errorf("got request %v, want the authorization redacted", line["request"])
+	}
+	if hash := HashEmail("driver@example.com"); line["email"] != hash || line["recipient_email"] != hash {
+		t.Errorf("got emails %v and %v, want both hashed to %s", line["email"], line["recipient_email"], hash)
+	}
+	if line["trip_id"] != float64(7) {
+		t.Errorf("got trip_id %v, want 7", line["trip_id"])
+	}
+	if strings.Contains(buf.String(), "example.com") {
+		t.Errorf("got an email address in %s", buf.String())
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Format: "json", Level: slog.LevelInfo}, &buf)
+
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), span)
+	ctx = With(ctx, slog.String("correlation_id", "correlation-1"))
+	ctx = With(ctx, slog.String("route", "/trips/stop"))
+
+	logger.InfoContext(ctx, "Trip stopped")
+
+	line := decode(t, &buf)
+	want := map[string]any{
+		"correlation_id": "correlation-1",
+		"route":          "/trips/stop",
+		"trace_id":       span.TraceID().String(),
+		"span_id":        span.SpanID().String(),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("got %s %v, want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Format: "text", Level: slog.LevelWarn}, &buf)
+
+	logger.Info("Dropped")
+	logger.Warn("Kept", "password", "supersecret")
+
+	if got := buf.String(); strings.Contains(got, "Dropped") || !strings.Contains(got, "msg=Kept password="+Redacted) {
+		t.Fatalf("got %q, want only the warning, in text, with the password redacted", got)
+	}
+}
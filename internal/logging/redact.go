@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of secrets in the logs.
+const Redacted = "[REDACTED]"
+
+// secretKeys are the words that mark the key of an attribute as a secret,
+// whatever its case.
+var secretKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key"}
+
+// HashEmail identifies the owner of an email address in the logs without
+// the address: the same address, whatever its case, always gives the same
+// hash.
+func HashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// redact replaces the values of secrets, and hashes the email addresses of
+// attributes whose key is email or ends in _email.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+	if (key == "email" || strings.HasSuffix(key, "_email")) && a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, HashEmail(a.Value.String()))
+	}
+	return a
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every message to its own .eml file in Dir.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), recipient)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg, now), 0o600)
+}
+
+// LogMailer logs messages instead of sending them. Bodies carry the links
+// to verify addresses and reset passwords, so they are only logged at debug
+// level.
+type LogMailer struct {
+	From   string
+	Logger *slog.Logger
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.DebugContext(ctx, "Mail", "recipient_email", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+	logger.InfoContext(ctx, "Mail", "recipient_email", msg.To, "subject", msg.Subject)
+	return nil
+}
@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/logging"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: filepath.Join(dir, "mail"), From: "DataDrive <no-reply@datadrive.com>"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "driver@example.com",
+		Subject: "Verify your email address",
+		Body:    "Follow this link",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*driver_at_example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got files %v (%v), want one message", files, err)
+	}
+
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"From: DataDrive <no-reply@datadrive.com>\r\n",
+		"To: driver@example.com\r\n",
+		"Subject: Verify your email address\r\n",
+		"\r\n\r\nFollow this link",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("message %q does not contain %q", content, want)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	msg := Message{
+		To:      "driver@example.com",
+		Subject: "Reset your password",
+		Body:    "Follow this link: https://datadrive.com/reset-password?token=abc123",
+	}
+
+	var buf bytes.Buffer
+	m := &LogMailer{Logger: logging.New(config.LogConfig{Format: "json", Level: slog.LevelInfo}, &buf)}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, msg.Subject) || !strings.Contains(got, logging.HashEmail(msg.To)) {
+		t.Errorf("got %q, want the subject and the hash of the recipient", got)
+	}
+	if strings.Contains(got, "abc123") || strings.Contains(got, msg.To) {
+		t.Errorf("got %q, want neither the body nor the recipient's address", got)
+	}
+
+	// The body is only logged at debug level.
+	buf.Reset()
+	m.Logger = logging.New(config.LogConfig{Format: "json", Level: slog.LevelDebug}, &buf)
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "abc123") || strings.Contains(got, msg.To) {
+		t.Errorf("got %q, want the body without the recipient's address", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.MailConfig{Driver: "smtp", From: "no-reply@datadrive.com", SMTPHost: "mailhog", SMTPPort: "1025"}
+	m, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, ok := m.(*SMTPMailer); !ok {
+		t.Fatalf("got %T, want *SMTPMailer", m)
+	}
+
+	cfg.Driver = "pigeon"
+	if _, err := New(cfg, nil); err == nil {
+		t.Fatal("New accepted an unknown driver")
+	}
+
+	cfg.Driver = "log"
+	cfg.From = "not an address"
+	if _, err := New(cfg, nil); err == nil {
+		t.Fatal("New accepted an invalid sender")
+	}
+}
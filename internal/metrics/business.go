@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+var (
+	activeTripsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_trips"),
+		"Trips that have started and not ended yet.",
+		nil, nil,
+	)
+	carsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "cars"),
+		"Cars in the fleet, by status.",
+		[]string{"status"}, nil,
+	)
+	activeSubscriptionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_subscriptions"),
+		"Subscriptions that currently cover trips, those in their grace period included.",
+		nil, nil,
+	)
+)
+
+// statuses are the statuses the cars gauge always reports, so that a status
+// no car is in reads as zero rather than missing.
+var statuses = []models.Status{models.Available, models.Rented, models.Maintenance}
+
+// businessCollector counts the trips, cars and subscriptions in the database
+// when the metrics are scraped.
+type businessCollector struct {
+	db      *database.Database
+	timeout time.Duration
+}
+
+// NewBusinessCollector returns a collector of the active trips, the cars per
+// status and the active subscriptions in db.
+func NewBusinessCollector(db *database.Database) prometheus.Collector {
+	return businessCollector{db: db, timeout: 3 * time.Second}
+}
+
+func (c businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeTripsDesc
+	ch <- carsDesc
+	ch <- activeSubscriptionsDesc
+}
+
+func (c businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if trips, err := c.db.TripDB.CountActiveTrips(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(activeTripsDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(activeTripsDesc, prometheus.GaugeValue, float64(trips))
+	}
+
+	if cars, err := c.db.CarDB.CountCarsByStatus(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(carsDesc, err)
+	} else {
+		for _, status := range statuses {
+			ch <- prometheus.MustNewConstMetric(carsDesc, prometheus.GaugeValue, float64(cars[status]), string(status))
+		}
+	}
+
+	if subscriptions, err := c.db.SubscriptionDB.CountActiveSubscriptions(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(activeSubscriptionsDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(activeSubscriptionsDesc, prometheus.GaugeValue, float64(subscriptions))
+	}
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ntentasd/db-deliverable3/internal/cache"
+)
+
+// InstrumentCache counts the operations on c, and their outcome, under the
+// name of its backend.
+func (m *Metrics) InstrumentCache(c cache.Cache, backend string) cache.Cache {
+	operations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   "cache",
+		Name:        "operations_total",
+		Help:        "Operations on the cache backend, by operation and result.",
+		ConstLabels: prometheus.Labels{"backend": backend},
+	}, []string{"operation", "result"})
+	m.Registry.MustRegister(operations)
+
+	return &instrumentedCache{Cache: c, operations: operations}
+}
+
+type instrumentedCache struct {
+	cache.Cache
+	operations *prometheus.CounterVec
+}
+
+func (c *instrumentedCache) Get(key string) ([]byte, error) {
+	value, err := c.Cache.Get(key)
+	switch {
+	case err == nil:
+		c.operations.WithLabelValues("get", "hit").Inc()
+	case errors.Is(err, cache.ErrMiss):
+		c.operations.WithLabelValues("get", "miss").Inc()
+	default:
+		c.operations.WithLabelValues("get", "error").Inc()
+	}
+	return value, err
+}
+
+func (c *instrumentedCache) Set(key string, value []byte, ttl time.Duration) error {
+	err := c.Cache.Set(key, value, ttl)
+	c.operations.WithLabelValues("set", result(err)).Inc()
+	return err
+}
+
+func (c *instrumentedCache) Delete(key string) error {
+	err := c.Cache.Delete(key)
+	c.operations.WithLabelValues("delete", result(err)).Inc()
+	return err
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+var (
+	cacheReadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "reads_total"),
+		"Reads through a cache, by how they were served: hit, stale_hit, negative_hit or miss.",
+		[]string{"cache", "result"}, nil,
+	)
+	cacheLoadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "loads_total"),
+		"Loads of what a cache did not hold, background refreshes included, by result.",
+		[]string{"cache", "result"}, nil,
+	)
+)
+
+// cacheCollector reports the reads through the read-through caches.
+type cacheCollector struct {
+	caches []cache.Reporter
+}
+
+// NewCacheCollector returns a collector of the reads through caches.
+func NewCacheCollector(caches []cache.Reporter) prometheus.Collector {
+	return cacheCollector{caches: caches}
+}
+
+func (c cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheReadsDesc
+	ch <- cacheLoadsDesc
+}
+
+func (c cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, reporter := range c.caches {
+		name := reporter.Name()
+		stats := reporter.Stats()
+
+		reads := map[string]int64{
+			"hit":          stats.Hits,
+			"stale_hit":    stats.StaleHits,
+			"negative_hit": stats.NegativeHits,
+			"miss":         stats.Misses,
+		}
+		for result, count := range reads {
+			ch <- prometheus.MustNewConstMetric(cacheReadsDesc, prometheus.CounterValue, float64(count), name, result)
+		}
+
+		ch <- prometheus.MustNewConstMetric(cacheLoadsDesc, prometheus.CounterValue, float64(stats.Loads-stats.LoadErrors), name, "ok")
+		ch <- prometheus.MustNewConstMetric(cacheLoadsDesc, prometheus.CounterValue, float64(stats.LoadErrors), name, "error")
+	}
+}
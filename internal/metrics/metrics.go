@@ -0,0 +1,106 @@
+// Package metrics exposes the Prometheus metrics of the API: its HTTP
+// traffic, the database pool, the cache, and gauges of the fleet and its
+// customers.
+package metrics
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+)
+
+// namespace prefixes the names of the metrics.
+const namespace = "datadrive"
+
+// Metrics holds the registry the API's metrics are gathered from.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New returns metrics with the HTTP, Go runtime and process collectors
+// registered. The other collectors are registered by whoever owns what they
+// observe.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests handled, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+
+	m.Registry.MustRegister(
+		m.requests,
+		m.duration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Middleware counts and times the requests. They are labelled with the
+// route they matched, such as /cars/:license_plate, so that the number of
+// series does not grow with the license plates or IDs in the paths.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		status := middleware.ResponseStatus(c, err)
+
+		// The method is only valid during the request, while the labels are
+		// kept.
+		labels := prometheus.Labels{
+			"method": strings.Clone(c.Method()),
+			"route":  c.Route().Path,
+			"status": strconv.Itoa(status),
+		}
+		m.requests.With(labels).Inc()
+		m.duration.With(labels).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. Collectors that
+// fail are reported in the log and left out, without failing the rest.
+func (m *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{
+		ErrorLog:      log.Default(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+}
+
+// RegisterDatabase registers the collectors of db: its caches, the counts
+// behind the business gauges and, when pool is not nil, the statistics of
+// the connection pool.
+func (m *Metrics) RegisterDatabase(pool *sql.DB, db *database.Database) {
+	m.Registry.MustRegister(
+		NewCacheCollector(db.Caches),
+		NewBusinessCollector(db),
+	)
+	if pool != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(pool, namespace))
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/cache"
+)
+
+// gather returns the value of every series of the family name, keyed by
+// the values of its labels joined with commas.
+func gather(t *testing.T, m *Metrics, name string) map[string]float64 {
+	t.Helper()
+
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	series := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var key string
+			for i, label := range metric.GetLabel() {
+				if i > 0 {
+					key += ","
+				}
+				key += label.GetValue()
+			}
+			switch {
+			case metric.Counter != nil:
+				series[key] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				series[key] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+func TestCacheMetrics(t *testing.T) {
+	m := New()
+	c := m.InstrumentCache(cache.NewLRU(100), "memory")
+	cars := cache.NewLoader[string](c, "cars", cache.Options{TTL: time.Minute})
+	m.Registry.MustRegister(NewCacheCollector([]cache.Reporter{cars}))
+
+	load := func(ctx context.Context) (string, error) {
+		return "page", nil
+	}
+	cars.Get(context.Background(), "all", load)
+	cars.Get(context.Background(), "all", load)
+
+	reads := gather(t, m, "datadrive_cache_reads_total")
+	if reads["cars,miss"] != 1 || reads["cars,hit"] != 1 || reads["cars,stale_hit"] != 0 {
+		t.Fatalf("got reads %v, want a miss then a hit", reads)
+	}
+	if loads := gather(t, m, "datadrive_cache_loads_total"); loads["cars,ok"] != 1 || loads["cars,error"] != 0 {
+		t.Fatalf("got loads %v, want one successful load", loads)
+	}
+
+	// The loader reads the generation of its namespace and then the page:
+	// both miss at first, and are set.
+	operations := gather(t, m, "datadrive_cache_operations_total")
+	if operations["memory,get,miss"] != 2 || operations["memory,get,hit"] != 2 || operations["memory,set,ok"] != 2 {
+		t.Fatalf("got operations %v, want two misses, two hits and two sets", operations)
+	}
+}
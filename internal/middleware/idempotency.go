@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyStore keeps the requests made with an Idempotency-Key and the
+// responses they got.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, request models.IdempotentRequest) (models.IdempotentRequest, error)
+	CompleteIdempotencyKey(ctx context.Context, request models.IdempotentRequest) error
+	ReleaseIdempotencyKey(ctx context.Context, email, key string) error
+}
+
+// Idempotency makes requests sent with an Idempotency-Key header safe to
+// retry for window: a retry gets the response of the first request instead
+// of being handled again, and reusing the key for a different request is
+// rejected. Keys are scoped to the user attached by JWTMiddleware, so it
+// must run after it. Requests without the header are handled as usual.
+// Failures to release or complete a key are logged to logger.
+func Idempotency(store IdempotencyStore, window time.Duration, logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > models.IdempotencyKeyMaxLength {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		email, ok := c.Locals(string(Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		request := models.IdempotentRequest{
+			UserEmail:   email,
+			Key:         key,
+			Method:      c.Method(),
+			Path:        c.Path(),
+			Fingerprint: fingerprint(c),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(window),
+		}
+
+		stored, err := store.ReserveIdempotencyKey(c.UserContext(), request)
+		if err == database.ErrIdempotencyKeyExists {
+			if stored.Method != request.Method || stored.Path != request.Path || stored.Fingerprint != request.Fingerprint {
+				return c.Status(http.StatusUnprocessableEntity).
+					JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+			}
+			if !stored.Completed() {
+				return c.Status(http.StatusConflict).
+					JSON(fiber.Map{"error": "a request with this Idempotency-Key is still being handled"})
+			}
+
+			c.Set(IdempotentReplayedHeader, "true")
+			if stored.ContentType != "" {
+				c.Set(fiber.HeaderContentType, stored.ContentType)
+			}
+			return c.Status(stored.ResponseStatus).Send(stored.ResponseBody)
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check the Idempotency-Key"})
+		}
+
+		// Handlers answer 500 when they could not make their changes, so the
+		// key is released and the request can be retried.
+		if err := c.Next(); err != nil || c.Response().StatusCode() == http.StatusInternalServerError {
+			if releaseErr := store.ReleaseIdempotencyKey(c.UserContext(), email, key); releaseErr != nil {
+				logger.ErrorContext(c.UserContext(), "Failed to release the Idempotency-Key", "error", releaseErr)
+			}
+			return err
+		}
+
+		completedAt := time.Now().UTC().Truncate(time.Second)
+		request.CompletedAt = &completedAt
+		request.ResponseStatus = c.Response().StatusCode()
+		request.ContentType = string(c.Response().Header.ContentType())
+		request.ResponseBody = append([]byte(nil), c.Response().Body()...)
+		if err := store.CompleteIdempotencyKey(c.UserContext(), request); err != nil {
+			logger.ErrorContext(c.UserContext(), "Failed to store the response for the Idempotency-Key", "error", err)
+		}
+
+		return nil
+	}
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method() + "\n" + c.Path() + "\n"))
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
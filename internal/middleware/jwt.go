@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
@@ -12,11 +14,20 @@ import (
 type ContextKey string
 
 const (
-	Email ContextKey = "email"
-	Role  ContextKey = "role"
+	Email       ContextKey = "email"
+	Role        ContextKey = "role"
+	SessionID   ContextKey = "session_id"
+	TokenID     ContextKey = "token_id"
+	TokenExpiry ContextKey = "token_expiry"
 )
 
-func JWTMiddleware(secretKey string) fiber.Handler {
+// SessionValidator reports whether an access token may still be used, given
+// the session it was issued for and its own ID.
+type SessionValidator interface {
+	SessionActive(ctx context.Context, sessionID, jti string) (bool, error)
+}
+
+func JWTMiddleware(secretKey string, sessions SessionValidator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Extract token from Authorization header
 		authHeader := c.Get("Authorization")
@@ -56,9 +67,31 @@ func JWTMiddleware(secretKey string) fiber.Handler {
 			role = "Client"
 		}
 
+		// Reject tokens whose session or own ID has been revoked
+		sessionID, ok := claims["sid"].(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid claims structure"})
+		}
+		tokenID, ok := claims["jti"].(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid claims structure"})
+		}
+		active, err := sessions.SessionActive(c.UserContext(), sessionID, tokenID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to validate session"})
+		}
+		if !active {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "session has been revoked"})
+		}
+
 		// Attach to context
 		c.Locals("email", email)
 		c.Locals("role", role)
+		c.Locals(string(SessionID), sessionID)
+		c.Locals(string(TokenID), tokenID)
+		if exp, ok := claims["exp"].(float64); ok {
+			c.Locals(string(TokenExpiry), time.Unix(int64(exp), 0))
+		}
 
 		return c.Next()
 	}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/ntentasd/db-deliverable3/internal/logging"
+)
+
+// RequestLogger logs every request once it has been handled, and attaches
+// the correlation ID, route and user of the request to its user context, so
+// that every line logged with it carries them. Users are identified by the
+// hash of their email.
+//
+// It must run after CorrelationMiddleware and TracingMiddleware, and before
+// the routes.
+func RequestLogger(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		request := &requestAttrs{c: c}
+		if correlationID, ok := c.Locals(CorrelationIDHeader).(string); ok {
+			request.correlationID = strings.Clone(correlationID)
+		}
+		ctx := logging.With(c.UserContext(), slog.Any("", request))
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		request.done()
+
+		status := ResponseStatus(c, err)
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "Request",
+			slog.String("method", strings.Clone(c.Method())),
+			slog.String("path", strings.Clone(c.Path())),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("ip", c.IP()),
+		)
+		return err
+	}
+}
+
+// ResponseStatus returns the status the request is answered with, given the
+// error its handlers returned. Such errors are turned into responses by the
+// error handler, after the middleware returns.
+func ResponseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// requestAttrs are the attributes of a request in the logs. The route and
+// user are only known once the request has been routed and authenticated,
+// so they are read from the request whenever a line is logged while it is
+// handled, and kept once it is done for the lines logged after it.
+type requestAttrs struct {
+	mu            sync.Mutex
+	c             *fiber.Ctx
+	correlationID string
+	attrs         []slog.Attr
+}
+
+func (r *requestAttrs) LogValue() slog.Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.c != nil {
+		return slog.GroupValue(r.current()...)
+	}
+	return slog.GroupValue(r.attrs...)
+}
+
+// done keeps the attributes of the request, whose context is reused once it
+// is done.
+func (r *requestAttrs) done() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attrs = r.current()
+	r.c = nil
+}
+
+func (r *requestAttrs) current() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("correlation_id", r.correlationID),
+		slog.String("route", r.c.Route().Path),
+	}
+	if email, ok := r.c.Locals(string(Email)).(string); ok && email != "" {
+		attrs = append(attrs, slog.String("user", logging.HashEmail(email)))
+	}
+	return attrs
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PermissionChecker reports whether a role has been granted a permission.
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, role, permission string) (bool, error)
+}
+
+// RequirePermission only lets the request through when the role attached by
+// JWTMiddleware has been granted permission, so it must run after it.
+func RequirePermission(checker PermissionChecker, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, ok := c.Locals(string(Role)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		allowed, err := checker.HasPermission(c.UserContext(), role, permission)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check permissions"})
+		}
+		if !allowed {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+		}
+
+		return c.Next()
+	}
+}
@@ -2,20 +2,121 @@ package middleware
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// TracingMiddleware starts a server span for each request, continuing the
+// trace of the W3C traceparent header when the client sent one, and makes
+// its context the user context of the request. Handlers and repositories
+// start their spans from c.UserContext(), so they become its children. The
+// trace is written back in the response headers.
+//
+// The context only carries the trace, and is cancelled once the request is
+// done. It does not derive from c.Context(), the RequestCtx fasthttp reuses
+// for later requests, so that work which outlives the request, such as a
+// background cache refresh, cannot reach it. fasthttp does not report
+// clients that disconnect mid-request, so their queries run until they
+// finish or time out.
+//
+// It must run after CorrelationMiddleware, whose ID is set on the span.
 func TracingMiddleware() fiber.Handler {
-	tracer := otel.Tracer("server")
-
 	return func(c *fiber.Ctx) error {
-		ctx, span := tracer.Start(context.Background(), c.Path())
+		// The tracer and propagator are looked up for each request, so that
+		// the app follows the global ones even when they are set after it is
+		// built.
+		tracer := otel.Tracer("server")
+		propagator := otel.GetTextMapPropagator()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ctx = propagator.Extract(ctx, requestHeaders{c})
+
+		// The method and path are only valid during the request, while the
+		// span is exported after it.
+		method := strings.Clone(c.Method())
+		ctx, span := tracer.Start(ctx, method+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(strings.Clone(c.Path())),
+			),
+		)
 		defer span.End()
 
-		// Attach the context with trace to Fiber's locals for downstream usage
-		c.Locals("context", ctx)
-		return c.Next()
+		if correlationID, ok := c.Locals(CorrelationIDHeader).(string); ok {
+			span.SetAttributes(attribute.String("correlation.id", strings.Clone(correlationID)))
+		}
+
+		c.SetUserContext(ctx)
+		propagator.Inject(ctx, responseHeaders{c})
+
+		err := c.Next()
+		status := ResponseStatus(c, err)
+		if err != nil {
+			span.RecordError(err)
+		}
+
+		// Spans are named after the route rather than the path, so that
+		// requests for different cars or trips are grouped together.
+		route := c.Route().Path
+		span.SetName(method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(status),
+		)
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fiber.ErrInternalServerError.Message)
+		}
+		return err
 	}
 }
+
+// requestHeaders reads the propagated trace from the request headers.
+type requestHeaders struct {
+	c *fiber.Ctx
+}
+
+func (h requestHeaders) Get(key string) string {
+	// Baggage keeps parts of the values, which must outlive the request.
+	return strings.Clone(h.c.Get(key))
+}
+
+func (h requestHeaders) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h requestHeaders) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// responseHeaders writes the trace of the request to the response headers.
+type responseHeaders struct {
+	c *fiber.Ctx
+}
+
+func (h responseHeaders) Get(key string) string {
+	return strings.Clone(h.c.GetRespHeader(key))
+}
+
+func (h responseHeaders) Set(key, value string) {
+	h.c.Set(key, value)
+}
+
+func (h responseHeaders) Keys() []string {
+	var keys []string
+	h.c.Response().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
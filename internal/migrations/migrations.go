@@ -0,0 +1,360 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	// lockName is the MySQL user level lock held while migrating, so that
+	// several API replicas starting at once do not run the same migration.
+	lockName = "datadrive.schema_migrations"
+
+	// legacyDumpVersion is the last migration whose contents were part of the
+	// original datadrive.sql dump.
+	legacyDumpVersion = 4
+
+	createTableQuery = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version)
+		)
+	`
+)
+
+var (
+	ErrLockTimeout       = fmt.Errorf("timed out waiting for the migration lock")
+	ErrNothingToRollBack = fmt.Errorf("no applied migrations to roll back")
+	ErrMissingDown       = fmt.Errorf("migration has no down file")
+
+	fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	// DB must be opened with multiStatements=true, since a single migration
+	// file may contain several statements (and trigger bodies).
+	DB          *sql.DB
+	Migrations  []Migration
+	LockTimeout time.Duration
+}
+
+// New returns a Migrator over the migrations embedded in the binary.
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Migrations: migrations, LockTimeout: time.Minute}, nil
+}
+
+// Load reads every NNNN_name.up.sql / NNNN_name.down.sql pair found in the
+// sql directory of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %v", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status lists every known migration together with the time it was applied,
+// if it was.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the n most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		done, err = m.down(ctx, conn, n)
+		return err
+	})
+
+	return done, err
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	var migration Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.down(ctx, conn, 1)
+		if err != nil {
+			return err
+		}
+
+		migration = done[0]
+		return m.apply(ctx, conn, migration)
+	})
+
+	return migration, err
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, n int) ([]Migration, error) {
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < n; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.revert(ctx, conn, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	if len(done) == 0 {
+		return nil, ErrNothingToRollBack
+	}
+
+	return done, nil
+}
+
+// MySQL commits DDL implicitly, so a migration cannot be wrapped in a
+// transaction. The version row is only written once the whole file succeeded.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if _, err := conn.ExecContext(ctx, migration.Up); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+	}
+
+	_, err := conn.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+		migration.Version, migration.Name,
+	)
+	return err
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("%w: %d_%s", ErrMissingDown, migration.Version, migration.Name)
+	}
+
+	if _, err := conn.ExecContext(ctx, migration.Down); err != nil {
+		return fmt.Errorf("rollback of %d_%s failed: %v", migration.Version, migration.Name, err)
+	}
+
+	_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// withLock runs fn on a single connection that holds the migration lock, after
+// making sure the schema_migrations table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, int(m.LockTimeout.Seconds())).Scan(&acquired)
+	if err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return ErrLockTimeout
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName)
+
+	if err := m.baseline(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// baseline creates the schema_migrations table. Databases that were created
+// from the old datadrive.sql dump already contain everything up to the seed
+// data, so those migrations are recorded as applied instead of being run.
+func (m *Migrator) baseline(ctx context.Context, conn *sql.Conn) error {
+	var exists int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND table_name = 'schema_migrations'
+	`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	var legacy int
+	err = conn.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND LOWER(table_name) = 'cars'
+	`).Scan(&legacy)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, createTableQuery); err != nil {
+		return err
+	}
+
+	if legacy == 0 {
+		return nil
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > legacyDumpVersion {
+			break
+		}
+		_, err := conn.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+			migration.Version, migration.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS `UserSubscriptions`;
+DROP TABLE IF EXISTS `UserSettings`;
+DROP TABLE IF EXISTS `Services`;
+DROP TABLE IF EXISTS `Damages`;
+DROP TABLE IF EXISTS `Reviews`;
+DROP TABLE IF EXISTS `Payments`;
+DROP TABLE IF EXISTS `Trips`;
+DROP TABLE IF EXISTS `Subscriptions`;
+DROP TABLE IF EXISTS `Cars`;
+DROP TABLE IF EXISTS `Users`;
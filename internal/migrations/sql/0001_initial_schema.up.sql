@@ -0,0 +1,116 @@
+CREATE TABLE `Users` (
+  `email` varchar(45) NOT NULL,
+  `username` varchar(45) NOT NULL,
+  `full_name` varchar(45) DEFAULT NULL,
+  `password` varchar(255) NOT NULL,
+  `driving_behavior` decimal(3,2) DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`email`),
+  UNIQUE KEY `username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Cars` (
+  `license_plate` varchar(7) NOT NULL,
+  `make` varchar(45) NOT NULL,
+  `model` varchar(45) NOT NULL,
+  `status` enum('AVAILABLE','RENTED','MAINTENANCE') NOT NULL,
+  `cost_per_km` decimal(10,2) DEFAULT NULL,
+  `location` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`license_plate`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Subscriptions` (
+  `name` enum('1_MONTH','3_MONTHS','1_YEAR') NOT NULL,
+  `price_per_month` decimal(5,2) NOT NULL,
+  `description` mediumtext,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Trips` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_email` varchar(45) NOT NULL,
+  `car_license_plate` varchar(7) NOT NULL,
+  `start_time` timestamp NOT NULL,
+  `end_time` timestamp NULL DEFAULT NULL,
+  `driving_behavior` decimal(3,2) DEFAULT NULL,
+  `distance` decimal(5,2) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_email` (`user_email`),
+  KEY `car_license_plate` (`car_license_plate`),
+  KEY `idx_trips_user_email_end_time` (`user_email`, `end_time`),
+  CONSTRAINT `Trips_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE,
+  CONSTRAINT `Trips_ibfk_2` FOREIGN KEY (`car_license_plate`) REFERENCES `Cars` (`license_plate`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Payments` (
+  `trip_id` bigint NOT NULL,
+  `payment_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `amount` decimal(10,2) NOT NULL,
+  `payment_method` enum('SUBSCRIPTION','CARD','CRYPTO') NOT NULL,
+  PRIMARY KEY (`trip_id`),
+  CONSTRAINT `Payments_ibfk_1` FOREIGN KEY (`trip_id`) REFERENCES `Trips` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Reviews` (
+  `trip_id` bigint NOT NULL,
+  `rating` int NOT NULL,
+  `comment` tinytext,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`trip_id`),
+  CONSTRAINT `Reviews_ibfk_1` FOREIGN KEY (`trip_id`) REFERENCES `Trips` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Damages` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `car_license_plate` varchar(7) NOT NULL,
+  `reported_date` date NOT NULL,
+  `description` mediumtext,
+  `repaired` bit(1) NOT NULL,
+  `repair_cost` decimal(10,2) DEFAULT NULL,
+  PRIMARY KEY (`id`,`car_license_plate`),
+  KEY `car_license_plate` (`car_license_plate`),
+  CONSTRAINT `Damages_ibfk_1` FOREIGN KEY (`car_license_plate`) REFERENCES `Cars` (`license_plate`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Services` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `car_license_plate` varchar(7) NOT NULL,
+  `service_date` date NOT NULL,
+  `description` mediumtext,
+  `service_cost` decimal(10,2) DEFAULT NULL,
+  PRIMARY KEY (`id`,`car_license_plate`),
+  KEY `car_license_plate` (`car_license_plate`),
+  CONSTRAINT `Services_ibfk_1` FOREIGN KEY (`car_license_plate`) REFERENCES `Cars` (`license_plate`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `UserSettings` (
+  `user_email` varchar(45) NOT NULL,
+  `seat_position_horizontal` decimal(4,1) DEFAULT NULL,
+  `seat_position_vertical` decimal(4,1) DEFAULT NULL,
+  `seat_recline_angle` decimal(4,1) DEFAULT NULL,
+  `steering_wheel_position` decimal(4,1) DEFAULT NULL,
+  `left_mirror_angle` decimal(4,1) DEFAULT NULL,
+  `right_mirror_angle` decimal(4,1) DEFAULT NULL,
+  `rearview_mirror_angle` decimal(4,1) DEFAULT NULL,
+  `cabin_temperature` decimal(4,1) DEFAULT NULL,
+  `drive_mode` enum('COMFORT','SPORT','ECO') DEFAULT NULL,
+  `suspension_height` decimal(4,1) DEFAULT NULL,
+  `engine_start_stop` bit(1) DEFAULT NULL,
+  `cruise_control` bit(1) DEFAULT NULL,
+  PRIMARY KEY (`user_email`),
+  CONSTRAINT `UserSettings_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `UserSubscriptions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_email` varchar(45) NOT NULL,
+  `subscription_name` enum('1_MONTH','3_MONTHS','1_YEAR') NOT NULL,
+  `start_date` date NOT NULL,
+  `end_date` date NOT NULL,
+  `is_cancelled` bit(1) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_email` (`user_email`),
+  KEY `subscription_name` (`subscription_name`),
+  CONSTRAINT `UserSubscriptions_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE,
+  CONSTRAINT `UserSubscriptions_ibfk_2` FOREIGN KEY (`subscription_name`) REFERENCES `Subscriptions` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
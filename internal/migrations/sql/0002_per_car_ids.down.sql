@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS `Services_BEFORE_INSERT`;
+DROP TRIGGER IF EXISTS `Damages_BEFORE_INSERT`;
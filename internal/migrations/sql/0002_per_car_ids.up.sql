@@ -0,0 +1,30 @@
+-- Damages and Services are numbered per car: the first damage of every car
+-- gets id 1, the second id 2 and so on.
+
+CREATE TRIGGER `Damages_BEFORE_INSERT` BEFORE INSERT ON `Damages` FOR EACH ROW
+BEGIN
+    DECLARE next_id BIGINT;
+
+    -- Find the maximum ID for the given car_license_plate
+    SELECT COALESCE(MAX(id), 0) + 1
+    INTO next_id
+    FROM `Damages`
+    WHERE `car_license_plate` = NEW.`car_license_plate`;
+
+    -- Assign the calculated ID to the new row
+    SET NEW.`id` = next_id;
+END;
+
+CREATE TRIGGER `Services_BEFORE_INSERT` BEFORE INSERT ON `Services` FOR EACH ROW
+BEGIN
+    DECLARE next_id BIGINT;
+
+    -- Find the maximum ID for the given car_license_plate
+    SELECT COALESCE(MAX(id), 0) + 1
+    INTO next_id
+    FROM `Services`
+    WHERE `car_license_plate` = NEW.`car_license_plate`;
+
+    -- Assign the calculated ID to the new row
+    SET NEW.`id` = next_id;
+END;
@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS `UserCarTrip`;
+DROP VIEW IF EXISTS `CarServiceDamageSummary`;
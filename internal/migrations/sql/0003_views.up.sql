@@ -0,0 +1,30 @@
+CREATE VIEW `CarServiceDamageSummary` AS
+SELECT c.license_plate AS license_plate,
+       c.make AS make,
+       c.model AS model,
+       svc.service_date AS service_date,
+       svc.service_cost AS service_cost,
+       dmg.reported_date AS reported_date,
+       dmg.repair_cost AS repair_cost,
+       dmg.repaired AS repaired
+FROM Cars c
+LEFT JOIN Services svc ON c.license_plate = svc.car_license_plate
+LEFT JOIN Damages dmg ON c.license_plate = dmg.car_license_plate;
+
+CREATE VIEW `UserCarTrip` AS
+SELECT t.id AS trip_id,
+       u.username AS username,
+       u.email AS email,
+       c.license_plate AS license_plate,
+       c.make AS make,
+       c.model AS model,
+       c.cost_per_km AS cost_per_km,
+       t.distance AS distance,
+       p.amount AS amount,
+       p.payment_method AS payment_method,
+       t.start_time AS start_time,
+       t.end_time AS end_time
+FROM Trips t
+JOIN Users u ON t.user_email = u.email
+JOIN Cars c ON t.car_license_plate = c.license_plate
+LEFT JOIN Payments p ON t.id = p.trip_id;
@@ -0,0 +1,12 @@
+-- Only the rows inserted by the matching up migration are removed.
+
+DELETE FROM `UserSubscriptions` WHERE `id` IN (1, 2, 3, 4, 5, 6);
+DELETE FROM `UserSettings` WHERE `user_email` IN ('billgates@icloud.com', 'chatzig@gmail.com', 'elonmusk@gmail.com', 'moutas@gmail.com', 'ntentas@gmail.com', 'stevejobs@outlook.com');
+DELETE FROM `Services` WHERE (`id`, `car_license_plate`) IN ((1, 'ABC1234'), (1, 'DEF4321'), (1, 'GHI8765'), (1, 'JKL9101'), (1, 'NIG3345'), (1, 'XYZ5678'), (2, 'ABC1234'), (2, 'JKL9101'), (3, 'ABC1234'));
+DELETE FROM `Damages` WHERE (`id`, `car_license_plate`) IN ((1, 'ABC1234'), (1, 'DEF4321'), (1, 'GHI8765'), (1, 'JKL9101'), (1, 'NIG3345'), (1, 'XYZ5678'), (2, 'ABC1234'), (2, 'JKL9101'), (2, 'XYZ5678'), (3, 'ABC1234'));
+DELETE FROM `Reviews` WHERE `trip_id` IN (1, 2, 3, 5, 6);
+DELETE FROM `Payments` WHERE `trip_id` IN (1, 2, 3, 4, 5, 6);
+DELETE FROM `Trips` WHERE `id` IN (1, 2, 3, 4, 5, 6, 7);
+DELETE FROM `Subscriptions` WHERE `name` IN ('1_MONTH', '3_MONTHS', '1_YEAR');
+DELETE FROM `Cars` WHERE `license_plate` IN ('ABC1234', 'DEF4321', 'GHI8765', 'JKL9101', 'NIG3345', 'XYZ5678');
+DELETE FROM `Users` WHERE `email` IN ('billgates@icloud.com', 'chatzig@gmail.com', 'elonmusk@gmail.com', 'moutas@gmail.com', 'ntentas@gmail.com', 'stevejobs@outlook.com');
@@ -0,0 +1,21 @@
+-- Demo data shipped with the original datadrive.sql dump.
+
+INSERT INTO `Users` VALUES ('billgates@icloud.com','bgates','Bill Gates','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',4.50,'2020-11-28 17:13:53'),('chatzig@gmail.com','spychat','Spyros Chatzigeorgiou','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',8.50,'2024-10-28 08:05:56'),('elonmusk@gmail.com','emusk','Elon Musk','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',4.00,'2014-02-02 07:31:43'),('moutas@gmail.com','mjo','Ioannis Moutevelidis','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',7.00,'2024-10-28 15:57:13'),('ntentas@gmail.com','tents','Dimitrios Ntentas','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',9.00,'2024-10-28 11:25:19'),('stevejobs@outlook.com','sjobs','Steve Jobs','$2a$12$p/zB8YKlkyWbNn1SQcoWre1CUIbbktlKJh50o.Qc3aIieIuS9P2ce',2.00,'2007-06-14 12:27:19');
+
+INSERT INTO `Cars` VALUES ('ABC1234','Toyota','Corolla','AVAILABLE',0.50,'KAMARA'),('DEF4321','Ford','Fiesta','RENTED',0.55,'VOTSI'),('GHI8765','Volkswagen','Golf','MAINTENANCE',0.70,'THERMAIKOS'),('JKL9101','BMW','320i','MAINTENANCE',1.20,'SYNERGEIO'),('NIG3345','Audi','RS6','RENTED',7.30,'KALAMARIA'),('XYZ5678','Honda','Civic','AVAILABLE',0.60,'PANORAMA');
+
+INSERT INTO `Subscriptions` VALUES ('1_MONTH',60.00,'This is a subscription for 1 month'),('3_MONTHS',50.00,'This is a subscription for 3 months'),('1_YEAR',30.00,'This is a subscription for 1 year');
+
+INSERT INTO `Trips` VALUES (1,'moutas@gmail.com','NIG3345','2024-12-19 12:25:17','2024-12-19 12:33:43',9.9,5.30),(2,'billgates@icloud.com','XYZ5678','2023-09-19 17:31:31','2023-09-19 17:13:17',3.1,1.20),(3,'ntentas@gmail.com','ABC1234','2024-03-06 16:10:57','2024-03-06 16:29:31',4.5,6.20),(4,'ntentas@gmail.com','GHI8765','2024-08-15 10:31:32','2024-08-15 10:49:31',6.1,4.90),(5,'elonmusk@gmail.com','JKL9101','2019-03-23 21:29:07','2019-03-23 23:19:48',7.2,102.60),(6,'elonmusk@gmail.com','GHI8765','2020-01-22 13:55:39','2020-01-22 21:15:19',6.4,19.40),(7,'stevejobs@outlook.com','DEF4321','2024-12-26 11:18:24',NULL,NULL,NULL);
+
+INSERT INTO `Payments` VALUES (1,'2024-12-19 12:33:43',27.20,'CRYPTO'),(2,'2023-09-19 17:13:17',9.75,'CARD'),(3,'2024-03-06 16:29:31',39.10,'CARD'),(4,'2024-08-15 10:49:31',26.50,'SUBSCRIPTION'),(5,'2019-03-23 23:19:48',230.20,'CRYPTO'),(6,'2020-01-22 21:15:19',54.60,'CRYPTO');
+
+INSERT INTO `Reviews` VALUES (1,4,'I liked the customizability','2024-12-19 12:34:21'),(2,5,'The ride was smooth and perfect','2023-09-19 17:15:41'),(3,2,'I didn’t like the car','2024-03-06 16:31:01'),(5,2,'The car was stinky','2019-03-23 23:20:19'),(6,3,'Had no problem moving around','2020-01-22 21:16:32');
+
+INSERT INTO `Damages` VALUES (1,'ABC1234','2024-01-04','Scratched door',b'1',149.43),(1,'DEF4321','2024-04-19','1 Broken mirror',b'1',178.25),(1,'GHI8765','2024-12-21','2 Broken Doors',b'0',560.43),(1,'JKL9101','2024-05-17','Engine issues',b'0',1450.00),(1,'NIG3345','2024-07-25','Cracked axle',b'1',740.58),(1,'XYZ5678','2024-05-16','Broken taillight',b'1',205.89),(2,'ABC1234','2024-10-20','1 Broken mirror',b'1',54.34),(2,'JKL9101','2024-10-22','Scratched left rear door',b'1',120.45),(2,'XYZ5678','2024-11-25','Broken headlights',b'0',350.00),(3,'ABC1234','2024-10-21','Burned down',b'1',10000.00);
+
+INSERT INTO `Services` VALUES (1,'ABC1234','2024-03-18','Oil Change',67.00),(1,'DEF4321','2024-10-12','Tire Rotation and Balancing',54.00),(1,'GHI8765','2024-01-29','Engine Tune-Up',325.00),(1,'JKL9101','2024-05-05','Battery Replacement',197.00),(1,'NIG3345','2024-11-21','Air Conditioning Service',145.00),(1,'XYZ5678','2024-06-09','Brake Pad Replacement',178.00),(2,'ABC1234','2024-03-20','Battery Replacement',56.00),(2,'JKL9101','2024-06-01','Handbrake Replacement',150.00),(3,'ABC1234','2024-04-10','Clutch Replacement',110.00);
+
+INSERT INTO `UserSettings` VALUES ('billgates@icloud.com',12.4,8.3,100.9,28.6,43.3,47.5,39.7,23.8,'ECO',9.1,b'1',b'0'),('chatzig@gmail.com',15.3,11.7,120.2,30.8,44.5,50.2,40.1,22.4,'ECO',10.2,b'1',b'0'),('elonmusk@gmail.com',17.2,10.2,118.7,33.5,45.2,49.3,35.9,22.3,'SPORT',7.7,b'1',b'1'),('moutas@gmail.com',18.8,15.5,115.4,25.3,42.1,46.7,37.2,29.9,'COMFORT',12.6,b'1',b'1'),('ntentas@gmail.com',20.1,9.3,110.6,35.7,41.8,48.2,38.5,24.1,'SPORT',8.4,b'0',b'1'),('stevejobs@outlook.com',25.7,12.9,105.8,32.2,40.4,45.6,36.8,21.5,'ECO',11.3,b'0',b'1');
+
+INSERT INTO `UserSubscriptions` VALUES (1,'moutas@gmail.com','1_MONTH','2024-12-10','2025-01-10',b'0'),(2,'billgates@icloud.com','3_MONTHS','2022-09-10','2022-12-10',b'0'),(3,'ntentas@gmail.com','3_MONTHS','2024-09-15','2024-12-15',b'1'),(4,'ntentas@gmail.com','1_YEAR','2024-11-16','2025-11-16',b'0'),(5,'elonmusk@gmail.com','1_MONTH','2019-05-09','2019-06-09',b'0'),(6,'elonmusk@gmail.com','1_YEAR','2020-06-29','2021-06-29',b'0');
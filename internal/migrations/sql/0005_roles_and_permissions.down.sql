@@ -0,0 +1,8 @@
+ALTER TABLE `Users`
+  DROP FOREIGN KEY `Users_ibfk_1`,
+  DROP KEY `role_name`,
+  DROP COLUMN `role_name`;
+
+DROP TABLE IF EXISTS `RolePermissions`;
+DROP TABLE IF EXISTS `Permissions`;
+DROP TABLE IF EXISTS `Roles`;
@@ -0,0 +1,49 @@
+CREATE TABLE `Roles` (
+  `name` varchar(20) NOT NULL,
+  `description` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Permissions` (
+  `name` varchar(45) NOT NULL,
+  `description` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `RolePermissions` (
+  `role_name` varchar(20) NOT NULL,
+  `permission_name` varchar(45) NOT NULL,
+  PRIMARY KEY (`role_name`,`permission_name`),
+  KEY `permission_name` (`permission_name`),
+  CONSTRAINT `RolePermissions_ibfk_1` FOREIGN KEY (`role_name`) REFERENCES `Roles` (`name`) ON DELETE CASCADE,
+  CONSTRAINT `RolePermissions_ibfk_2` FOREIGN KEY (`permission_name`) REFERENCES `Permissions` (`name`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+INSERT INTO `Roles` VALUES
+  ('Admin','Manages the fleet'),
+  ('Client','Rents cars');
+
+INSERT INTO `Permissions` VALUES
+  ('cars:read','List the whole fleet and read any car and its trips'),
+  ('cars:write','Add, update and delete cars and record damages and services'),
+  ('trips:read','Read your own trips'),
+  ('trips:write','Start and stop trips'),
+  ('reviews:write','Review your own trips'),
+  ('subscriptions:write','Buy and cancel subscriptions');
+
+INSERT INTO `RolePermissions` VALUES
+  ('Admin','cars:read'),
+  ('Admin','cars:write'),
+  ('Admin','trips:read'),
+  ('Admin','trips:write'),
+  ('Admin','reviews:write'),
+  ('Admin','subscriptions:write'),
+  ('Client','trips:read'),
+  ('Client','trips:write'),
+  ('Client','reviews:write'),
+  ('Client','subscriptions:write');
+
+ALTER TABLE `Users`
+  ADD COLUMN `role_name` varchar(20) NOT NULL DEFAULT 'Client' AFTER `password`,
+  ADD KEY `role_name` (`role_name`),
+  ADD CONSTRAINT `Users_ibfk_1` FOREIGN KEY (`role_name`) REFERENCES `Roles` (`name`);
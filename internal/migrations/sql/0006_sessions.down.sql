@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `RevokedTokens`;
+DROP TABLE IF EXISTS `Sessions`;
@@ -0,0 +1,22 @@
+CREATE TABLE `Sessions` (
+  `id` char(36) NOT NULL,
+  `user_email` varchar(45) NOT NULL,
+  `refresh_token_hash` char(64) NOT NULL,
+  `user_agent` varchar(255) DEFAULT NULL,
+  `ip_address` varchar(45) DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_used_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` timestamp NOT NULL,
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `refresh_token_hash` (`refresh_token_hash`),
+  KEY `user_email` (`user_email`),
+  CONSTRAINT `Sessions_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `RevokedTokens` (
+  `jti` char(36) NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  PRIMARY KEY (`jti`),
+  KEY `expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,17 @@
+ALTER TABLE `Users`
+  ADD COLUMN `email_verified_at` timestamp NULL DEFAULT NULL AFTER `driving_behavior`;
+
+-- Accounts created before verification existed are trusted as they are.
+UPDATE `Users` SET `email_verified_at` = `created_at`;
+
+CREATE TABLE `UserTokens` (
+  `token_hash` char(64) NOT NULL,
+  `user_email` varchar(45) NOT NULL,
+  `purpose` enum('PASSWORD_RESET','EMAIL_VERIFICATION') NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` timestamp NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`token_hash`),
+  KEY `user_email_purpose` (`user_email`,`purpose`),
+  CONSTRAINT `UserTokens_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
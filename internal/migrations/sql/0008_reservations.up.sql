@@ -0,0 +1,18 @@
+CREATE TABLE `Reservations` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_email` varchar(45) NOT NULL,
+  `car_license_plate` varchar(7) NOT NULL,
+  `start_time` timestamp NOT NULL,
+  `end_time` timestamp NOT NULL,
+  `status` enum('ACTIVE','FULFILLED','CANCELLED','EXPIRED') NOT NULL DEFAULT 'ACTIVE',
+  `trip_id` bigint DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `user_email` (`user_email`),
+  KEY `idx_reservations_car_status_start_time` (`car_license_plate`,`status`,`start_time`),
+  KEY `trip_id` (`trip_id`),
+  CONSTRAINT `Reservations_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE,
+  CONSTRAINT `Reservations_ibfk_2` FOREIGN KEY (`car_license_plate`) REFERENCES `Cars` (`license_plate`) ON DELETE CASCADE,
+  CONSTRAINT `Reservations_ibfk_3` FOREIGN KEY (`trip_id`) REFERENCES `Trips` (`id`) ON DELETE SET NULL,
+  CONSTRAINT `chk_reservations_window` CHECK (`end_time` > `start_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
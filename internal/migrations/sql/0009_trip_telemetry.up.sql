@@ -0,0 +1,16 @@
+-- Telemetry reported by the car during a trip. The table is partitioned by
+-- trip, and MySQL does not support foreign keys on partitioned tables, so
+-- the rows of deleted trips are removed by the application (see
+-- UserDB.DeleteUser).
+CREATE TABLE `TripTelemetry` (
+  `trip_id` bigint NOT NULL,
+  `recorded_at` timestamp(3) NOT NULL,
+  `latitude` decimal(9,6) NOT NULL,
+  `longitude` decimal(9,6) NOT NULL,
+  `speed` decimal(5,2) NOT NULL,
+  `acceleration` decimal(5,2) NOT NULL,
+  `harsh_braking` tinyint(1) NOT NULL DEFAULT '0',
+  `received_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`trip_id`,`recorded_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1
+PARTITION BY KEY (`trip_id`) PARTITIONS 16;
@@ -0,0 +1,13 @@
+ALTER TABLE `TripTelemetry`
+  DROP COLUMN `odometer`;
+
+UPDATE `Users` SET `driving_behavior` = LEAST(`driving_behavior`, 9.99);
+ALTER TABLE `Users`
+  MODIFY COLUMN `driving_behavior` decimal(3,2) DEFAULT NULL;
+
+UPDATE `Trips`
+SET `driving_behavior` = LEAST(`driving_behavior`, 9.99),
+    `distance` = LEAST(`distance`, 999.99);
+ALTER TABLE `Trips`
+  MODIFY COLUMN `driving_behavior` decimal(3,2) DEFAULT NULL,
+  MODIFY COLUMN `distance` decimal(5,2) DEFAULT NULL;
@@ -0,0 +1,12 @@
+-- Distance and driving behavior are computed by the API from telemetry, so
+-- they are widened to hold any value it can produce: scores go up to 10.00
+-- and trips may be longer than 999.99 km.
+ALTER TABLE `Trips`
+  MODIFY COLUMN `driving_behavior` decimal(4,2) DEFAULT NULL,
+  MODIFY COLUMN `distance` decimal(8,2) DEFAULT NULL;
+
+ALTER TABLE `Users`
+  MODIFY COLUMN `driving_behavior` decimal(4,2) DEFAULT NULL;
+
+ALTER TABLE `TripTelemetry`
+  ADD COLUMN `odometer` decimal(9,1) DEFAULT NULL AFTER `harsh_braking`;
@@ -0,0 +1,2 @@
+ALTER TABLE `Cars`
+  DROP COLUMN `category`;
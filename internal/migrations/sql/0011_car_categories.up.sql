@@ -0,0 +1,4 @@
+-- Cars without a cost_per_km of their own are priced by the per-km rate of
+-- their category.
+ALTER TABLE `Cars`
+  ADD COLUMN `category` enum('ECONOMY','STANDARD','PREMIUM','VAN') NOT NULL DEFAULT 'STANDARD' AFTER `cost_per_km`;
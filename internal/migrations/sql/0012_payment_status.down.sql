@@ -0,0 +1,5 @@
+ALTER TABLE `Payments`
+  DROP COLUMN `updated_at`,
+  DROP COLUMN `failure_reason`,
+  DROP COLUMN `provider_reference`,
+  DROP COLUMN `status`;
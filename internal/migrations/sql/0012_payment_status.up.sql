@@ -0,0 +1,10 @@
+-- Payments are charged through a payment provider. Payments recorded before
+-- this migration were never charged, and are treated as captured.
+ALTER TABLE `Payments`
+  ADD COLUMN `status` enum('PENDING','AUTHORIZED','CAPTURED','FAILED','REFUNDED') NOT NULL DEFAULT 'CAPTURED' AFTER `payment_method`,
+  ADD COLUMN `provider_reference` varchar(64) DEFAULT NULL AFTER `status`,
+  ADD COLUMN `failure_reason` varchar(255) DEFAULT NULL AFTER `provider_reference`,
+  ADD COLUMN `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER `failure_reason`;
+
+ALTER TABLE `Payments`
+  ALTER COLUMN `status` SET DEFAULT 'PENDING';
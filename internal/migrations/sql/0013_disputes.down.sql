@@ -0,0 +1,6 @@
+DELETE FROM `RolePermissions` WHERE `permission_name` = 'disputes:manage';
+DELETE FROM `Permissions` WHERE `name` = 'disputes:manage';
+
+DROP TABLE IF EXISTS `Refunds`;
+DROP TABLE IF EXISTS `DisputeEvents`;
+DROP TABLE IF EXISTS `Disputes`;
@@ -0,0 +1,53 @@
+-- Users dispute the charge of a trip, once per trip. Admins resolve disputes,
+-- and refunds are recorded in the Refunds ledger.
+CREATE TABLE `Disputes` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `trip_id` bigint NOT NULL,
+  `user_email` varchar(45) NOT NULL,
+  `reason` varchar(500) NOT NULL,
+  `status` enum('OPEN','APPROVED','REJECTED') NOT NULL DEFAULT 'OPEN',
+  `resolution` varchar(500) DEFAULT NULL,
+  `resolved_by` varchar(45) DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `resolved_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `trip_id` (`trip_id`),
+  KEY `user_email` (`user_email`),
+  KEY `status` (`status`,`created_at`),
+  CONSTRAINT `Disputes_ibfk_1` FOREIGN KEY (`trip_id`) REFERENCES `Payments` (`trip_id`) ON DELETE CASCADE,
+  CONSTRAINT `Disputes_ibfk_2` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `DisputeEvents` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `dispute_id` bigint NOT NULL,
+  `status` enum('OPEN','APPROVED','REJECTED') NOT NULL,
+  `actor` varchar(45) NOT NULL,
+  `note` varchar(500) DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `dispute_id` (`dispute_id`),
+  CONSTRAINT `DisputeEvents_ibfk_1` FOREIGN KEY (`dispute_id`) REFERENCES `Disputes` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `Refunds` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `trip_id` bigint NOT NULL,
+  `dispute_id` bigint DEFAULT NULL,
+  `amount` decimal(10,2) NOT NULL,
+  `provider_reference` varchar(64) DEFAULT NULL,
+  `created_by` varchar(45) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `trip_id` (`trip_id`),
+  KEY `dispute_id` (`dispute_id`),
+  CONSTRAINT `Refunds_ibfk_1` FOREIGN KEY (`trip_id`) REFERENCES `Payments` (`trip_id`) ON DELETE CASCADE,
+  CONSTRAINT `Refunds_ibfk_2` FOREIGN KEY (`dispute_id`) REFERENCES `Disputes` (`id`) ON DELETE SET NULL,
+  CONSTRAINT `chk_refunds_amount` CHECK (`amount` > 0)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+INSERT INTO `Permissions` VALUES
+  ('disputes:manage','Resolve disputes and refund payments');
+
+INSERT INTO `RolePermissions` VALUES
+  ('Admin','disputes:manage');
@@ -0,0 +1,18 @@
+-- Requests sent with an Idempotency-Key, with the response they got, so that
+-- retries are answered without handling the request again.
+CREATE TABLE `IdempotencyKeys` (
+  `user_email` varchar(45) NOT NULL,
+  `idempotency_key` varchar(255) NOT NULL,
+  `method` varchar(10) NOT NULL,
+  `path` varchar(255) NOT NULL,
+  `fingerprint` char(64) NOT NULL,
+  `response_status` smallint DEFAULT NULL,
+  `content_type` varchar(100) DEFAULT NULL,
+  `response_body` mediumblob,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` timestamp NULL DEFAULT NULL,
+  `expires_at` timestamp NOT NULL,
+  PRIMARY KEY (`user_email`,`idempotency_key`),
+  KEY `expires_at` (`expires_at`),
+  CONSTRAINT `IdempotencyKeys_ibfk_1` FOREIGN KEY (`user_email`) REFERENCES `Users` (`email`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
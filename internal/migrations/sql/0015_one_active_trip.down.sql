@@ -0,0 +1,3 @@
+ALTER TABLE `Trips`
+  DROP KEY `one_active_trip_per_car`,
+  DROP KEY `one_active_trip_per_user`;
@@ -0,0 +1,5 @@
+-- A user drives and a car is driven on one trip at a time. Trips that have
+-- ended index as NULL, which the unique keys allow any number of.
+ALTER TABLE `Trips`
+  ADD UNIQUE KEY `one_active_trip_per_user` ((IF(`end_time` IS NULL, `user_email`, NULL))),
+  ADD UNIQUE KEY `one_active_trip_per_car` ((IF(`end_time` IS NULL, `car_license_plate`, NULL)));
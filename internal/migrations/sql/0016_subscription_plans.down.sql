@@ -0,0 +1,30 @@
+-- Only the latest version of the original plans is kept, and subscriptions
+-- to other plans are removed.
+DELETE FROM `RolePermissions` WHERE `permission_name` = 'subscriptions:manage';
+DELETE FROM `Permissions` WHERE `name` = 'subscriptions:manage';
+
+CREATE TABLE `Subscriptions` (
+  `name` enum('1_MONTH','3_MONTHS','1_YEAR') NOT NULL,
+  `price_per_month` decimal(5,2) NOT NULL,
+  `description` mediumtext,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+INSERT INTO `Subscriptions`
+SELECT p.`name`, p.`price_per_month`, p.`description`
+FROM `SubscriptionPlans` p
+WHERE p.`name` IN ('1_MONTH','3_MONTHS','1_YEAR')
+AND p.`version` = (SELECT MAX(`version`) FROM `SubscriptionPlans` WHERE `name` = p.`name`);
+
+DELETE FROM `UserSubscriptions` WHERE `subscription_name` NOT IN (SELECT `name` FROM `Subscriptions`);
+
+ALTER TABLE `UserSubscriptions`
+  DROP FOREIGN KEY `UserSubscriptions_ibfk_2`,
+  DROP KEY `plan_id`,
+  DROP COLUMN `plan_id`,
+  MODIFY `subscription_name` enum('1_MONTH','3_MONTHS','1_YEAR') NOT NULL;
+
+ALTER TABLE `UserSubscriptions`
+  ADD CONSTRAINT `UserSubscriptions_ibfk_2` FOREIGN KEY (`subscription_name`) REFERENCES `Subscriptions` (`name`);
+
+DROP TABLE `SubscriptionPlans`;
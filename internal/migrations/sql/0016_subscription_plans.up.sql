@@ -0,0 +1,53 @@
+-- Subscription plans are managed by admins instead of being fixed in an
+-- ENUM. Editing a plan adds a new version of it, and user subscriptions keep
+-- the version they bought.
+CREATE TABLE `SubscriptionPlans` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `name` varchar(45) NOT NULL,
+  `version` int NOT NULL,
+  `description` mediumtext,
+  `duration_months` smallint NOT NULL,
+  `price_per_month` decimal(10,2) NOT NULL,
+  `included_km` decimal(8,2) DEFAULT NULL,
+  `included_minutes` int DEFAULT NULL,
+  `km_discount` decimal(3,2) NOT NULL DEFAULT '0.00',
+  `categories` set('ECONOMY','STANDARD','PREMIUM','VAN') NOT NULL DEFAULT '',
+  `visible_from` timestamp NULL DEFAULT NULL,
+  `visible_until` timestamp NULL DEFAULT NULL,
+  `retired_at` timestamp NULL DEFAULT NULL,
+  `created_by` varchar(45) DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `name_version` (`name`,`version`),
+  CONSTRAINT `chk_subscription_plans_duration` CHECK (`duration_months` > 0),
+  CONSTRAINT `chk_subscription_plans_price` CHECK (`price_per_month` > 0),
+  CONSTRAINT `chk_subscription_plans_km_discount` CHECK (`km_discount` BETWEEN 0 AND 1)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+INSERT INTO `SubscriptionPlans` (`name`, `version`, `description`, `duration_months`, `price_per_month`)
+SELECT `name`, 1, `description`,
+  CASE `name` WHEN '1_MONTH' THEN 1 WHEN '3_MONTHS' THEN 3 ELSE 12 END,
+  `price_per_month`
+FROM `Subscriptions`;
+
+ALTER TABLE `UserSubscriptions`
+  DROP FOREIGN KEY `UserSubscriptions_ibfk_2`,
+  MODIFY `subscription_name` varchar(45) NOT NULL,
+  ADD COLUMN `plan_id` bigint DEFAULT NULL AFTER `subscription_name`;
+
+UPDATE `UserSubscriptions` us
+JOIN `SubscriptionPlans` p ON p.`name` = us.`subscription_name`
+SET us.`plan_id` = p.`id`;
+
+ALTER TABLE `UserSubscriptions`
+  MODIFY `plan_id` bigint NOT NULL,
+  ADD KEY `plan_id` (`plan_id`),
+  ADD CONSTRAINT `UserSubscriptions_ibfk_2` FOREIGN KEY (`plan_id`) REFERENCES `SubscriptionPlans` (`id`);
+
+DROP TABLE `Subscriptions`;
+
+INSERT INTO `Permissions` VALUES
+  ('subscriptions:manage','Create, edit and retire subscription plans');
+
+INSERT INTO `RolePermissions` VALUES
+  ('Admin','subscriptions:manage');
@@ -0,0 +1,10 @@
+DROP TABLE `SubscriptionCharges`;
+
+ALTER TABLE `UserSubscriptions`
+  DROP KEY `renewals`,
+  DROP COLUMN `next_renewal_attempt`,
+  DROP COLUMN `grace_until`,
+  DROP COLUMN `payment_method`,
+  DROP COLUMN `cancelled_at`,
+  DROP COLUMN `cancel_at_period_end`,
+  DROP COLUMN `auto_renew`;
@@ -0,0 +1,32 @@
+-- Subscriptions can renew automatically and be cancelled at the end of the
+-- paid period. Every purchase and renewal is charged through the payment
+-- provider and recorded in SubscriptionCharges.
+ALTER TABLE `UserSubscriptions`
+  ADD COLUMN `auto_renew` bit(1) NOT NULL DEFAULT b'0' AFTER `is_cancelled`,
+  ADD COLUMN `cancel_at_period_end` bit(1) NOT NULL DEFAULT b'0' AFTER `auto_renew`,
+  ADD COLUMN `cancelled_at` timestamp NULL DEFAULT NULL AFTER `cancel_at_period_end`,
+  ADD COLUMN `payment_method` enum('CARD','CRYPTO') NOT NULL DEFAULT 'CARD' AFTER `cancelled_at`,
+  ADD COLUMN `grace_until` timestamp NULL DEFAULT NULL AFTER `payment_method`,
+  ADD COLUMN `next_renewal_attempt` timestamp NULL DEFAULT NULL AFTER `grace_until`,
+  ADD KEY `renewals` (`auto_renew`,`end_date`);
+
+CREATE TABLE `SubscriptionCharges` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_subscription_id` bigint NOT NULL,
+  `kind` enum('PURCHASE','RENEWAL') NOT NULL,
+  `plan_id` bigint NOT NULL,
+  `amount` decimal(10,2) NOT NULL,
+  `payment_method` enum('CARD','CRYPTO') NOT NULL,
+  `status` enum('PENDING','AUTHORIZED','CAPTURED','FAILED','REFUNDED') NOT NULL DEFAULT 'PENDING',
+  `provider_reference` varchar(64) DEFAULT NULL,
+  `failure_reason` varchar(255) DEFAULT NULL,
+  `period_end` date NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `user_subscription_id` (`user_subscription_id`),
+  KEY `plan_id` (`plan_id`),
+  CONSTRAINT `SubscriptionCharges_ibfk_1` FOREIGN KEY (`user_subscription_id`) REFERENCES `UserSubscriptions` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `SubscriptionCharges_ibfk_2` FOREIGN KEY (`plan_id`) REFERENCES `SubscriptionPlans` (`id`),
+  CONSTRAINT `chk_subscription_charges_amount` CHECK (`amount` > 0)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,8 @@
+DROP TABLE `SubscriptionUsage`;
+
+ALTER TABLE `SubscriptionPlans`
+  MODIFY `included_km` decimal(8,2) DEFAULT NULL,
+  MODIFY `included_minutes` int DEFAULT NULL,
+  DROP CHECK `chk_subscription_plans_overage`,
+  DROP COLUMN `overage_per_minute`,
+  DROP COLUMN `overage_per_km`;
@@ -0,0 +1,35 @@
+-- Subscriptions cover trips up to the monthly allowances of their plan, and
+-- the usage beyond them is charged at the overage rates of the plan.
+ALTER TABLE `SubscriptionPlans`
+  ADD COLUMN `overage_per_km` decimal(10,2) DEFAULT NULL AFTER `km_discount`,
+  ADD COLUMN `overage_per_minute` decimal(10,2) DEFAULT NULL AFTER `overage_per_km`,
+  ADD CONSTRAINT `chk_subscription_plans_overage` CHECK (`overage_per_km` > 0 AND `overage_per_minute` > 0);
+
+-- Plans had no allowances, and covered trips without a limit. The plans on
+-- sale until now get monthly allowances and overage rates, and every plan
+-- has allowances from now on.
+UPDATE `SubscriptionPlans`
+SET `included_km` = COALESCE(`included_km`, CASE `name` WHEN '1_MONTH' THEN 500 WHEN '3_MONTHS' THEN 400 ELSE 300 END),
+  `included_minutes` = COALESCE(`included_minutes`, CASE `name` WHEN '1_MONTH' THEN 1500 WHEN '3_MONTHS' THEN 1200 ELSE 900 END),
+  `overage_per_km` = COALESCE(`overage_per_km`, 0.30),
+  `overage_per_minute` = COALESCE(`overage_per_minute`, 0.08)
+WHERE `included_km` IS NULL OR `included_minutes` IS NULL;
+
+ALTER TABLE `SubscriptionPlans`
+  MODIFY `included_km` decimal(8,2) NOT NULL,
+  MODIFY `included_minutes` int NOT NULL;
+
+CREATE TABLE `SubscriptionUsage` (
+  `trip_id` bigint NOT NULL,
+  `user_subscription_id` bigint NOT NULL,
+  `km` decimal(8,2) NOT NULL,
+  `minutes` int NOT NULL,
+  `overage_km` decimal(8,2) NOT NULL DEFAULT '0.00',
+  `overage_minutes` int NOT NULL DEFAULT '0',
+  `overage_amount` decimal(10,2) NOT NULL DEFAULT '0.00',
+  `recorded_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`trip_id`),
+  KEY `user_subscription_id` (`user_subscription_id`,`recorded_at`),
+  CONSTRAINT `SubscriptionUsage_ibfk_1` FOREIGN KEY (`trip_id`) REFERENCES `Trips` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `SubscriptionUsage_ibfk_2` FOREIGN KEY (`user_subscription_id`) REFERENCES `UserSubscriptions` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
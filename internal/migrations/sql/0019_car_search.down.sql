@@ -0,0 +1,3 @@
+ALTER TABLE `Cars`
+  DROP KEY `ft_cars`,
+  DROP KEY `status`;
@@ -0,0 +1,5 @@
+-- Indexes for /cars/search: the filters on status and category, and the free
+-- text search over make, model and location.
+ALTER TABLE `Cars`
+  ADD KEY `status` (`status`, `category`),
+  ADD FULLTEXT KEY `ft_cars` (`make`, `model`, `location`);
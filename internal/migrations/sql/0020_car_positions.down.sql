@@ -0,0 +1,3 @@
+ALTER TABLE `Cars`
+  DROP KEY `position`,
+  DROP COLUMN `position`;
@@ -0,0 +1,22 @@
+-- Cars are positioned by coordinates, kept in an SRID 4326 POINT (latitude
+-- first, like MySQL reads its WKT) under a spatial index for the queries of
+-- /available/nearby. A spatial index needs a NOT NULL column, so existing
+-- cars are placed in the neighbourhood of their location, or at the centre
+-- of Thessaloniki.
+ALTER TABLE `Cars`
+  ADD COLUMN `position` point SRID 4326 DEFAULT NULL AFTER `location`;
+
+UPDATE `Cars`
+SET `position` = ST_PointFromText(CASE `location`
+  WHEN 'KAMARA' THEN 'POINT(40.6320 22.9515)'
+  WHEN 'VOTSI' THEN 'POINT(40.6135 22.9576)'
+  WHEN 'THERMAIKOS' THEN 'POINT(40.5230 22.9380)'
+  WHEN 'SYNERGEIO' THEN 'POINT(40.6068 22.9622)'
+  WHEN 'KALAMARIA' THEN 'POINT(40.5825 22.9500)'
+  WHEN 'PANORAMA' THEN 'POINT(40.5880 23.0310)'
+  ELSE 'POINT(40.6324 22.9408)'
+END, 4326);
+
+ALTER TABLE `Cars`
+  MODIFY `position` point NOT NULL SRID 4326,
+  ADD SPATIAL KEY `position` (`position`);
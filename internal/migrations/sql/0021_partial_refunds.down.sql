@@ -0,0 +1,4 @@
+UPDATE `Payments` SET `status` = 'CAPTURED' WHERE `status` = 'PARTIALLY_REFUNDED';
+
+ALTER TABLE `Payments`
+  MODIFY COLUMN `status` enum('PENDING','AUTHORIZED','CAPTURED','FAILED','REFUNDED') NOT NULL DEFAULT 'PENDING';
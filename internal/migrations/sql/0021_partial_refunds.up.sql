@@ -0,0 +1,3 @@
+-- A payment refunded in part is no longer CAPTURED in full.
+ALTER TABLE `Payments`
+  MODIFY COLUMN `status` enum('PENDING','AUTHORIZED','CAPTURED','FAILED','PARTIALLY_REFUNDED','REFUNDED') NOT NULL DEFAULT 'PENDING';
@@ -0,0 +1,10 @@
+-- Keep the latest dispute of every trip.
+DELETE `older`
+FROM `Disputes` `older`
+JOIN `Disputes` `newer` ON `newer`.`trip_id` = `older`.`trip_id` AND `newer`.`id` > `older`.`id`;
+
+ALTER TABLE `Disputes`
+  DROP KEY `trip_id`,
+  ADD UNIQUE KEY `trip_id` (`trip_id`),
+  DROP KEY `open_trip_id`,
+  DROP COLUMN `open_trip_id`;
@@ -0,0 +1,8 @@
+-- What is left of a partially refunded payment can be disputed again once
+-- the previous dispute is resolved, so a trip may have several disputes, but
+-- only one of them open at a time.
+ALTER TABLE `Disputes`
+  ADD COLUMN `open_trip_id` bigint GENERATED ALWAYS AS (IF(`status` = 'OPEN', `trip_id`, NULL)) VIRTUAL AFTER `trip_id`,
+  ADD UNIQUE KEY `open_trip_id` (`open_trip_id`),
+  DROP KEY `trip_id`,
+  ADD KEY `trip_id` (`trip_id`);
@@ -0,0 +1,4 @@
+DELETE FROM `Refunds` WHERE `status` = 'FAILED';
+
+ALTER TABLE `Refunds`
+  DROP COLUMN `status`;
@@ -0,0 +1,8 @@
+-- Refunds are written to the ledger as PENDING before the provider is asked
+-- for them, and settled as COMPLETED or FAILED once it answered, so that a
+-- refund the provider made is never missing from the ledger. The refunds
+-- recorded so far were all made.
+ALTER TABLE `Refunds`
+  ADD COLUMN `status` enum('PENDING','COMPLETED','FAILED') NOT NULL DEFAULT 'PENDING' AFTER `amount`;
+
+UPDATE `Refunds` SET `status` = 'COMPLETED';
@@ -0,0 +1,2 @@
+DELETE FROM `RolePermissions` WHERE `permission_name` IN ('users:self','subscriptions:read');
+DELETE FROM `Permissions` WHERE `name` IN ('users:self','subscriptions:read');
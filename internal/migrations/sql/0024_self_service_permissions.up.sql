@@ -0,0 +1,11 @@
+-- Users reach their own account and subscriptions through permissions too,
+-- like every other route.
+INSERT INTO `Permissions` VALUES
+  ('users:self','Manage your own account, sessions and settings'),
+  ('subscriptions:read','Read your own subscriptions and their usage');
+
+INSERT INTO `RolePermissions` VALUES
+  ('Admin','users:self'),
+  ('Admin','subscriptions:read'),
+  ('Client','users:self'),
+  ('Client','subscriptions:read');
@@ -1,7 +1,12 @@
 package models
 
 import (
+	"strings"
+	"unicode"
+
 	_ "github.com/go-playground/validator/v10"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type Status string
@@ -12,11 +17,80 @@ const (
 	Maintenance Status = "MAINTENANCE"
 )
 
+// Category groups cars that are priced alike.
+type Category string
+
+const (
+	Economy  Category = "ECONOMY"
+	Standard Category = "STANDARD"
+	Premium  Category = "PREMIUM"
+	Van      Category = "VAN"
+)
+
 type Car struct {
-	LicensePlate string   `json:"license_plate" validate:"required,len=7,alphanum,licenseplate"`
-	Make         string   `json:"make" validate:"required,max=45"`
-	Model        string   `json:"model" validate:"required,max=45"`
-	Status       Status   `json:"status" validate:"required,oneof=AVAILABLE RENTED MAINTENANCE"`
-	CostPerKm    *float64 `json:"cost_per_km,omitempty" validate:"omitempty,gt=0"`
-	Location     string   `json:"location,omitempty" validate:"omitempty,max=255"`
+	LicensePlate string        `json:"license_plate" validate:"required,len=7,alphanum,licenseplate"`
+	Make         string        `json:"make" validate:"required,max=45"`
+	Model        string        `json:"model" validate:"required,max=45"`
+	Status       Status        `json:"status" validate:"required,oneof=AVAILABLE RENTED MAINTENANCE"`
+	CostPerKm    *money.Amount `json:"cost_per_km,omitempty" validate:"omitempty,gt=0"`
+	Category     Category      `json:"category,omitempty" validate:"omitempty,oneof=ECONOMY STANDARD PREMIUM VAN"`
+	Location     string        `json:"location,omitempty" validate:"omitempty,max=255"`
+	// Latitude and Longitude are where the car was last parked.
+	Latitude  *float64 `json:"latitude,omitempty" validate:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" validate:"required,min=-180,max=180"`
+}
+
+// NearbyCar is a car found around a position, Distance km away from it.
+type NearbyCar struct {
+	Car
+	Distance float64 `json:"distance"`
+}
+
+// CarSortField is a column the fleet can be sorted by.
+type CarSortField string
+
+const (
+	SortByLicensePlate CarSortField = "license_plate"
+	SortByMake         CarSortField = "make"
+	SortByModel        CarSortField = "model"
+	SortByStatus       CarSortField = "status"
+	SortByCostPerKm    CarSortField = "cost_per_km"
+	SortByCategory     CarSortField = "category"
+	SortByLocation     CarSortField = "location"
+)
+
+// Valid reports whether the fleet can be sorted by f.
+func (f CarSortField) Valid() bool {
+	switch f {
+	case SortByLicensePlate, SortByMake, SortByModel, SortByStatus, SortByCostPerKm, SortByCategory, SortByLocation:
+		return true
+	}
+	return false
+}
+
+// CarSearch filters, sorts and pages the fleet. Zero fields do not filter.
+type CarSearch struct {
+	Status   Status
+	Make     string
+	Model    string
+	Location string
+	Category Category
+	// MinCostPerKm and MaxCostPerKm only match cars with a cost per km of
+	// their own.
+	MinCostPerKm *money.Amount
+	MaxCostPerKm *money.Amount
+	// Text matches cars with a word of their make, model or location
+	// starting with every word of it.
+	Text       string
+	Sort       CarSortField
+	Descending bool
+	Page       int
+	PageSize   int
+}
+
+// Terms returns the words of the free text search.
+func (s CarSearch) Terms() []string {
+	return strings.FieldsFunc(s.Text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+type DisputeStatus string
+
+const (
+	DisputeOpen     DisputeStatus = "OPEN"
+	DisputeApproved DisputeStatus = "APPROVED"
+	DisputeRejected DisputeStatus = "REJECTED"
+)
+
+// Dispute contests the charge of a trip. Disputes are opened by the user who
+// took the trip and resolved by an admin, who refunds part or all of the
+// payment when approving one.
+type Dispute struct {
+	ID         int64          `json:"id"`
+	TripID     int64          `json:"trip_id"`
+	UserEmail  string         `json:"user_email"`
+	Reason     string         `json:"reason"`
+	Status     DisputeStatus  `json:"status"`
+	Resolution string         `json:"resolution,omitempty"`
+	ResolvedBy string         `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ResolvedAt *time.Time     `json:"resolved_at,omitempty"`
+	History    []DisputeEvent `json:"history,omitempty"`
+}
+
+// DisputeEvent records a status a dispute went through, and who moved it
+// there.
+type DisputeEvent struct {
+	Status    DisputeStatus `json:"status"`
+	Actor     string        `json:"actor"`
+	Note      string        `json:"note,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type RefundStatus string
+
+// Refunds are PENDING while the provider is asked for them, and COMPLETED or
+// FAILED once it answered.
+const (
+	RefundPending   RefundStatus = "PENDING"
+	RefundCompleted RefundStatus = "COMPLETED"
+	RefundFailed    RefundStatus = "FAILED"
+)
+
+// Refund is an entry of the refund ledger: an amount paid back on the
+// payment of a trip.
+type Refund struct {
+	ID                int64        `json:"id"`
+	TripID            int64        `json:"trip_id"`
+	DisputeID         *int64       `json:"dispute_id,omitempty"`
+	Amount            money.Amount `json:"amount"`
+	Status            RefundStatus `json:"status"`
+	ProviderReference string       `json:"provider_reference,omitempty"`
+	CreatedBy         string       `json:"created_by"`
+	CreatedAt         time.Time    `json:"created_at"`
+}
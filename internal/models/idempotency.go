@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// IdempotencyKeyMaxLength is the longest Idempotency-Key header accepted.
+const IdempotencyKeyMaxLength = 255
+
+// IdempotentRequest records a request made with an Idempotency-Key, so that
+// retries of it get the same response instead of repeating its effects. Keys
+// are scoped to the user who sent them.
+type IdempotentRequest struct {
+	UserEmail   string
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	// The response is only known once CompletedAt is set. Until then the
+	// request is still being handled.
+	CompletedAt    *time.Time
+	ResponseStatus int
+	ContentType    string
+	ResponseBody   []byte
+}
+
+// Completed reports whether the response of the request was stored.
+func (r IdempotentRequest) Completed() bool {
+	return r.CompletedAt != nil
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	_ "github.com/go-playground/validator/v10"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type PaymentMethod string
@@ -14,9 +16,58 @@ const (
 	Crypto PaymentMethod = "CRYPTO"
 )
 
+// PaymentStatus tracks a payment through the payment provider. Payments start
+// PENDING, are AUTHORIZED and then CAPTURED, and a captured payment can be
+// PARTIALLY_REFUNDED and then REFUNDED once nothing is left to refund. A
+// payment the provider declines ends up FAILED.
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "PENDING"
+	PaymentAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentCaptured   PaymentStatus = "CAPTURED"
+	PaymentFailed     PaymentStatus = "FAILED"
+	PaymentRefunded   PaymentStatus = "REFUNDED"
+
+	PaymentPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+)
+
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentPending:    {PaymentAuthorized, PaymentFailed},
+	PaymentAuthorized: {PaymentCaptured, PaymentFailed},
+	PaymentCaptured:   {PaymentPartiallyRefunded, PaymentRefunded},
+
+	PaymentPartiallyRefunded: {PaymentPartiallyRefunded, PaymentRefunded},
+}
+
+// CanTransitionTo reports whether a payment in status s may move to next.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentStatusesBefore returns the statuses a payment may move to next from.
+func PaymentStatusesBefore(next PaymentStatus) []PaymentStatus {
+	var statuses []PaymentStatus
+	for _, status := range []PaymentStatus{PaymentPending, PaymentAuthorized, PaymentCaptured, PaymentFailed, PaymentPartiallyRefunded, PaymentRefunded} {
+		if status.CanTransitionTo(next) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
 type Payment struct {
-	TripID        int           `json:"trip_id" validate:"required,gt=0"`
-	Amount        float64       `json:"amount" validate:"required,gt=0,max=99999999.99"`
-	PaymentTime   time.Time     `json:"payment_time" validate:"required"`
-	PaymentMethod PaymentMethod `json:"payment_method" validate:"required,oneof=SUBSCRIPTION CARD CRYPTO"`
+	TripID            int           `json:"trip_id" validate:"required,gt=0"`
+	Amount            money.Amount  `json:"amount" validate:"required,gt=0"`
+	PaymentTime       time.Time     `json:"payment_time" validate:"required"`
+	PaymentMethod     PaymentMethod `json:"payment_method" validate:"required,oneof=SUBSCRIPTION CARD CRYPTO"`
+	Status            PaymentStatus `json:"status"`
+	ProviderReference string        `json:"provider_reference,omitempty"`
+	FailureReason     string        `json:"failure_reason,omitempty"`
+	UpdatedAt         time.Time     `json:"updated_at"`
 }
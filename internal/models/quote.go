@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// QuoteItem is one line of a price quote. Items charged by the unit carry
+// their Quantity and Rate, and items that scale other charges their Factor.
+type QuoteItem struct {
+	Code        string       `json:"code"`
+	Description string       `json:"description"`
+	Quantity    float64      `json:"quantity,omitempty"`
+	Unit        string       `json:"unit,omitempty"`
+	Rate        money.Amount `json:"rate,omitempty"`
+	Factor      float64      `json:"factor,omitempty"`
+	Amount      money.Amount `json:"amount"`
+}
+
+// Quote is an itemised price. Total is the sum of the item amounts.
+type Quote struct {
+	Items    []QuoteItem    `json:"items"`
+	Total    money.Amount   `json:"total"`
+	Currency money.Currency `json:"currency"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationActive    ReservationStatus = "ACTIVE"
+	ReservationFulfilled ReservationStatus = "FULFILLED"
+	ReservationCancelled ReservationStatus = "CANCELLED"
+	ReservationExpired   ReservationStatus = "EXPIRED"
+)
+
+const (
+	// ReservationHoldLead is how long before its start an active
+	// reservation keeps other users from starting a trip on the car.
+	ReservationHoldLead = 30 * time.Minute
+	// ReservationNoShowGrace is how long after its start a reservation waits
+	// for the trip to be started before it expires.
+	ReservationNoShowGrace = 15 * time.Minute
+)
+
+type Reservation struct {
+	ID              int64             `json:"id"`
+	UserEmail       string            `json:"user_email"`
+	CarLicensePlate string            `json:"car_license_plate"`
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	Status          ReservationStatus `json:"status"`
+	TripID          *int64            `json:"trip_id,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// HeldAt reports whether the reservation keeps the car for its user at t.
+func (r Reservation) HeldAt(t time.Time) bool {
+	return r.Status == ReservationActive &&
+		!t.Before(r.StartTime.Add(-ReservationHoldLead)) &&
+		t.Before(r.StartTime.Add(ReservationNoShowGrace))
+}
@@ -0,0 +1,21 @@
+package models
+
+// Roles a user can be assigned. Each one is a row in the Roles table.
+const (
+	AdminRole  = "Admin"
+	ClientRole = "Client"
+)
+
+// Permissions are granted to roles through the RolePermissions table.
+const (
+	PermissionUsersSelf           = "users:self"
+	PermissionCarsRead            = "cars:read"
+	PermissionCarsWrite           = "cars:write"
+	PermissionTripsRead           = "trips:read"
+	PermissionTripsWrite          = "trips:write"
+	PermissionReviewsWrite        = "reviews:write"
+	PermissionSubscriptionsRead   = "subscriptions:read"
+	PermissionSubscriptionsWrite  = "subscriptions:write"
+	PermissionDisputesManage      = "disputes:manage"
+	PermissionSubscriptionsManage = "subscriptions:manage"
+)
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login on one device. It holds the refresh token, of which
+// only the hash is stored, and every access token issued for it carries its
+// ID.
+type Session struct {
+	ID         string     `json:"id"`
+	UserEmail  string     `json:"-"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
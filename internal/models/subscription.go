@@ -1,19 +1,84 @@
 package models
 
 import (
+	"time"
+
 	_ "github.com/go-playground/validator/v10"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
+// SubscriptionName names a subscription plan.
 type SubscriptionName string
 
+// The plans the seed migration creates.
 const (
 	OneMonth    SubscriptionName = "1_MONTH"
 	ThreeMonths SubscriptionName = "3_MONTHS"
 	OneYear     SubscriptionName = "1_YEAR"
 )
 
-type Subscription struct {
-	Name          SubscriptionName `json:"name" validate:"required,oneof=1_MONTH 3_MONTHS 1_YEAR"`
-	PricePerMonth float64          `json:"price_per_month" validate:"required,gt=0"`
-	Description   string           `json:"description,omitempty" validate:"omitempty,max=16777215"`
+// SubscriptionPlan is a version of a plan users can subscribe to. Admins
+// edit a plan by adding a new version, so that existing subscriptions keep
+// the terms they bought.
+type SubscriptionPlan struct {
+	ID             int64            `json:"id"`
+	Name           SubscriptionName `json:"name"`
+	Version        int              `json:"version"`
+	Description    string           `json:"description,omitempty" validate:"omitempty,max=16777215"`
+	DurationMonths int              `json:"duration_months" validate:"required,min=1,max=120"`
+	PricePerMonth  money.Amount     `json:"price_per_month" validate:"required,gt=0"`
+	// IncludedKm and IncludedMinutes are the allowance per month. Every
+	// plan has them; a plan without one covers none of that usage.
+	IncludedKm      *float64 `json:"included_km" validate:"required,gte=0"`
+	IncludedMinutes *int     `json:"included_minutes" validate:"required,gte=0"`
+	// KmDiscount is the share taken off the per-km rate of the car for the
+	// km over the allowance, from 0 to 1.
+	KmDiscount float64 `json:"km_discount" validate:"min=0,max=1"`
+	// OveragePerKm and OveragePerMinute charge the usage over the allowance.
+	// Without them, the km are charged at the rate of the car less
+	// KmDiscount and the minutes at the usual rate.
+	OveragePerKm     *money.Amount `json:"overage_per_km,omitempty" validate:"omitempty,gt=0"`
+	OveragePerMinute *money.Amount `json:"overage_per_minute,omitempty" validate:"omitempty,gt=0"`
+	// Categories are the car categories the plan covers, all of them when
+	// empty.
+	Categories   []Category `json:"categories,omitempty" validate:"dive,oneof=ECONOMY STANDARD PREMIUM VAN"`
+	VisibleFrom  *time.Time `json:"visible_from,omitempty"`
+	VisibleUntil *time.Time `json:"visible_until,omitempty"`
+	RetiredAt    *time.Time `json:"retired_at,omitempty"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Purchasable reports whether the plan can be bought at now: it has not been
+// retired and now is within its visibility window.
+func (p SubscriptionPlan) Purchasable(now time.Time) bool {
+	if p.RetiredAt != nil {
+		return false
+	}
+	if p.VisibleFrom != nil && now.Before(*p.VisibleFrom) {
+		return false
+	}
+	if p.VisibleUntil != nil && !now.Before(*p.VisibleUntil) {
+		return false
+	}
+	return true
+}
+
+// Price is what a period of the plan costs.
+func (p SubscriptionPlan) Price() money.Amount {
+	return p.PricePerMonth.Mul(float64(p.DurationMonths))
+}
+
+// Covers reports whether the plan covers trips on cars of category.
+func (p SubscriptionPlan) Covers(category Category) bool {
+	if len(p.Categories) == 0 {
+		return true
+	}
+	for _, covered := range p.Categories {
+		if covered == category {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// TelemetryPoint is a sample reported by a car during a trip. Speed is in
+// km/h, acceleration in m/s², negative when slowing down, and the optional
+// odometer reading in km.
+type TelemetryPoint struct {
+	RecordedAt   time.Time `json:"recorded_at" validate:"required"`
+	Latitude     float64   `json:"latitude" validate:"min=-90,max=90"`
+	Longitude    float64   `json:"longitude" validate:"min=-180,max=180"`
+	Speed        float64   `json:"speed" validate:"min=0,max=300"`
+	Acceleration float64   `json:"acceleration" validate:"min=-30,max=30"`
+	HarshBraking bool      `json:"harsh_braking"`
+	Odometer     *float64  `json:"odometer,omitempty" validate:"omitempty,min=0"`
+}
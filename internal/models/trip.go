@@ -4,6 +4,8 @@ import (
 	"time"
 
 	_ "github.com/go-playground/validator/v10"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type Trip struct {
@@ -24,6 +26,26 @@ type PayloadTrip struct {
 	EndTime         *time.Time    `json:"end_time,omitempty"`
 	DrivingBehavior *float64      `json:"driving_behavior,omitempty"`
 	Distance        float64       `json:"distance"`
-	Amount          float64       `json:"amount"`
+	Amount          money.Amount  `json:"amount"`
+	PaymentMethod   PaymentMethod `json:"payment_method"`
+	PaymentStatus   PaymentStatus `json:"payment_status,omitempty"`
+}
+
+// TripReceipt is what a trip was billed and rated on when it ended.
+type TripReceipt struct {
+	TripID          int64         `json:"trip_id"`
+	CarLicensePlate string        `json:"car_license_plate"`
+	StartTime       time.Time     `json:"start_time"`
+	EndTime         time.Time     `json:"end_time"`
+	Distance        float64       `json:"distance"`
+	DistanceSource  string        `json:"distance_source"`
+	TelemetryPoints int           `json:"telemetry_points"`
+	DrivingBehavior float64       `json:"driving_behavior"`
+	Quote           Quote         `json:"quote"`
+	Amount          money.Amount  `json:"amount"`
 	PaymentMethod   PaymentMethod `json:"payment_method"`
+	PaymentStatus   PaymentStatus `json:"payment_status"`
+	// Usage is what the trip took from the allowance of the subscription
+	// that covered it.
+	Usage *TripUsage `json:"usage,omitempty"`
 }
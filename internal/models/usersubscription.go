@@ -4,13 +4,109 @@ import (
 	"time"
 
 	_ "github.com/go-playground/validator/v10"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
 )
 
 type UserSubscription struct {
 	ID               int64            `json:"id,omitempty"`
 	UserEmail        string           `json:"user_email,omitempty"`
-	SubscriptionName SubscriptionName `json:"subscription_name" validate:"required,oneof=1_MONTH 3_MONTHS 1_YEAR"`
+	SubscriptionName SubscriptionName `json:"subscription_name" validate:"required,max=45"`
+	PlanID           int64            `json:"plan_id,omitempty"`
 	StartDate        time.Time        `json:"start_date,omitempty"`
 	EndDate          time.Time        `json:"end_date,omitempty"`
 	IsCancelled      bool             `json:"is_cancelled,omitempty"`
+	// AutoRenew charges the subscription for another period when it ends.
+	AutoRenew bool `json:"auto_renew"`
+	// CancelAtPeriodEnd is set when the user cancelled the subscription but
+	// keeps it until EndDate.
+	CancelAtPeriodEnd bool          `json:"cancel_at_period_end,omitempty"`
+	CancelledAt       *time.Time    `json:"cancelled_at,omitempty"`
+	PaymentMethod     PaymentMethod `json:"payment_method,omitempty" validate:"omitempty,oneof=CARD CRYPTO"`
+	// GraceUntil keeps a subscription whose renewal failed active while the
+	// renewal is retried.
+	GraceUntil         *time.Time `json:"grace_until,omitempty"`
+	NextRenewalAttempt *time.Time `json:"-"`
+	// Plan is the version of the plan the subscription was bought with, or
+	// last renewed on.
+	Plan    *SubscriptionPlan    `json:"plan,omitempty"`
+	Charges []SubscriptionCharge `json:"charges,omitempty"`
+}
+
+// Active reports whether the subscription covers trips at now.
+func (s UserSubscription) Active(now time.Time) bool {
+	if s.IsCancelled {
+		return false
+	}
+	return s.EndDate.After(now) || (s.GraceUntil != nil && s.GraceUntil.After(now))
+}
+
+// UsagePeriod returns the month of the subscription that now falls in.
+// Allowances are counted by the month from the start date.
+func (s UserSubscription) UsagePeriod(now time.Time) (time.Time, time.Time) {
+	months := 0
+	for !s.StartDate.AddDate(0, months+1, 0).After(now) {
+		months++
+	}
+	return s.StartDate.AddDate(0, months, 0), s.StartDate.AddDate(0, months+1, 0)
+}
+
+// CancellationMode is how a subscription is cancelled.
+type CancellationMode string
+
+const (
+	// CancelImmediately ends the subscription now.
+	CancelImmediately CancellationMode = "IMMEDIATE"
+	// CancelAtPeriodEnd stops the renewals and keeps the subscription until
+	// the end of the period paid for.
+	CancelAtPeriodEnd CancellationMode = "PERIOD_END"
+)
+
+type SubscriptionChargeKind string
+
+const (
+	ChargePurchase SubscriptionChargeKind = "PURCHASE"
+	ChargeRenewal  SubscriptionChargeKind = "RENEWAL"
+)
+
+// SubscriptionCharge is a payment for a period of a subscription. It moves
+// through the same statuses as the payments of trips.
+type SubscriptionCharge struct {
+	ID                 int64                  `json:"id"`
+	UserSubscriptionID int64                  `json:"user_subscription_id"`
+	Kind               SubscriptionChargeKind `json:"kind"`
+	PlanID             int64                  `json:"plan_id"`
+	Amount             money.Amount           `json:"amount"`
+	PaymentMethod      PaymentMethod          `json:"payment_method"`
+	Status             PaymentStatus          `json:"status"`
+	ProviderReference  string                 `json:"provider_reference,omitempty"`
+	FailureReason      string                 `json:"failure_reason,omitempty"`
+	// PeriodEnd is the date the subscription runs until once the charge is
+	// captured.
+	PeriodEnd time.Time `json:"period_end"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TripUsage is what a trip took from the allowance of a subscription, and
+// what was charged for the usage over it.
+type TripUsage struct {
+	TripID             int64        `json:"trip_id"`
+	UserSubscriptionID int64        `json:"user_subscription_id"`
+	Km                 float64      `json:"km"`
+	Minutes            int          `json:"minutes"`
+	OverageKm          float64      `json:"overage_km"`
+	OverageMinutes     int          `json:"overage_minutes"`
+	OverageAmount      money.Amount `json:"overage_amount"`
+	RecordedAt         time.Time    `json:"recorded_at"`
+}
+
+// UsageTotals sums the usage of a subscription over a period.
+type UsageTotals struct {
+	Km             float64      `json:"km"`
+	Minutes        int          `json:"minutes"`
+	OverageKm      float64      `json:"overage_km"`
+	OverageMinutes int          `json:"overage_minutes"`
+	OverageAmount  money.Amount `json:"overage_amount"`
+	Trips          int          `json:"trips"`
 }
@@ -0,0 +1,9 @@
+package models
+
+// TokenPurpose is what a single-use token mailed to a user can be spent on.
+type TokenPurpose string
+
+const (
+	PasswordReset     TokenPurpose = "PASSWORD_RESET"
+	EmailVerification TokenPurpose = "EMAIL_VERIFICATION"
+)
@@ -0,0 +1,253 @@
+// Package money represents amounts of money exactly. Amounts are counted in
+// cents, like the decimal(10,2) columns they are stored in, so adding them
+// up never drifts the way float64 sums do.
+//
+// Multiplying an amount by a quantity, such as a per-km rate by a distance,
+// is done on the exact decimal values and rounded to the cent half away
+// from zero, the way MySQL rounds DECIMAL values.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+const EUR Currency = "EUR"
+
+// DefaultCurrency is the currency every amount is charged in. The database
+// does not record currencies, so every stored amount is in it.
+const DefaultCurrency = EUR
+
+var (
+	ErrSyntax    = errors.New("invalid amount")
+	ErrPrecision = errors.New("amounts have at most two decimals")
+	ErrRange     = errors.New("amount does not fit decimal(10,2)")
+)
+
+// Amount is an amount of money in cents of DefaultCurrency.
+type Amount int64
+
+const (
+	Cent Amount = 1
+	Unit Amount = 100
+	// MaxDecimal is the largest amount a decimal(10,2) column holds.
+	MaxDecimal Amount = 99_999_999_99
+)
+
+func FromCents(cents int64) Amount {
+	return Amount(cents)
+}
+
+// FromFloat converts f to the nearest cent. It is meant for values that are
+// already floats, such as those of other libraries; amounts written out
+// should be parsed with Parse.
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Parse parses a decimal amount such as "12.5" or "-0.05". It rejects
+// amounts with more than two decimals and amounts that do not fit
+// decimal(10,2).
+func Parse(s string) (Amount, error) {
+	text := s
+	negative := strings.HasPrefix(text, "-")
+	if negative || strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+
+	units, fraction, _ := strings.Cut(text, ".")
+	if units == "" && fraction == "" || !digits(units) || !digits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("%w: %q", ErrPrecision, s)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units = strings.TrimLeft(units, "0")
+	if len(units) > 8 {
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	}
+	if units == "" {
+		units = "0"
+	}
+
+	cents, err := strconv.ParseInt(units+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MustParse is Parse for amounts known to be valid, and panics otherwise.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Float64 returns the amount in units. It is only meant for display and
+// for libraries that expect floats.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// String formats the amount with two decimals, like "12.50".
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return a + b
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	return a - b
+}
+
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+// Mul multiplies the amount by q, rounded to the cent half away from zero.
+// q is taken at its shortest decimal representation, so that 0.30 × 2.35
+// is 0.705 and rounds to 0.71, as it would in decimal arithmetic.
+func (a Amount) Mul(q float64) Amount {
+	factor, ok := new(big.Rat).SetString(strconv.FormatFloat(q, 'g', -1, 64))
+	if !ok {
+		// Infinities and NaN have no decimal representation.
+		return FromFloat(a.Float64() * q)
+	}
+	return round(new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), factor))
+}
+
+// round rounds r to an integer number of cents, half away from zero.
+func round(r *big.Rat) Amount {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if remainder.Lsh(remainder, 1).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return Amount(quotient.Int64())
+}
+
+// Sum adds amounts up.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
+
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// MarshalJSON writes the amount as a number with two decimals.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a number or a string holding one, see Parse.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Scan reads a DECIMAL column, which the MySQL driver returns as text.
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	case nil:
+		*a = 0
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanText(text string) error {
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value writes the amount as a decimal string, which MySQL stores exactly.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
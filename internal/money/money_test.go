@@ -0,0 +1,111 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{in: "12.5", want: 1250},
+		{in: "0.05", want: 5},
+		{in: "-1.10", want: -110},
+		{in: "+3", want: 300},
+		{in: ".5", want: 50},
+		{in: "7.", want: 700},
+		{in: "1.2300", want: 123},
+		{in: "99999999.99", want: MaxDecimal},
+		{in: "100000000", err: ErrRange},
+		{in: "0.125", err: ErrPrecision},
+		{in: "", err: ErrSyntax},
+		{in: ".", err: ErrSyntax},
+		{in: "1e3", err: ErrSyntax},
+		{in: "1.2.3", err: ErrSyntax},
+	} {
+		got, err := Parse(tc.in)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Parse(%q) = %v, %v, want %v", tc.in, got, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("Parse(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for amount, want := range map[Amount]string{
+		0:    "0.00",
+		5:    "0.05",
+		1250: "12.50",
+		-110: "-1.10",
+		-5:   "-0.05",
+	} {
+		if got := amount.String(); got != want {
+			t.Errorf("Amount(%d).String() = %q, want %q", amount, got, want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	for _, tc := range []struct {
+		amount Amount
+		q      float64
+		want   Amount
+	}{
+		{amount: MustParse("0.30"), q: 2.35, want: MustParse("0.71")},
+		{amount: MustParse("0.10"), q: 15, want: MustParse("1.50")},
+		// 1.005 is just below 1.005 as a float, but half a cent exactly.
+		{amount: MustParse("1.00"), q: 1.005, want: MustParse("1.01")},
+		{amount: MustParse("-0.30"), q: 2.35, want: MustParse("-0.71")},
+		{amount: MustParse("2.50"), q: 0.25, want: MustParse("0.63")},
+		{amount: MustParse("2.50"), q: -0.2, want: MustParse("-0.50")},
+	} {
+		if got := tc.amount.Mul(tc.q); got != tc.want {
+			t.Errorf("%v.Mul(%v) = %v, want %v", tc.amount, tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Amount Amount  `json:"amount"`
+		Rate   *Amount `json:"rate"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 12.5, "rate": "0.30"}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.Amount != 1250 || v.Rate == nil || *v.Rate != 30 {
+		t.Fatalf("got %+v, want 12.50 and 0.30", v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil || string(data) != `{"amount":12.50,"rate":0.30}` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 0.001}`), &v); !errors.Is(err, ErrPrecision) {
+		t.Fatalf("unmarshaling 0.001: got %v, want ErrPrecision", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, src := range []any{[]byte("12.34"), "12.34", 12.34} {
+		var a Amount
+		if err := a.Scan(src); err != nil || a != 1234 {
+			t.Errorf("Scan(%#v) = %v, %v, want 12.34", src, a, err)
+		}
+	}
+
+	value, err := MustParse("12.3").Value()
+	if err != nil || value != "12.30" {
+		t.Errorf("Value() = %#v, %v, want \"12.30\"", value, err)
+	}
+}
@@ -0,0 +1,137 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// FakeConfig decides which operations the fake provider declines.
+type FakeConfig struct {
+	// DeclineAbove declines authorizations of larger amounts, when set.
+	DeclineAbove money.Amount
+	// DeclineCustomers declines every authorization for these customers.
+	DeclineCustomers []string
+	// Fail declines every call of these operations: authorize, capture,
+	// refund or void.
+	Fail []string
+}
+
+type fakeAuthorization struct {
+	amount   money.Amount
+	captured money.Amount
+	refunded money.Amount
+	voided   bool
+}
+
+// Fake is a deterministic in-process provider. Authorization IDs are
+// sequential and whether an operation succeeds only depends on its input
+// and the configuration, so the same calls always give the same results.
+type Fake struct {
+	Config FakeConfig
+
+	mu             sync.Mutex
+	next           int
+	authorizations map[string]*fakeAuthorization
+}
+
+func NewFake(config FakeConfig) *Fake {
+	return &Fake{Config: config, authorizations: make(map[string]*fakeAuthorization)}
+}
+
+func (f *Fake) fails(operation string) bool {
+	for _, failing := range f.Config.Fail {
+		if strings.EqualFold(failing, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fails("authorize") {
+		return "", declined("authorizations are configured to fail")
+	}
+	if req.Amount <= 0 || req.Currency != money.DefaultCurrency {
+		return "", declined("invalid amount")
+	}
+	if f.Config.DeclineAbove > 0 && req.Amount > f.Config.DeclineAbove {
+		return "", declined("insufficient funds")
+	}
+	for _, customer := range f.Config.DeclineCustomers {
+		if strings.EqualFold(customer, req.Customer) {
+			return "", declined("card declined")
+		}
+	}
+
+	f.next++
+	id := fmt.Sprintf("fake_auth_%06d", f.next)
+	f.authorizations[id] = &fakeAuthorization{amount: req.Amount}
+	return id, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, authorizationID string, amount money.Amount) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	authorization, ok := f.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if f.fails("capture") {
+		return declined("captures are configured to fail")
+	}
+	if authorization.voided || authorization.captured > 0 {
+		return declined("authorization is no longer open")
+	}
+	if amount <= 0 || amount > authorization.amount {
+		return declined("amount exceeds the authorization")
+	}
+
+	authorization.captured = amount
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, authorizationID string, amount money.Amount) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	authorization, ok := f.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if f.fails("refund") {
+		return declined("refunds are configured to fail")
+	}
+	if amount <= 0 || amount > authorization.captured.Sub(authorization.refunded) {
+		return declined("amount exceeds what was captured")
+	}
+
+	authorization.refunded = authorization.refunded.Add(amount)
+	return nil
+}
+
+func (f *Fake) Void(ctx context.Context, authorizationID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	authorization, ok := f.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if f.fails("void") {
+		return declined("voids are configured to fail")
+	}
+	if authorization.captured > 0 {
+		return declined("authorization was already captured")
+	}
+
+	authorization.voided = true
+	return nil
+}
@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// The HTTP API of the fake provider, which HTTPProvider speaks:
+//
+//	POST /authorizations               AuthorizeRequest -> 201 {"id": "..."}
+//	POST /authorizations/{id}/capture  {"amount": 1.23} -> 204
+//	POST /authorizations/{id}/refund   {"amount": 1.23} -> 204
+//	POST /authorizations/{id}/void                      -> 204
+//
+// Declines are answered with 402 and unknown authorizations with 404, both
+// with an {"error": "..."} body.
+
+type amountRequest struct {
+	Amount money.Amount `json:"amount"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the fake over HTTP, so that it can stand in for a real
+// provider, see cmd/fakepay.
+func (f *Fake) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /authorizations", func(w http.ResponseWriter, r *http.Request) {
+		var req AuthorizeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+			return
+		}
+
+		id, err := f.Authorize(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	})
+
+	mux.HandleFunc("POST /authorizations/{id}/capture", func(w http.ResponseWriter, r *http.Request) {
+		var req amountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+			return
+		}
+		writeError(w, f.Capture(r.Context(), r.PathValue("id"), req.Amount))
+	})
+
+	mux.HandleFunc("POST /authorizations/{id}/refund", func(w http.ResponseWriter, r *http.Request) {
+		var req amountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+			return
+		}
+		writeError(w, f.Refund(r.Context(), r.PathValue("id"), req.Amount))
+	})
+
+	mux.HandleFunc("POST /authorizations/{id}/void", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, f.Void(r.Context(), r.PathValue("id")))
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers 204 for a nil err.
+func writeError(w http.ResponseWriter, err error) {
+	var decline *DeclineError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &decline):
+		writeJSON(w, http.StatusPaymentRequired, errorResponse{Error: decline.Reason})
+	case errors.Is(err, ErrUnknownAuthorization):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+	}
+}
+
+// HTTPProvider is a client for a provider serving the API of Fake.Handler.
+type HTTPProvider struct {
+	BaseURL string
+	// Client defaults to a client with a 10 second timeout.
+	Client *http.Client
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (p *HTTPProvider) Authorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := p.post(ctx, "/authorizations", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (p *HTTPProvider) Capture(ctx context.Context, authorizationID string, amount money.Amount) error {
+	return p.post(ctx, "/authorizations/"+url.PathEscape(authorizationID)+"/capture", amountRequest{Amount: amount}, nil)
+}
+
+func (p *HTTPProvider) Refund(ctx context.Context, authorizationID string, amount money.Amount) error {
+	return p.post(ctx, "/authorizations/"+url.PathEscape(authorizationID)+"/refund", amountRequest{Amount: amount}, nil)
+}
+
+func (p *HTTPProvider) Void(ctx context.Context, authorizationID string) error {
+	return p.post(ctx, "/authorizations/"+url.PathEscape(authorizationID)+"/void", struct{}{}, nil)
+}
+
+func (p *HTTPProvider) post(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.BaseURL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	client := p.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payment provider unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	var failure errorResponse
+	json.NewDecoder(resp.Body).Decode(&failure)
+
+	switch resp.StatusCode {
+	case http.StatusPaymentRequired:
+		return declined(failure.Error)
+	case http.StatusNotFound:
+		return ErrUnknownAuthorization
+	default:
+		return fmt.Errorf("payment provider answered %d: %s", resp.StatusCode, failure.Error)
+	}
+}
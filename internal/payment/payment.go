@@ -0,0 +1,75 @@
+// Package payment charges trips through a payment provider. Payments are
+// authorized first and captured once the amount is final; an authorization
+// that will not be captured is voided, and a captured payment can be
+// refunded.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+var (
+	// ErrDeclined matches the DeclineError returned when the provider refuses
+	// an operation. Other errors mean the provider could not be reached or
+	// failed.
+	ErrDeclined = errors.New("payment declined")
+	// ErrUnknownAuthorization is returned for operations on authorizations
+	// the provider does not know of.
+	ErrUnknownAuthorization = errors.New("unknown authorization")
+)
+
+type AuthorizeRequest struct {
+	// Reference identifies what is paid for, such as "trip-42".
+	Reference string               `json:"reference"`
+	Customer  string               `json:"customer"`
+	Method    models.PaymentMethod `json:"method"`
+	Amount    money.Amount         `json:"amount"`
+	Currency  money.Currency       `json:"currency"`
+}
+
+type PaymentProvider interface {
+	// Authorize reserves the amount and returns the authorization ID.
+	Authorize(ctx context.Context, req AuthorizeRequest) (string, error)
+	Capture(ctx context.Context, authorizationID string, amount money.Amount) error
+	Refund(ctx context.Context, authorizationID string, amount money.Amount) error
+	Void(ctx context.Context, authorizationID string) error
+}
+
+// New returns the provider selected by cfg.Provider.
+func New(cfg config.PaymentConfig) (PaymentProvider, error) {
+	switch cfg.Provider {
+	case "fake":
+		return NewFake(FakeConfig{
+			DeclineAbove:     cfg.FakeDeclineAbove,
+			DeclineCustomers: cfg.FakeDeclineCustomers,
+			Fail:             cfg.FakeFail,
+		}), nil
+	case "http":
+		return &HTTPProvider{BaseURL: cfg.URL}, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+	}
+}
+
+// DeclineError carries the reason the provider gave for declining.
+type DeclineError struct {
+	Reason string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDeclined, e.Reason)
+}
+
+func (e *DeclineError) Is(target error) bool {
+	return target == ErrDeclined
+}
+
+func declined(reason string) error {
+	return &DeclineError{Reason: reason}
+}
@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+func authorize(customer, amount string) AuthorizeRequest {
+	return AuthorizeRequest{
+		Reference: "trip-1",
+		Customer:  customer,
+		Method:    models.Card,
+		Amount:    money.MustParse(amount),
+		Currency:  money.EUR,
+	}
+}
+
+// exercise runs the same operations against any provider.
+func exercise(t *testing.T, provider PaymentProvider) {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := provider.Authorize(ctx, authorize("user@example.com", "12.5"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if id != "fake_auth_000001" {
+		t.Errorf("authorization ID = %q, want fake_auth_000001", id)
+	}
+
+	if err := provider.Capture(ctx, id, money.MustParse("20")); !errors.Is(err, ErrDeclined) {
+		t.Errorf("capturing more than authorized: got %v, want a decline", err)
+	}
+	if err := provider.Capture(ctx, id, money.MustParse("12.5")); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if err := provider.Void(ctx, id); !errors.Is(err, ErrDeclined) {
+		t.Errorf("voiding a captured payment: got %v, want a decline", err)
+	}
+	if err := provider.Refund(ctx, id, money.MustParse("5")); err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	if err := provider.Refund(ctx, id, money.MustParse("7.51")); !errors.Is(err, ErrDeclined) {
+		t.Errorf("refunding more than captured: got %v, want a decline", err)
+	}
+	if err := provider.Refund(ctx, id, money.MustParse("7.5")); err != nil {
+		t.Fatalf("refund of the rest: %v", err)
+	}
+
+	_, err = provider.Authorize(ctx, authorize("user@example.com", "150"))
+	var decline *DeclineError
+	if !errors.As(err, &decline) || decline.Reason != "insufficient funds" {
+		t.Errorf("authorizing above the limit: got %v, want insufficient funds", err)
+	}
+	if _, err := provider.Authorize(ctx, authorize("Broke@example.com", "1")); !errors.Is(err, ErrDeclined) {
+		t.Errorf("authorizing for a declined customer: got %v, want a decline", err)
+	}
+
+	id, err = provider.Authorize(ctx, authorize("user@example.com", "3"))
+	if err != nil {
+		t.Fatalf("second authorize: %v", err)
+	}
+	if id != "fake_auth_000002" {
+		t.Errorf("second authorization ID = %q, want fake_auth_000002", id)
+	}
+	if err := provider.Void(ctx, id); err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	if err := provider.Capture(ctx, id, money.MustParse("3")); !errors.Is(err, ErrDeclined) {
+		t.Errorf("capturing a voided authorization: got %v, want a decline", err)
+	}
+
+	if err := provider.Capture(ctx, "missing", money.MustParse("1")); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("capturing an unknown authorization: got %v, want ErrUnknownAuthorization", err)
+	}
+}
+
+func fakeConfig() FakeConfig {
+	return FakeConfig{DeclineAbove: money.MustParse("100"), DeclineCustomers: []string{"broke@example.com"}}
+}
+
+func TestFake(t *testing.T) {
+	exercise(t, NewFake(fakeConfig()))
+}
+
+func TestHTTPProvider(t *testing.T) {
+	server := httptest.NewServer(NewFake(fakeConfig()).Handler())
+	defer server.Close()
+
+	exercise(t, &HTTPProvider{BaseURL: server.URL})
+}
+
+func TestFakeFailingOperations(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(FakeConfig{Fail: []string{"capture"}})
+
+	id, err := fake.Authorize(ctx, authorize("user@example.com", "10"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if err := fake.Capture(ctx, id, money.MustParse("10")); !errors.Is(err, ErrDeclined) {
+		t.Errorf("capture: got %v, want a decline", err)
+	}
+	if err := fake.Void(ctx, id); err != nil {
+		t.Errorf("void: %v", err)
+	}
+}
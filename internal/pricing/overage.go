@@ -0,0 +1,62 @@
+package pricing
+
+import (
+	"math"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// Overage works out what a trip covered by a subscription to plan takes from
+// its monthly allowance, given the usage of the month so far, and what the
+// usage over the allowance costs. quote is the usual price of the trip, which
+// the overage rates fall back to.
+//
+// The minutes of a trip are its started minutes, like the TIME item of a
+// quote counts them.
+func Overage(plan models.SubscriptionPlan, trip Trip, quote models.Quote, used models.UsageTotals) models.TripUsage {
+	usage := models.TripUsage{
+		Km:      trip.Distance,
+		Minutes: int(math.Ceil(trip.EndTime.Sub(trip.StartTime).Minutes())),
+	}
+
+	// A missing allowance covers nothing.
+	var includedKm float64
+	if plan.IncludedKm != nil {
+		includedKm = *plan.IncludedKm
+	}
+	var includedMinutes int
+	if plan.IncludedMinutes != nil {
+		includedMinutes = *plan.IncludedMinutes
+	}
+
+	remainingKm := math.Max(0, includedKm-used.Km)
+	usage.OverageKm = math.Round(math.Max(0, usage.Km-remainingKm)*100) / 100
+	remainingMinutes := max(0, includedMinutes-used.Minutes)
+	usage.OverageMinutes = max(0, usage.Minutes-remainingMinutes)
+
+	kmRate := quoteRate(quote, ItemDistance).Mul(1 - plan.KmDiscount)
+	if plan.OveragePerKm != nil {
+		kmRate = *plan.OveragePerKm
+	}
+	minuteRate := quoteRate(quote, ItemTime)
+	if plan.OveragePerMinute != nil {
+		minuteRate = *plan.OveragePerMinute
+	}
+
+	usage.OverageAmount = money.Sum(
+		kmRate.Mul(usage.OverageKm),
+		minuteRate.Mul(float64(usage.OverageMinutes)),
+	)
+	return usage
+}
+
+// quoteRate returns the rate of the quote item with code, or zero.
+func quoteRate(quote models.Quote, code string) money.Amount {
+	for _, item := range quote.Items {
+		if item.Code == code {
+			return item.Rate
+		}
+	}
+	return 0
+}
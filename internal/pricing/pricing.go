@@ -0,0 +1,256 @@
+// Package pricing works out what a trip costs.
+package pricing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+	// The fleet's time zone must load wherever the API runs, containers
+	// without a zoneinfo database included.
+	_ "time/tzdata"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+var (
+	ErrInvalidTrip = fmt.Errorf("trip ends before it starts")
+	ErrNoRate      = fmt.Errorf("no per-km rate for the car")
+)
+
+// Codes of the quote items.
+const (
+	ItemUnlock      = "UNLOCK"
+	ItemTime        = "TIME"
+	ItemDistance    = "DISTANCE"
+	ItemTimeOfDay   = "TIME_OF_DAY"
+	ItemDailyCap    = "DAILY_CAP"
+	ItemMinimumFare = "MINIMUM_FARE"
+)
+
+// Engine prices trips.
+type Engine interface {
+	Quote(trip Trip) (models.Quote, error)
+}
+
+// Trip is what a trip is priced on. Only the cost per km and the category
+// of Car are used.
+type Trip struct {
+	Car       models.Car
+	StartTime time.Time
+	EndTime   time.Time
+	Distance  float64
+}
+
+// Multiplier scales the time and distance charges of the trips that start
+// between From and To o'clock. A window with From after To wraps past
+// midnight.
+type Multiplier struct {
+	Name   string  `json:"name"`
+	From   int     `json:"from"`
+	To     int     `json:"to"`
+	Factor float64 `json:"factor"`
+}
+
+func (m Multiplier) applies(hour int) bool {
+	if m.From <= m.To {
+		return hour >= m.From && hour < m.To
+	}
+	return hour >= m.From || hour < m.To
+}
+
+// Rules is the rule based Engine. A trip is charged:
+//
+//   - UnlockFee once;
+//   - PerMinute for every started minute between its start and end;
+//   - the cost per km of the car, or the PerKm rate of its category when the
+//     car has none, for every km driven;
+//   - the Factor of the first of Multipliers whose window contains the hour
+//     the trip started at, in Location, on the time and distance charges;
+//   - at most DailyCap for every started day, and at least MinimumFare.
+//
+// Every charge is rounded to the cent, see money.Amount.Mul. Zero values turn
+// the corresponding rule off.
+type Rules struct {
+	UnlockFee   money.Amount                     `json:"unlock_fee"`
+	PerMinute   money.Amount                     `json:"per_minute"`
+	PerKm       map[models.Category]money.Amount `json:"per_km"`
+	Multipliers []Multiplier                     `json:"multipliers"`
+	MinimumFare money.Amount                     `json:"minimum_fare"`
+	DailyCap    money.Amount                     `json:"daily_cap"`
+	// Location is the time zone of the multiplier windows, UTC when nil.
+	Location *time.Location `json:"-"`
+}
+
+// FleetLocation is the time zone the fleet drives in, Thessaloniki's.
+var FleetLocation = mustLoadLocation("Europe/Athens")
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// New returns DefaultRules tuned by cfg: cfg.Rules, JSON in the shape of
+// Rules, is decoded over them, so that it only needs the fields it changes.
+// Its per_km rates are added to the default ones, while its multipliers
+// replace them. cfg.TimeZone, when set, replaces FleetLocation.
+func New(cfg config.PricingConfig) (Rules, error) {
+	rules := DefaultRules()
+	if cfg.Rules != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(cfg.Rules)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rules); err != nil {
+			return Rules{}, fmt.Errorf("invalid pricing rules: %w", err)
+		}
+	}
+	if cfg.TimeZone != "" {
+		location, err := time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid pricing time zone: %w", err)
+		}
+		rules.Location = location
+	}
+	return rules, nil
+}
+
+// DefaultRules are the rules the API prices trips with. Their multiplier
+// windows are in FleetLocation.
+func DefaultRules() Rules {
+	return Rules{
+		UnlockFee: money.MustParse("1.00"),
+		PerMinute: money.MustParse("0.10"),
+		PerKm: map[models.Category]money.Amount{
+			models.Economy:  money.MustParse("0.30"),
+			models.Standard: money.MustParse("0.40"),
+			models.Premium:  money.MustParse("0.70"),
+			models.Van:      money.MustParse("0.55"),
+		},
+		Multipliers: []Multiplier{
+			{Name: "Morning peak", From: 7, To: 10, Factor: 1.25},
+			{Name: "Evening peak", From: 17, To: 20, Factor: 1.25},
+			{Name: "Night", From: 23, To: 6, Factor: 0.8},
+		},
+		MinimumFare: money.MustParse("3.00"),
+		DailyCap:    money.MustParse("80.00"),
+		Location:    FleetLocation,
+	}
+}
+
+func (r Rules) Quote(trip Trip) (models.Quote, error) {
+	if trip.EndTime.Before(trip.StartTime) {
+		return models.Quote{}, ErrInvalidTrip
+	}
+
+	rate, err := r.perKm(trip.Car)
+	if err != nil && trip.Distance > 0 {
+		return models.Quote{}, err
+	}
+
+	quote := models.Quote{Currency: money.DefaultCurrency}
+	add := func(item models.QuoteItem) {
+		quote.Items = append(quote.Items, item)
+		quote.Total = quote.Total.Add(item.Amount)
+	}
+
+	if r.UnlockFee > 0 {
+		add(models.QuoteItem{Code: ItemUnlock, Description: "Unlock fee", Amount: r.UnlockFee})
+	}
+
+	duration := trip.EndTime.Sub(trip.StartTime)
+
+	var usage money.Amount
+	if r.PerMinute > 0 {
+		minutes := math.Ceil(duration.Minutes())
+		charge := r.PerMinute.Mul(minutes)
+		usage = usage.Add(charge)
+		add(models.QuoteItem{
+			Code:        ItemTime,
+			Description: "Time",
+			Quantity:    minutes,
+			Unit:        "min",
+			Rate:        r.PerMinute,
+			Amount:      charge,
+		})
+	}
+
+	charge := rate.Mul(trip.Distance)
+	usage = usage.Add(charge)
+	add(models.QuoteItem{
+		Code:        ItemDistance,
+		Description: "Distance",
+		Quantity:    trip.Distance,
+		Unit:        "km",
+		Rate:        rate,
+		Amount:      charge,
+	})
+
+	if multiplier, ok := r.multiplier(trip.StartTime); ok && multiplier.Factor != 1 && usage > 0 {
+		add(models.QuoteItem{
+			Code:        ItemTimeOfDay,
+			Description: multiplier.Name,
+			Factor:      multiplier.Factor,
+			Amount:      usage.Mul(multiplier.Factor).Sub(usage),
+		})
+	}
+
+	if r.DailyCap > 0 {
+		days := math.Max(1, math.Ceil(duration.Hours()/24))
+		limit := r.DailyCap.Mul(days)
+		if quote.Total > limit {
+			add(models.QuoteItem{
+				Code:        ItemDailyCap,
+				Description: "Daily cap",
+				Quantity:    days,
+				Unit:        "day",
+				Rate:        r.DailyCap,
+				Amount:      limit.Sub(quote.Total),
+			})
+		}
+	}
+
+	if quote.Total < r.MinimumFare {
+		add(models.QuoteItem{
+			Code:        ItemMinimumFare,
+			Description: "Minimum fare",
+			Amount:      r.MinimumFare.Sub(quote.Total),
+		})
+	}
+
+	return quote, nil
+}
+
+func (r Rules) perKm(car models.Car) (money.Amount, error) {
+	if car.CostPerKm != nil {
+		return *car.CostPerKm, nil
+	}
+
+	category := car.Category
+	if category == "" {
+		category = models.Standard
+	}
+	if rate, ok := r.PerKm[category]; ok {
+		return rate, nil
+	}
+	return 0, ErrNoRate
+}
+
+func (r Rules) multiplier(start time.Time) (Multiplier, bool) {
+	location := r.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	hour := start.In(location).Hour()
+	for _, multiplier := range r.Multipliers {
+		if multiplier.applies(hour) {
+			return multiplier, true
+		}
+	}
+	return Multiplier{}, false
+}
@@ -0,0 +1,264 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+// at is a time on a winter Monday, in the fleet's time zone.
+func at(hour, minute int) time.Time {
+	return time.Date(2025, 1, 6, hour, minute, 0, 0, FleetLocation)
+}
+
+func costPerKm(rate string) *money.Amount {
+	amount := money.MustParse(rate)
+	return &amount
+}
+
+func TestDefaultRules(t *testing.T) {
+	standard := models.Car{LicensePlate: "ABC1234", Category: models.Standard}
+	priced := models.Car{LicensePlate: "ABC1234", Category: models.Premium, CostPerKm: costPerKm("0.50")}
+
+	for _, tc := range []struct {
+		name      string
+		trip      Trip
+		wantTotal string
+		wantCodes []string
+	}{
+		{
+			name:      "midday",
+			trip:      Trip{Car: standard, StartTime: at(12, 0), EndTime: at(12, 30), Distance: 10},
+			wantTotal: "8.00",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance},
+		},
+		{
+			name:      "started minutes are billed",
+			trip:      Trip{Car: standard, StartTime: at(12, 0), EndTime: at(12, 30).Add(time.Second), Distance: 10},
+			wantTotal: "8.10",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance},
+		},
+		{
+			name:      "morning peak",
+			trip:      Trip{Car: standard, StartTime: at(8, 0), EndTime: at(8, 30), Distance: 10},
+			wantTotal: "9.75",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance, ItemTimeOfDay},
+		},
+		{
+			name:      "night",
+			trip:      Trip{Car: standard, StartTime: at(23, 30), EndTime: at(23, 30).Add(30 * time.Minute), Distance: 10},
+			wantTotal: "6.60",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance, ItemTimeOfDay},
+		},
+		{
+			name:      "cost per km of the car",
+			trip:      Trip{Car: priced, StartTime: at(12, 0), EndTime: at(12, 30), Distance: 10},
+			wantTotal: "9.00",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance},
+		},
+		{
+			name:      "minimum fare",
+			trip:      Trip{Car: priced, StartTime: at(12, 0), EndTime: at(12, 2), Distance: 0.5},
+			wantTotal: "3.00",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance, ItemMinimumFare},
+		},
+		{
+			name:      "daily cap",
+			trip:      Trip{Car: standard, StartTime: at(12, 0), EndTime: at(13, 0).Add(24 * time.Hour), Distance: 100},
+			wantTotal: "160.00",
+			wantCodes: []string{ItemUnlock, ItemTime, ItemDistance, ItemDailyCap},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			quote, err := DefaultRules().Quote(tc.trip)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if quote.Total != money.MustParse(tc.wantTotal) {
+				t.Fatalf("got total %v, want %s: %+v", quote.Total, tc.wantTotal, quote.Items)
+			}
+
+			var sum money.Amount
+			var codes []string
+			for _, item := range quote.Items {
+				sum = sum.Add(item.Amount)
+				codes = append(codes, item.Code)
+			}
+			if sum != quote.Total {
+				t.Fatalf("items add up to %v, total is %v", sum, quote.Total)
+			}
+			if len(codes) != len(tc.wantCodes) {
+				t.Fatalf("got items %v, want %v", codes, tc.wantCodes)
+			}
+			for i := range codes {
+				if codes[i] != tc.wantCodes[i] {
+					t.Fatalf("got items %v, want %v", codes, tc.wantCodes)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiplierLocation(t *testing.T) {
+	rules := DefaultRules()
+	rules.Location = time.FixedZone("EET", 2*60*60)
+
+	// 06:00 UTC is 08:00 in the rules' time zone, during the morning peak.
+	start := time.Date(2025, 1, 6, 6, 0, 0, 0, time.UTC)
+	quote, err := rules.Quote(Trip{
+		Car:       models.Car{Category: models.Standard},
+		StartTime: start,
+		EndTime:   start.Add(30 * time.Minute),
+		Distance:  10,
+	})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if quote.Total != money.MustParse("9.75") {
+		t.Fatalf("got total %v, want the morning peak 9.75", quote.Total)
+	}
+}
+
+func TestDefaultRulesUseLocalTime(t *testing.T) {
+	standard := models.Car{Category: models.Standard}
+
+	// Summer time in Thessaloniki is UTC+3.
+	for _, tc := range []struct {
+		name      string
+		start     time.Time
+		wantTotal string
+	}{
+		{"08:00 local is the morning peak", time.Date(2025, 7, 7, 5, 0, 0, 0, time.UTC), "9.75"},
+		{"12:00 local is not", time.Date(2025, 7, 7, 9, 0, 0, 0, time.UTC), "8.00"},
+		{"23:30 local is night", time.Date(2025, 7, 7, 20, 30, 0, 0, time.UTC), "6.60"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			quote, err := DefaultRules().Quote(Trip{Car: standard, StartTime: tc.start, EndTime: tc.start.Add(30 * time.Minute), Distance: 10})
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if quote.Total != money.MustParse(tc.wantTotal) {
+				t.Fatalf("got total %v, want %s", quote.Total, tc.wantTotal)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	rules, err := New(config.PricingConfig{
+		Rules:    `{"unlock_fee": "2.00", "per_km": {"ECONOMY": "0.25"}, "multipliers": []}`,
+		TimeZone: "UTC",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if rules.UnlockFee != money.MustParse("2.00") || rules.PerMinute != money.MustParse("0.10") {
+		t.Errorf("got unlock fee %v and per minute %v, want 2.00 and the default 0.10", rules.UnlockFee, rules.PerMinute)
+	}
+	if rules.PerKm[models.Economy] != money.MustParse("0.25") || rules.PerKm[models.Premium] != money.MustParse("0.70") {
+		t.Errorf("got per km %v, want ECONOMY changed and the other defaults kept", rules.PerKm)
+	}
+	if len(rules.Multipliers) != 0 || rules.Location != time.UTC {
+		t.Errorf("got multipliers %v in %v, want none in UTC", rules.Multipliers, rules.Location)
+	}
+
+	for _, cfg := range []config.PricingConfig{
+		{Rules: `{"unlock_fees": "2.00"}`},
+		{Rules: `{"unlock_fee": 2`},
+		{TimeZone: "Europe/Nowhere"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("got no error for %+v", cfg)
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	rules := Rules{PerKm: map[models.Category]money.Amount{models.Economy: money.MustParse("0.30")}}
+	standard := models.Car{Category: models.Standard}
+
+	if _, err := rules.Quote(Trip{Car: standard, StartTime: at(12, 0), EndTime: at(11, 0)}); err != ErrInvalidTrip {
+		t.Fatalf("got %v for a trip ending before it starts, want ErrInvalidTrip", err)
+	}
+	if _, err := rules.Quote(Trip{Car: standard, StartTime: at(12, 0), EndTime: at(13, 0), Distance: 1}); err != ErrNoRate {
+		t.Fatalf("got %v for a category without a rate, want ErrNoRate", err)
+	}
+	if quote, err := rules.Quote(Trip{Car: standard, StartTime: at(12, 0), EndTime: at(13, 0)}); err != nil || quote.Total != 0 {
+		t.Fatalf("got %+v, %v for a trip that did not move, want it free", quote, err)
+	}
+}
+
+func TestOverage(t *testing.T) {
+	km := func(v float64) *float64 { return &v }
+	minutes := func(v int) *int { return &v }
+	costPerMinute := costPerKm("0.10")
+	standard := models.Car{Category: models.Standard}
+	trip := Trip{Car: standard, StartTime: at(12, 0), EndTime: at(12, 30), Distance: 10}
+	quote, err := DefaultRules().Quote(trip)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		plan        models.SubscriptionPlan
+		used        models.UsageTotals
+		wantKm      float64
+		wantMinutes int
+		wantAmount  string
+	}{
+		{
+			name:        "without allowances",
+			plan:        models.SubscriptionPlan{},
+			wantKm:      10,
+			wantMinutes: 30,
+			wantAmount:  "7.00",
+		},
+		{
+			name:       "within the allowance",
+			plan:       models.SubscriptionPlan{IncludedKm: km(100), IncludedMinutes: minutes(60)},
+			used:       models.UsageTotals{Km: 90, Minutes: 30},
+			wantAmount: "0.00",
+		},
+		{
+			name:       "over the km allowance at the plan rate",
+			plan:       models.SubscriptionPlan{IncludedKm: km(100), IncludedMinutes: minutes(60), OveragePerKm: costPerKm("0.40")},
+			used:       models.UsageTotals{Km: 96},
+			wantKm:     6,
+			wantAmount: "2.40",
+		},
+		{
+			name:       "allowance already spent",
+			plan:       models.SubscriptionPlan{IncludedKm: km(100), IncludedMinutes: minutes(60), OveragePerKm: costPerKm("0.40")},
+			used:       models.UsageTotals{Km: 120},
+			wantKm:     10,
+			wantAmount: "4.00",
+		},
+		{
+			name:        "over the minutes at the plan rate",
+			plan:        models.SubscriptionPlan{IncludedKm: km(100), IncludedMinutes: minutes(60), OveragePerMinute: costPerMinute},
+			used:        models.UsageTotals{Minutes: 50},
+			wantMinutes: 20,
+			wantAmount:  "2.00",
+		},
+		{
+			name:       "discounted usual rate without an overage rate",
+			plan:       models.SubscriptionPlan{IncludedKm: km(0), IncludedMinutes: minutes(60), KmDiscount: 0.5},
+			wantKm:     10,
+			wantAmount: "2.00",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			usage := Overage(tc.plan, trip, quote, tc.used)
+			if usage.Km != 10 || usage.Minutes != 30 {
+				t.Fatalf("got %+v, want 10 km and 30 minutes used", usage)
+			}
+			if usage.OverageKm != tc.wantKm || usage.OverageMinutes != tc.wantMinutes || usage.OverageAmount != money.MustParse(tc.wantAmount) {
+				t.Fatalf("got %+v, want %v km and %d minutes over for %s", usage, tc.wantKm, tc.wantMinutes, tc.wantAmount)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 24 * time.Hour
+)
+
+var (
+	ErrIncorrectPassword = fmt.Errorf("current password is incorrect")
+	ErrAlreadyVerified   = fmt.Errorf("email address is already verified")
+)
+
+// SetupAccountRoutes registers password recovery, password changes and
+// email verification.
+func (srv *Server) SetupAccountRoutes() {
+	validator := validator.New()
+
+	authenticated := middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB)
+
+	srv.FiberApp.Post("/password/forgot", func(c *fiber.Ctx) error {
+		var payload struct {
+			Email string `json:"email" validate:"required,email"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		// Answer the same way whether the address is registered or not, so
+		// that it cannot be used to find out who has an account.
+		response := fiber.Map{"message": "if the address is registered, a password reset link has been sent to it"}
+
+		user, err := srv.Database.UserDB.GetUserByEmail(c.UserContext(), payload.Email)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				return c.JSON(response)
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := srv.sendPasswordResetMail(c.UserContext(), user.Email); err != nil {
+			srv.logger().ErrorContext(c.UserContext(), "Failed to send the password reset mail", "recipient_email", user.Email, "error", err)
+		}
+
+		return c.JSON(response)
+	})
+
+	srv.FiberApp.Post("/password/reset", func(c *fiber.Ctx) error {
+		var payload struct {
+			Token    string `json:"token" validate:"required"`
+			Password string `json:"password" validate:"required,min=8,max=72"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		email, err := srv.Database.UserTokenDB.ConsumeToken(c.UserContext(), models.PasswordReset, HashToken(payload.Token))
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidToken) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := srv.Database.UserDB.UpdatePassword(c.UserContext(), email, string(hashedPassword)); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update password"})
+		}
+
+		// Whoever knew the old password must not stay logged in
+		if err := srv.Database.SessionDB.RevokeAllSessions(c.UserContext(), email, ""); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to revoke sessions"})
+		}
+
+		// The reset link reached the inbox, which verifies the address as well
+		if err := srv.Database.UserDB.MarkEmailVerified(c.UserContext(), email); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{"message": "password reset successfully"})
+	})
+
+	srv.FiberApp.Put("/user/password", authenticated, srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
+		var payload struct {
+			CurrentPassword string `json:"current_password" validate:"required"`
+			NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		sessionID, _ := c.Locals(string(middleware.SessionID)).(string)
+
+		user, err := srv.Database.UserDB.GetUserByEmail(c.UserContext(), email)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !validatePassword(user.Password, payload.CurrentPassword) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrIncorrectPassword.Error()})
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := srv.Database.UserDB.UpdatePassword(c.UserContext(), email, string(hashedPassword)); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update password"})
+		}
+
+		// Log out every other device
+		if err := srv.Database.SessionDB.RevokeAllSessions(c.UserContext(), email, sessionID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to revoke sessions"})
+		}
+
+		return c.JSON(fiber.Map{"message": "password updated successfully"})
+	})
+
+	srv.FiberApp.Post("/email/verify", func(c *fiber.Ctx) error {
+		var payload struct {
+			Token string `json:"token" validate:"required"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		email, err := srv.Database.UserTokenDB.ConsumeToken(c.UserContext(), models.EmailVerification, HashToken(payload.Token))
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidToken) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := srv.Database.UserDB.MarkEmailVerified(c.UserContext(), email); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{"message": "email verified successfully"})
+	})
+
+	srv.FiberApp.Post("/user/email/verify", authenticated, srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		user, err := srv.Database.UserDB.GetUserDetails(c.UserContext(), email)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch user details"})
+		}
+		if user.EmailVerifiedAt != nil {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": ErrAlreadyVerified.Error()})
+		}
+
+		if err := srv.sendVerificationMail(c.UserContext(), email); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to send verification email"})
+		}
+
+		return c.JSON(fiber.Map{"message": "verification email sent"})
+	})
+}
+
+// issueUserToken stores a new single-use token for email and returns it.
+func (srv *Server) issueUserToken(ctx context.Context, email string, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	token, tokenHash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl)
+	if err := srv.Database.UserTokenDB.CreateToken(ctx, email, purpose, tokenHash, expiresAt); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (srv *Server) sendPasswordResetMail(ctx context.Context, email string) error {
+	token, err := srv.issueUserToken(ctx, email, models.PasswordReset, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return srv.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your DataDrive password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your DataDrive account.\n\n"+
+				"Follow this link within the next hour to choose a new one:\n%s/reset-password?token=%s\n\n"+
+				"If it was not you, you can ignore this email.\n",
+			srv.AppURL, url.QueryEscape(token),
+		),
+	})
+}
+
+func (srv *Server) sendVerificationMail(ctx context.Context, email string) error {
+	token, err := srv.issueUserToken(ctx, email, models.EmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return srv.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your DataDrive email address",
+		Body: fmt.Sprintf(
+			"Welcome to DataDrive!\n\n"+
+				"Follow this link within the next 24 hours to verify your email address:\n%s/verify-email?token=%s\n",
+			srv.AppURL, url.QueryEscape(token),
+		),
+	})
+}
@@ -0,0 +1,243 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestPasswordReset(t *testing.T) {
+	h := testutil.New(t)
+	oldToken := signup(h, "driver@example.com", "driver")
+
+	var resetToken string
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "unknown address gets the same answer",
+			Method:     http.MethodPost,
+			Path:       "/password/forgot",
+			Body:       map[string]string{"email": "nobody@example.com"},
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := len(h.Mailbox.Messages("nobody@example.com")); got != 0 {
+					t.Fatalf("sent %d mails to an unknown address", got)
+				}
+			},
+		},
+		{
+			Name:       "forgot password",
+			Method:     http.MethodPost,
+			Path:       "/password/forgot",
+			Body:       map[string]string{"email": "driver@example.com"},
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				resetToken = h.Mailbox.LastToken(t, "driver@example.com")
+			},
+		},
+	})
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "password too short",
+			Method:     http.MethodPost,
+			Path:       "/password/reset",
+			Body:       map[string]string{"token": resetToken, "password": "short"},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "verification token cannot reset the password",
+			Method:     http.MethodPost,
+			Path:       "/password/reset",
+			Body:       map[string]string{"token": testutil.Token(t, h.Mailbox.Messages("driver@example.com")[0]), "password": "brand-new-password"},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "reset password",
+			Method:     http.MethodPost,
+			Path:       "/password/reset",
+			Body:       map[string]string{"token": resetToken, "password": "brand-new-password"},
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "token is single-use",
+			Method:     http.MethodPost,
+			Path:       "/password/reset",
+			Body:       map[string]string{"token": resetToken, "password": "another-password"},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "existing sessions are revoked",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      oldToken,
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "old password no longer works",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "supersecret"},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "new password works",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "brand-new-password"},
+			WantStatus: http.StatusOK,
+		},
+	})
+}
+
+func TestPasswordResetInvalidatesEarlierTokens(t *testing.T) {
+	h := testutil.New(t)
+	signup(h, "driver@example.com", "driver")
+
+	for range 2 {
+		resp := h.Do(http.MethodPost, "/password/forgot", map[string]string{"email": "driver@example.com"}, "")
+		if resp.Status != http.StatusOK {
+			t.Fatalf("forgot password failed with status %d", resp.Status)
+		}
+	}
+	messages := h.Mailbox.Messages("driver@example.com")
+	first := messages[len(messages)-2]
+
+	resp := h.Do(http.MethodPost, "/password/reset", map[string]string{
+		"token":    testutil.Token(t, first),
+		"password": "brand-new-password",
+	}, "")
+	if resp.Status != http.StatusBadRequest {
+		t.Fatalf("got status %d for a superseded token, want %d", resp.Status, http.StatusBadRequest)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	h := testutil.New(t)
+	other := signup(h, "driver@example.com", "driver")
+	current := login(h, "driver@example.com", "supersecret")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "requires a token",
+			Method:     http.MethodPut,
+			Path:       "/user/password",
+			Body:       map[string]string{"current_password": "supersecret", "new_password": "brand-new-password"},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "wrong current password",
+			Method:     http.MethodPut,
+			Path:       "/user/password",
+			Body:       map[string]string{"current_password": "wrong-password", "new_password": "brand-new-password"},
+			Token:      current,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "change password",
+			Method:     http.MethodPut,
+			Path:       "/user/password",
+			Body:       map[string]string{"current_password": "supersecret", "new_password": "brand-new-password"},
+			Token:      current,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "current session stays logged in",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      current,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "other sessions are revoked",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      other,
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "new password works",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "brand-new-password"},
+			WantStatus: http.StatusOK,
+		},
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	h := testutil.New(t)
+	token := signup(h, "driver@example.com", "driver")
+	firstToken := h.Mailbox.LastToken(t, "driver@example.com")
+
+	var verificationToken string
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "unverified after signup",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if _, ok := resp.Map(t)["email_verified_at"]; ok {
+					t.Fatal("new account is already verified")
+				}
+			},
+		},
+		{
+			Name:       "resend verification",
+			Method:     http.MethodPost,
+			Path:       "/user/email/verify",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				verificationToken = h.Mailbox.LastToken(t, "driver@example.com")
+			},
+		},
+	})
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "superseded token",
+			Method:     http.MethodPost,
+			Path:       "/email/verify",
+			Body:       map[string]string{"token": firstToken},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "verify",
+			Method:     http.MethodPost,
+			Path:       "/email/verify",
+			Body:       map[string]string{"token": verificationToken},
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "token is single-use",
+			Method:     http.MethodPost,
+			Path:       "/email/verify",
+			Body:       map[string]string{"token": verificationToken},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "verified",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if _, ok := resp.Map(t)["email_verified_at"]; !ok {
+					t.Fatal("account is not verified")
+				}
+			},
+		},
+		{
+			Name:       "nothing left to verify",
+			Method:     http.MethodPost,
+			Path:       "/user/email/verify",
+			Token:      token,
+			WantStatus: http.StatusConflict,
+		},
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// startSession opens a session for the client making the request and returns
+// the first pair of tokens for it.
+func (srv *Server) startSession(c *fiber.Ctx, email, role string) (fiber.Map, error) {
+	refreshToken, refreshTokenHash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := models.Session{
+		ID:         uuid.New().String(),
+		UserEmail:  email,
+		UserAgent:  userAgent,
+		IPAddress:  c.IP(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := srv.Database.SessionDB.CreateSession(c.UserContext(), session, refreshTokenHash); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateJWT(email, role, session.ID, srv.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenResponse(accessToken, refreshToken), nil
+}
+
+func tokenResponse(accessToken, refreshToken string) fiber.Map {
+	return fiber.Map{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(AccessTokenTTL.Seconds()),
+	}
+}
+
+func generateJWT(email, role, sessionID, jwtSecret string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+		"role":  role,
+		"sid":   sessionID,
+		"jti":   uuid.New().String(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(AccessTokenTTL).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// generateToken returns a random token along with the hash that is stored
+// in its place, for refresh tokens and the tokens mailed to users.
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the form in which tokens are stored. They are random, so
+// a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
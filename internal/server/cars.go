@@ -1,8 +1,12 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -12,6 +16,22 @@ import (
 	"github.com/ntentasd/db-deliverable3/internal/database"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
 	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+)
+
+var (
+	ErrInvalidCarStatus   = fmt.Errorf("invalid car status")
+	ErrInvalidCarCategory = fmt.Errorf("invalid car category")
+	ErrInvalidPriceRange  = fmt.Errorf("invalid price range")
+	ErrInvalidSortOrder   = fmt.Errorf("invalid sort order")
+	ErrInvalidCoordinates = fmt.Errorf("invalid coordinates")
+	ErrInvalidRadius      = fmt.Errorf("invalid radius")
+)
+
+// The radius of /available/nearby, in km.
+const (
+	defaultNearbyRadius = 5.0
+	maxNearbyRadius     = 50.0
 )
 
 func (srv *Server) SetupCarRoutes() {
@@ -21,12 +41,12 @@ func (srv *Server) SetupCarRoutes() {
 
 	_ = validate.RegisterValidation("licenseplate", validateLicensePlate)
 
-	authenticatedGroup := srv.FiberApp.Group("/cars", middleware.JWTMiddleware(srv.JWTSecret))
+	authenticatedGroup := srv.FiberApp.Group("/cars", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB))
 
 	// Get all cars
-	authenticatedGroup.Get("/", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
 		tracer := otel.Tracer("server")
-		ctx, span := tracer.Start(c.Context(), "GetAllCarsHandler")
+		ctx, span := tracer.Start(c.UserContext(), "GetAllCarsHandler")
 		defer span.End()
 
 		correlationID := c.Locals(middleware.CorrelationIDHeader).(string)
@@ -36,9 +56,6 @@ func (srv *Server) SetupCarRoutes() {
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if !checkAdmin(c) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 
 		page := c.QueryInt("page", 1)
 		if page < 1 {
@@ -69,7 +86,7 @@ func (srv *Server) SetupCarRoutes() {
 	})
 
 	// Get all rented cars
-	authenticatedGroup.Get("/rented", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/rented", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetAllRentedCarsHandler")
 		defer span.End()
 
@@ -77,9 +94,6 @@ func (srv *Server) SetupCarRoutes() {
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if !checkAdmin(c) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 
 		page := c.QueryInt("page", 1)
 		if page < 1 {
@@ -110,7 +124,7 @@ func (srv *Server) SetupCarRoutes() {
 	})
 
 	// Get all maintenance cars
-	authenticatedGroup.Get("/maintenance", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/maintenance", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetAllMaintenanceCarsHandler")
 		defer span.End()
 
@@ -118,9 +132,6 @@ func (srv *Server) SetupCarRoutes() {
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if !checkAdmin(c) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 
 		page := c.QueryInt("page", 1)
 		if page < 1 {
@@ -150,6 +161,52 @@ func (srv *Server) SetupCarRoutes() {
 		})
 	})
 
+	// Search the fleet
+	authenticatedGroup.Get("/search", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "SearchCarsHandler")
+		defer span.End()
+
+		page := c.QueryInt("page", 1)
+		if page < 1 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrInvalidPageNumber.Error()})
+		}
+
+		pageSize := c.QueryInt("page_size", 5)
+		if pageSize < 1 || pageSize > 100 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrInvalidPageSize.Error()})
+		}
+
+		search, err := parseCarSearch(c)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		search.Page = page
+		search.PageSize = pageSize
+
+		cars, totalCars, err := srv.Database.CarDB.SearchCars(ctx, search)
+		if err != nil {
+			if err == database.ErrInvalidCarSort {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if cars == nil {
+			cars = []models.Car{}
+		}
+
+		totalPages := (totalCars + pageSize - 1) / pageSize
+
+		return c.JSON(fiber.Map{
+			"data": cars,
+			"meta": fiber.Map{
+				"current_page": page,
+				"page_size":    pageSize,
+				"total_pages":  totalPages,
+				"total_cars":   totalCars,
+			},
+		})
+	})
+
 	// Get all available cars
 	srv.FiberApp.Get("/available", func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetAllAvailableCarsHandler")
@@ -183,10 +240,56 @@ func (srv *Server) SetupCarRoutes() {
 		})
 	})
 
+	// Get the available cars around a position
+	srv.FiberApp.Get("/available/nearby", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetNearbyCarsHandler")
+		defer span.End()
+
+		latitude, err := strconv.ParseFloat(c.Query("lat"), 64)
+		if err != nil || latitude < -90 || latitude > 90 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrInvalidCoordinates.Error()})
+		}
+		longitude, err := strconv.ParseFloat(c.Query("lng"), 64)
+		if err != nil || longitude < -180 || longitude > 180 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrInvalidCoordinates.Error()})
+		}
+
+		radius := defaultNearbyRadius
+		if value := c.Query("radius"); value != "" {
+			radius, err = strconv.ParseFloat(value, 64)
+			if err != nil || radius <= 0 || radius > maxNearbyRadius {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrInvalidRadius.Error()})
+			}
+		}
+
+		limit := c.QueryInt("limit", 20)
+		if limit < 1 || limit > 100 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrInvalidPageSize.Error()})
+		}
+
+		cars, err := srv.Database.CarDB.GetAvailableCarsNear(ctx, latitude, longitude, radius, limit)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if cars == nil {
+			cars = []models.NearbyCar{}
+		}
+
+		return c.JSON(fiber.Map{
+			"data": cars,
+			"meta": fiber.Map{
+				"latitude":   latitude,
+				"longitude":  longitude,
+				"radius":     radius,
+				"total_cars": len(cars),
+			},
+		})
+	})
+
 	// Get car by license plate
-	authenticatedGroup.Get("/:license_plate", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/:license_plate", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
 		tracer := otel.Tracer("server")
-		ctx, span := tracer.Start(c.Context(), "GetCarByLicensePlateHandler")
+		ctx, span := tracer.Start(c.UserContext(), "GetCarByLicensePlateHandler")
 		defer span.End()
 
 		correlationID := c.Locals(middleware.CorrelationIDHeader).(string)
@@ -208,7 +311,7 @@ func (srv *Server) SetupCarRoutes() {
 	})
 
 	// Add a new car
-	authenticatedGroup.Post("/", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/", srv.RequirePermission(models.PermissionCarsWrite), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "CreateNewCarHandler")
 		defer span.End()
 
@@ -217,9 +320,6 @@ func (srv *Server) SetupCarRoutes() {
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if role, ok := c.Locals(string(middleware.Role)).(string); !ok || role != "Admin" {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 		if err := c.BodyParser(&car); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
 		}
@@ -230,6 +330,8 @@ func (srv *Server) SetupCarRoutes() {
 					switch fieldErr.Field() {
 					case "LicensePlate":
 						errorMsgs["license_plate"] = "license plate must consist of 3 letters followed by 4 digits"
+					case "Latitude", "Longitude":
+						errorMsgs[strings.ToLower(fieldErr.Field())] = "the car's coordinates are required"
 					default:
 						errorMsgs[fieldErr.Field()] = "Invalid value"
 					}
@@ -242,14 +344,12 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"errors": err.Error()})
 		}
 
-		for page := 1; page <= 10; page++ {
-			srv.Database.CarDB.InvalidateCars(page, 5)
-		}
+		srv.carsChanged(ctx)
 		return c.Status(http.StatusCreated).JSON(car)
 	})
 
 	// Update car details
-	authenticatedGroup.Put("/:license_plate", func(c *fiber.Ctx) error {
+	authenticatedGroup.Put("/:license_plate", srv.RequirePermission(models.PermissionCarsWrite), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "UpdateCarDetailsHandler")
 		defer span.End()
 
@@ -262,11 +362,15 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid license plate format"})
 		}
 		var car struct {
-			Make      string        `json:"make" validate:"required,max=45"`
-			Model     string        `json:"model" validate:"required,max=45"`
-			Status    models.Status `json:"status" validate:"required,oneof=AVAILABLE RENTED MAINTENANCE"`
-			CostPerKm *float64      `json:"cost_per_km" validate:"omitempty,gt=0"`
-			Location  string        `json:"location" validate:"omitempty,max=255"`
+			Make      string          `json:"make" validate:"required,max=45"`
+			Model     string          `json:"model" validate:"required,max=45"`
+			Status    models.Status   `json:"status" validate:"required,oneof=AVAILABLE RENTED MAINTENANCE"`
+			CostPerKm *money.Amount   `json:"cost_per_km" validate:"omitempty,gt=0"`
+			Category  models.Category `json:"category" validate:"omitempty,oneof=ECONOMY STANDARD PREMIUM VAN"`
+			Location  string          `json:"location" validate:"omitempty,max=255"`
+			// The car keeps its position unless both coordinates are given.
+			Latitude  *float64 `json:"latitude" validate:"required_with=Longitude,omitempty,min=-90,max=90"`
+			Longitude *float64 `json:"longitude" validate:"required_with=Latitude,omitempty,min=-180,max=180"`
 		}
 		if err := c.BodyParser(&car); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid data format"})
@@ -280,7 +384,10 @@ func (srv *Server) SetupCarRoutes() {
 			Model:        car.Model,
 			Status:       car.Status,
 			CostPerKm:    car.CostPerKm,
+			Category:     car.Category,
 			Location:     car.Location,
+			Latitude:     car.Latitude,
+			Longitude:    car.Longitude,
 		})
 		if err != nil {
 			if err == database.ErrInvalidStatusChange {
@@ -289,15 +396,13 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		for page := 1; page <= 10; page++ {
-			srv.Database.CarDB.InvalidateCars(page, 5)
-		}
+		srv.carsChanged(ctx)
 
 		return c.Status(http.StatusOK).JSON(updatedCar)
 	})
 
 	// Delete a car
-	authenticatedGroup.Delete("/:license_plate", func(c *fiber.Ctx) error {
+	authenticatedGroup.Delete("/:license_plate", srv.RequirePermission(models.PermissionCarsWrite), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "DeleteCarHandler")
 		defer span.End()
 
@@ -305,9 +410,6 @@ func (srv *Server) SetupCarRoutes() {
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if role, ok := c.Locals(string(middleware.Role)).(string); !ok || role != "Admin" {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 		licensePlate := c.Params("license_plate")
 		if err := validate.Var(licensePlate, "required,licenseplate"); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid license plate format"})
@@ -320,15 +422,13 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		for page := 1; page <= 10; page++ {
-			srv.Database.CarDB.InvalidateCars(page, 5)
-		}
+		srv.carsChanged(ctx)
 		return c.Status(http.StatusOK).JSON(car)
 	})
 
 	carGroup.Get("/:license_plate/damages", func(c *fiber.Ctx) error {
 		tracer := otel.Tracer("server")
-		ctx, span := tracer.Start(c.Context(), "GetCarDamagesHandler")
+		ctx, span := tracer.Start(c.UserContext(), "GetCarDamagesHandler")
 		defer span.End()
 
 		correlationID := c.Locals(middleware.CorrelationIDHeader).(string)
@@ -356,7 +456,7 @@ func (srv *Server) SetupCarRoutes() {
 		}
 
 		// Fetch damages
-		damages, totalDamages, err := srv.Database.DamageDB.GetDamages(licensePlate, page, pageSize)
+		damages, totalDamages, err := srv.Database.DamageDB.GetDamages(ctx, licensePlate, page, pageSize)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -377,14 +477,11 @@ func (srv *Server) SetupCarRoutes() {
 		})
 	})
 
-	authenticatedGroup.Post("/damages", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/damages", srv.RequirePermission(models.PermissionCarsWrite), func(c *fiber.Ctx) error {
 		_, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if !checkAdmin(c) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 		var damage models.Damage
 		if err := c.BodyParser(&damage); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
@@ -393,7 +490,7 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
 
-		err := srv.Database.DamageDB.AddDamage(damage)
+		err := srv.Database.DamageDB.AddDamage(c.UserContext(), damage)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -403,7 +500,7 @@ func (srv *Server) SetupCarRoutes() {
 
 	carGroup.Get("/:license_plate/services", func(c *fiber.Ctx) error {
 		tracer := otel.Tracer("server")
-		ctx, span := tracer.Start(c.Context(), "GetCarServicesHandler")
+		ctx, span := tracer.Start(c.UserContext(), "GetCarServicesHandler")
 		defer span.End()
 
 		correlationID := c.Locals(middleware.CorrelationIDHeader).(string)
@@ -430,7 +527,7 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Car not found"})
 		}
 
-		totalServices, err := srv.Database.ServiceDB.GetTotalServices(car.LicensePlate)
+		totalServices, err := srv.Database.ServiceDB.GetTotalServices(ctx, car.LicensePlate)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch total services count"})
 		}
@@ -438,7 +535,7 @@ func (srv *Server) SetupCarRoutes() {
 		totalPages := (totalServices + pageSize - 1) / pageSize
 
 		// Fetch services
-		services, err := srv.Database.ServiceDB.GetServices(licensePlate, page, pageSize)
+		services, err := srv.Database.ServiceDB.GetServices(ctx, licensePlate, page, pageSize)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -457,14 +554,11 @@ func (srv *Server) SetupCarRoutes() {
 		})
 	})
 
-	authenticatedGroup.Post("/services", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/services", srv.RequirePermission(models.PermissionCarsWrite), func(c *fiber.Ctx) error {
 		_, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
-		if !checkAdmin(c) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
-		}
 		var service models.Service
 		if err := c.BodyParser(&service); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
@@ -473,7 +567,7 @@ func (srv *Server) SetupCarRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
 
-		err := srv.Database.ServiceDB.AddService(service)
+		err := srv.Database.ServiceDB.AddService(c.UserContext(), service)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -489,9 +583,70 @@ func validateLicensePlate(fl validator.FieldLevel) bool {
 	return re.MatchString(fl.Field().String())
 }
 
-func checkAdmin(c *fiber.Ctx) bool {
-	if role, ok := c.Locals(string(middleware.Role)).(string); ok && role == "Admin" {
-		return true
+// carsChanged drops the cached listings of the cars after a change to any
+// car. A failure leaves them stale until they expire, which is logged but
+// does not fail the change.
+func (srv *Server) carsChanged(ctx context.Context) {
+	if err := srv.Database.CarDB.InvalidateCars(); err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to invalidate the cached cars", "error", err)
+	}
+}
+
+// parseCarSearch reads the filters and sort order of /cars/search from the
+// query string.
+func parseCarSearch(c *fiber.Ctx) (models.CarSearch, error) {
+	search := models.CarSearch{
+		Status:   models.Status(strings.ToUpper(c.Query("status"))),
+		Category: models.Category(strings.ToUpper(c.Query("category"))),
+		Make:     c.Query("make"),
+		Model:    c.Query("model"),
+		Location: c.Query("location"),
+		Text:     c.Query("q"),
+		Sort:     models.CarSortField(c.Query("sort")),
 	}
-	return false
+
+	switch search.Status {
+	case "", models.Available, models.Rented, models.Maintenance:
+	default:
+		return models.CarSearch{}, ErrInvalidCarStatus
+	}
+	switch search.Category {
+	case "", models.Economy, models.Standard, models.Premium, models.Van:
+	default:
+		return models.CarSearch{}, ErrInvalidCarCategory
+	}
+	if search.Sort != "" && !search.Sort.Valid() {
+		return models.CarSearch{}, database.ErrInvalidCarSort
+	}
+
+	switch strings.ToLower(c.Query("order", "asc")) {
+	case "asc":
+	case "desc":
+		search.Descending = true
+	default:
+		return models.CarSearch{}, ErrInvalidSortOrder
+	}
+
+	for _, bound := range []struct {
+		param string
+		dst   **money.Amount
+	}{
+		{"min_price", &search.MinCostPerKm},
+		{"max_price", &search.MaxCostPerKm},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		amount, err := money.Parse(value)
+		if err != nil || amount < 0 {
+			return models.CarSearch{}, ErrInvalidPriceRange
+		}
+		*bound.dst = &amount
+	}
+	if search.MinCostPerKm != nil && search.MaxCostPerKm != nil && *search.MinCostPerKm > *search.MaxCostPerKm {
+		return models.CarSearch{}, ErrInvalidPriceRange
+	}
+
+	return search, nil
 }
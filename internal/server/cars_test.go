@@ -0,0 +1,365 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestCarPermissions(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedAdmin("admin@datadrive.com", "supersecret")
+
+	client := signup(h, "driver@example.com", "driver")
+	admin := login(h, "admin@datadrive.com", "supersecret")
+
+	newCar := map[string]any{
+		"license_plate": "XYZ5678",
+		"make":          "Honda",
+		"model":         "Civic",
+		"status":        models.Available,
+		"cost_per_km":   0.6,
+		"location":      "PANORAMA",
+		"latitude":      40.5880,
+		"longitude":     23.0310,
+	}
+	update := map[string]any{
+		"make":        "Toyota",
+		"model":       "Corolla",
+		"status":      models.Maintenance,
+		"cost_per_km": 0.5,
+	}
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "list requires a token",
+			Method:     http.MethodGet,
+			Path:       "/cars",
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "clients cannot list the fleet",
+			Method:     http.MethodGet,
+			Path:       "/cars",
+			Token:      client,
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "clients cannot add cars",
+			Method:     http.MethodPost,
+			Path:       "/cars",
+			Body:       newCar,
+			Token:      client,
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "clients cannot update cars",
+			Method:     http.MethodPut,
+			Path:       "/cars/ABC1234",
+			Body:       update,
+			Token:      client,
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "a forged role without permissions is rejected",
+			Method:     http.MethodPost,
+			Path:       "/cars",
+			Body:       newCar,
+			Token:      h.Token("driver@example.com", "Owner"),
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "admin lists the fleet",
+			Method:     http.MethodGet,
+			Path:       "/cars",
+			Token:      admin,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:   "admin adds a car without coordinates",
+			Method: http.MethodPost,
+			Path:   "/cars",
+			Body: map[string]any{
+				"license_plate": "XYZ5678",
+				"make":          "Honda",
+				"model":         "Civic",
+				"status":        models.Available,
+			},
+			Token:      admin,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "admin adds a car",
+			Method:     http.MethodPost,
+			Path:       "/cars",
+			Body:       newCar,
+			Token:      admin,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "admin updates a car",
+			Method:     http.MethodPut,
+			Path:       "/cars/ABC1234",
+			Body:       update,
+			Token:      admin,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "admin reads a car's trips",
+			Method:     http.MethodGet,
+			Path:       "/trips/car/ABC1234",
+			Token:      admin,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "clients cannot read a car's trips",
+			Method:     http.MethodGet,
+			Path:       "/trips/car/ABC1234",
+			Token:      client,
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "admin profile shows the role",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      admin,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := resp.Map(t)["role"]; got != models.AdminRole {
+					t.Fatalf("got role %v, want %s", got, models.AdminRole)
+				}
+			},
+		},
+	})
+
+	if err := h.Database.RoleDB.SetUserRole(context.Background(), "driver@example.com", models.AdminRole); err != nil {
+		t.Fatalf("failed to promote the client: %v", err)
+	}
+	promoted := login(h, "driver@example.com", "supersecret")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "promoted user lists the fleet",
+			Method:     http.MethodGet,
+			Path:       "/cars",
+			Token:      promoted,
+			WantStatus: http.StatusOK,
+		},
+	})
+}
+
+// login returns the token issued for email and password.
+func login(h *testutil.Harness, email, password string) string {
+	h.T.Helper()
+
+	resp := h.Do(http.MethodPost, "/login", map[string]string{"email": email, "password": password}, "")
+	if resp.Status != http.StatusOK {
+		h.T.Fatalf("login failed with status %d: %s", resp.Status, resp.Body)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	resp.JSON(h.T, &body)
+	return body.Token
+}
+
+func TestCarSearch(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedAdmin("admin@datadrive.com", "supersecret")
+	admin := login(h, "admin@datadrive.com", "supersecret")
+	client := signup(h, "driver@example.com", "driver")
+
+	for _, car := range []struct {
+		plate, make, model, location, cost string
+		status                             models.Status
+		category                           models.Category
+	}{
+		{"AAA1111", "Toyota", "Corolla", "KAMARA", "0.40", models.Available, models.Standard},
+		{"BBB2222", "Toyota", "Yaris", "VOTSI", "0.30", models.Rented, models.Economy},
+		{"CCC3333", "Honda", "Civic", "KAMARA", "0.60", models.Available, models.Standard},
+		{"DDD4444", "Mercedes", "Sprinter", "PANORAMA", "0.90", models.Maintenance, models.Van},
+		{"EEE5555", "BMW", "X5", "ARISTOTELOUS SQUARE", "", models.Available, models.Premium},
+	} {
+		latitude, longitude := 40.6324, 22.9408
+		seeded := models.Car{
+			LicensePlate: car.plate,
+			Make:         car.make,
+			Model:        car.model,
+			Status:       car.status,
+			Category:     car.category,
+			Location:     car.location,
+			Latitude:     &latitude,
+			Longitude:    &longitude,
+		}
+		if car.cost != "" {
+			cost := money.MustParse(car.cost)
+			seeded.CostPerKm = &cost
+		}
+		if err := h.Database.CarDB.InsertCar(context.Background(), seeded); err != nil {
+			t.Fatalf("failed to seed car %s: %v", car.plate, err)
+		}
+	}
+
+	plates := func(plates ...string) func(*testing.T, *testutil.Response) {
+		return func(t *testing.T, resp *testutil.Response) {
+			var body struct {
+				Data []models.Car `json:"data"`
+			}
+			resp.JSON(t, &body)
+			var got []string
+			for _, car := range body.Data {
+				got = append(got, car.LicensePlate)
+			}
+			if strings.Join(got, ",") != strings.Join(plates, ",") {
+				t.Fatalf("got cars %v, want %v", got, plates)
+			}
+		}
+	}
+
+	h.Run(t, []testutil.Case{
+		{Name: "requires a token", Method: http.MethodGet, Path: "/cars/search", WantStatus: http.StatusUnauthorized},
+		{Name: "clients cannot search the fleet", Method: http.MethodGet, Path: "/cars/search", Token: client, WantStatus: http.StatusForbidden},
+		{Name: "everything", Method: http.MethodGet, Path: "/cars/search?page_size=10", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111", "BBB2222", "CCC3333", "DDD4444", "EEE5555")},
+		{Name: "by status", Method: http.MethodGet, Path: "/cars/search?status=available", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111", "CCC3333", "EEE5555")},
+		{Name: "by make and location", Method: http.MethodGet, Path: "/cars/search?make=toyota&location=kamara", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111")},
+		{Name: "by category", Method: http.MethodGet, Path: "/cars/search?category=VAN", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("DDD4444")},
+		{Name: "by price range", Method: http.MethodGet, Path: "/cars/search?min_price=0.35&max_price=0.60", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111", "CCC3333")},
+		{Name: "sorted by price", Method: http.MethodGet, Path: "/cars/search?sort=cost_per_km&order=desc&status=AVAILABLE", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("CCC3333", "AAA1111", "EEE5555")},
+		{Name: "sorted by make", Method: http.MethodGet, Path: "/cars/search?sort=make&page_size=10", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("EEE5555", "CCC3333", "DDD4444", "AAA1111", "BBB2222")},
+		{Name: "free text", Method: http.MethodGet, Path: "/cars/search?q=toy", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111", "BBB2222")},
+		{Name: "free text across columns", Method: http.MethodGet, Path: "/cars/search?q=toyota+kam", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("AAA1111")},
+		{Name: "free text over a location", Method: http.MethodGet, Path: "/cars/search?q=square", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("EEE5555")},
+		{Name: "paged", Method: http.MethodGet, Path: "/cars/search?page=2&page_size=2", Token: admin, WantStatus: http.StatusOK,
+			Check: plates("CCC3333", "DDD4444")},
+		{Name: "nothing matches", Method: http.MethodGet, Path: "/cars/search?q=tesla", Token: admin, WantStatus: http.StatusOK,
+			Check: plates()},
+		{Name: "sort column not allowed", Method: http.MethodGet, Path: "/cars/search?sort=password", Token: admin, WantStatus: http.StatusBadRequest},
+		{Name: "invalid order", Method: http.MethodGet, Path: "/cars/search?order=sideways", Token: admin, WantStatus: http.StatusBadRequest},
+		{Name: "invalid status", Method: http.MethodGet, Path: "/cars/search?status=STOLEN", Token: admin, WantStatus: http.StatusBadRequest},
+		{Name: "invalid price", Method: http.MethodGet, Path: "/cars/search?min_price=cheap", Token: admin, WantStatus: http.StatusBadRequest},
+		{Name: "empty price range", Method: http.MethodGet, Path: "/cars/search?min_price=1&max_price=0.5", Token: admin, WantStatus: http.StatusBadRequest},
+	})
+}
+
+func TestNearbyCars(t *testing.T) {
+	h := testutil.New(t)
+	// ABC1234 is parked at Kamara, about 900 m from Aristotelous Square.
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	token := signup(h, "driver@example.com", "driver")
+
+	for _, car := range []struct {
+		plate               string
+		status              models.Status
+		latitude, longitude float64
+	}{
+		{"VOT1111", models.Available, 40.6135, 22.9576},
+		{"PAN2222", models.Available, 40.5880, 23.0310},
+		{"REN3333", models.Rented, 40.6320, 22.9515},
+		{"ATH4444", models.Available, 37.9400, 23.7000},
+	} {
+		latitude, longitude := car.latitude, car.longitude
+		err := h.Database.CarDB.InsertCar(context.Background(), models.Car{
+			LicensePlate: car.plate,
+			Make:         "Toyota",
+			Model:        "Yaris",
+			Status:       car.status,
+			Latitude:     &latitude,
+			Longitude:    &longitude,
+		})
+		if err != nil {
+			t.Fatalf("failed to seed car %s: %v", car.plate, err)
+		}
+	}
+
+	nearby := func(plates ...string) func(*testing.T, *testutil.Response) {
+		return func(t *testing.T, resp *testutil.Response) {
+			var body struct {
+				Data []models.NearbyCar `json:"data"`
+			}
+			resp.JSON(t, &body)
+			var got []string
+			for i, car := range body.Data {
+				got = append(got, car.LicensePlate)
+				if i > 0 && car.Distance < body.Data[i-1].Distance {
+					t.Fatalf("got cars %+v, want them ordered by distance", body.Data)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(plates, ",") {
+				t.Fatalf("got cars %v, want %v", got, plates)
+			}
+		}
+	}
+
+	const square = "/available/nearby?lat=40.6324&lng=22.9408"
+	h.Run(t, []testutil.Case{
+		{Name: "within the default radius", Method: http.MethodGet, Path: square, WantStatus: http.StatusOK,
+			Check: nearby("ABC1234", "VOT1111")},
+		{Name: "within a wider radius", Method: http.MethodGet, Path: square + "&radius=10", WantStatus: http.StatusOK,
+			Check: nearby("ABC1234", "VOT1111", "PAN2222")},
+		{Name: "closest only", Method: http.MethodGet, Path: square + "&limit=1", WantStatus: http.StatusOK,
+			Check: nearby("ABC1234")},
+		{Name: "nothing around", Method: http.MethodGet, Path: "/available/nearby?lat=0&lng=0", WantStatus: http.StatusOK,
+			Check: nearby()},
+		{Name: "missing latitude", Method: http.MethodGet, Path: "/available/nearby?lng=22.9408", WantStatus: http.StatusBadRequest},
+		{Name: "latitude out of range", Method: http.MethodGet, Path: "/available/nearby?lat=91&lng=22.9408", WantStatus: http.StatusBadRequest},
+		{Name: "empty radius", Method: http.MethodGet, Path: square + "&radius=0", WantStatus: http.StatusBadRequest},
+		{Name: "radius too wide", Method: http.MethodGet, Path: square + "&radius=500", WantStatus: http.StatusBadRequest},
+	})
+
+	// The car is left at the last point of the trip, about 4 km north of
+	// where the track starts in Athens.
+	billedTrip(t, h, token)
+	h.Run(t, []testutil.Case{
+		{Name: "moved away from the square", Method: http.MethodGet, Path: square, WantStatus: http.StatusOK,
+			Check: nearby("VOT1111")},
+		{Name: "parked at the end of the trip", Method: http.MethodGet, Path: "/available/nearby?lat=37.936&lng=23.7&radius=1", WantStatus: http.StatusOK,
+			Check: nearby("ABC1234", "ATH4444")},
+	})
+
+	// A position supplied on stop wins over the telemetry.
+	resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+	}
+	resp = h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 1, 7)...), token)
+	if resp.Status != http.StatusAccepted {
+		t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+	}
+	resp = h.Do(http.MethodPost, "/trips/stop", map[string]any{
+		"payment_method": models.Card,
+		"latitude":       40.6330,
+		"longitude":      22.9410,
+	}, token)
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("failed to stop trip: %d %s", resp.Status, resp.Body)
+	}
+	h.Run(t, []testutil.Case{
+		{Name: "parked where the driver said", Method: http.MethodGet, Path: square + "&limit=1", WantStatus: http.StatusOK,
+			Check: nearby("ABC1234")},
+		{Name: "half a position", Method: http.MethodPost, Path: "/trips/stop", Token: token,
+			Body: map[string]any{"payment_method": models.Card, "latitude": 40.6}, WantStatus: http.StatusBadRequest,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := resp.Map(t)["error"]; got != "validation failed" {
+					t.Fatalf("got error %v, want the validation to fail", got)
+				}
+			}},
+	})
+}
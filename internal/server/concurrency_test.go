@@ -0,0 +1,129 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+// parallel sends n requests at once and returns the status codes they got.
+func parallel(h *testutil.Harness, n int, send func(i int) *testutil.Response) map[int]int {
+	statuses := make(map[int]int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ready
+			resp := send(i)
+			mu.Lock()
+			statuses[resp.Status]++
+			mu.Unlock()
+		}()
+	}
+	close(ready)
+	wg.Wait()
+	return statuses
+}
+
+func TestConcurrentTrips(t *testing.T) {
+	const n = 20
+
+	t.Run("one car, many users", func(t *testing.T) {
+		h := testutil.New(t)
+		h.SeedCar("ABC1234", models.Available, "0.50")
+
+		// Signing up through the API hashes passwords, which is too slow for
+		// this many users.
+		tokens := make([]string, n)
+		for i := range tokens {
+			email := fmt.Sprintf("driver%d@example.com", i)
+			if _, err := h.Database.UserDB.CreateUser(context.Background(), email, fmt.Sprintf("driver%d", i), "Test Driver", "hash"); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			tokens[i] = h.ClientToken(email)
+		}
+
+		statuses := parallel(h, n, func(i int) *testutil.Response {
+			return h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, tokens[i])
+		})
+		if statuses[http.StatusCreated] != 1 || statuses[http.StatusBadRequest] != n-1 {
+			t.Fatalf("got statuses %v, want one trip started", statuses)
+		}
+
+		active := 0
+		for i := range tokens {
+			if _, err := h.Database.TripDB.GetActiveTrip(context.Background(), fmt.Sprintf("driver%d@example.com", i)); err == nil {
+				active++
+			}
+		}
+		car, err := h.Database.CarDB.GetCarByLicensePlate(context.Background(), "ABC1234")
+		if active != 1 || err != nil || car.Status != models.Rented {
+			t.Fatalf("got %d active trips and car %+v (%v), want one trip on the RENTED car", active, car, err)
+		}
+	})
+
+	t.Run("one user, many cars", func(t *testing.T) {
+		h := testutil.New(t)
+		for i := range n {
+			h.SeedCar(fmt.Sprintf("CAR%04d", i), models.Available, "0.50")
+		}
+		token := signup(h, "driver@example.com", "driver")
+
+		statuses := parallel(h, n, func(i int) *testutil.Response {
+			return h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": fmt.Sprintf("CAR%04d", i)}, token)
+		})
+		if statuses[http.StatusCreated] != 1 || statuses[http.StatusConflict] != n-1 {
+			t.Fatalf("got statuses %v, want one trip started", statuses)
+		}
+
+		rented := 0
+		for i := range n {
+			car, err := h.Database.CarDB.GetCarByLicensePlate(context.Background(), fmt.Sprintf("CAR%04d", i))
+			if err != nil {
+				t.Fatalf("failed to read car: %v", err)
+			}
+			if car.Status == models.Rented {
+				rented++
+			}
+		}
+		if rented != 1 {
+			t.Fatalf("got %d rented cars, want the refused starts rolled back", rented)
+		}
+	})
+
+	t.Run("stopped once", func(t *testing.T) {
+		h := testutil.New(t)
+		h.SeedCar("ABC1234", models.Available, "0.50")
+		token := signup(h, "driver@example.com", "driver")
+
+		resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token)
+		if resp.Status != http.StatusAccepted {
+			t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+		}
+
+		statuses := parallel(h, n, func(i int) *testutil.Response {
+			return h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Card}, token)
+		})
+		if statuses[http.StatusCreated] != 1 || statuses[http.StatusBadRequest] != n-1 {
+			t.Fatalf("got statuses %v, want the trip stopped once", statuses)
+		}
+
+		payment, err := h.Database.PaymentDB.GetPayment(context.Background(), 1)
+		if err != nil || payment.Status != models.PaymentCaptured {
+			t.Fatalf("got payment %+v (%v), want it CAPTURED", payment, err)
+		}
+	})
+}
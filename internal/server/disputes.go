@@ -0,0 +1,500 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+)
+
+var ErrPaymentNotRefundable = errors.New("only captured or partially refunded payments can be disputed or refunded")
+
+// setupTripDisputeRoutes registers the routes users dispute the charge of
+// their trips on. tripGroup is the authenticated /trips group.
+func (srv *Server) setupTripDisputeRoutes(tripGroup fiber.Router, validator *validator.Validate) {
+	tripGroup.Post("/details/:id/dispute", srv.RequirePermission(models.PermissionTripsWrite), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "CreateDisputeHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		var payload struct {
+			Reason string `json:"reason" validate:"required,max=500"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		trip, _, err := srv.Database.TripDB.GetTripByID(ctx, c.Params("id"), email)
+		if err != nil {
+			if err == database.ErrTripNotFound {
+				return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		pay, err := srv.Database.PaymentDB.GetPayment(ctx, int(trip.ID))
+		if err != nil {
+			if err == database.ErrPaymentNotFound {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": ErrPaymentNotRefundable.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if (pay.Status != models.PaymentCaptured && pay.Status != models.PaymentPartiallyRefunded) || pay.Amount <= 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": ErrPaymentNotRefundable.Error()})
+		}
+
+		dispute, err := srv.Database.DisputeDB.CreateDispute(ctx, models.Dispute{
+			TripID:    trip.ID,
+			UserEmail: email,
+			Reason:    payload.Reason,
+		})
+		if err != nil {
+			if err == database.ErrDisputeExists {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		srv.notifyDispute(ctx, dispute, 0)
+
+		return c.Status(http.StatusCreated).JSON(dispute)
+	})
+
+	tripGroup.Get("/details/:id/dispute", srv.RequirePermission(models.PermissionTripsRead), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetTripDisputeHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		trip, _, err := srv.Database.TripDB.GetTripByID(ctx, c.Params("id"), email)
+		if err != nil {
+			if err == database.ErrTripNotFound {
+				return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		dispute, err := srv.Database.DisputeDB.GetDisputeForTrip(ctx, trip.ID)
+		if err != nil {
+			if err == database.ErrDisputeNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		refunds, err := srv.Database.PaymentDB.GetRefunds(ctx, trip.ID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{
+			"dispute": dispute,
+			"refunds": refunds,
+		})
+	})
+
+}
+
+// SetupDisputeRoutes registers the queue admins resolve disputes from.
+func (srv *Server) SetupDisputeRoutes() {
+	validator := validator.New()
+
+	disputeGroup := srv.FiberApp.Group("/disputes")
+
+	adminGroup := disputeGroup.Group("/",
+		middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB),
+		srv.RequirePermission(models.PermissionDisputesManage),
+	)
+
+	adminGroup.Get("/", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetDisputesHandler")
+		defer span.End()
+
+		page := c.QueryInt("page", 1)
+		if page < 1 {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": database.ErrInvalidPageNumber.Error()})
+		}
+
+		pageSize := c.QueryInt("page_size", 5)
+		if pageSize < 1 || pageSize > 100 {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": database.ErrInvalidPageSize.Error()})
+		}
+
+		// The queue holds the open disputes unless asked otherwise.
+		status := models.DisputeStatus(c.Query("status", string(models.DisputeOpen)))
+		switch status {
+		case models.DisputeOpen, models.DisputeApproved, models.DisputeRejected:
+		case "ALL":
+			status = ""
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid dispute status"})
+		}
+
+		disputes, totalDisputes, err := srv.Database.DisputeDB.GetDisputes(ctx, status, page, pageSize)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		totalPages := (totalDisputes + pageSize - 1) / pageSize
+
+		return c.JSON(fiber.Map{
+			"data": disputes,
+			"meta": fiber.Map{
+				"current_page":   page,
+				"page_size":      pageSize,
+				"total_pages":    totalPages,
+				"total_disputes": totalDisputes,
+			},
+		})
+	})
+
+	adminGroup.Get("/:id", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetDisputeHandler")
+		defer span.End()
+
+		id, err := c.ParamsInt("id")
+		if err != nil || id < 1 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid dispute ID"})
+		}
+
+		dispute, err := srv.Database.DisputeDB.GetDispute(ctx, int64(id))
+		if err != nil {
+			if err == database.ErrDisputeNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		pay, err := srv.Database.PaymentDB.GetPayment(ctx, int(dispute.TripID))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		refunds, err := srv.Database.PaymentDB.GetRefunds(ctx, dispute.TripID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{
+			"dispute": dispute,
+			"payment": pay,
+			"refunds": refunds,
+		})
+	})
+
+	adminGroup.Post("/:id/approve", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "ApproveDisputeHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		id, err := c.ParamsInt("id")
+		if err != nil || id < 1 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid dispute ID"})
+		}
+
+		// Amount defaults to what is left of the payment, a full refund, and
+		// the body may be left out altogether.
+		var payload struct {
+			Amount *money.Amount `json:"amount" validate:"omitempty,gt=0"`
+			Note   string        `json:"note" validate:"max=500"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&payload); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+			}
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		dispute, err := srv.Database.DisputeDB.GetDispute(ctx, int64(id))
+		if err != nil {
+			if err == database.ErrDisputeNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if dispute.Status != models.DisputeOpen {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": database.ErrDisputeNotOpen.Error()})
+		}
+
+		pay, err := srv.Database.PaymentDB.GetPayment(ctx, int(dispute.TripID))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if (pay.Status != models.PaymentCaptured && pay.Status != models.PaymentPartiallyRefunded) || pay.ProviderReference == "" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": ErrPaymentNotRefundable.Error()})
+		}
+
+		refunds, err := srv.Database.PaymentDB.GetRefunds(ctx, dispute.TripID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// Pending refunds may have been made, so they count against what is
+		// left until they are settled.
+		remaining := pay.Amount
+		for _, refund := range refunds {
+			if refund.Status != models.RefundFailed {
+				remaining = remaining.Sub(refund.Amount)
+			}
+		}
+
+		amount := remaining
+		if payload.Amount != nil {
+			amount = *payload.Amount
+		}
+		if amount <= 0 || amount > remaining {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": fmt.Sprintf("refund amount must be more than 0 and at most %s", remaining)})
+		}
+
+		// Resolving the dispute first keeps a concurrent approval from
+		// refunding it a second time, and the refund is written to the ledger
+		// as pending along with it, so that a refund the provider makes is
+		// never missing from it. Both are committed before the provider is
+		// called, so that no locks are held while it answers.
+		refund, err := srv.approveDispute(ctx, dispute, email, payload.Note, models.Refund{
+			TripID:            dispute.TripID,
+			DisputeID:         &dispute.ID,
+			Amount:            amount,
+			Status:            models.RefundPending,
+			ProviderReference: pay.ProviderReference,
+			CreatedBy:         email,
+		})
+		if err != nil {
+			if err == database.ErrDisputeNotOpen {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// When the provider does not make the refund, it is marked as failed
+		// and the dispute is opened again.
+		if err := srv.Payments.Refund(ctx, pay.ProviderReference, amount); err != nil {
+			if err := srv.Database.PaymentDB.UpdateRefundStatus(ctx, nil, refund.ID, models.RefundFailed); err != nil {
+				srv.logger().ErrorContext(ctx, "Failed to mark the refund as failed", "refund_id", refund.ID, "error", err)
+			}
+			if err := srv.Database.DisputeDB.ReopenDispute(ctx, dispute.ID, email, "refund failed: "+err.Error()); err != nil {
+				srv.logger().ErrorContext(ctx, "Failed to reopen the dispute", "dispute_id", dispute.ID, "error", err)
+			}
+			if errors.Is(err, payment.ErrDeclined) {
+				return c.Status(http.StatusPaymentRequired).JSON(fiber.Map{"error": err.Error()})
+			}
+			srv.logger().ErrorContext(ctx, "Failed to refund the trip", "trip_id", dispute.TripID, "error", err)
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "failed to refund the payment"})
+		}
+
+		// A refund that cannot be settled stays pending in the ledger, where
+		// it still counts against what is left of the payment.
+		refund, err = srv.completeRefund(ctx, refund, amount == remaining)
+		if err != nil {
+			srv.logger().ErrorContext(ctx, "Refunded the trip but failed to settle the refund", "trip_id", dispute.TripID, "refund_id", refund.ID, "amount", amount, "error", err)
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to record the refund"})
+		}
+
+		dispute, err = srv.Database.DisputeDB.GetDispute(ctx, dispute.ID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		srv.notifyDispute(ctx, dispute, refund.Amount)
+
+		return c.JSON(fiber.Map{
+			"dispute": dispute,
+			"refund":  refund,
+		})
+	})
+
+	adminGroup.Post("/:id/reject", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "RejectDisputeHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		id, err := c.ParamsInt("id")
+		if err != nil || id < 1 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid dispute ID"})
+		}
+
+		var payload struct {
+			Note string `json:"note" validate:"required,max=500"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		err = srv.Database.DisputeDB.ResolveDispute(ctx, nil, int64(id), models.DisputeRejected, email, payload.Note)
+		if err != nil {
+			switch err {
+			case database.ErrDisputeNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			case database.ErrDisputeNotOpen:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		dispute, err := srv.Database.DisputeDB.GetDispute(ctx, int64(id))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		srv.notifyDispute(ctx, dispute, 0)
+
+		return c.JSON(fiber.Map{"dispute": dispute})
+	})
+}
+
+// approveDispute approves an open dispute and writes the refund it was
+// approved with to the ledger, together.
+func (srv *Server) approveDispute(ctx context.Context, dispute models.Dispute, approvedBy, note string, refund models.Refund) (models.Refund, error) {
+	tx, err := srv.Database.Begin(ctx)
+	if err != nil {
+		return models.Refund{}, err
+	}
+	defer tx.Rollback()
+
+	err = srv.Database.DisputeDB.ResolveDispute(ctx, tx, dispute.ID, models.DisputeApproved, approvedBy, note)
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	refund, err = srv.Database.PaymentDB.CreateRefund(ctx, tx, refund)
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	return refund, tx.Commit()
+}
+
+// completeRefund settles a pending refund the provider made, and moves the
+// payment to REFUNDED when nothing is left to refund, or to
+// PARTIALLY_REFUNDED otherwise.
+func (srv *Server) completeRefund(ctx context.Context, refund models.Refund, full bool) (models.Refund, error) {
+	tx, err := srv.Database.Begin(ctx)
+	if err != nil {
+		return refund, err
+	}
+	defer tx.Rollback()
+
+	err = srv.Database.PaymentDB.UpdateRefundStatus(ctx, tx, refund.ID, models.RefundCompleted)
+	if err != nil {
+		return refund, err
+	}
+
+	status := models.PaymentPartiallyRefunded
+	if full {
+		status = models.PaymentRefunded
+	}
+	err = srv.Database.PaymentDB.UpdatePaymentStatus(ctx, tx, int(refund.TripID), status, "", "")
+	if err != nil {
+		return refund, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return refund, err
+	}
+
+	refund.Status = models.RefundCompleted
+	return refund, nil
+}
+
+// notifyDispute mails the user about the status the dispute is in. Opened
+// disputes are also announced to the users who can resolve them. Failures
+// are only logged, the dispute has been recorded either way.
+func (srv *Server) notifyDispute(ctx context.Context, dispute models.Dispute, refunded money.Amount) {
+	var msg mailer.Message
+	switch dispute.Status {
+	case models.DisputeOpen:
+		msg = mailer.Message{
+			Subject: fmt.Sprintf("We received your dispute of trip %d", dispute.TripID),
+			Body: fmt.Sprintf(
+				"We received your dispute of the charge of trip %d:\n\n%s\n\n"+
+					"We will let you know once it has been reviewed.\n",
+				dispute.TripID, dispute.Reason,
+			),
+		}
+	case models.DisputeApproved:
+		msg = mailer.Message{
+			Subject: fmt.Sprintf("Your dispute of trip %d was approved", dispute.TripID),
+			Body: fmt.Sprintf(
+				"Your dispute of the charge of trip %d was approved, and %s was refunded.\n\n%s\n",
+				dispute.TripID, refunded, dispute.Resolution,
+			),
+		}
+	case models.DisputeRejected:
+		msg = mailer.Message{
+			Subject: fmt.Sprintf("Your dispute of trip %d was rejected", dispute.TripID),
+			Body: fmt.Sprintf(
+				"Your dispute of the charge of trip %d was rejected:\n\n%s\n",
+				dispute.TripID, dispute.Resolution,
+			),
+		}
+	}
+
+	msg.To = dispute.UserEmail
+	if err := srv.Mailer.Send(ctx, msg); err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to notify about the dispute", "dispute_id", dispute.ID, "recipient_email", dispute.UserEmail, "error", err)
+	}
+
+	if dispute.Status != models.DisputeOpen {
+		return
+	}
+
+	admins, err := srv.Database.RoleDB.GetUsersWithPermission(ctx, models.PermissionDisputesManage)
+	if err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to look up who resolves the dispute", "dispute_id", dispute.ID, "error", err)
+		return
+	}
+	for _, admin := range admins {
+		err := srv.Mailer.Send(ctx, mailer.Message{
+			To:      admin,
+			Subject: fmt.Sprintf("New dispute of trip %d", dispute.TripID),
+			Body: fmt.Sprintf(
+				"%s disputed the charge of trip %d:\n\n%s\n\n"+
+					"It is waiting in the dispute queue as dispute %d.\n",
+				dispute.UserEmail, dispute.TripID, dispute.Reason, dispute.ID,
+			),
+		})
+		if err != nil {
+			srv.logger().ErrorContext(ctx, "Failed to notify about the dispute", "dispute_id", dispute.ID, "recipient_email", admin, "error", err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestDisputes(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedAdmin("admin@datadrive.com", "password")
+
+	token := signup(h, "driver@example.com", "driver")
+	otherToken := signup(h, "other@example.com", "other")
+	adminToken := h.AdminToken("admin@datadrive.com")
+
+	dispute := func(t *testing.T, tripID int64, token string, body map[string]string) *testutil.Response {
+		t.Helper()
+		return h.Do(http.MethodPost, fmt.Sprintf("/trips/details/%d/dispute", tripID), body, token)
+	}
+	open := func(t *testing.T) (models.TripReceipt, models.Dispute) {
+		t.Helper()
+		_, receipt := billedTrip(t, h, token)
+		resp := dispute(t, receipt.TripID, token, map[string]string{"reason": "I was charged for the ride back"})
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to dispute trip %d: %d %s", receipt.TripID, resp.Status, resp.Body)
+		}
+		var created models.Dispute
+		resp.JSON(t, &created)
+		return receipt, created
+	}
+	paymentStatus := func(t *testing.T, tripID int64) models.PaymentStatus {
+		t.Helper()
+		stored, err := h.Database.PaymentDB.GetPayment(context.Background(), int(tripID))
+		if err != nil {
+			t.Fatalf("failed to read the payment of trip %d: %v", tripID, err)
+		}
+		return stored.Status
+	}
+
+	t.Run("opening", func(t *testing.T) {
+		receipt, created := open(t)
+		if created.Status != models.DisputeOpen || len(created.History) != 1 {
+			t.Fatalf("got dispute %+v, want it open with one event", created)
+		}
+
+		if resp := dispute(t, receipt.TripID, token, map[string]string{"reason": "again"}); resp.Status != http.StatusConflict {
+			t.Fatalf("disputing twice: got %d, want 409", resp.Status)
+		}
+		if resp := dispute(t, receipt.TripID, otherToken, map[string]string{"reason": "not mine"}); resp.Status != http.StatusForbidden {
+			t.Fatalf("disputing another user's trip: got %d, want 403", resp.Status)
+		}
+		if resp := dispute(t, receipt.TripID, token, map[string]string{}); resp.Status != http.StatusBadRequest {
+			t.Fatalf("disputing without a reason: got %d, want 400", resp.Status)
+		}
+
+		if got := h.Mailbox.Messages("driver@example.com"); !strings.Contains(got[len(got)-1].Subject, "We received your dispute") {
+			t.Fatalf("got mails %+v, want an acknowledgement", got)
+		}
+		if got := h.Mailbox.Messages("admin@datadrive.com"); len(got) != 1 || !strings.Contains(got[0].Body, "I was charged for the ride back") {
+			t.Fatalf("got admin mails %+v, want the new dispute", got)
+		}
+
+		resp := h.Do(http.MethodGet, "/disputes", nil, token)
+		if resp.Status != http.StatusForbidden {
+			t.Fatalf("queue as a client: got %d, want 403", resp.Status)
+		}
+		resp = h.Do(http.MethodGet, "/disputes", nil, adminToken)
+		var queue struct {
+			Data []models.Dispute `json:"data"`
+		}
+		resp.JSON(t, &queue)
+		if resp.Status != http.StatusOK || len(queue.Data) != 1 || queue.Data[0].ID != created.ID {
+			t.Fatalf("got queue %d %s, want the open dispute", resp.Status, resp.Body)
+		}
+	})
+
+	t.Run("partial refund", func(t *testing.T) {
+		receipt, created := open(t)
+
+		path := fmt.Sprintf("/disputes/%d/approve", created.ID)
+		if resp := h.Do(http.MethodPost, path, map[string]any{"amount": 2.5}, adminToken); resp.Status != http.StatusBadRequest {
+			t.Fatalf("refunding more than was paid: got %d, want 400", resp.Status)
+		}
+
+		resp := h.Do(http.MethodPost, path, map[string]any{"amount": 0.75, "note": "Part of the ride was a detour"}, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to approve: %d %s", resp.Status, resp.Body)
+		}
+		var body struct {
+			Dispute models.Dispute `json:"dispute"`
+			Refund  models.Refund  `json:"refund"`
+		}
+		resp.JSON(t, &body)
+		if body.Dispute.Status != models.DisputeApproved || len(body.Dispute.History) != 2 ||
+			body.Dispute.ResolvedBy != "admin@datadrive.com" || body.Refund.Amount != money.MustParse("0.75") {
+			t.Fatalf("got %s, want the dispute approved with 0.75 refunded", resp.Body)
+		}
+		if status := paymentStatus(t, receipt.TripID); status != models.PaymentPartiallyRefunded {
+			t.Fatalf("got payment %s, want it PARTIALLY_REFUNDED", status)
+		}
+
+		if resp := h.Do(http.MethodPost, path, nil, adminToken); resp.Status != http.StatusConflict {
+			t.Fatalf("approving twice: got %d, want 409", resp.Status)
+		}
+
+		resp = h.Do(http.MethodGet, fmt.Sprintf("/trips/details/%d/dispute", receipt.TripID), nil, token)
+		var view struct {
+			Dispute models.Dispute  `json:"dispute"`
+			Refunds []models.Refund `json:"refunds"`
+		}
+		resp.JSON(t, &view)
+		if resp.Status != http.StatusOK || view.Dispute.Status != models.DisputeApproved || len(view.Refunds) != 1 {
+			t.Fatalf("got %d %s, want the approved dispute and its refund", resp.Status, resp.Body)
+		}
+
+		got := h.Mailbox.Messages("driver@example.com")
+		if last := got[len(got)-1]; !strings.Contains(last.Body, "0.75 was refunded") {
+			t.Fatalf("got mail %+v, want the refund announced", last)
+		}
+
+		// What is left of the payment can be disputed again, once at a time.
+		resp = dispute(t, receipt.TripID, token, map[string]string{"reason": "The rest was a detour too"})
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("disputing the rest: got %d %s, want 201", resp.Status, resp.Body)
+		}
+		var again models.Dispute
+		resp.JSON(t, &again)
+		if resp := dispute(t, receipt.TripID, token, map[string]string{"reason": "again"}); resp.Status != http.StatusConflict {
+			t.Fatalf("disputing while a dispute is open: got %d, want 409", resp.Status)
+		}
+
+		resp = h.Do(http.MethodGet, fmt.Sprintf("/trips/details/%d/dispute", receipt.TripID), nil, token)
+		resp.JSON(t, &view)
+		if view.Dispute.ID != again.ID || view.Dispute.Status != models.DisputeOpen {
+			t.Fatalf("got %s, want the latest dispute", resp.Body)
+		}
+
+		resp = h.Do(http.MethodPost, fmt.Sprintf("/disputes/%d/approve", again.ID), nil, adminToken)
+		resp.JSON(t, &body)
+		if resp.Status != http.StatusOK || body.Refund.Amount != money.MustParse("1.25") {
+			t.Fatalf("got %d %s, want the remaining 1.25 refunded", resp.Status, resp.Body)
+		}
+		if status := paymentStatus(t, receipt.TripID); status != models.PaymentRefunded {
+			t.Fatalf("got payment %s, want it REFUNDED", status)
+		}
+		if resp := dispute(t, receipt.TripID, token, map[string]string{"reason": "again"}); resp.Status != http.StatusConflict {
+			t.Fatalf("disputing a refunded payment: got %d, want 409", resp.Status)
+		}
+	})
+
+	t.Run("full refund", func(t *testing.T) {
+		receipt, created := open(t)
+
+		resp := h.Do(http.MethodPost, fmt.Sprintf("/disputes/%d/approve", created.ID), nil, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to approve: %d %s", resp.Status, resp.Body)
+		}
+		if status := paymentStatus(t, receipt.TripID); status != models.PaymentRefunded {
+			t.Fatalf("got payment %s, want it REFUNDED", status)
+		}
+	})
+
+	t.Run("refund declined", func(t *testing.T) {
+		receipt, created := open(t)
+
+		h.Payments.Config = payment.FakeConfig{Fail: []string{"refund"}}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		resp := h.Do(http.MethodPost, fmt.Sprintf("/disputes/%d/approve", created.ID), nil, adminToken)
+		if resp.Status != http.StatusPaymentRequired {
+			t.Fatalf("got %d %s, want 402", resp.Status, resp.Body)
+		}
+
+		// The refund is marked as failed, and the dispute is opened again for
+		// another try.
+		stored, err := h.Database.DisputeDB.GetDispute(context.Background(), created.ID)
+		if err != nil || stored.Status != models.DisputeOpen || stored.ResolvedAt != nil || len(stored.History) != 3 {
+			t.Fatalf("got dispute %+v (%v), want it opened again", stored, err)
+		}
+		refunds, err := h.Database.PaymentDB.GetRefunds(context.Background(), receipt.TripID)
+		if err != nil || len(refunds) != 1 || refunds[0].Status != models.RefundFailed {
+			t.Fatalf("got refunds %+v (%v), want a failed one", refunds, err)
+		}
+		if status := paymentStatus(t, receipt.TripID); status != models.PaymentCaptured {
+			t.Fatalf("got payment %s, want it CAPTURED", status)
+		}
+
+		h.Payments.Config = payment.FakeConfig{}
+		if resp := h.Do(http.MethodPost, fmt.Sprintf("/disputes/%d/approve", created.ID), nil, adminToken); resp.Status != http.StatusOK {
+			t.Fatalf("approving again: got %d %s, want 200", resp.Status, resp.Body)
+		}
+		if status := paymentStatus(t, receipt.TripID); status != models.PaymentRefunded {
+			t.Fatalf("got payment %s, want it REFUNDED", status)
+		}
+	})
+
+	t.Run("refund in the ledger before the provider", func(t *testing.T) {
+		receipt, created := open(t)
+
+		provider := &ledgerCheckingProvider{PaymentProvider: h.Server.Payments, payments: h.Database.PaymentDB, tripID: receipt.TripID}
+		h.Server.Payments = provider
+		defer func() { h.Server.Payments = provider.PaymentProvider }()
+
+		resp := h.Do(http.MethodPost, fmt.Sprintf("/disputes/%d/approve", created.ID), nil, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to approve: %d %s", resp.Status, resp.Body)
+		}
+		if len(provider.seen) != 1 || provider.seen[0].Status != models.RefundPending {
+			t.Fatalf("provider saw refunds %+v, want a pending one", provider.seen)
+		}
+
+		refunds, err := h.Database.PaymentDB.GetRefunds(context.Background(), receipt.TripID)
+		if err != nil || len(refunds) != 1 || refunds[0].Status != models.RefundCompleted {
+			t.Fatalf("got refunds %+v (%v), want a completed one", refunds, err)
+		}
+	})
+
+	t.Run("rejection", func(t *testing.T) {
+		receipt, created := open(t)
+
+		path := fmt.Sprintf("/disputes/%d/reject", created.ID)
+		if resp := h.Do(http.MethodPost, path, nil, adminToken); resp.Status != http.StatusBadRequest {
+			t.Fatalf("rejecting without a note: got %d, want 400", resp.Status)
+		}
+
+		resp := h.Do(http.MethodPost, path, map[string]string{"note": "The trip matches the telemetry"}, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to reject: %d %s", resp.Status, resp.Body)
+		}
+
+		got := h.Mailbox.Messages("driver@example.com")
+		if last := got[len(got)-1]; !strings.Contains(last.Body, "The trip matches the telemetry") {
+			t.Fatalf("got mail %+v, want the rejection note", last)
+		}
+
+		resp = h.Do(http.MethodGet, "/disputes?status=REJECTED", nil, adminToken)
+		var queue struct {
+			Data []models.Dispute `json:"data"`
+		}
+		resp.JSON(t, &queue)
+		if len(queue.Data) != 1 || queue.Data[0].ID != created.ID {
+			t.Fatalf("got %s, want the rejected dispute", resp.Body)
+		}
+
+		if resp := dispute(t, receipt.TripID, token, map[string]string{"reason": "again"}); resp.Status != http.StatusConflict {
+			t.Fatalf("disputing after a rejection: got %d, want 409", resp.Status)
+		}
+	})
+}
+
+// ledgerCheckingProvider records the ledger of a trip as it was when the
+// provider was asked for a refund.
+type ledgerCheckingProvider struct {
+	payment.PaymentProvider
+	payments database.PaymentRepository
+	tripID   int64
+	seen     []models.Refund
+}
+
+func (p *ledgerCheckingProvider) Refund(ctx context.Context, authorizationID string, amount money.Amount) error {
+	refunds, err := p.payments.GetRefunds(ctx, p.tripID)
+	if err != nil {
+		return err
+	}
+	p.seen = refunds
+	return p.PaymentProvider.Refund(ctx, authorizationID, amount)
+}
@@ -0,0 +1,309 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestTripLifecycle(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedSubscriptions()
+
+	var token string
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:   "signup",
+			Method: http.MethodPost,
+			Path:   "/signup",
+			Body: map[string]string{
+				"email":     "driver@example.com",
+				"username":  "driver",
+				"full_name": "Test Driver",
+				"password":  "supersecret",
+			},
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "login",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "supersecret"},
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Token string `json:"token"`
+				}
+				resp.JSON(t, &body)
+				if body.Token == "" {
+					t.Fatal("login did not return a token")
+				}
+				token = body.Token
+			},
+		},
+	})
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "start trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "active trip",
+			Method:     http.MethodGet,
+			Path:       "/trips/active",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var trip models.Trip
+				resp.JSON(t, &trip)
+				if trip.CarLicensePlate != "ABC1234" {
+					t.Fatalf("got active trip on %q, want ABC1234", trip.CarLicensePlate)
+				}
+			},
+		},
+		{
+			Name:       "telemetry",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234", track(time.Now().Add(-30*time.Second), 2, 7)...),
+			Token:      token,
+			WantStatus: http.StatusAccepted,
+		},
+		{
+			Name:       "stop trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/stop",
+			Body:       map[string]any{"payment_method": models.Card},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Receipt models.TripReceipt `json:"receipt"`
+				}
+				resp.JSON(t, &body)
+				if body.Receipt.Distance != 2 || body.Receipt.Amount != money.MustParse("1.00") || body.Receipt.DrivingBehavior != 10 {
+					t.Fatalf("got receipt %+v, want 2 km billed 1.00 and a perfect score", body.Receipt)
+				}
+			},
+		},
+		{
+			Name:       "car is available again",
+			Method:     http.MethodGet,
+			Path:       "/available",
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.Car `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 1 || body.Data[0].Status != models.Available {
+					t.Fatalf("got available cars %+v, want ABC1234", body.Data)
+				}
+			},
+		},
+		{
+			Name:       "trip history",
+			Method:     http.MethodGet,
+			Path:       "/trips",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.PayloadTrip `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 1 {
+					t.Fatalf("got %d trips, want 1", len(body.Data))
+				}
+				trip := body.Data[0]
+				if trip.Amount != money.MustParse("1.00") || trip.PaymentMethod != models.Card || trip.EndTime == nil {
+					t.Fatalf("got trip %+v, want a finished trip paid 1.00 by card", trip)
+				}
+			},
+		},
+		{
+			Name:       "trip details",
+			Method:     http.MethodGet,
+			Path:       "/trips/details/1",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Trip  models.PayloadTrip `json:"trip"`
+					Quote models.Quote       `json:"quote"`
+				}
+				resp.JSON(t, &body)
+				if body.Trip.Amount != money.MustParse("1.00") || body.Quote.Total != money.MustParse("1.00") {
+					t.Fatalf("got trip %+v quoted %+v, want both at 1.00", body.Trip, body.Quote)
+				}
+			},
+		},
+		{
+			Name:       "review",
+			Method:     http.MethodPost,
+			Path:       "/reviews",
+			Body:       map[string]any{"trip_id": 1, "rating": 5, "comment": "Smooth ride"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "car reviews",
+			Method:     http.MethodGet,
+			Path:       "/reviews/car/ABC1234",
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data struct {
+						Reviews []models.Review `json:"reviews"`
+						Emails  []string        `json:"emails"`
+					} `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data.Reviews) != 1 || body.Data.Emails[0] != "driver@example.com" {
+					t.Fatalf("got reviews %+v, want the driver's review", body.Data)
+				}
+			},
+		},
+		{
+			Name:       "reviews of an unknown car",
+			Method:     http.MethodGet,
+			Path:       "/reviews/car/XYZ9999",
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "buy subscription",
+			Method:     http.MethodPost,
+			Path:       "/subscriptions/buy",
+			Body:       map[string]string{"subscription_name": string(models.OneMonth)},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "active subscription",
+			Method:     http.MethodGet,
+			Path:       "/subscriptions/active",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var subscription models.UserSubscription
+				resp.JSON(t, &subscription)
+				if subscription.SubscriptionName != models.OneMonth {
+					t.Fatalf("got subscription %q, want %q", subscription.SubscriptionName, models.OneMonth)
+				}
+			},
+		},
+		{
+			Name:       "cannot buy a second subscription",
+			Method:     http.MethodPost,
+			Path:       "/subscriptions/buy",
+			Body:       map[string]string{"subscription_name": string(models.OneYear)},
+			Token:      token,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "cancel subscription",
+			Method:     http.MethodPut,
+			Path:       "/subscriptions/cancel?mode=IMMEDIATE",
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "no active subscription",
+			Method:     http.MethodGet,
+			Path:       "/subscriptions/active",
+			Token:      token,
+			WantStatus: http.StatusNotFound,
+		},
+	})
+}
+
+func TestSubscribedTripIsFree(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedSubscriptions()
+
+	token := signup(h, "driver@example.com", "driver")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "buy subscription",
+			Method:     http.MethodPost,
+			Path:       "/subscriptions/buy",
+			Body:       map[string]string{"subscription_name": string(models.OneMonth)},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "start trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "telemetry",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234", track(time.Now().Add(-30*time.Second), 2, 7)...),
+			Token:      token,
+			WantStatus: http.StatusAccepted,
+		},
+		{
+			Name:       "stop trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/stop",
+			Body:       map[string]any{"payment_method": models.Card},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "trip paid by subscription",
+			Method:     http.MethodGet,
+			Path:       "/trips",
+			Token:      token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.PayloadTrip `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 1 || body.Data[0].Amount != 0 || body.Data[0].PaymentMethod != models.Sub {
+					t.Fatalf("got trips %+v, want one free subscription trip", body.Data)
+				}
+			},
+		},
+	})
+}
+
+// signup registers a client through the API and returns its token.
+func signup(h *testutil.Harness, email, username string) string {
+	h.T.Helper()
+
+	resp := h.Do(http.MethodPost, "/signup", map[string]string{
+		"email":     email,
+		"username":  username,
+		"full_name": "Test Driver",
+		"password":  "supersecret",
+	}, "")
+	if resp.Status != http.StatusCreated {
+		h.T.Fatalf("signup failed with status %d: %s", resp.Status, resp.Body)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	resp.JSON(h.T, &body)
+	return body.Token
+}
@@ -0,0 +1,92 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedCar("DEF4321", models.Available, "0.50")
+
+	token := signup(h, "driver@example.com", "driver")
+	other := signup(h, "other@example.com", "other")
+
+	key := func(value string) http.Header {
+		return http.Header{middleware.IdempotencyKeyHeader: {value}}
+	}
+	start := map[string]string{"license_plate": "ABC1234"}
+
+	first := h.DoWithHeader(http.MethodPost, "/trips/start", start, token, key("start-1"))
+	if first.Status != http.StatusCreated || first.Header.Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Fatalf("failed to start trip: %d %s", first.Status, first.Body)
+	}
+
+	t.Run("retry is replayed", func(t *testing.T) {
+		retry := h.DoWithHeader(http.MethodPost, "/trips/start", start, token, key("start-1"))
+		if retry.Status != http.StatusCreated || !bytes.Equal(retry.Body, first.Body) ||
+			retry.Header.Get(middleware.IdempotentReplayedHeader) != "true" {
+			t.Fatalf("got %d %s, want the first response replayed", retry.Status, retry.Body)
+		}
+	})
+
+	t.Run("key reused for another request", func(t *testing.T) {
+		resp := h.DoWithHeader(http.MethodPost, "/trips/start", map[string]string{"license_plate": "DEF4321"}, token, key("start-1"))
+		if resp.Status != http.StatusUnprocessableEntity {
+			t.Fatalf("got %d %s, want 422", resp.Status, resp.Body)
+		}
+	})
+
+	t.Run("keys are scoped to the user", func(t *testing.T) {
+		resp := h.DoWithHeader(http.MethodPost, "/trips/start", map[string]string{"license_plate": "DEF4321"}, other, key("start-1"))
+		if resp.Status != http.StatusCreated || resp.Header.Get(middleware.IdempotentReplayedHeader) != "" {
+			t.Fatalf("got %d %s, want the other user's trip started", resp.Status, resp.Body)
+		}
+	})
+
+	t.Run("without a key the request is handled again", func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/trips/start", start, token)
+		if resp.Status != http.StatusBadRequest {
+			t.Fatalf("got %d %s, want the active trip to be refused", resp.Status, resp.Body)
+		}
+	})
+
+	t.Run("stop is charged once", func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token)
+		if resp.Status != http.StatusAccepted {
+			t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+		}
+
+		stop := map[string]any{"payment_method": models.Card}
+		stopped := h.DoWithHeader(http.MethodPost, "/trips/stop", stop, token, key("stop-1"))
+		if stopped.Status != http.StatusCreated {
+			t.Fatalf("failed to stop trip: %d %s", stopped.Status, stopped.Body)
+		}
+		retry := h.DoWithHeader(http.MethodPost, "/trips/stop", stop, token, key("stop-1"))
+		if retry.Status != http.StatusCreated || !bytes.Equal(retry.Body, stopped.Body) {
+			t.Fatalf("got %d %s, want the receipt replayed", retry.Status, retry.Body)
+		}
+
+		var trips struct {
+			Data []models.PayloadTrip `json:"data"`
+		}
+		h.Do(http.MethodGet, "/trips", nil, token).JSON(t, &trips)
+		if len(trips.Data) != 1 || trips.Data[0].PaymentStatus != models.PaymentCaptured {
+			t.Fatalf("got trips %+v, want one captured trip", trips.Data)
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		resp := h.DoWithHeader(http.MethodPost, "/trips/start", start, token, key(string(bytes.Repeat([]byte("k"), models.IdempotencyKeyMaxLength+1))))
+		if resp.Status != http.StatusBadRequest {
+			t.Fatalf("got %d %s, want 400", resp.Status, resp.Body)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ntentasd/db-deliverable3/internal/logging"
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestRequestLogs(t *testing.T) {
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagator) })
+
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	token := signup(h, "driver@example.com", "driver")
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	h.Server.Payments = &payment.HTTPProvider{BaseURL: unreachable.URL}
+
+	if resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token); resp.Status != http.StatusCreated {
+		t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+	}
+	if resp := h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token); resp.Status != http.StatusAccepted {
+		t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	resp := h.DoWithHeader(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Card}, token, http.Header{
+		"Traceparent":                  {"00-" + traceID + "-00f067aa0ba902b7-01"},
+		middleware.CorrelationIDHeader: {"correlation-1"},
+	})
+	if resp.Status != http.StatusBadGateway {
+		t.Fatalf("got %d %s, want 502", resp.Status, resp.Body)
+	}
+
+	// The line logged by the handler and the one logged once the request is
+	// done both carry the request's attributes.
+	failures := h.Logs.Lines(t, "Failed to charge the trip")
+	requests := h.Logs.Lines(t, "Request")
+	if len(failures) != 1 || len(requests) == 0 {
+		t.Fatalf("got %d charge failures and %d requests logged, want one of each at least", len(failures), len(requests))
+	}
+	for _, line := range []map[string]any{failures[0], requests[len(requests)-1]} {
+		want := map[string]any{
+			"level":          "ERROR",
+			"correlation_id": "correlation-1",
+			"route":          "/trips/stop",
+			"user":           logging.HashEmail("driver@example.com"),
+			"trace_id":       traceID,
+		}
+		for key, value := range want {
+			if line[key] != value {
+				t.Errorf("got %s %v in %q, want %v", key, line[key], line["msg"], value)
+			}
+		}
+	}
+	if request := requests[len(requests)-1]; request["status"] != float64(http.StatusBadGateway) || request["method"] != http.MethodPost {
+		t.Errorf("got request logged as %v, want POST answered with 502", request)
+	}
+
+	if logs := h.Logs.String(); strings.Contains(logs, "driver@example.com") || strings.Contains(logs, "supersecret") {
+		t.Fatalf("got the user's email or password in the logs:\n%s", logs)
+	}
+}
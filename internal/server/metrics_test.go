@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedCar("DEF4321", models.Available, "0.55")
+	h.SeedCar("GHI5678", models.Maintenance, "0.60")
+	h.SeedSubscriptions()
+
+	token := signup(h, "driver@example.com", "driver")
+	h.SeedAdmin("admin@datadrive.com", "supersecret")
+	admin := login(h, "admin@datadrive.com", "supersecret")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "buy subscription",
+			Method:     http.MethodPost,
+			Path:       "/subscriptions/buy",
+			Body:       map[string]string{"subscription_name": string(models.OneMonth)},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "start trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "car",
+			Method:     http.MethodGet,
+			Path:       "/cars/DEF4321",
+			Token:      admin,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "another car",
+			Method:     http.MethodGet,
+			Path:       "/cars/GHI5678",
+			Token:      admin,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "reviews of an unknown car",
+			Method:     http.MethodGet,
+			Path:       "/reviews/car/ZZZ9999",
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			// Like any path the API does not serve, which only answers
+			// preflight requests.
+			Name:       "metrics on the API",
+			Method:     http.MethodGet,
+			Path:       "/metrics",
+			WantStatus: http.StatusMethodNotAllowed,
+		},
+	})
+
+	// The metrics are only served apart from the API.
+	resp := h.Scrape()
+	if resp.Status != http.StatusOK {
+		t.Fatalf("failed to scrape the metrics: %d %s", resp.Status, resp.Body)
+	}
+	body := string(resp.Body)
+	for _, want := range []string{
+		// Requests are labelled with their route, not their path.
+		`datadrive_http_requests_total{method="GET",route="/cars/:license_plate",status="200"} 2`,
+		`datadrive_http_requests_total{method="GET",route="/reviews/car/:license_plate",status="404"} 1`,
+		`datadrive_http_requests_total{method="POST",route="/trips/start",status="201"} 1`,
+		`datadrive_http_request_duration_seconds_count{method="GET",route="/cars/:license_plate",status="200"} 2`,
+		`datadrive_active_trips 1`,
+		`datadrive_cars{status="AVAILABLE"} 1`,
+		`datadrive_cars{status="RENTED"} 1`,
+		`datadrive_cars{status="MAINTENANCE"} 1`,
+		`datadrive_active_subscriptions 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+	if strings.Contains(body, "DEF4321") || strings.Contains(body, "ZZZ9999") {
+		t.Error("got a license plate in the metrics, want routes only")
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+)
+
+// recordPayment stores how far a payment got with the provider.
+type recordPayment func(ctx context.Context, status models.PaymentStatus, reference, reason string) error
+
+// chargeTrip charges the amount of a receipt through the payment provider and
+// records how far the PENDING payment got. It returns the status the payment
+// ended up in.
+func (srv *Server) chargeTrip(ctx context.Context, email string, receipt models.TripReceipt) (models.PaymentStatus, error) {
+	tripID := int(receipt.TripID)
+
+	return srv.charge(ctx, payment.AuthorizeRequest{
+		Reference: fmt.Sprintf("trip-%d", receipt.TripID),
+		Customer:  email,
+		Method:    receipt.PaymentMethod,
+		Amount:    receipt.Amount,
+		Currency:  money.DefaultCurrency,
+	}, func(ctx context.Context, status models.PaymentStatus, reference, reason string) error {
+		return srv.Database.PaymentDB.UpdatePaymentStatus(ctx, nil, tripID, status, reference, reason)
+	})
+}
+
+// chargeSubscription charges a PENDING subscription charge through the
+// payment provider, the same way trips are charged.
+func (srv *Server) chargeSubscription(ctx context.Context, email string, charge models.SubscriptionCharge) (models.PaymentStatus, error) {
+	return srv.charge(ctx, payment.AuthorizeRequest{
+		Reference: fmt.Sprintf("subscription-charge-%d", charge.ID),
+		Customer:  email,
+		Method:    charge.PaymentMethod,
+		Amount:    charge.Amount,
+		Currency:  money.DefaultCurrency,
+	}, func(ctx context.Context, status models.PaymentStatus, reference, reason string) error {
+		return srv.Database.SubscriptionDB.UpdateSubscriptionCharge(ctx, charge.ID, status, reference, reason)
+	})
+}
+
+// charge authorizes and captures req through the payment provider, storing
+// each step with record. An authorization that cannot be captured is voided,
+// so that no hold is left on the customer's funds. It returns the status the
+// payment ended up in.
+func (srv *Server) charge(ctx context.Context, req payment.AuthorizeRequest, record recordPayment) (models.PaymentStatus, error) {
+	authorizationID, err := srv.Payments.Authorize(ctx, req)
+	if err != nil {
+		return srv.failPayment(ctx, req.Reference, record, "", err), err
+	}
+
+	err = record(ctx, models.PaymentAuthorized, authorizationID, "")
+	if err != nil {
+		srv.voidAuthorization(ctx, req.Reference, authorizationID)
+		return models.PaymentPending, err
+	}
+
+	if err := srv.Payments.Capture(ctx, authorizationID, req.Amount); err != nil {
+		srv.voidAuthorization(ctx, req.Reference, authorizationID)
+		return srv.failPayment(ctx, req.Reference, record, authorizationID, err), err
+	}
+
+	err = record(ctx, models.PaymentCaptured, "", "")
+	if err != nil {
+		return models.PaymentAuthorized, err
+	}
+	return models.PaymentCaptured, nil
+}
+
+// failPayment marks a payment FAILED, keeping the reason the provider gave.
+func (srv *Server) failPayment(ctx context.Context, paymentReference string, record recordPayment, reference string, cause error) models.PaymentStatus {
+	reason := "payment provider unavailable"
+	var decline *payment.DeclineError
+	if errors.As(cause, &decline) {
+		reason = decline.Reason
+	}
+
+	if err := record(ctx, models.PaymentFailed, reference, reason); err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to mark the payment as failed", "payment_reference", paymentReference, "error", err)
+	}
+	return models.PaymentFailed
+}
+
+func (srv *Server) voidAuthorization(ctx context.Context, paymentReference, authorizationID string) {
+	if err := srv.Payments.Void(ctx, authorizationID); err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to void the authorization", "payment_reference", paymentReference, "authorization_id", authorizationID, "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+// billedTrip drives a 4 km trip on ABC1234, which costs 0.50 per km, and
+// stops it, expecting it to be billed 2.00.
+func billedTrip(t *testing.T, h *testutil.Harness, token string) (*testutil.Response, models.TripReceipt) {
+	t.Helper()
+	resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+	}
+	resp = h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token)
+	if resp.Status != http.StatusAccepted {
+		t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+	}
+
+	resp = h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Card}, token)
+	var body struct {
+		Receipt models.TripReceipt `json:"receipt"`
+	}
+	resp.JSON(t, &body)
+	if body.Receipt.Amount != money.MustParse("2.00") {
+		t.Fatalf("got receipt %+v, want 2.00 billed", body.Receipt)
+	}
+	return resp, body.Receipt
+}
+
+func TestStopTripPayment(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	token := signup(h, "driver@example.com", "driver")
+
+	// settled checks that the car was released and how the payment ended.
+	settled := func(t *testing.T, tripID int64, want models.PaymentStatus) models.Payment {
+		t.Helper()
+		car, err := h.Database.CarDB.GetCarByLicensePlate(context.Background(), "ABC1234")
+		if err != nil || car.Status != models.Available {
+			t.Fatalf("got car %+v (%v), want it AVAILABLE", car, err)
+		}
+		stored, err := h.Database.PaymentDB.GetPayment(context.Background(), int(tripID))
+		if err != nil || stored.Status != want {
+			t.Fatalf("got payment %+v (%v), want it %s", stored, err, want)
+		}
+		return stored
+	}
+
+	t.Run("captured", func(t *testing.T) {
+		resp, receipt := billedTrip(t, h, token)
+		if resp.Status != http.StatusCreated || receipt.PaymentStatus != models.PaymentCaptured {
+			t.Fatalf("got %d %s, want the payment captured", resp.Status, resp.Body)
+		}
+		stored := settled(t, receipt.TripID, models.PaymentCaptured)
+		if stored.ProviderReference == "" {
+			t.Fatalf("got payment %+v, want the authorization it was captured on", stored)
+		}
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		h.Payments.Config = payment.FakeConfig{DeclineAbove: money.MustParse("1.00")}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		resp, receipt := billedTrip(t, h, token)
+		if resp.Status != http.StatusPaymentRequired || receipt.PaymentStatus != models.PaymentFailed {
+			t.Fatalf("got %d %s, want 402 with the payment failed", resp.Status, resp.Body)
+		}
+		stored := settled(t, receipt.TripID, models.PaymentFailed)
+		if stored.FailureReason != "insufficient funds" {
+			t.Fatalf("got payment %+v, want the decline reason", stored)
+		}
+	})
+
+	t.Run("capture fails", func(t *testing.T) {
+		h.Payments.Config = payment.FakeConfig{Fail: []string{"capture"}}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		resp, receipt := billedTrip(t, h, token)
+		if resp.Status != http.StatusPaymentRequired {
+			t.Fatalf("got %d %s, want 402", resp.Status, resp.Body)
+		}
+		stored := settled(t, receipt.TripID, models.PaymentFailed)
+		// The authorization was voided, so it cannot be captured anymore.
+		h.Payments.Config = payment.FakeConfig{}
+		if err := h.Payments.Capture(context.Background(), stored.ProviderReference, 2); err == nil {
+			t.Fatalf("authorization %q of the failed payment was not voided", stored.ProviderReference)
+		}
+	})
+
+	t.Run("provider unreachable", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+
+		payments := h.Server.Payments
+		h.Server.Payments = &payment.HTTPProvider{BaseURL: unreachable.URL}
+		defer func() { h.Server.Payments = payments }()
+
+		resp, receipt := billedTrip(t, h, token)
+		if resp.Status != http.StatusBadGateway {
+			t.Fatalf("got %d %s, want 502", resp.Status, resp.Body)
+		}
+		stored := settled(t, receipt.TripID, models.PaymentFailed)
+		if stored.FailureReason != "payment provider unavailable" {
+			t.Fatalf("got payment %+v, want it failed on the provider", stored)
+		}
+	})
+}
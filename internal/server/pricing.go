@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
+)
+
+// MaxQuoteDuration is the longest trip a quote can be asked for.
+const MaxQuoteDuration = 30 * 24 * time.Hour
+
+func (srv *Server) SetupPricingRoutes() {
+	validator := validator.New()
+
+	_ = validator.RegisterValidation("licenseplate", validateLicensePlate)
+
+	srv.FiberApp.Post("/quote", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "QuoteHandler")
+		defer span.End()
+
+		var payload struct {
+			LicensePlate string    `json:"license_plate" validate:"required,licenseplate"`
+			StartTime    time.Time `json:"start_time" validate:"required"`
+			EndTime      time.Time `json:"end_time" validate:"required"`
+			Distance     float64   `json:"distance" validate:"min=0,max=100000"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+		if payload.EndTime.Sub(payload.StartTime) > MaxQuoteDuration {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "trip is too long"})
+		}
+
+		car, err := srv.Database.CarDB.GetCarByLicensePlate(ctx, payload.LicensePlate)
+		if err != nil {
+			if err == database.ErrCarNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "car not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		quote, err := srv.pricing().Quote(pricing.Trip{
+			Car:       car,
+			StartTime: payload.StartTime,
+			EndTime:   payload.EndTime,
+			Distance:  payload.Distance,
+		})
+		if err != nil {
+			if err == pricing.ErrInvalidTrip {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{
+			"car_license_plate": car.LicensePlate,
+			"category":          car.Category,
+			"quote":             quote,
+		})
+	})
+}
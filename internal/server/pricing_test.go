@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestQuote(t *testing.T) {
+	h := testutil.New(t)
+	h.Server.Pricing = pricing.DefaultRules()
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	quote := func(start, end string, distance float64) map[string]any {
+		return map[string]any{
+			"license_plate": "ABC1234",
+			"start_time":    start,
+			"end_time":      end,
+			"distance":      distance,
+		}
+	}
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "quote",
+			Method:     http.MethodPost,
+			Path:       "/quote",
+			Body:       quote("2025-01-06T12:00:00Z", "2025-01-06T12:30:00Z", 10),
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Quote models.Quote `json:"quote"`
+				}
+				resp.JSON(t, &body)
+				// 1.00 to unlock, 30 minutes at 0.10 and 10 km at 0.50.
+				if body.Quote.Total != money.MustParse("9.00") || len(body.Quote.Items) != 3 {
+					t.Fatalf("got quote %+v, want 9.00 over three items", body.Quote)
+				}
+			},
+		},
+		{
+			Name:       "ends before it starts",
+			Method:     http.MethodPost,
+			Path:       "/quote",
+			Body:       quote("2025-01-06T12:30:00Z", "2025-01-06T12:00:00Z", 10),
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "negative distance",
+			Method:     http.MethodPost,
+			Path:       "/quote",
+			Body:       quote("2025-01-06T12:00:00Z", "2025-01-06T12:30:00Z", -1),
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:   "unknown car",
+			Method: http.MethodPost,
+			Path:   "/quote",
+			Body: map[string]any{
+				"license_plate": "ZZZ9999",
+				"start_time":    "2025-01-06T12:00:00Z",
+				"end_time":      "2025-01-06T12:30:00Z",
+			},
+			WantStatus: http.StatusNotFound,
+		},
+	})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+const (
+	// MaxReservationDuration is the longest window a single reservation
+	// may cover.
+	MaxReservationDuration = 7 * 24 * time.Hour
+	// MaxReservationAdvance is how far ahead a reservation may start.
+	MaxReservationAdvance = 30 * 24 * time.Hour
+)
+
+func (srv *Server) SetupReservationRoutes() {
+	reservationGroup := srv.FiberApp.Group("/reservations")
+
+	validator := validator.New()
+
+	_ = validator.RegisterValidation("licenseplate", validateLicensePlate)
+
+	authenticatedGroup := reservationGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB))
+
+	authenticatedGroup.Get("/", srv.RequirePermission(models.PermissionTripsRead), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetReservationsHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		page := c.QueryInt("page", 1)
+		if page < 1 {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": database.ErrInvalidPageNumber.Error()})
+		}
+
+		pageSize := c.QueryInt("page_size", 5)
+		if pageSize < 1 || pageSize > 100 {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": database.ErrInvalidPageSize.Error()})
+		}
+
+		reservations, totalReservations, err := srv.Database.ReservationDB.GetReservationsForUser(ctx, email, page, pageSize)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		totalPages := (totalReservations + pageSize - 1) / pageSize
+
+		return c.JSON(fiber.Map{
+			"data": reservations,
+			"meta": fiber.Map{
+				"current_page":       page,
+				"page_size":          pageSize,
+				"total_pages":        totalPages,
+				"total_reservations": totalReservations,
+			},
+		})
+	})
+
+	authenticatedGroup.Post("/", srv.RequirePermission(models.PermissionTripsWrite), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "CreateReservationHandler")
+		defer span.End()
+
+		var payload struct {
+			LicensePlate string    `json:"license_plate" validate:"required,licenseplate"`
+			StartTime    time.Time `json:"start_time" validate:"required"`
+			EndTime      time.Time `json:"end_time" validate:"required"`
+		}
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		// Stored timestamps have second precision.
+		startTime := payload.StartTime.UTC().Truncate(time.Second)
+		endTime := payload.EndTime.UTC().Truncate(time.Second)
+		now := time.Now().UTC()
+
+		switch {
+		case !startTime.After(now):
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "reservation must start in the future"})
+		case !endTime.After(startTime):
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "reservation must end after it starts"})
+		case endTime.Sub(startTime) > MaxReservationDuration:
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "reservation is too long"})
+		case startTime.Sub(now) > MaxReservationAdvance:
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "reservation starts too far in the future"})
+		}
+
+		reservation, err := srv.Database.ReservationDB.CreateReservation(ctx, models.Reservation{
+			UserEmail:       email,
+			CarLicensePlate: payload.LicensePlate,
+			StartTime:       startTime,
+			EndTime:         endTime,
+		})
+		if err != nil {
+			switch err {
+			case database.ErrCarNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "car not found"})
+			case database.ErrReservationOverlap, database.ErrCarNotReservable:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.Status(http.StatusCreated).JSON(reservation)
+	})
+
+	authenticatedGroup.Delete("/:id", srv.RequirePermission(models.PermissionTripsWrite), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "CancelReservationHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		id, err := c.ParamsInt("id")
+		if err != nil || id < 1 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid reservation ID"})
+		}
+
+		err = srv.Database.ReservationDB.CancelReservation(ctx, email, int64(id))
+		if err != nil {
+			switch err {
+			case database.ErrReservationNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			case database.ErrReservationNotActive:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{"message": "reservation cancelled successfully"})
+	})
+}
+
+// ExpireReservations marks the reservations whose user did not start a trip
+// within models.ReservationNoShowGrace as expired, every interval until ctx
+// is done.
+func (srv *Server) ExpireReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().UTC().Add(-models.ReservationNoShowGrace)
+			expired, err := srv.Database.ReservationDB.ExpireReservations(ctx, cutoff)
+			if err != nil {
+				srv.logger().ErrorContext(ctx, "Failed to expire reservations", "error", err)
+				continue
+			}
+			if expired > 0 {
+				srv.logger().InfoContext(ctx, "Expired no-show reservations", "count", expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func reservationBody(licensePlate string, start, end time.Time) map[string]string {
+	return map[string]string{
+		"license_plate": licensePlate,
+		"start_time":    start.Format(time.RFC3339),
+		"end_time":      end.Format(time.RFC3339),
+	}
+}
+
+func TestReservations(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedCar("DEF4321", models.Maintenance, "0.50")
+	h.SeedCar("GHI5678", models.Rented, "0.50")
+
+	owner := signup(h, "owner@example.com", "owner")
+	other := signup(h, "other@example.com", "other")
+
+	now := time.Now().UTC()
+	tomorrow := now.Add(24 * time.Hour)
+
+	var reservationID int64
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "unauthenticated",
+			Method:     http.MethodGet,
+			Path:       "/reservations",
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "start in the past",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", now.Add(-time.Hour), now.Add(time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "end before start",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", tomorrow, tomorrow.Add(-time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "too long",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", tomorrow, tomorrow.Add(8*24*time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "unknown car",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ZZZ9999", tomorrow, tomorrow.Add(2*time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "car in maintenance",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("DEF4321", tomorrow, tomorrow.Add(2*time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			// The car is in use now, and free by tomorrow.
+			Name:       "rented car for tomorrow",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("GHI5678", tomorrow, tomorrow.Add(2*time.Hour)),
+			Token:      other,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "create",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("abc1234", tomorrow, tomorrow.Add(2*time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusCreated,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var reservation models.Reservation
+				resp.JSON(t, &reservation)
+				if reservation.Status != models.ReservationActive || reservation.CarLicensePlate != "ABC1234" {
+					t.Fatalf("got reservation %+v", reservation)
+				}
+				reservationID = reservation.ID
+			},
+		},
+		{
+			Name:       "overlapping",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", tomorrow.Add(time.Hour), tomorrow.Add(3*time.Hour)),
+			Token:      other,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "adjacent",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", tomorrow.Add(2*time.Hour), tomorrow.Add(3*time.Hour)),
+			Token:      other,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "list",
+			Method:     http.MethodGet,
+			Path:       "/reservations",
+			Token:      owner,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.Reservation `json:"data"`
+					Meta struct {
+						TotalReservations int `json:"total_reservations"`
+					} `json:"meta"`
+				}
+				resp.JSON(t, &body)
+				if body.Meta.TotalReservations != 1 || len(body.Data) != 1 {
+					t.Fatalf("got %d reservations, want only the owner's", body.Meta.TotalReservations)
+				}
+			},
+		},
+	})
+
+	path := fmt.Sprintf("/reservations/%d", reservationID)
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "cancel someone else's",
+			Method:     http.MethodDelete,
+			Path:       path,
+			Token:      other,
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "cancel",
+			Method:     http.MethodDelete,
+			Path:       path,
+			Token:      owner,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "cancel twice",
+			Method:     http.MethodDelete,
+			Path:       path,
+			Token:      owner,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "window is free again",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", tomorrow, tomorrow.Add(time.Hour)),
+			Token:      other,
+			WantStatus: http.StatusCreated,
+		},
+	})
+}
+
+func TestReservationHold(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	owner := signup(h, "owner@example.com", "owner")
+	other := signup(h, "other@example.com", "other")
+
+	start := time.Now().UTC().Add(10 * time.Minute)
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "reserve",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", start, start.Add(time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "other user cannot start",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      other,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "owner starts",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      owner,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "reservation is fulfilled",
+			Method:     http.MethodGet,
+			Path:       "/reservations",
+			Token:      owner,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.Reservation `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 1 {
+					t.Fatalf("got %d reservations, want 1", len(body.Data))
+				}
+				if body.Data[0].Status != models.ReservationFulfilled || body.Data[0].TripID == nil {
+					t.Fatalf("got reservation %+v, want it fulfilled by the trip", body.Data[0])
+				}
+			},
+		},
+		{
+			Name:       "cannot cancel a fulfilled reservation",
+			Method:     http.MethodDelete,
+			Path:       "/reservations/1",
+			Token:      owner,
+			WantStatus: http.StatusConflict,
+		},
+	})
+}
+
+func TestReservationNoShowExpiry(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	owner := signup(h, "owner@example.com", "owner")
+	other := signup(h, "other@example.com", "other")
+
+	start := time.Now().UTC().Add(10 * time.Minute)
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "reserve",
+			Method:     http.MethodPost,
+			Path:       "/reservations",
+			Body:       reservationBody("ABC1234", start, start.Add(time.Hour)),
+			Token:      owner,
+			WantStatus: http.StatusCreated,
+		},
+	})
+
+	// Expire as if the grace period after the start had passed.
+	expired, err := h.Database.ReservationDB.ExpireReservations(context.Background(), start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to expire reservations: %v", err)
+	}
+	if expired != 1 {
+		t.Fatalf("expired %d reservations, want 1", expired)
+	}
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "other user can start",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      other,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "reservation is expired",
+			Method:     http.MethodGet,
+			Path:       "/reservations",
+			Token:      owner,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.Reservation `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 1 || body.Data[0].Status != models.ReservationExpired {
+					t.Fatalf("got reservations %+v, want one expired", body.Data)
+				}
+			},
+		},
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/ntentasd/db-deliverable3/internal/database"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
 )
 
 func (srv *Server) SetupReviewRoutes() {
@@ -31,7 +32,7 @@ func (srv *Server) SetupReviewRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrInvalidPageSize.Error()})
 		}
 
-		reviews, emails, totalReviews, err := srv.Database.ReviewDB.GetAllReviewsForCar(licensePlate, page, pageSize)
+		reviews, emails, totalReviews, err := srv.Database.ReviewDB.GetAllReviewsForCar(c.UserContext(), licensePlate, page, pageSize)
 		if err != nil {
 			if err == database.ErrCarNotFound {
 				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
@@ -55,9 +56,12 @@ func (srv *Server) SetupReviewRoutes() {
 		})
 	})
 
-	authenticatedGroup := reviewGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret))
+	authenticatedGroup := reviewGroup.Group("/",
+		middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB),
+		srv.RequirePermission(models.PermissionReviewsWrite),
+	)
 
-	authenticatedGroup.Post("/", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/", srv.Idempotent(), func(c *fiber.Ctx) error {
 		var payload struct {
 			TripID  int    `json:"trip_id" validate:"required,gt=0"`
 			Rating  int    `json:"rating" validate:"required,min=1,max=5"`
@@ -72,7 +76,7 @@ func (srv *Server) SetupReviewRoutes() {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		err := srv.Database.ReviewDB.CreateReview(payload.TripID, payload.Rating, payload.Comment, email)
+		err := srv.Database.ReviewDB.CreateReview(c.UserContext(), payload.TripID, payload.Rating, payload.Comment, email)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
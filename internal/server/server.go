@@ -2,28 +2,198 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
+	"github.com/ntentasd/db-deliverable3/internal/metrics"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
+	"github.com/ntentasd/db-deliverable3/internal/telemetry"
 )
 
 type Server struct {
 	FiberApp  *fiber.App
 	Database  *database.Database
 	JWTSecret string
+	Mailer    mailer.Mailer
+	// AppURL is the address of the UI, used for the links in emails.
+	AppURL string
+	// ScoringModel rates the driving behavior of finished trips. The zero
+	// value means telemetry.DefaultScoringModel.
+	ScoringModel telemetry.ScoringModel
+	// Pricing prices trips, pricing.DefaultRules when nil.
+	Pricing pricing.Engine
+	// Payments charges the trips that are not covered by a subscription.
+	Payments payment.PaymentProvider
+	// IdempotencyWindow is how long the responses to requests sent with an
+	// Idempotency-Key are replayed, DefaultIdempotencyWindow when zero.
+	IdempotencyWindow time.Duration
+	// SubscriptionGracePeriod is how long a subscription whose renewal
+	// failed stays active, DefaultSubscriptionGracePeriod when zero.
+	SubscriptionGracePeriod time.Duration
+	// SubscriptionRetryInterval is how long after a failed renewal it is
+	// retried, DefaultSubscriptionRetryInterval when zero.
+	SubscriptionRetryInterval time.Duration
+	// Logger logs what goes wrong without failing the requests,
+	// slog.Default() when nil.
+	Logger *slog.Logger
+}
+
+const (
+	// DefaultIdempotencyWindow is how long idempotency keys are kept by
+	// default.
+	DefaultIdempotencyWindow         = 24 * time.Hour
+	DefaultSubscriptionGracePeriod   = 72 * time.Hour
+	DefaultSubscriptionRetryInterval = 24 * time.Hour
+)
+
+// NewApp creates the Fiber app with the middleware stack and the endpoints
+// that are not part of any route group. Requests are measured by m and
+// logged to logger.
+func NewApp(frontendOrigin string, m *metrics.Metrics, logger *slog.Logger) *fiber.App {
+	app := fiber.New()
+	app.Use(m.Middleware())
+	app.Use(middleware.CorrelationMiddleware())
+	app.Use(middleware.TracingMiddleware())
+	app.Use(middleware.RequestLogger(logger))
+	app.Use(middleware.OriginMiddleware())
+
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  fmt.Sprintf("%s, http://datadrive-ui", frontendOrigin),
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  "Content-Type, Authorization, traceparent, tracestate, " + middleware.IdempotencyKeyHeader,
+		ExposeHeaders: "Content-Length, traceparent, " + middleware.IdempotentReplayedHeader,
+	}))
+
+	app.Options("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK) // Respond with 200 OK for preflight requests
+	})
+
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.Status(http.StatusOK).JSON(fiber.Map{
+			"status":  "healthy",
+			"message": "service is up and running",
+		})
+	})
+
+	return app
+}
+
+// NewMetricsApp creates the Fiber app serving m on /metrics. It listens apart
+// from the API, on an address only reachable from inside the deployment.
+func NewMetricsApp(m *metrics.Metrics) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/metrics", m.Handler())
+	return app
+}
+
+// SetupRoutes registers every route group on the server's Fiber app.
+func (srv *Server) SetupRoutes() {
+	srv.SetupCarRoutes()
+	srv.SetupTripRoutes()
+	srv.SetupDisputeRoutes()
+	srv.SetupReservationRoutes()
+	srv.SetupPricingRoutes()
+	srv.SetupUserRoutes()
+	srv.SetupAccountRoutes()
+	srv.SetupReviewRoutes()
+	srv.SetupSubscriptionRoutes()
+}
+
+// RequirePermission rejects requests whose role has not been granted
+// permission. Routes using it must be behind middleware.JWTMiddleware.
+func (srv *Server) RequirePermission(permission string) fiber.Handler {
+	return middleware.RequirePermission(srv.Database.RoleDB, permission)
+}
+
+// Idempotent replays the response to retries of requests sent with an
+// Idempotency-Key. Routes using it must be behind middleware.JWTMiddleware.
+func (srv *Server) Idempotent() fiber.Handler {
+	window := srv.IdempotencyWindow
+	if window == 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return middleware.Idempotency(srv.Database.IdempotencyDB, window, srv.logger())
+}
+
+// PurgeIdempotencyKeys deletes the expired idempotency keys every interval
+// until ctx is done.
+func (srv *Server) PurgeIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := srv.Database.IdempotencyDB.DeleteExpiredIdempotencyKeys(ctx, time.Now().UTC())
+			if err != nil {
+				srv.logger().ErrorContext(ctx, "Failed to purge idempotency keys", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				srv.logger().InfoContext(ctx, "Purged expired idempotency keys", "count", deleted)
+			}
+		}
+	}
+}
+
+func (srv *Server) logger() *slog.Logger {
+	if srv.Logger == nil {
+		return slog.Default()
+	}
+	return srv.Logger
+}
+
+func (srv *Server) subscriptionGracePeriod() time.Duration {
+	if srv.SubscriptionGracePeriod == 0 {
+		return DefaultSubscriptionGracePeriod
+	}
+	return srv.SubscriptionGracePeriod
+}
+
+func (srv *Server) subscriptionRetryInterval() time.Duration {
+	if srv.SubscriptionRetryInterval == 0 {
+		return DefaultSubscriptionRetryInterval
+	}
+	return srv.SubscriptionRetryInterval
+}
+
+func (srv *Server) scoringModel() telemetry.ScoringModel {
+	if srv.ScoringModel == (telemetry.ScoringModel{}) {
+		return telemetry.DefaultScoringModel()
+	}
+	return srv.ScoringModel
+}
+
+func (srv *Server) pricing() pricing.Engine {
+	if srv.Pricing == nil {
+		return pricing.DefaultRules()
+	}
+	return srv.Pricing
 }
 
 func InitServerTracer(c *fiber.Ctx, name string) (context.Context, trace.Span) {
 	tracer := otel.Tracer("server")
-	ctx, span := tracer.Start(c.Context(), name)
+	ctx, span := tracer.Start(c.UserContext(), name)
 
+	// The ID is only valid during the request, while the span is exported
+	// after it.
 	correlationID := c.Locals(middleware.CorrelationIDHeader).(string)
-	span.SetAttributes(attribute.String("correlation.id", correlationID))
+	span.SetAttributes(attribute.String("correlation.id", strings.Clone(correlationID)))
 
 	return ctx, span
 }
@@ -0,0 +1,179 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func TestSessions(t *testing.T) {
+	h := testutil.New(t)
+	signupToken := signup(h, "driver@example.com", "driver")
+
+	var laptop, phone, refreshed tokens
+	var phoneSessionID string
+
+	loginAs := func(into *tokens) testutil.Case {
+		return testutil.Case{
+			Name:       "login",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "supersecret"},
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				resp.JSON(t, into)
+				if into.Token == "" || into.RefreshToken == "" || into.ExpiresIn <= 0 {
+					t.Fatalf("got tokens %+v, want an access and a refresh token", into)
+				}
+			},
+		}
+	}
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "logout from signup",
+			Method:     http.MethodPost,
+			Path:       "/logout",
+			Token:      signupToken,
+			WantStatus: http.StatusOK,
+		},
+		loginAs(&laptop),
+		loginAs(&phone),
+	})
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "refresh",
+			Method:     http.MethodPost,
+			Path:       "/token/refresh",
+			Body:       map[string]string{"refresh_token": phone.RefreshToken},
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				resp.JSON(t, &refreshed)
+				if refreshed.RefreshToken == phone.RefreshToken {
+					t.Fatal("refresh token was not rotated")
+				}
+			},
+		},
+		{
+			Name:       "rotated refresh token is rejected",
+			Method:     http.MethodPost,
+			Path:       "/token/refresh",
+			Body:       map[string]string{"refresh_token": phone.RefreshToken},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "unknown refresh token is rejected",
+			Method:     http.MethodPost,
+			Path:       "/token/refresh",
+			Body:       map[string]string{"refresh_token": "not-a-token"},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "list sessions",
+			Method:     http.MethodGet,
+			Path:       "/user/sessions",
+			Token:      laptop.Token,
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Data []models.Session `json:"data"`
+				}
+				resp.JSON(t, &body)
+				if len(body.Data) != 2 {
+					t.Fatalf("got %d sessions, want 2", len(body.Data))
+				}
+				for _, session := range body.Data {
+					if !session.Current {
+						phoneSessionID = session.ID
+					}
+				}
+				if phoneSessionID == "" || body.Data[0].Current == body.Data[1].Current {
+					t.Fatalf("got sessions %+v, want only the laptop's marked as current", body.Data)
+				}
+			},
+		},
+	})
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "revoke the phone's session",
+			Method:     http.MethodDelete,
+			Path:       "/user/sessions/" + phoneSessionID,
+			Token:      laptop.Token,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "revoked session's access token is rejected",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      refreshed.Token,
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "revoked session cannot be refreshed",
+			Method:     http.MethodPost,
+			Path:       "/token/refresh",
+			Body:       map[string]string{"refresh_token": refreshed.RefreshToken},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "revoking it again",
+			Method:     http.MethodDelete,
+			Path:       "/user/sessions/" + phoneSessionID,
+			Token:      laptop.Token,
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "logout",
+			Method:     http.MethodPost,
+			Path:       "/logout",
+			Token:      laptop.Token,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "token is rejected after logout",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      laptop.Token,
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "session cannot be refreshed after logout",
+			Method:     http.MethodPost,
+			Path:       "/token/refresh",
+			Body:       map[string]string{"refresh_token": laptop.RefreshToken},
+			WantStatus: http.StatusUnauthorized,
+		},
+	})
+}
+
+func TestDeletedUserTokensAreRejected(t *testing.T) {
+	h := testutil.New(t)
+	token := signup(h, "driver@example.com", "driver")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "delete account",
+			Method:     http.MethodDelete,
+			Path:       "/user",
+			Token:      token,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "token is rejected",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      token,
+			WantStatus: http.StatusUnauthorized,
+		},
+	})
+}
@@ -1,39 +1,50 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
 	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
 )
 
+// planNamePattern matches names like the seeded 1_MONTH and 3_MONTHS.
+var planNamePattern = regexp.MustCompile(`^[A-Z0-9_]{1,45}$`)
+
 func (srv *Server) SetupSubscriptionRoutes() {
 	subscriptionGroup := srv.FiberApp.Group("/subscriptions")
 
 	validator := validator.New()
 
 	subscriptionGroup.Get("/", func(c *fiber.Ctx) error {
-		subscriptions, err := srv.Database.SubscriptionDB.GetAllSubscriptions()
+		subscriptions, err := srv.Database.SubscriptionDB.GetAllSubscriptions(c.UserContext())
 		if err != nil {
-			c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
 		return c.JSON(subscriptions)
 	})
 
-	authenticatedGroup := subscriptionGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret))
+	authenticatedGroup := subscriptionGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB))
 
-	authenticatedGroup.Get("/active", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/active", srv.RequirePermission(models.PermissionSubscriptionsRead), func(c *fiber.Ctx) error {
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		subscription, err := srv.Database.SubscriptionDB.GetActiveSubscription(email)
+		subscription, err := srv.Database.SubscriptionDB.GetActiveSubscription(c.UserContext(), email)
 		if err != nil {
 			if err == database.ErrUserSubscriptionNotFound {
 				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
@@ -44,7 +55,85 @@ func (srv *Server) SetupSubscriptionRoutes() {
 		return c.JSON(subscription)
 	})
 
-	authenticatedGroup.Post("/buy", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/history", srv.RequirePermission(models.PermissionSubscriptionsRead), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetSubscriptionHistoryHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		subscriptions, err := srv.Database.SubscriptionDB.GetSubscriptionHistory(ctx, email)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if subscriptions == nil {
+			subscriptions = []models.UserSubscription{}
+		}
+
+		return c.JSON(subscriptions)
+	})
+
+	authenticatedGroup.Get("/usage", srv.RequirePermission(models.PermissionSubscriptionsRead), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetSubscriptionUsageHandler")
+		defer span.End()
+
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		subscription, err := srv.Database.SubscriptionDB.GetActiveSubscription(ctx, email)
+		if err != nil {
+			if err == database.ErrUserSubscriptionNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		from, to := subscription.UsagePeriod(time.Now())
+		used, err := srv.Database.SubscriptionDB.GetUsage(ctx, subscription.ID, from, to)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// A missing allowance covers nothing.
+		var plan models.SubscriptionPlan
+		if subscription.Plan != nil {
+			plan = *subscription.Plan
+		}
+		var includedKm float64
+		if plan.IncludedKm != nil {
+			includedKm = *plan.IncludedKm
+		}
+		var includedMinutes int
+		if plan.IncludedMinutes != nil {
+			includedMinutes = *plan.IncludedMinutes
+		}
+		remainingKm := math.Round(math.Max(0, includedKm-used.Km)*100) / 100
+		remainingMinutes := max(0, includedMinutes-used.Minutes)
+
+		return c.JSON(fiber.Map{
+			"subscription_id":    subscription.ID,
+			"subscription_name":  subscription.SubscriptionName,
+			"period_start":       from,
+			"period_end":         to,
+			"used":               used,
+			"included_km":        plan.IncludedKm,
+			"included_minutes":   plan.IncludedMinutes,
+			"remaining_km":       remainingKm,
+			"remaining_minutes":  remainingMinutes,
+			"categories":         plan.Categories,
+			"overage_per_km":     plan.OveragePerKm,
+			"overage_per_minute": plan.OveragePerMinute,
+		})
+	})
+
+	authenticatedGroup.Post("/buy", srv.RequirePermission(models.PermissionSubscriptionsWrite), srv.Idempotent(), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "BuySubscriptionHandler")
+		defer span.End()
+
 		var subscription models.UserSubscription
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
@@ -56,37 +145,344 @@ func (srv *Server) SetupSubscriptionRoutes() {
 		if err := validator.Struct(subscription); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
+		if subscription.PaymentMethod == "" {
+			subscription.PaymentMethod = models.Card
+		}
+		subscription.UserEmail = email
 
-		endDate, err := srv.Database.SubscriptionDB.BuySubscription(email, string(subscription.SubscriptionName))
+		subscription, err := srv.Database.SubscriptionDB.BuySubscription(ctx, subscription)
 		if err != nil {
-			if err == database.ErrInvalidSubscriptionName {
+			switch err {
+			case database.ErrInvalidSubscriptionName:
 				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case database.ErrAlreadyActibeSubscriptionError:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		// The subscription only stays if its first period is paid for. A
+		// charge left AUTHORIZED was captured but could not be recorded.
+		status, chargeErr := srv.chargeSubscription(ctx, email, subscription.Charges[0])
+		subscription.Charges[0].Status = status
+		if chargeErr != nil {
+			if status != models.PaymentAuthorized {
+				_, err := srv.Database.SubscriptionDB.CancelSubscription(ctx, email, models.CancelImmediately)
+				if err != nil {
+					srv.logger().ErrorContext(ctx, "Failed to cancel the unpaid subscription", "subscription_id", subscription.ID, "error", err)
+				}
+			}
+			if errors.Is(chargeErr, payment.ErrDeclined) {
+				return c.Status(http.StatusPaymentRequired).JSON(fiber.Map{"error": chargeErr.Error()})
+			}
+			srv.logger().ErrorContext(ctx, "Failed to charge the subscription", "subscription_id", subscription.ID, "error", chargeErr)
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "failed to charge the subscription"})
+		}
+
 		return c.Status(http.StatusCreated).JSON(fiber.Map{
-			"message":  fmt.Sprintf("successfully bought a %s subscription", subscription.SubscriptionName),
-			"end_date": endDate,
+			"message":      fmt.Sprintf("successfully bought a %s subscription", subscription.SubscriptionName),
+			"end_date":     subscription.EndDate,
+			"subscription": subscription,
 		})
 	})
 
-	authenticatedGroup.Put("/cancel", func(c *fiber.Ctx) error {
+	// Cancelling keeps the subscription until the end of the period paid for,
+	// unless ?mode=IMMEDIATE asks to end it now.
+	authenticatedGroup.Put("/cancel", srv.RequirePermission(models.PermissionSubscriptionsWrite), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "CancelSubscriptionHandler")
+		defer span.End()
+
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		err := srv.Database.SubscriptionDB.CancelSubscription(email)
+		mode := models.CancellationMode(strings.ToUpper(c.Query("mode", string(models.CancelAtPeriodEnd))))
+		if mode != models.CancelImmediately && mode != models.CancelAtPeriodEnd {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "mode must be IMMEDIATE or PERIOD_END"})
+		}
+
+		subscription, err := srv.Database.SubscriptionDB.CancelSubscription(ctx, email, mode)
 		if err != nil {
-			if err == database.ErrInvalidSubscriptionName {
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			if err == database.ErrActiveSubscriptionNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		message := "successfully cancelled current subscription"
+		if mode == models.CancelAtPeriodEnd {
+			message = fmt.Sprintf("your subscription will end on %s", subscription.EndDate.Format(time.DateOnly))
+		}
+
 		return c.Status(http.StatusCreated).JSON(fiber.Map{
-			"message": fmt.Sprintf("successfully cancelled current subscription"),
+			"message":      message,
+			"subscription": subscription,
 		})
 	})
+
+	srv.setupSubscriptionPlanRoutes(authenticatedGroup, validator)
+}
+
+// setupSubscriptionPlanRoutes registers the routes admins manage subscription
+// plans on. subscriptionGroup is the authenticated /subscriptions group.
+func (srv *Server) setupSubscriptionPlanRoutes(subscriptionGroup fiber.Router, validator *validator.Validate) {
+	planGroup := subscriptionGroup.Group("/plans", srv.RequirePermission(models.PermissionSubscriptionsManage))
+
+	planGroup.Get("/", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetPlansHandler")
+		defer span.End()
+
+		plans, err := srv.Database.SubscriptionDB.GetPlans(ctx)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(plans)
+	})
+
+	planGroup.Get("/:name", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "GetPlanVersionsHandler")
+		defer span.End()
+
+		plans, err := srv.Database.SubscriptionDB.GetPlanVersions(ctx, c.Params("name"))
+		if err != nil {
+			if err == database.ErrPlanNotFound {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(plans)
+	})
+
+	planGroup.Post("/", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "CreatePlanHandler")
+		defer span.End()
+
+		plan, err := parsePlan(c, validator)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !planNamePattern.MatchString(string(plan.Name)) {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": "plan names are up to 45 upper case letters, digits and underscores"})
+		}
+
+		plan, err = srv.Database.SubscriptionDB.CreatePlan(ctx, plan)
+		if err != nil {
+			if err == database.ErrPlanExists {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.Status(http.StatusCreated).JSON(plan)
+	})
+
+	// Editing a plan adds a new version of it. Subscriptions bought earlier
+	// keep the version they were bought on.
+	planGroup.Put("/:name", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "UpdatePlanHandler")
+		defer span.End()
+
+		plan, err := parsePlan(c, validator)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		plan.Name = models.SubscriptionName(c.Params("name"))
+
+		plan, err = srv.Database.SubscriptionDB.UpdatePlan(ctx, plan)
+		if err != nil {
+			switch err {
+			case database.ErrPlanNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			case database.ErrPlanRetired:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(plan)
+	})
+
+	// Retiring a plan stops its sales. Active subscriptions on it run until
+	// their end date.
+	planGroup.Delete("/:name", func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "RetirePlanHandler")
+		defer span.End()
+
+		err := srv.Database.SubscriptionDB.RetirePlan(ctx, c.Params("name"))
+		if err != nil {
+			switch err {
+			case database.ErrPlanNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			case database.ErrPlanRetired:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(fiber.Map{"message": fmt.Sprintf("retired the %s plan", c.Params("name"))})
+	})
+}
+
+// parsePlan reads a plan from the request body and stamps it with the admin
+// creating it.
+func parsePlan(c *fiber.Ctx, validator *validator.Validate) (models.SubscriptionPlan, error) {
+	var plan models.SubscriptionPlan
+	if err := c.BodyParser(&plan); err != nil {
+		return models.SubscriptionPlan{}, fmt.Errorf("invalid request body")
+	}
+	if err := validator.Struct(plan); err != nil {
+		return models.SubscriptionPlan{}, ErrValidationFailed
+	}
+	if plan.VisibleFrom != nil && plan.VisibleUntil != nil && !plan.VisibleUntil.After(*plan.VisibleFrom) {
+		return models.SubscriptionPlan{}, fmt.Errorf("visible_until must be after visible_from")
+	}
+
+	plan.CreatedBy, _ = c.Locals(string(middleware.Email)).(string)
+	plan.CreatedAt = time.Now()
+	return plan, nil
+}
+
+// subscriptionRenewalLead is how long before their end subscriptions are
+// renewed, so that they do not lapse between two runs of the renewal job.
+const subscriptionRenewalLead = 24 * time.Hour
+
+// subscriptionRenewalClaim is how long a run of the renewal job holds the
+// renewal of a subscription before another run may attempt it, should the
+// first one never finish it.
+const subscriptionRenewalClaim = 10 * time.Minute
+
+// RenewSubscriptions renews the subscriptions that are due every interval
+// until ctx is done.
+func (srv *Server) RenewSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := srv.RenewDueSubscriptions(ctx, time.Now().UTC())
+			if err != nil {
+				srv.logger().ErrorContext(ctx, "Failed to renew subscriptions", "error", err)
+				continue
+			}
+			if renewed > 0 {
+				srv.logger().InfoContext(ctx, "Renewed subscriptions", "count", renewed)
+			}
+		}
+	}
+}
+
+// RenewDueSubscriptions charges the auto-renewing subscriptions that end
+// within subscriptionRenewalLead of now for another period, on the latest
+// version of their plan. A subscription whose charge fails stays active for
+// the grace period, during which the renewal is retried, and lapses if no
+// retry succeeds. Subscriptions to retired plans are not renewed. It returns
+// how many subscriptions were renewed.
+func (srv *Server) RenewDueSubscriptions(ctx context.Context, now time.Time) (int, error) {
+	due, err := srv.Database.SubscriptionDB.GetDueRenewals(ctx, now.Add(subscriptionRenewalLead), now)
+	if err != nil {
+		return 0, err
+	}
+
+	renewed := 0
+	for _, subscription := range due {
+		ok, err := srv.renewSubscription(ctx, subscription, now)
+		if err != nil {
+			srv.logger().ErrorContext(ctx, "Failed to renew the subscription", "subscription_id", subscription.ID, "error", err)
+			continue
+		}
+		if ok {
+			renewed++
+		}
+	}
+	return renewed, nil
+}
+
+func (srv *Server) renewSubscription(ctx context.Context, subscription models.UserSubscription, now time.Time) (bool, error) {
+	// Claiming the renewal before charging it keeps overlapping runs from
+	// charging it twice.
+	err := srv.Database.SubscriptionDB.ClaimRenewal(ctx, subscription.ID, subscription.EndDate, now, now.Add(subscriptionRenewalClaim))
+	if err != nil {
+		if err == database.ErrSubscriptionChanged {
+			return false, nil
+		}
+		return false, err
+	}
+
+	versions, err := srv.Database.SubscriptionDB.GetPlanVersions(ctx, string(subscription.SubscriptionName))
+	if err != nil {
+		return false, err
+	}
+	plan := versions[0]
+	if plan.RetiredAt != nil {
+		return false, srv.Database.SubscriptionDB.DisableAutoRenew(ctx, subscription.ID)
+	}
+
+	periodEnd := subscription.EndDate.AddDate(0, plan.DurationMonths, 0)
+	charge, err := srv.Database.SubscriptionDB.CreateSubscriptionCharge(ctx, models.SubscriptionCharge{
+		UserSubscriptionID: subscription.ID,
+		Kind:               models.ChargeRenewal,
+		PlanID:             plan.ID,
+		Amount:             plan.Price(),
+		PaymentMethod:      subscription.PaymentMethod,
+		PeriodEnd:          periodEnd,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	status, chargeErr := srv.chargeSubscription(ctx, subscription.UserEmail, charge)
+	if chargeErr != nil && status != models.PaymentAuthorized {
+		graceUntil := subscription.EndDate.Add(srv.subscriptionGracePeriod())
+		if subscription.GraceUntil != nil {
+			graceUntil = *subscription.GraceUntil
+		}
+		// The last retry is the one before the grace period ends.
+		var retryAt *time.Time
+		if next := now.Add(srv.subscriptionRetryInterval()); next.Before(graceUntil) {
+			retryAt = &next
+		}
+		if err := srv.Database.SubscriptionDB.DeferRenewal(ctx, subscription.ID, graceUntil, retryAt); err != nil {
+			return false, err
+		}
+		srv.notifyRenewalFailed(ctx, subscription, graceUntil, retryAt != nil)
+		return false, chargeErr
+	}
+	if chargeErr != nil {
+		srv.logger().ErrorContext(ctx, "Failed to record the charge of the subscription", "subscription_id", subscription.ID, "charge_id", charge.ID, "error", chargeErr)
+	}
+
+	err = srv.Database.SubscriptionDB.ExtendSubscription(ctx, subscription.ID, subscription.EndDate, periodEnd, plan.ID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (srv *Server) notifyRenewalFailed(ctx context.Context, subscription models.UserSubscription, graceUntil time.Time, retrying bool) {
+	body := fmt.Sprintf(
+		"We could not charge the renewal of your %s subscription. It stays active until %s",
+		subscription.SubscriptionName, graceUntil.Format(time.DateOnly),
+	)
+	if retrying {
+		body += ", and we will try again before then.\n"
+	} else {
+		body += ", and will not be renewed.\n"
+	}
+
+	msg := mailer.Message{
+		To:      subscription.UserEmail,
+		Subject: fmt.Sprintf("The renewal of your %s subscription failed", subscription.SubscriptionName),
+		Body:    body,
+	}
+	if err := srv.Mailer.Send(ctx, msg); err != nil {
+		srv.logger().ErrorContext(ctx, "Failed to notify about the failed renewal", "subscription_id", subscription.ID, "recipient_email", subscription.UserEmail, "error", err)
+	}
 }
@@ -0,0 +1,637 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func subscriptionHistory(t *testing.T, h *testutil.Harness, token string) []models.UserSubscription {
+	t.Helper()
+	resp := h.Do(http.MethodGet, "/subscriptions/history", nil, token)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("failed to read the subscription history: %d %s", resp.Status, resp.Body)
+	}
+	var history []models.UserSubscription
+	resp.JSON(t, &history)
+	return history
+}
+
+func buySubscription(t *testing.T, h *testutil.Harness, token string, body map[string]any) models.UserSubscription {
+	t.Helper()
+	resp := h.Do(http.MethodPost, "/subscriptions/buy", body, token)
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("failed to buy a subscription: %d %s", resp.Status, resp.Body)
+	}
+	var bought struct {
+		Subscription models.UserSubscription `json:"subscription"`
+	}
+	resp.JSON(t, &bought)
+	return bought.Subscription
+}
+
+func TestSubscriptionPlans(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedSubscriptions()
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedAdmin("admin@datadrive.com", "password")
+
+	adminToken := h.AdminToken("admin@datadrive.com")
+	token := signup(h, "driver@example.com", "driver")
+	otherToken := signup(h, "other@example.com", "other")
+
+	listed := func(t *testing.T, name models.SubscriptionName) bool {
+		t.Helper()
+		var plans []models.SubscriptionPlan
+		h.Do(http.MethodGet, "/subscriptions", nil, "").JSON(t, &plans)
+		for _, plan := range plans {
+			if plan.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	h.Run(t, []testutil.Case{
+		{Name: "list as client", Method: http.MethodGet, Path: "/subscriptions/plans", Token: token, WantStatus: http.StatusForbidden},
+		{Name: "create as client", Method: http.MethodPost, Path: "/subscriptions/plans", Token: token,
+			Body: map[string]any{"name": "PROMO", "duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900}, WantStatus: http.StatusForbidden},
+		{Name: "invalid name", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "promo plan", "duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900}, WantStatus: http.StatusBadRequest},
+		{Name: "missing price", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "PROMO", "duration_months": 1}, WantStatus: http.StatusBadRequest},
+		{Name: "missing allowances", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "PROMO", "duration_months": 1, "price_per_month": "10.00"}, WantStatus: http.StatusBadRequest},
+		{Name: "unknown category", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "PROMO", "duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900, "categories": []string{"TRUCK"}}, WantStatus: http.StatusBadRequest},
+		{Name: "empty visibility window", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "PROMO", "duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900,
+				"visible_from": "2030-01-01T00:00:00Z", "visible_until": "2029-01-01T00:00:00Z"}, WantStatus: http.StatusBadRequest},
+		{Name: "existing name", Method: http.MethodPost, Path: "/subscriptions/plans", Token: adminToken,
+			Body: map[string]any{"name": "1_MONTH", "duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900}, WantStatus: http.StatusConflict},
+		{Name: "update unknown plan", Method: http.MethodPut, Path: "/subscriptions/plans/NOPE", Token: adminToken,
+			Body: map[string]any{"duration_months": 1, "price_per_month": "10.00", "included_km": 300, "included_minutes": 900}, WantStatus: http.StatusNotFound},
+		{Name: "retire unknown plan", Method: http.MethodDelete, Path: "/subscriptions/plans/NOPE", Token: adminToken, WantStatus: http.StatusNotFound},
+		{Name: "versions of unknown plan", Method: http.MethodGet, Path: "/subscriptions/plans/NOPE", Token: adminToken, WantStatus: http.StatusNotFound},
+	})
+
+	t.Run("versioning", func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/subscriptions/plans", map[string]any{
+			"name":             "PROMO",
+			"description":      "Two months for the summer",
+			"duration_months":  2,
+			"price_per_month":  "40.00",
+			"included_km":      300,
+			"included_minutes": 900,
+		}, adminToken)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to create plan: %d %s", resp.Status, resp.Body)
+		}
+		var created models.SubscriptionPlan
+		resp.JSON(t, &created)
+		if created.Version != 1 || created.CreatedBy != "admin@datadrive.com" {
+			t.Fatalf("got plan %+v, want version 1 created by the admin", created)
+		}
+		if !listed(t, "PROMO") {
+			t.Fatalf("new plan is not for sale")
+		}
+
+		resp = h.Do(http.MethodPost, "/subscriptions/buy", map[string]string{"subscription_name": "PROMO"}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to buy plan: %d %s", resp.Status, resp.Body)
+		}
+
+		resp = h.Do(http.MethodPut, "/subscriptions/plans/PROMO", map[string]any{
+			"description":      "Two months for the summer",
+			"duration_months":  2,
+			"price_per_month":  "45.00",
+			"included_km":      300,
+			"included_minutes": 900,
+		}, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to update plan: %d %s", resp.Status, resp.Body)
+		}
+		var updated models.SubscriptionPlan
+		resp.JSON(t, &updated)
+		if updated.Version != 2 || updated.Name != "PROMO" {
+			t.Fatalf("got plan %+v, want version 2 of PROMO", updated)
+		}
+
+		var versions []models.SubscriptionPlan
+		h.Do(http.MethodGet, "/subscriptions/plans/PROMO", nil, adminToken).JSON(t, &versions)
+		if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+			t.Fatalf("got versions %+v, want 2 then 1", versions)
+		}
+
+		// The subscription keeps the terms it was bought on.
+		var active models.UserSubscription
+		h.Do(http.MethodGet, "/subscriptions/active", nil, token).JSON(t, &active)
+		if active.PlanID != created.ID || active.Plan == nil || active.Plan.PricePerMonth != money.MustParse("40.00") {
+			t.Fatalf("got subscription %+v, want version 1 at 40.00", active)
+		}
+		want := active.StartDate.AddDate(0, 2, 0)
+		if !active.EndDate.Equal(want) {
+			t.Fatalf("got end date %v, want %v", active.EndDate, want)
+		}
+	})
+
+	t.Run("retiring", func(t *testing.T) {
+		if resp := h.Do(http.MethodDelete, "/subscriptions/plans/PROMO", nil, adminToken); resp.Status != http.StatusOK {
+			t.Fatalf("failed to retire plan: %d %s", resp.Status, resp.Body)
+		}
+		if listed(t, "PROMO") {
+			t.Fatalf("retired plan is still for sale")
+		}
+		resp := h.Do(http.MethodPost, "/subscriptions/buy", map[string]string{"subscription_name": "PROMO"}, otherToken)
+		if resp.Status != http.StatusBadRequest {
+			t.Fatalf("buying a retired plan: got %d, want 400", resp.Status)
+		}
+		if resp := h.Do(http.MethodDelete, "/subscriptions/plans/PROMO", nil, adminToken); resp.Status != http.StatusConflict {
+			t.Fatalf("retiring twice: got %d, want 409", resp.Status)
+		}
+		resp = h.Do(http.MethodPut, "/subscriptions/plans/PROMO", map[string]any{"duration_months": 2, "price_per_month": "45.00", "included_km": 300, "included_minutes": 900}, adminToken)
+		if resp.Status != http.StatusConflict {
+			t.Fatalf("updating a retired plan: got %d, want 409", resp.Status)
+		}
+
+		// Subscriptions to a retired plan run until they end.
+		if resp := h.Do(http.MethodGet, "/subscriptions/active", nil, token); resp.Status != http.StatusOK {
+			t.Fatalf("subscription ended with its plan: %d %s", resp.Status, resp.Body)
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/subscriptions/plans", map[string]any{
+			"name":             "NEXT_YEAR",
+			"duration_months":  12,
+			"price_per_month":  "25.00",
+			"included_km":      300,
+			"included_minutes": 900,
+			"visible_from":     time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339),
+		}, adminToken)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to create plan: %d %s", resp.Status, resp.Body)
+		}
+		if listed(t, "NEXT_YEAR") {
+			t.Fatalf("plan is for sale before it is visible")
+		}
+		resp = h.Do(http.MethodPost, "/subscriptions/buy", map[string]string{"subscription_name": "NEXT_YEAR"}, otherToken)
+		if resp.Status != http.StatusBadRequest {
+			t.Fatalf("buying a hidden plan: got %d, want 400", resp.Status)
+		}
+
+		var plans []models.SubscriptionPlan
+		h.Do(http.MethodGet, "/subscriptions/plans", nil, adminToken).JSON(t, &plans)
+		if len(plans) != 5 {
+			t.Fatalf("got %d plans, want all 5 including hidden and retired ones", len(plans))
+		}
+	})
+
+	t.Run("categories", func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/subscriptions/plans", map[string]any{
+			"name":             "VANS",
+			"duration_months":  1,
+			"price_per_month":  "80.00",
+			"included_km":      300,
+			"included_minutes": 900,
+			"categories":       []string{"VAN"},
+		}, adminToken)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to create plan: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/subscriptions/buy", map[string]string{"subscription_name": "VANS"}, otherToken)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to buy plan: %d %s", resp.Status, resp.Body)
+		}
+
+		// The car is not a van, so the trip is charged as usual.
+		_, receipt := billedTrip(t, h, otherToken)
+		if receipt.PaymentMethod != models.Card {
+			t.Fatalf("got receipt %+v, want it paid by card", receipt)
+		}
+	})
+}
+
+func TestSubscriptionPurchase(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedSubscriptions()
+
+	token := signup(h, "driver@example.com", "driver")
+
+	t.Run("declined", func(t *testing.T) {
+		h.Payments.Config = payment.FakeConfig{DeclineCustomers: []string{"driver@example.com"}}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		resp := h.Do(http.MethodPost, "/subscriptions/buy", map[string]string{"subscription_name": string(models.OneMonth)}, token)
+		if resp.Status != http.StatusPaymentRequired {
+			t.Fatalf("got %d %s, want 402", resp.Status, resp.Body)
+		}
+		if resp := h.Do(http.MethodGet, "/subscriptions/active", nil, token); resp.Status != http.StatusNotFound {
+			t.Fatalf("unpaid subscription is active: %d %s", resp.Status, resp.Body)
+		}
+
+		history := subscriptionHistory(t, h, token)
+		if len(history) != 1 || !history[0].IsCancelled || len(history[0].Charges) != 1 ||
+			history[0].Charges[0].Status != models.PaymentFailed {
+			t.Fatalf("got history %+v, want a cancelled subscription with a failed charge", history)
+		}
+	})
+
+	t.Run("paid", func(t *testing.T) {
+		subscription := buySubscription(t, h, token, map[string]any{
+			"subscription_name": models.ThreeMonths,
+			"payment_method":    models.Crypto,
+		})
+		charge := subscription.Charges[0]
+		if charge.Kind != models.ChargePurchase || charge.Status != models.PaymentCaptured ||
+			charge.Amount != money.MustParse("150.00") || charge.PaymentMethod != models.Crypto {
+			t.Fatalf("got charge %+v, want 150.00 captured by crypto", charge)
+		}
+		if !charge.PeriodEnd.Equal(subscription.EndDate) {
+			t.Fatalf("charge pays until %v, want %v", charge.PeriodEnd, subscription.EndDate)
+		}
+
+		history := subscriptionHistory(t, h, token)
+		if len(history) != 2 || history[0].ID != subscription.ID || history[0].Plan == nil {
+			t.Fatalf("got history %+v, want the new subscription first", history)
+		}
+	})
+
+	h.Run(t, []testutil.Case{
+		{Name: "subscription method", Method: http.MethodPost, Path: "/subscriptions/buy", Token: token,
+			Body: map[string]any{"subscription_name": models.OneMonth, "payment_method": models.Sub}, WantStatus: http.StatusBadRequest},
+		{Name: "history without login", Method: http.MethodGet, Path: "/subscriptions/history", WantStatus: http.StatusUnauthorized},
+	})
+}
+
+func TestSubscriptionCancellation(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedSubscriptions()
+
+	token := signup(h, "driver@example.com", "driver")
+	subscription := buySubscription(t, h, token, map[string]any{"subscription_name": models.OneMonth, "auto_renew": true})
+
+	h.Run(t, []testutil.Case{
+		{Name: "unknown mode", Method: http.MethodPut, Path: "/subscriptions/cancel?mode=LATER", Token: token, WantStatus: http.StatusBadRequest},
+		{
+			Name: "at period end", Method: http.MethodPut, Path: "/subscriptions/cancel", Token: token, WantStatus: http.StatusCreated,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					Subscription models.UserSubscription `json:"subscription"`
+				}
+				resp.JSON(t, &body)
+				if !body.Subscription.CancelAtPeriodEnd || body.Subscription.AutoRenew || body.Subscription.IsCancelled {
+					t.Fatalf("got %+v, want it to run until the end of the period without renewing", body.Subscription)
+				}
+			},
+		},
+		{
+			Name: "still active", Method: http.MethodGet, Path: "/subscriptions/active", Token: token, WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var active models.UserSubscription
+				resp.JSON(t, &active)
+				if active.ID != subscription.ID || !active.EndDate.Equal(subscription.EndDate) {
+					t.Fatalf("got %+v, want the subscription until %v", active, subscription.EndDate)
+				}
+			},
+		},
+		{Name: "immediately", Method: http.MethodPut, Path: "/subscriptions/cancel?mode=immediate", Token: token, WantStatus: http.StatusCreated},
+		{Name: "gone", Method: http.MethodGet, Path: "/subscriptions/active", Token: token, WantStatus: http.StatusNotFound},
+		{Name: "nothing to cancel", Method: http.MethodPut, Path: "/subscriptions/cancel", Token: token, WantStatus: http.StatusNotFound},
+	})
+
+	// A cancelled subscription is never renewed.
+	renewed, err := h.Server.RenewDueSubscriptions(context.Background(), subscription.EndDate)
+	if err != nil || renewed != 0 {
+		t.Fatalf("renewed %d subscriptions (%v), want none", renewed, err)
+	}
+}
+
+func TestSubscriptionRenewal(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedSubscriptions()
+	h.SeedAdmin("admin@datadrive.com", "password")
+
+	adminToken := h.AdminToken("admin@datadrive.com")
+	token := signup(h, "driver@example.com", "driver")
+	ctx := context.Background()
+
+	renew := func(t *testing.T, now time.Time) int {
+		t.Helper()
+		renewed, err := h.Server.RenewDueSubscriptions(ctx, now)
+		if err != nil {
+			t.Fatalf("failed to renew subscriptions: %v", err)
+		}
+		return renewed
+	}
+	latest := func(t *testing.T) models.UserSubscription {
+		t.Helper()
+		return subscriptionHistory(t, h, token)[0]
+	}
+
+	subscription := buySubscription(t, h, token, map[string]any{"subscription_name": models.OneMonth, "auto_renew": true})
+	end := subscription.EndDate
+
+	t.Run("renewed on the latest plan version", func(t *testing.T) {
+		if renewed := renew(t, end.Add(-48*time.Hour)); renewed != 0 {
+			t.Fatalf("renewed %d subscriptions two days early", renewed)
+		}
+
+		resp := h.Do(http.MethodPut, "/subscriptions/plans/1_MONTH", map[string]any{
+			"duration_months":  1,
+			"price_per_month":  "65.00",
+			"included_km":      300,
+			"included_minutes": 900,
+		}, adminToken)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to update the plan: %d %s", resp.Status, resp.Body)
+		}
+
+		if renewed := renew(t, end.Add(-12*time.Hour)); renewed != 1 {
+			t.Fatalf("renewed %d subscriptions, want 1", renewed)
+		}
+		if renewed := renew(t, end.Add(-11*time.Hour)); renewed != 0 {
+			t.Fatalf("renewed the subscription twice")
+		}
+
+		got := latest(t)
+		want := end.AddDate(0, 1, 0)
+		if got.ID != subscription.ID || !got.EndDate.Equal(want) || got.Plan.Version != 2 {
+			t.Fatalf("got %+v, want it on version 2 until %v", got, want)
+		}
+		if len(got.Charges) != 2 {
+			t.Fatalf("got charges %+v, want the purchase and the renewal", got.Charges)
+		}
+		charge := got.Charges[1]
+		if charge.Kind != models.ChargeRenewal || charge.Status != models.PaymentCaptured ||
+			charge.Amount != money.MustParse("65.00") || !charge.PeriodEnd.Equal(want) {
+			t.Fatalf("got renewal charge %+v, want 65.00 captured until %v", charge, want)
+		}
+		end = want
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		h.Payments.Config = payment.FakeConfig{DeclineCustomers: []string{"driver@example.com"}}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		start := end.Add(-12 * time.Hour)
+		if renewed := renew(t, start); renewed != 0 {
+			t.Fatalf("renewed with a declined charge")
+		}
+		got := latest(t)
+		grace := end.Add(72 * time.Hour)
+		if got.GraceUntil == nil || !got.GraceUntil.Equal(grace) || !got.AutoRenew {
+			t.Fatalf("got %+v, want a grace period until %v", got, grace)
+		}
+		if charge := got.Charges[len(got.Charges)-1]; charge.Status != models.PaymentFailed {
+			t.Fatalf("got charge %+v, want it failed", charge)
+		}
+		if mails := h.Mailbox.Messages("driver@example.com"); !strings.Contains(mails[len(mails)-1].Subject, "renewal") {
+			t.Fatalf("got mails %+v, want a failed renewal notice", mails)
+		}
+
+		// The renewal is only retried once the retry interval has passed.
+		renew(t, start.Add(time.Hour))
+		if charges := len(latest(t).Charges); charges != len(got.Charges) {
+			t.Fatalf("retried after an hour: %d charges, want %d", charges, len(got.Charges))
+		}
+
+		h.Payments.Config = payment.FakeConfig{}
+		if renewed := renew(t, start.Add(25*time.Hour)); renewed != 1 {
+			t.Fatalf("renewed %d subscriptions on retry, want 1", renewed)
+		}
+		got = latest(t)
+		if got.GraceUntil != nil || !got.EndDate.Equal(end.AddDate(0, 1, 0)) {
+			t.Fatalf("got %+v, want it renewed without a grace period", got)
+		}
+		end = got.EndDate
+	})
+
+	t.Run("lapses after the grace period", func(t *testing.T) {
+		h.Payments.Config = payment.FakeConfig{DeclineCustomers: []string{"driver@example.com"}}
+		defer func() { h.Payments.Config = payment.FakeConfig{} }()
+
+		for now := end.Add(-12 * time.Hour); now.Before(end.Add(96 * time.Hour)); now = now.Add(time.Hour) {
+			renew(t, now)
+		}
+		got := latest(t)
+		failed := 0
+		for _, charge := range got.Charges {
+			if charge.Status == models.PaymentFailed {
+				failed++
+			}
+		}
+		// One failure from the grace period above, and the attempts 12
+		// hours before the end and 12, 36 and 60 hours after it.
+		if failed != 5 || got.AutoRenew || got.GraceUntil == nil || !got.GraceUntil.Equal(end.Add(72*time.Hour)) {
+			t.Fatalf("got %+v with %d failed charges, want 5 and no more renewals", got, failed)
+		}
+	})
+
+	t.Run("retired plan", func(t *testing.T) {
+		otherToken := signup(h, "other@example.com", "other")
+		subscription := buySubscription(t, h, otherToken, map[string]any{"subscription_name": models.OneYear, "auto_renew": true})
+		if resp := h.Do(http.MethodDelete, "/subscriptions/plans/1_YEAR", nil, adminToken); resp.Status != http.StatusOK {
+			t.Fatalf("failed to retire the plan: %d %s", resp.Status, resp.Body)
+		}
+
+		if renewed := renew(t, subscription.EndDate.Add(-time.Hour)); renewed != 0 {
+			t.Fatalf("renewed a subscription to a retired plan")
+		}
+		got := subscriptionHistory(t, h, otherToken)[0]
+		if got.AutoRenew || len(got.Charges) != 1 || !got.EndDate.Equal(subscription.EndDate) {
+			t.Fatalf("got %+v, want it to end without renewing", got)
+		}
+	})
+
+	t.Run("overlapping runs", func(t *testing.T) {
+		otherToken := signup(h, "overlap@example.com", "overlap")
+		subscription := buySubscription(t, h, otherToken, map[string]any{"subscription_name": models.OneMonth, "auto_renew": true})
+
+		// A second run starts while the first one charges the renewal.
+		due := subscription.EndDate.Add(-time.Hour)
+		h.Server.Payments = &duringAuthorize{PaymentProvider: h.Payments, run: func() { renew(t, due) }}
+		defer func() { h.Server.Payments = h.Payments }()
+
+		renew(t, due)
+
+		got := subscriptionHistory(t, h, otherToken)[0]
+		if len(got.Charges) != 2 || !got.EndDate.Equal(subscription.EndDate.AddDate(0, 1, 0)) {
+			t.Fatalf("got %+v, want it renewed once, with a single renewal charge", got)
+		}
+	})
+}
+
+// duringAuthorize runs run while the first authorization is requested.
+type duringAuthorize struct {
+	payment.PaymentProvider
+	started atomic.Bool
+	run     func()
+}
+
+func (p *duringAuthorize) Authorize(ctx context.Context, req payment.AuthorizeRequest) (string, error) {
+	if p.started.CompareAndSwap(false, true) {
+		p.run()
+	}
+	return p.PaymentProvider.Authorize(ctx, req)
+}
+
+func TestSubscriptionUsage(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedAdmin("admin@datadrive.com", "password")
+
+	adminToken := h.AdminToken("admin@datadrive.com")
+	token := signup(h, "driver@example.com", "driver")
+
+	resp := h.Do(http.MethodPost, "/subscriptions/plans", map[string]any{
+		"name":             "CITY",
+		"duration_months":  1,
+		"price_per_month":  "20.00",
+		"included_km":      5,
+		"included_minutes": 600,
+		"overage_per_km":   "0.40",
+	}, adminToken)
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("failed to create plan: %d %s", resp.Status, resp.Body)
+	}
+
+	h.Run(t, []testutil.Case{
+		{Name: "usage without a subscription", Method: http.MethodGet, Path: "/subscriptions/usage", Token: token, WantStatus: http.StatusNotFound},
+		{Name: "usage without a token", Method: http.MethodGet, Path: "/subscriptions/usage", WantStatus: http.StatusUnauthorized},
+	})
+
+	// Without a subscription, the trip cannot be paid with one, and goes on
+	// until it is stopped with another payment method.
+	if resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token); resp.Status != http.StatusCreated {
+		t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+	}
+	if resp := h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Sub}, token); resp.Status != http.StatusBadRequest {
+		t.Fatalf("stopping on a subscription without one: got %d %s, want 400", resp.Status, resp.Body)
+	}
+	if resp := h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Card}, token); resp.Status != http.StatusCreated {
+		t.Fatalf("failed to stop trip by card: %d %s", resp.Status, resp.Body)
+	}
+
+	buySubscription(t, h, token, map[string]any{"subscription_name": "CITY"})
+
+	// subscribedTrip drives 4 km on ABC1234 and stops the trip on the
+	// subscription.
+	subscribedTrip := func(t *testing.T) models.TripReceipt {
+		t.Helper()
+		resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token)
+		if resp.Status != http.StatusAccepted {
+			t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Sub}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to stop trip: %d %s", resp.Status, resp.Body)
+		}
+		var body struct {
+			Receipt models.TripReceipt `json:"receipt"`
+		}
+		resp.JSON(t, &body)
+		return body.Receipt
+	}
+
+	usage := func(t *testing.T) (used models.UsageTotals, remainingKm *float64) {
+		t.Helper()
+		resp := h.Do(http.MethodGet, "/subscriptions/usage", nil, token)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("failed to read the usage: %d %s", resp.Status, resp.Body)
+		}
+		var body struct {
+			Used        models.UsageTotals `json:"used"`
+			RemainingKm *float64           `json:"remaining_km"`
+		}
+		resp.JSON(t, &body)
+		return body.Used, body.RemainingKm
+	}
+
+	if used, remaining := usage(t); used.Trips != 0 || remaining == nil || *remaining != 5 {
+		t.Fatalf("got %+v with %v km remaining, want the whole allowance of 5 km", used, remaining)
+	}
+
+	receipt := subscribedTrip(t)
+	if receipt.Amount != 0 || receipt.PaymentMethod != models.Sub || receipt.Usage == nil || receipt.Usage.OverageKm != 0 {
+		t.Fatalf("got receipt %+v, want a trip within the allowance paid by the subscription", receipt)
+	}
+	if used, remaining := usage(t); used.Trips != 1 || used.Km != 4 || remaining == nil || *remaining != 1 {
+		t.Fatalf("got %+v with %v km remaining, want 4 km used and 1 km remaining", used, remaining)
+	}
+
+	// 3 of the next 4 km are over the allowance, charged at 0.40 per km on
+	// the card the subscription was bought with.
+	receipt = subscribedTrip(t)
+	if receipt.Usage == nil || receipt.Usage.OverageKm != 3 || receipt.Amount != money.MustParse("1.20") ||
+		receipt.PaymentMethod != models.Card || receipt.PaymentStatus != models.PaymentCaptured {
+		t.Fatalf("got receipt %+v, want 3 km of overage charged 1.20 on the card", receipt)
+	}
+	if used, remaining := usage(t); used.Km != 8 || used.OverageAmount != money.MustParse("1.20") || remaining == nil || *remaining != 0 {
+		t.Fatalf("got %+v with %v km remaining, want 8 km used and the allowance spent", used, remaining)
+	}
+}
+
+// The plans sold before allowances existed were given some by migration 0018,
+// so their trips are no longer free once the allowance is spent.
+func TestMigratedPlanAllowance(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedSubscriptions()
+
+	token := signup(h, "driver@example.com", "driver")
+
+	stop := func(t *testing.T, method models.PaymentMethod) models.TripReceipt {
+		t.Helper()
+		resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", track(time.Now().Add(-60*time.Second), 4, 7)...), token)
+		if resp.Status != http.StatusAccepted {
+			t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+		}
+		resp = h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": method}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to stop trip: %d %s", resp.Status, resp.Body)
+		}
+		var body struct {
+			Receipt models.TripReceipt `json:"receipt"`
+		}
+		resp.JSON(t, &body)
+		return body.Receipt
+	}
+
+	// A trip taken before the subscription stands in for the 498 km driven
+	// on it so far, which leave 2 km of the 500 km allowance.
+	earlier := stop(t, models.Card)
+	subscription := buySubscription(t, h, token, map[string]any{"subscription_name": models.OneMonth})
+	err := h.Database.SubscriptionDB.RecordTripUsage(context.Background(), nil, models.TripUsage{
+		TripID:             earlier.TripID,
+		UserSubscriptionID: subscription.ID,
+		Km:                 498,
+		RecordedAt:         time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("failed to record usage: %v", err)
+	}
+
+	// The other 2 km are charged at the overage rate of the plan, 0.30 per km.
+	receipt := stop(t, models.Sub)
+	if receipt.Usage == nil || receipt.Usage.OverageKm != 2 || receipt.Amount != money.MustParse("0.60") ||
+		receipt.PaymentMethod != models.Card || receipt.PaymentStatus != models.PaymentCaptured {
+		t.Fatalf("got receipt %+v, want 2 km of overage charged 0.60 on the card", receipt)
+	}
+}
@@ -0,0 +1,227 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func telemetryBody(licensePlate string, points ...models.TelemetryPoint) map[string]any {
+	return map[string]any{"license_plate": licensePlate, "points": points}
+}
+
+// track returns n points, 10 seconds apart from start, along a straight
+// line northwards that is km long.
+func track(start time.Time, km float64, n int) []models.TelemetryPoint {
+	// A degree of latitude is 111.195 km long everywhere.
+	step := km / 111.19508 / float64(n-1)
+
+	points := make([]models.TelemetryPoint, n)
+	for i := range points {
+		points[i] = models.TelemetryPoint{
+			RecordedAt: start.Add(time.Duration(i) * 10 * time.Second).UTC(),
+			Latitude:   37.9 + float64(i)*step,
+			Longitude:  23.7,
+			Speed:      50,
+		}
+	}
+	return points
+}
+
+func TestTelemetry(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedCar("DEF4321", models.Available, "0.50")
+
+	token := signup(h, "driver@example.com", "driver")
+
+	now := time.Now().UTC()
+	points := []models.TelemetryPoint{
+		{RecordedAt: now, Latitude: 37.9838, Longitude: 23.7275, Speed: 30, Acceleration: 1.2},
+		{RecordedAt: now.Add(time.Second), Latitude: 37.9840, Longitude: 23.7279, Speed: 28, Acceleration: -6.5, HarshBraking: true},
+	}
+
+	var tripID int64
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "without an active trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234", points...),
+			Token:      token,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "start trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "empty batch",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234"),
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:   "invalid coordinates",
+			Method: http.MethodPost,
+			Path:   "/trips/telemetry",
+			Body: telemetryBody("ABC1234", models.TelemetryPoint{
+				RecordedAt: now, Latitude: 91, Longitude: 23.7275,
+			}),
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "other car",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("DEF4321", points...),
+			Token:      token,
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:   "before the trip started",
+			Method: http.MethodPost,
+			Path:   "/trips/telemetry",
+			Body: telemetryBody("ABC1234", models.TelemetryPoint{
+				RecordedAt: now.Add(-time.Hour), Latitude: 37.9838, Longitude: 23.7275,
+			}),
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "too many points",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234", make([]models.TelemetryPoint, 501)...),
+			Token:      token,
+			WantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name:       "record",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("abc1234", points...),
+			Token:      token,
+			WantStatus: http.StatusAccepted,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				var body struct {
+					TripID   int64 `json:"trip_id"`
+					Recorded int   `json:"recorded"`
+				}
+				resp.JSON(t, &body)
+				if body.Recorded != 2 {
+					t.Fatalf("recorded %d points, want 2", body.Recorded)
+				}
+				tripID = body.TripID
+			},
+		},
+		{
+			Name:       "retried batch is not stored twice",
+			Method:     http.MethodPost,
+			Path:       "/trips/telemetry",
+			Body:       telemetryBody("ABC1234", points...),
+			Token:      token,
+			WantStatus: http.StatusAccepted,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if recorded := resp.Map(t)["recorded"]; recorded != 0.0 {
+					t.Fatalf("recorded %v points, want 0", recorded)
+				}
+			},
+		},
+	})
+
+	stored, err := h.Database.TelemetryDB.GetTelemetry(context.Background(), tripID)
+	if err != nil {
+		t.Fatalf("failed to read telemetry: %v", err)
+	}
+	if len(stored) != 2 || !stored[1].HarshBraking {
+		t.Fatalf("got telemetry %+v, want both points in order", stored)
+	}
+}
+
+func TestStopTripReceipt(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	token := signup(h, "driver@example.com", "driver")
+
+	start := func(t *testing.T) {
+		resp := h.Do(http.MethodPost, "/trips/start", map[string]string{"license_plate": "ABC1234"}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to start trip: %d %s", resp.Status, resp.Body)
+		}
+	}
+	stop := func(t *testing.T) models.TripReceipt {
+		resp := h.Do(http.MethodPost, "/trips/stop", map[string]any{"payment_method": models.Card}, token)
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("failed to stop trip: %d %s", resp.Status, resp.Body)
+		}
+		var body struct {
+			Receipt models.TripReceipt `json:"receipt"`
+		}
+		resp.JSON(t, &body)
+		return body.Receipt
+	}
+	record := func(t *testing.T, points []models.TelemetryPoint) {
+		resp := h.Do(http.MethodPost, "/trips/telemetry", telemetryBody("ABC1234", points...), token)
+		if resp.Status != http.StatusAccepted {
+			t.Fatalf("failed to record telemetry: %d %s", resp.Status, resp.Body)
+		}
+	}
+
+	t.Run("harsh driving lowers the score", func(t *testing.T) {
+		start(t)
+		points := track(time.Now().Add(-30*time.Second), 2, 7)
+		points[2].Acceleration = -7
+		points[3].Acceleration = -6
+		points[5].HarshBraking = true
+		record(t, points)
+
+		receipt := stop(t)
+		if receipt.Distance != 2 || receipt.DistanceSource != "GPS" || receipt.TelemetryPoints != 7 {
+			t.Fatalf("got receipt %+v, want 2 km over 7 GPS points", receipt)
+		}
+		// Two harsh braking events on a trip shorter than 10 km.
+		if receipt.DrivingBehavior != 8 || receipt.Amount != money.MustParse("1.00") || receipt.PaymentMethod != models.Card {
+			t.Fatalf("got receipt %+v, want a score of 8 and 1.00 paid by card", receipt)
+		}
+	})
+
+	t.Run("odometer replaces a broken GPS track", func(t *testing.T) {
+		start(t)
+		points := track(time.Now().Add(-30*time.Second), 2, 7)
+		// A fix on the other side of the world.
+		points[3].Latitude, points[3].Longitude = -33.86, 151.2
+		first, last := 1000.0, 1003.4
+		points[0].Odometer = &first
+		points[6].Odometer = &last
+		record(t, points)
+
+		receipt := stop(t)
+		if receipt.Distance != 3.4 || receipt.DistanceSource != "ODOMETER" || receipt.Amount != money.MustParse("1.70") {
+			t.Fatalf("got receipt %+v, want 3.4 km from the odometer billed 1.70", receipt)
+		}
+	})
+
+	t.Run("trip without telemetry", func(t *testing.T) {
+		start(t)
+
+		receipt := stop(t)
+		if receipt.Distance != 0 || receipt.DistanceSource != "NONE" || receipt.Amount != 0 {
+			t.Fatalf("got receipt %+v, want nothing measured or billed", receipt)
+		}
+	})
+}
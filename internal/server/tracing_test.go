@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ntentasd/db-deliverable3/internal/middleware"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestTracePropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	resp := h.DoWithHeader(http.MethodGet, "/available", nil, "", http.Header{
+		"Traceparent":                  {"00-" + traceID + "-" + parentID + "-01"},
+		middleware.CorrelationIDHeader: {"correlation-1"},
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", resp.Status, http.StatusOK, resp.Body)
+	}
+	if traceparent := resp.Header.Get("Traceparent"); !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+		t.Fatalf("got traceparent %q in the response, want the trace of the request", traceparent)
+	}
+
+	var request, handler *tracetest.SpanStub
+	spans := exporter.GetSpans()
+	for i := range spans {
+		switch spans[i].Name {
+		case "GET /available":
+			request = &spans[i]
+		case "GetAllAvailableCarsHandler":
+			handler = &spans[i]
+		}
+	}
+	if request == nil || handler == nil {
+		t.Fatalf("got spans %v, want the request's and the handler's", spans)
+	}
+
+	if request.SpanKind != trace.SpanKindServer || request.SpanContext.TraceID().String() != traceID || request.Parent.SpanID().String() != parentID {
+		t.Fatalf("got request span %s in trace %s under %s, want a server span under the caller's",
+			request.SpanKind, request.SpanContext.TraceID(), request.Parent.SpanID())
+	}
+	if !hasAttribute(request.Attributes, attribute.String("correlation.id", "correlation-1")) {
+		t.Errorf("got request span attributes %v, want the correlation ID", request.Attributes)
+	}
+	if !hasAttribute(request.Attributes, attribute.String("http.route", "/available")) {
+		t.Errorf("got request span attributes %v, want the route", request.Attributes)
+	}
+	if handler.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("got handler span under %s, want it under the request span %s", handler.Parent.SpanID(), request.SpanContext.SpanID())
+	}
+}
+
+func hasAttribute(attributes []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attribute := range attributes {
+		if attribute == want {
+			return true
+		}
+	}
+	return false
+}
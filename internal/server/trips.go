@@ -1,7 +1,8 @@
 package server
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"strings"
@@ -13,6 +14,21 @@ import (
 	"github.com/ntentasd/db-deliverable3/internal/database"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
 	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
+	"github.com/ntentasd/db-deliverable3/internal/telemetry"
+)
+
+var ErrTripNotCovered = errors.New("no active subscription covers this trip")
+
+const (
+	// MaxTelemetryBatch is the number of points a single telemetry request
+	// may carry.
+	MaxTelemetryBatch = 500
+	// TelemetryClockSkew is how far the clock of a car may drift from ours
+	// before its points are rejected as outside of the trip.
+	TelemetryClockSkew = time.Minute
 )
 
 func (srv *Server) SetupTripRoutes() {
@@ -22,9 +38,9 @@ func (srv *Server) SetupTripRoutes() {
 
 	_ = validator.RegisterValidation("licenseplate", validateLicensePlate)
 
-	authenticatedGroup := tripGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret))
+	authenticatedGroup := tripGroup.Group("/", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB))
 
-	authenticatedGroup.Get("/car/:license_plate", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/car/:license_plate", srv.RequirePermission(models.PermissionCarsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetCarTripsHandler")
 		defer span.End()
 
@@ -53,7 +69,7 @@ func (srv *Server) SetupTripRoutes() {
 		return c.JSON(trips)
 	})
 
-	authenticatedGroup.Get("/details/:id", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/details/:id", srv.RequirePermission(models.PermissionTripsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetTripDetailsHandler")
 		defer span.End()
 
@@ -67,7 +83,7 @@ func (srv *Server) SetupTripRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid trip ID"})
 		}
 
-		trip, costPerKm, err := srv.Database.TripDB.GetTripByID(ctx, tripID, email)
+		trip, car, err := srv.Database.TripDB.GetTripByID(ctx, tripID, email)
 		if err != nil {
 			if err == database.ErrTripNotFound {
 				return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
@@ -75,13 +91,37 @@ func (srv *Server) SetupTripRoutes() {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		// An active trip is quoted as if it ended now.
+		endTime := time.Now().UTC()
+		if trip.EndTime != nil {
+			endTime = *trip.EndTime
+		}
+
+		quote, err := srv.pricing().Quote(pricing.Trip{
+			Car:       car,
+			StartTime: trip.StartTime,
+			EndTime:   endTime,
+			Distance:  trip.Distance,
+		})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		var costPerKm money.Amount
+		if car.CostPerKm != nil {
+			costPerKm = *car.CostPerKm
+		}
+
 		return c.JSON(fiber.Map{
 			"trip":        trip,
 			"cost_per_km": costPerKm,
+			"quote":       quote,
 		})
 	})
 
-	authenticatedGroup.Get("/", func(c *fiber.Ctx) error {
+	srv.setupTripDisputeRoutes(authenticatedGroup, validator)
+
+	authenticatedGroup.Get("/", srv.RequirePermission(models.PermissionTripsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetUserTripsHandler")
 		defer span.End()
 
@@ -120,7 +160,7 @@ func (srv *Server) SetupTripRoutes() {
 		})
 	})
 
-	authenticatedGroup.Get("/active", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/active", srv.RequirePermission(models.PermissionTripsRead), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "GetActiveTripHandler")
 		defer span.End()
 
@@ -144,7 +184,7 @@ func (srv *Server) SetupTripRoutes() {
 		return c.JSON(car)
 	})
 
-	authenticatedGroup.Post("/start", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/start", srv.RequirePermission(models.PermissionTripsWrite), srv.Idempotent(), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "StartTripHandler")
 		defer span.End()
 
@@ -177,7 +217,19 @@ func (srv *Server) SetupTripRoutes() {
 				JSON(fiber.Map{"error": "car is not available for a trip"})
 		}
 
-		tx, err := srv.Database.CarDB.DB.Begin()
+		// A reservation holds the car for its user around its start time.
+		reservation, err := srv.Database.ReservationDB.GetHeldReservation(ctx, car.LicensePlate, time.Now().UTC())
+		switch {
+		case err == database.ErrReservationNotFound:
+			reservation = models.Reservation{}
+		case err != nil:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		case !strings.EqualFold(reservation.UserEmail, email):
+			return c.Status(http.StatusConflict).
+				JSON(fiber.Map{"error": "car is reserved by another user"})
+		}
+
+		tx, err := srv.Database.Begin(ctx)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to start transaction"})
@@ -189,34 +241,118 @@ func (srv *Server) SetupTripRoutes() {
 			}
 		}()
 
-		err = srv.Database.TripDB.CreateTrip(ctx, tx, email, strings.ToUpper(requestBody.LicensePlate))
+		// Taking the car only succeeds while it is still available, so of
+		// concurrent starts on the same car only one gets it.
+		err = srv.Database.CarDB.ChangeCarStatus(ctx, tx, car.LicensePlate, models.Available, models.Rented)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			if err == database.ErrCarStatusChanged {
+				return c.Status(http.StatusBadRequest).
+					JSON(fiber.Map{"error": "car is not available for a trip"})
+			}
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to update car status"})
 		}
 
-		err = srv.Database.CarDB.UpdateCarStatus(ctx, tx, requestBody.LicensePlate, "RENTED")
+		err = srv.Database.TripDB.CreateTrip(ctx, tx, email, car.LicensePlate)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(fiber.Map{"error": "failed to update car status"})
+			switch err {
+			case database.ErrActiveTripExists:
+				return c.Status(http.StatusConflict).
+					JSON(fiber.Map{"error": "you already have an active trip"})
+			case database.ErrCarOnTrip:
+				return c.Status(http.StatusBadRequest).
+					JSON(fiber.Map{"error": "car is not available for a trip"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if reservation.ID != 0 {
+			err = srv.Database.ReservationDB.FulfillReservation(ctx, tx, reservation.ID, email)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).
+					JSON(fiber.Map{"error": "failed to fulfill reservation"})
+			}
 		}
 
 		if err = tx.Commit(); err != nil {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"errir": "failed to commit transaction"})
 		}
+		srv.carsChanged(ctx)
 
 		return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "trip started successfully"})
 	})
 
-	authenticatedGroup.Post("/stop", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/telemetry", srv.RequirePermission(models.PermissionTripsWrite), func(c *fiber.Ctx) error {
+		ctx, span := InitServerTracer(c, "RecordTelemetryHandler")
+		defer span.End()
+
+		var payload struct {
+			LicensePlate string                  `json:"license_plate" validate:"required,licenseplate"`
+			Points       []models.TelemetryPoint `json:"points" validate:"required,min=1,dive"`
+		}
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if len(payload.Points) > MaxTelemetryBatch {
+			return c.Status(http.StatusRequestEntityTooLarge).
+				JSON(fiber.Map{"error": fmt.Sprintf("at most %d points per request", MaxTelemetryBatch)})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).
+				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		trip, err := srv.Database.TripDB.GetActiveTrip(ctx, email)
+		if err != nil {
+			if err == database.ErrTripNotFound {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "no active trip found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if !strings.EqualFold(trip.CarLicensePlate, payload.LicensePlate) {
+			return c.Status(http.StatusConflict).
+				JSON(fiber.Map{"error": "telemetry does not belong to the active trip"})
+		}
+
+		earliest := trip.StartTime.Add(-TelemetryClockSkew)
+		latest := time.Now().Add(TelemetryClockSkew)
+		for _, point := range payload.Points {
+			if point.RecordedAt.Before(earliest) || point.RecordedAt.After(latest) {
+				return c.Status(http.StatusBadRequest).
+					JSON(fiber.Map{"error": "telemetry point outside of the active trip"})
+			}
+		}
+
+		recorded, err := srv.Database.TelemetryDB.RecordTelemetry(ctx, trip.ID, payload.Points)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to record telemetry"})
+		}
+
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{
+			"trip_id":  trip.ID,
+			"received": len(payload.Points),
+			"recorded": recorded,
+		})
+	})
+
+	authenticatedGroup.Post("/stop", srv.RequirePermission(models.PermissionTripsWrite), srv.Idempotent(), func(c *fiber.Ctx) error {
 		ctx, span := InitServerTracer(c, "StopTripHandler")
 		defer span.End()
 
 		var payload struct {
-			Distance        float64              `json:"distance" validate:"required,gt=0"`
-			DrivingBehavior float64              `json:"driving_behavior" validate:"required,gt=0,max=10"`
-			Amount          float64              `json:"amount" validate:"required,gt=0,max=99999999.99"`
-			PaymentMethod   models.PaymentMethod `json:"payment_method" validate:"required,oneof=SUBSCRIPTION CARD CRYPTO"`
+			PaymentMethod models.PaymentMethod `json:"payment_method" validate:"required,oneof=SUBSCRIPTION CARD CRYPTO"`
+			// Latitude and Longitude are where the car was parked, when the
+			// client knows better than the last telemetry point.
+			Latitude  *float64 `json:"latitude" validate:"required_with=Longitude,omitempty,min=-90,max=90"`
+			Longitude *float64 `json:"longitude" validate:"required_with=Latitude,omitempty,min=-180,max=180"`
 		}
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
@@ -231,19 +367,69 @@ func (srv *Server) SetupTripRoutes() {
 				JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
 
-		tripID, licensePlate, costPerKm, err := srv.Database.TripDB.FindActiveTripCar(ctx, email)
+		trip, err := srv.Database.TripDB.GetActiveTrip(ctx, email)
 		if err != nil {
-			if err == database.ErrCarNotFound {
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			if err == database.ErrTripNotFound {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "no active trip found"})
 			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		if calculateAmount(payload.Distance, costPerKm) != payload.Amount {
-			return c.Status(fiber.StatusBadRequest).SendString("inconsistent amount calculation")
+		car, err := srv.Database.CarDB.GetCarByLicensePlate(ctx, trip.CarLicensePlate)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		points, err := srv.Database.TelemetryDB.GetTelemetry(ctx, trip.ID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to read trip telemetry"})
 		}
 
-		tx, err := srv.Database.CarDB.DB.Begin()
+		distance, source := telemetry.Distance(points)
+		// Trips.distance has two decimals, and the trip is priced on it.
+		distance = math.Round(distance*100) / 100
+		// Trips.end_time has second precision.
+		endTime := time.Now().UTC().Truncate(time.Second)
+
+		quote, err := srv.pricing().Quote(pricing.Trip{
+			Car:       car,
+			StartTime: trip.StartTime,
+			EndTime:   endTime,
+			Distance:  distance,
+		})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to price the trip"})
+		}
+
+		receipt := models.TripReceipt{
+			TripID:          trip.ID,
+			CarLicensePlate: car.LicensePlate,
+			StartTime:       trip.StartTime,
+			EndTime:         endTime,
+			Distance:        distance,
+			DistanceSource:  string(source),
+			TelemetryPoints: len(points),
+			DrivingBehavior: srv.scoringModel().Score(points, distance),
+			Quote:           quote,
+			Amount:          quote.Total,
+			PaymentMethod:   payload.PaymentMethod,
+		}
+
+		// A plan only covers trips on the car categories it lists. Trips it
+		// does not cover cannot be paid with it.
+		sub, err := srv.Database.SubscriptionDB.GetActiveSubscription(ctx, email)
+		if err != nil && err != database.ErrUserSubscriptionNotFound {
+			return c.Status(http.StatusInternalServerError).
+				JSON(fiber.Map{"error": "failed to read the subscription"})
+		}
+		covered := err == nil && sub.Active(time.Now()) && sub.Plan != nil && sub.Plan.Covers(car.Category)
+		if !covered && payload.PaymentMethod == models.Sub {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrTripNotCovered.Error()})
+		}
+
+		tx, err := srv.Database.Begin(ctx)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to start transaction"})
@@ -257,43 +443,97 @@ func (srv *Server) SetupTripRoutes() {
 			}
 		}()
 
-		err = srv.Database.TripDB.EndTrip(ctx, tx, email, payload.Distance, payload.DrivingBehavior)
+		// Ending the trip only succeeds while it is still active, so of
+		// concurrent stops only one bills it.
+		err = srv.Database.TripDB.EndTrip(ctx, tx, trip.ID, receipt.EndTime, receipt.Distance, receipt.DrivingBehavior)
 		if err != nil {
+			if err == database.ErrTripNotFound {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "no active trip found"})
+			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		err = srv.Database.CarDB.UpdateCarStatus(ctx, tx, licensePlate, "AVAILABLE")
+		err = srv.Database.CarDB.ChangeCarStatus(ctx, tx, car.LicensePlate, models.Rented, models.Available)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to update car status"})
 		}
 
-		err = srv.Database.UserDB.UpdateDrivingBehavior(tx, email, payload.DrivingBehavior)
+		// The car is left where the trip ended.
+		latitude, longitude := payload.Latitude, payload.Longitude
+		if latitude == nil && len(points) > 0 {
+			last := points[len(points)-1]
+			latitude, longitude = &last.Latitude, &last.Longitude
+		}
+		if latitude != nil {
+			err = srv.Database.CarDB.MoveCar(ctx, tx, car.LicensePlate, *latitude, *longitude)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).
+					JSON(fiber.Map{"error": "failed to update car position"})
+			}
+		}
+
+		err = srv.Database.UserDB.UpdateDrivingBehavior(ctx, tx, email, receipt.DrivingBehavior)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to update driving behavior"})
 		}
 
-		var subbed bool
-		if sub, err := srv.Database.SubscriptionDB.GetActiveSubscription(email); err == nil &&
-			sub.EndDate.After(time.Now()) {
-			subbed = true
+		// Only the usage over the monthly allowance of the plan is charged.
+		if covered {
+			from, to := sub.UsagePeriod(endTime)
+			var used models.UsageTotals
+			used, err = srv.Database.SubscriptionDB.GetUsage(ctx, sub.ID, from, to)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).
+					JSON(fiber.Map{"error": "failed to read subscription usage"})
+			}
+			usage := pricing.Overage(*sub.Plan, pricing.Trip{
+				Car:       car,
+				StartTime: trip.StartTime,
+				EndTime:   endTime,
+				Distance:  distance,
+			}, quote, used)
+			usage.TripID = trip.ID
+			usage.UserSubscriptionID = sub.ID
+			usage.RecordedAt = endTime
+
+			err = srv.Database.SubscriptionDB.RecordTripUsage(ctx, tx, usage)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).
+					JSON(fiber.Map{"error": "failed to record subscription usage"})
+			}
+
+			receipt.Usage = &usage
+			receipt.Amount = usage.OverageAmount
+			switch {
+			case usage.OverageAmount == 0:
+				receipt.PaymentMethod = models.Sub
+			case payload.PaymentMethod == models.Sub:
+				// The overage goes on the payment method of the subscription.
+				receipt.PaymentMethod = sub.PaymentMethod
+				if receipt.PaymentMethod == "" {
+					receipt.PaymentMethod = models.Card
+				}
+			}
 		}
 
-		// If subbed, set the payment amount to 0 and payment method to `SUBSCRIPTION`
-		if subbed {
-			payload.Amount = 0
-			payload.PaymentMethod = models.Sub
+		// Nothing is charged for trips that cost nothing.
+		receipt.PaymentStatus = models.PaymentPending
+		if receipt.Amount == 0 {
+			receipt.PaymentStatus = models.PaymentCaptured
 		}
 
 		err = srv.Database.PaymentDB.CreatePayment(
+			ctx,
 			tx,
-			tripID,
-			payload.Amount,
-			string(payload.PaymentMethod),
+			int(trip.ID),
+			receipt.Amount,
+			string(receipt.PaymentMethod),
+			receipt.PaymentStatus,
 		)
 		if err != nil {
-			log.Println(err)
+			srv.logger().ErrorContext(ctx, "Failed to register the payment of the trip", "trip_id", trip.ID, "error", err)
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to register payment"})
 		}
@@ -302,11 +542,31 @@ func (srv *Server) SetupTripRoutes() {
 			return c.Status(http.StatusInternalServerError).
 				JSON(fiber.Map{"error": "failed to commit transaction"})
 		}
+		srv.carsChanged(ctx)
+
+		// The trip is over and the car released whether or not the charge
+		// goes through; a failed payment is left FAILED to be settled later.
+		if receipt.PaymentStatus == models.PaymentPending {
+			status, chargeErr := srv.chargeTrip(ctx, email, receipt)
+			receipt.PaymentStatus = status
+			if errors.Is(chargeErr, payment.ErrDeclined) {
+				return c.Status(http.StatusPaymentRequired).JSON(fiber.Map{
+					"error":   chargeErr.Error(),
+					"receipt": receipt,
+				})
+			}
+			if chargeErr != nil {
+				srv.logger().ErrorContext(ctx, "Failed to charge the trip", "trip_id", trip.ID, "error", chargeErr)
+				return c.Status(http.StatusBadGateway).JSON(fiber.Map{
+					"error":   "failed to charge the trip",
+					"receipt": receipt,
+				})
+			}
+		}
 
-		return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "trip ended successfully"})
+		return c.Status(http.StatusCreated).JSON(fiber.Map{
+			"message": "trip ended successfully",
+			"receipt": receipt,
+		})
 	})
 }
-
-func calculateAmount(distance float64, costPerKm float64) float64 {
-	return math.Round(distance*costPerKm*100) / 100
-}
@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestTripErrors(t *testing.T) {
+	h := testutil.New(t)
+	h.SeedCar("ABC1234", models.Available, "0.50")
+	h.SeedCar("DEF4321", models.Maintenance, "0.55")
+
+	token := signup(h, "driver@example.com", "driver")
+	other := signup(h, "other@example.com", "other")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:       "stop without an active trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/stop",
+			Body:       map[string]any{"payment_method": models.Card},
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "invalid license plate",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC"},
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "unknown car",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ZZZ9999"},
+			Token:      token,
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "car in maintenance",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "DEF4321"},
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "start trip",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      token,
+			WantStatus: http.StatusCreated,
+		},
+		{
+			Name:       "car already rented",
+			Method:     http.MethodPost,
+			Path:       "/trips/start",
+			Body:       map[string]string{"license_plate": "ABC1234"},
+			Token:      other,
+			WantStatus: http.StatusBadRequest,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := resp.Map(t)["error"]; got != "car is not available for a trip" {
+					t.Fatalf("got error %q", got)
+				}
+			},
+		},
+		{
+			Name:       "unknown payment method",
+			Method:     http.MethodPost,
+			Path:       "/trips/stop",
+			Body:       map[string]any{"payment_method": "CASH"},
+			Token:      token,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "trip is still active",
+			Method:     http.MethodGet,
+			Path:       "/trips/active",
+			Token:      token,
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "other users cannot read the trip",
+			Method:     http.MethodGet,
+			Path:       "/trips/details/1",
+			Token:      other,
+			WantStatus: http.StatusForbidden,
+		},
+	})
+}
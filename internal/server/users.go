@@ -8,7 +8,6 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/ntentasd/db-deliverable3/internal/database"
 	"github.com/ntentasd/db-deliverable3/internal/middleware"
 	"github.com/ntentasd/db-deliverable3/internal/models"
@@ -17,9 +16,6 @@ import (
 
 var (
 	ErrValidationFailed = fmt.Errorf("validation failed")
-
-	AdminUser  = fmt.Sprintf("Admin")
-	ClientUser = fmt.Sprintf("Client")
 )
 
 func (srv *Server) SetupUserRoutes() {
@@ -27,7 +23,7 @@ func (srv *Server) SetupUserRoutes() {
 
 	validator := validator.New()
 
-	authenticatedGroup := userGroup.Group("/user", middleware.JWTMiddleware(srv.JWTSecret))
+	authenticatedGroup := userGroup.Group("/user", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB))
 
 	userGroup.Post("/login", func(c *fiber.Ctx) error {
 		var payload struct {
@@ -41,32 +37,87 @@ func (srv *Server) SetupUserRoutes() {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
 
-		if isAdmin(payload.Email, payload.Password) {
-			token, err := generateJWT(payload.Email, AdminUser, srv.JWTSecret)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
-			}
-			return c.JSON(fiber.Map{"token": token})
-		}
-
-		user, err := srv.Database.UserDB.GetUserByEmail(payload.Email)
+		user, err := srv.Database.UserDB.GetUserByEmail(c.UserContext(), payload.Email)
 		if err != nil {
 			if err == database.ErrUserNotFound {
-				c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrInvalidCredentials.Error()})
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": database.ErrInvalidCredentials.Error()})
 			}
-			c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
 		if user.Email == "" || user.Password == "" || !validatePassword(user.Password, payload.Password) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": database.ErrInvalidCredentials.Error()})
 		}
 
-		token, err := generateJWT(user.Email, ClientUser, srv.JWTSecret)
+		tokens, err := srv.startSession(c, user.Email, user.Role)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
+		}
+
+		return c.JSON(tokens)
+	})
+
+	userGroup.Post("/token/refresh", func(c *fiber.Ctx) error {
+		var payload struct {
+			RefreshToken string `json:"refresh_token" validate:"required"`
+		}
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if err := validator.Struct(payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
+		}
+
+		refreshToken, refreshTokenHash, err := generateToken()
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
 		}
 
-		return c.JSON(fiber.Map{"token": token})
+		session, err := srv.Database.SessionDB.RotateRefreshToken(c.UserContext(), HashToken(payload.RefreshToken), refreshTokenHash)
+		if err != nil {
+			if errors.Is(err, database.ErrSessionExpired) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// The role may have changed since the session started
+		user, err := srv.Database.UserDB.GetUserByEmail(c.UserContext(), session.UserEmail)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": database.ErrSessionExpired.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		accessToken, err := generateJWT(user.Email, user.Role, session.ID, srv.JWTSecret)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
+		}
+
+		return c.JSON(tokenResponse(accessToken, refreshToken))
+	})
+
+	userGroup.Post("/logout", middleware.JWTMiddleware(srv.JWTSecret, srv.Database.SessionDB), func(c *fiber.Ctx) error {
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		sessionID, _ := c.Locals(string(middleware.SessionID)).(string)
+		tokenID, _ := c.Locals(string(middleware.TokenID)).(string)
+		expiry, ok := c.Locals(string(middleware.TokenExpiry)).(time.Time)
+		if !ok {
+			expiry = time.Now().Add(AccessTokenTTL)
+		}
+
+		if err := srv.Database.SessionDB.RevokeSession(c.UserContext(), email, sessionID); err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to log out"})
+		}
+		if err := srv.Database.SessionDB.RevokeToken(c.UserContext(), tokenID, expiry); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to log out"})
+		}
+
+		return c.JSON(fiber.Map{"message": "logged out successfully"})
 	})
 
 	userGroup.Post("/signup", func(c *fiber.Ctx) error {
@@ -77,22 +128,18 @@ func (srv *Server) SetupUserRoutes() {
 			Password string `json:"password" validate:"required"`
 		}
 		if err := c.BodyParser(&payload); err != nil {
-			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
 		}
 		if err := validator.Struct(payload); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": ErrValidationFailed.Error()})
 		}
 
-		if payload.Email == "admin@datadrive.com" {
-			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": database.ErrDuplicateEmail})
-		}
-
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 		if err != nil {
-			c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		user, err := srv.Database.UserDB.CreateUser(payload.Email, payload.UserName, payload.FullName, string(hashedPassword))
+		user, err := srv.Database.UserDB.CreateUser(c.UserContext(), payload.Email, payload.UserName, payload.FullName, string(hashedPassword))
 		if err != nil {
 			if errors.Is(err, database.ErrDuplicateEmail) {
 				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
@@ -103,25 +150,27 @@ func (srv *Server) SetupUserRoutes() {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		token, err := generateJWT(user.Email, ClientUser, srv.JWTSecret)
+		if err := srv.sendVerificationMail(c.UserContext(), user.Email); err != nil {
+			srv.logger().ErrorContext(c.UserContext(), "Failed to send the verification mail", "recipient_email", user.Email, "error", err)
+		}
+
+		tokens, err := srv.startSession(c, user.Email, models.ClientRole)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
 		}
 
-		return c.Status(http.StatusCreated).JSON(fiber.Map{
-			"message": "user created successfully",
-			"user":    user,
-			"token":   token,
-		})
+		tokens["message"] = "user created successfully"
+		tokens["user"] = user
+		return c.Status(http.StatusCreated).JSON(tokens)
 	})
 
-	authenticatedGroup.Get("/", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		user, err := srv.Database.UserDB.GetUserDetails(email)
+		user, err := srv.Database.UserDB.GetUserDetails(c.UserContext(), email)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch user details"})
 		}
@@ -129,7 +178,7 @@ func (srv *Server) SetupUserRoutes() {
 		return c.JSON(user)
 	})
 
-	authenticatedGroup.Put("/username", func(c *fiber.Ctx) error {
+	authenticatedGroup.Put("/username", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		var payload struct {
 			UserName string `json:"username" validate:"required"`
 		}
@@ -145,7 +194,7 @@ func (srv *Server) SetupUserRoutes() {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		err := srv.Database.UserDB.UpdateUsername(email, payload.UserName)
+		err := srv.Database.UserDB.UpdateUsername(c.UserContext(), email, payload.UserName)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update username"})
 		}
@@ -153,7 +202,7 @@ func (srv *Server) SetupUserRoutes() {
 		return c.JSON(fiber.Map{"message": "username updated successfully"})
 	})
 
-	authenticatedGroup.Put("/full_name", func(c *fiber.Ctx) error {
+	authenticatedGroup.Put("/full_name", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		var payload struct {
 			FullName string `json:"full_name" validate:"required"`
 		}
@@ -169,7 +218,7 @@ func (srv *Server) SetupUserRoutes() {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		err := srv.Database.UserDB.UpdateFullname(email, payload.FullName)
+		err := srv.Database.UserDB.UpdateFullname(c.UserContext(), email, payload.FullName)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update full_name"})
 		}
@@ -177,13 +226,13 @@ func (srv *Server) SetupUserRoutes() {
 		return c.JSON(fiber.Map{"message": "full_name updated successfully"})
 	})
 
-	authenticatedGroup.Delete("/", func(c *fiber.Ctx) error {
+	authenticatedGroup.Delete("/", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		err := srv.Database.UserDB.DeleteUser(email)
+		err := srv.Database.UserDB.DeleteUser(c.UserContext(), email)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete user"})
 		}
@@ -191,14 +240,50 @@ func (srv *Server) SetupUserRoutes() {
 		return c.JSON(fiber.Map{"message": "user deleted successfully"})
 	})
 
+	// -- Sessions --
+	authenticatedGroup.Get("/sessions", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		currentSessionID, _ := c.Locals(string(middleware.SessionID)).(string)
+
+		sessions, err := srv.Database.SessionDB.GetSessions(c.UserContext(), email)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch sessions"})
+		}
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == currentSessionID
+		}
+
+		return c.JSON(fiber.Map{"data": sessions})
+	})
+
+	authenticatedGroup.Delete("/sessions/:id", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
+		email, ok := c.Locals(string(middleware.Email)).(string)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		err := srv.Database.SessionDB.RevokeSession(c.UserContext(), email, c.Params("id"))
+		if err != nil {
+			if errors.Is(err, database.ErrSessionNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to revoke session"})
+		}
+
+		return c.JSON(fiber.Map{"message": "session revoked successfully"})
+	})
+
 	// -- Settings --
-	authenticatedGroup.Get("/settings", func(c *fiber.Ctx) error {
+	authenticatedGroup.Get("/settings", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		settings, err := srv.Database.SettingDB.GetSettings(email)
+		settings, err := srv.Database.SettingDB.GetSettings(c.UserContext(), email)
 		if err != nil {
 			if err == database.ErrSettingsNotFound {
 				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
@@ -209,7 +294,7 @@ func (srv *Server) SetupUserRoutes() {
 		return c.JSON(settings)
 	})
 
-	authenticatedGroup.Post("/settings", func(c *fiber.Ctx) error {
+	authenticatedGroup.Post("/settings", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		var settings models.Settings
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
@@ -218,7 +303,7 @@ func (srv *Server) SetupUserRoutes() {
 		if err := c.BodyParser(&settings); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
 		}
-		err := srv.Database.SettingDB.CreateSettings(email, settings)
+		err := srv.Database.SettingDB.CreateSettings(c.UserContext(), email, settings)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -226,7 +311,7 @@ func (srv *Server) SetupUserRoutes() {
 		return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "settings created"})
 	})
 
-	authenticatedGroup.Put("/settings", func(c *fiber.Ctx) error {
+	authenticatedGroup.Put("/settings", srv.RequirePermission(models.PermissionUsersSelf), func(c *fiber.Ctx) error {
 		var settings models.Settings
 		email, ok := c.Locals(string(middleware.Email)).(string)
 		if !ok {
@@ -235,7 +320,7 @@ func (srv *Server) SetupUserRoutes() {
 		if err := c.BodyParser(&settings); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
 		}
-		err := srv.Database.SettingDB.UpdateSetting(email, settings)
+		err := srv.Database.SettingDB.UpdateSetting(c.UserContext(), email, settings)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -248,23 +333,3 @@ func validatePassword(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
-
-func isAdmin(email, password string) bool {
-	if email == "admin@datadrive.com" && password == "password" {
-		return true
-	}
-	return false
-}
-
-func generateJWT(email, role, jwtSecret string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": email,
-		"role":  role,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
-}
@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/testutil"
+)
+
+func TestSignupAndLoginErrors(t *testing.T) {
+	h := testutil.New(t)
+	signup(h, "driver@example.com", "driver")
+
+	h.Run(t, []testutil.Case{
+		{
+			Name:   "duplicate email",
+			Method: http.MethodPost,
+			Path:   "/signup",
+			Body: map[string]string{
+				"email":     "driver@example.com",
+				"username":  "someone-else",
+				"full_name": "Someone Else",
+				"password":  "supersecret",
+			},
+			WantStatus: http.StatusConflict,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := resp.Map(t)["error"]; got != "a user with this email address already exists" {
+					t.Fatalf("got error %q", got)
+				}
+			},
+		},
+		{
+			Name:   "duplicate username",
+			Method: http.MethodPost,
+			Path:   "/signup",
+			Body: map[string]string{
+				"email":     "other@example.com",
+				"username":  "driver",
+				"full_name": "Someone Else",
+				"password":  "supersecret",
+			},
+			WantStatus: http.StatusConflict,
+		},
+		{
+			Name:       "missing fields",
+			Method:     http.MethodPost,
+			Path:       "/signup",
+			Body:       map[string]string{"email": "new@example.com"},
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "wrong password",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "driver@example.com", "password": "wrong-password"},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "unknown user",
+			Method:     http.MethodPost,
+			Path:       "/login",
+			Body:       map[string]string{"email": "nobody@example.com", "password": "supersecret"},
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "profile requires a token",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:       "profile",
+			Method:     http.MethodGet,
+			Path:       "/user",
+			Token:      h.ClientToken("driver@example.com"),
+			WantStatus: http.StatusOK,
+			Check: func(t *testing.T, resp *testutil.Response) {
+				if got := resp.Map(t)["user_name"]; got != "driver" {
+					t.Fatalf("got username %q, want driver", got)
+				}
+			},
+		},
+	})
+}
+
+func TestSelfServicePermissions(t *testing.T) {
+	h := testutil.New(t)
+	client := signup(h, "driver@example.com", "driver")
+	guest := h.Token("driver@example.com", "Guest")
+
+	var cases []testutil.Case
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/user"},
+		{http.MethodPut, "/user/username"},
+		{http.MethodGet, "/user/sessions"},
+		{http.MethodGet, "/user/settings"},
+		{http.MethodPut, "/user/password"},
+		{http.MethodPost, "/user/email/verify"},
+		{http.MethodGet, "/subscriptions/active"},
+		{http.MethodGet, "/subscriptions/history"},
+		{http.MethodGet, "/subscriptions/usage"},
+		{http.MethodPost, "/reviews"},
+	} {
+		cases = append(cases, testutil.Case{
+			Name:       "a role without permissions cannot " + route.method + " " + route.path,
+			Method:     route.method,
+			Path:       route.path,
+			Body:       map[string]any{},
+			Token:      guest,
+			WantStatus: http.StatusForbidden,
+		})
+	}
+	for _, path := range []string{"/user", "/user/sessions", "/subscriptions/history"} {
+		cases = append(cases, testutil.Case{
+			Name:       "clients read " + path,
+			Method:     http.MethodGet,
+			Path:       path,
+			Token:      client,
+			WantStatus: http.StatusOK,
+		})
+	}
+
+	h.Run(t, cases)
+}
@@ -0,0 +1,108 @@
+// Package telemetry derives the figures a trip is billed and rated on from
+// the points its car reported.
+package telemetry
+
+import (
+	"math"
+
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+// DistanceSource tells which readings a trip's distance was computed from.
+type DistanceSource string
+
+const (
+	SourceGPS      DistanceSource = "GPS"
+	SourceOdometer DistanceSource = "ODOMETER"
+	// SourceNone means the trip did not report enough telemetry to measure
+	// any distance.
+	SourceNone DistanceSource = "NONE"
+)
+
+const (
+	earthRadiusKm = 6371.0088
+
+	// MaxPlausibleSpeed is the speed, in km/h, above which the jump between
+	// two consecutive GPS points is treated as a bad fix and skipped.
+	MaxPlausibleSpeed = 300.0
+)
+
+// Haversine returns the great-circle distance in km between two points.
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaPhi := (lat2 - lat1) * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Distance returns the km driven over points, which must be ordered by
+// time.
+//
+// The GPS track is used when it moved and none of its segments had to be
+// skipped as a bad fix. Otherwise, the difference between the first and last
+// odometer readings is used when there are two of them, falling back to
+// whatever is left of the GPS track.
+func Distance(points []models.TelemetryPoint) (float64, DistanceSource) {
+	gps, skipped := gpsDistance(points)
+	if gps > 0 && !skipped {
+		return gps, SourceGPS
+	}
+
+	if odometer, ok := odometerDistance(points); ok {
+		return odometer, SourceOdometer
+	}
+
+	if len(points) >= 2 {
+		return gps, SourceGPS
+	}
+	return 0, SourceNone
+}
+
+// gpsDistance sums the haversine distance between consecutive points,
+// skipping those that would have required driving faster than
+// MaxPlausibleSpeed to reach.
+func gpsDistance(points []models.TelemetryPoint) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+
+	var total float64
+	var skipped bool
+	previous := points[0]
+	for _, point := range points[1:] {
+		segment := Haversine(previous.Latitude, previous.Longitude, point.Latitude, point.Longitude)
+		hours := point.RecordedAt.Sub(previous.RecordedAt).Hours()
+		if hours <= 0 || segment/hours > MaxPlausibleSpeed {
+			if segment > 0 {
+				skipped = true
+			}
+			continue
+		}
+		total += segment
+		previous = point
+	}
+
+	return total, skipped
+}
+
+func odometerDistance(points []models.TelemetryPoint) (float64, bool) {
+	var first, last *float64
+	for _, point := range points {
+		if point.Odometer == nil {
+			continue
+		}
+		if first == nil {
+			first = point.Odometer
+		}
+		last = point.Odometer
+	}
+
+	if first == nil || first == last || *last < *first {
+		return 0, false
+	}
+	return *last - *first, true
+}
@@ -0,0 +1,116 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+// ScoringModel rates how a trip was driven on a scale from MinScore to
+// MaxScore, higher being better.
+//
+// A trip starts at MaxScore and loses:
+//
+//   - HarshBrakingPenalty for every harsh braking event, that is a run of
+//     consecutive points either flagged by the car or decelerating at
+//     HarshBrakingThreshold or harder;
+//   - HarshAccelerationPenalty for every run of consecutive points
+//     accelerating at HarshAccelerationThreshold or harder;
+//   - SpeedingPenalty times the share of points above SpeedLimit.
+//
+// Event penalties are per PenaltyDistance km, so a long trip is not rated
+// worse than a short one for braking as often. Trips shorter than
+// PenaltyDistance are rated as if they were that long.
+type ScoringModel struct {
+	MaxScore float64 `json:"max_score"`
+	MinScore float64 `json:"min_score"`
+
+	HarshBrakingThreshold      float64 `json:"harsh_braking_threshold"` // m/s², negative
+	HarshBrakingPenalty        float64 `json:"harsh_braking_penalty"`
+	HarshAccelerationThreshold float64 `json:"harsh_acceleration_threshold"` // m/s²
+	HarshAccelerationPenalty   float64 `json:"harsh_acceleration_penalty"`
+	SpeedLimit                 float64 `json:"speed_limit"` // km/h
+	SpeedingPenalty            float64 `json:"speeding_penalty"`
+
+	PenaltyDistance float64 `json:"penalty_distance"` // km
+}
+
+// NewScoringModel returns DefaultScoringModel tuned by cfg: cfg.Model, JSON
+// in the shape of ScoringModel, is decoded over it, so that it only needs
+// the fields it changes.
+func NewScoringModel(cfg config.ScoringConfig) (ScoringModel, error) {
+	model := DefaultScoringModel()
+	if cfg.Model == "" {
+		return model, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(cfg.Model)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&model); err != nil {
+		return ScoringModel{}, fmt.Errorf("invalid scoring model: %w", err)
+	}
+	if model.MinScore > model.MaxScore || model.PenaltyDistance <= 0 {
+		return ScoringModel{}, fmt.Errorf("invalid scoring model: min_score must not exceed max_score and penalty_distance must be positive")
+	}
+	return model, nil
+}
+
+// DefaultScoringModel is the model the API uses.
+func DefaultScoringModel() ScoringModel {
+	return ScoringModel{
+		MaxScore:                   10,
+		MinScore:                   0.1,
+		HarshBrakingThreshold:      -4.5,
+		HarshBrakingPenalty:        1,
+		HarshAccelerationThreshold: 3.5,
+		HarshAccelerationPenalty:   0.5,
+		SpeedLimit:                 130,
+		SpeedingPenalty:            4,
+		PenaltyDistance:            10,
+	}
+}
+
+// Score rates points, which must be ordered by time, for a trip of
+// distance km. A trip without telemetry gets MaxScore.
+func (m ScoringModel) Score(points []models.TelemetryPoint, distance float64) float64 {
+	if len(points) == 0 {
+		return m.MaxScore
+	}
+
+	var braking, accelerating int
+	var brakingRun, acceleratingRun bool
+	var speeding int
+	for _, point := range points {
+		harshBraking := point.HarshBraking || point.Acceleration <= m.HarshBrakingThreshold
+		if harshBraking && !brakingRun {
+			braking++
+		}
+		brakingRun = harshBraking
+
+		harshAcceleration := point.Acceleration >= m.HarshAccelerationThreshold
+		if harshAcceleration && !acceleratingRun {
+			accelerating++
+		}
+		acceleratingRun = harshAcceleration
+
+		if point.Speed > m.SpeedLimit {
+			speeding++
+		}
+	}
+
+	per := 1.0
+	if m.PenaltyDistance > 0 {
+		per = m.PenaltyDistance / math.Max(distance, m.PenaltyDistance)
+	}
+
+	score := m.MaxScore -
+		float64(braking)*m.HarshBrakingPenalty*per -
+		float64(accelerating)*m.HarshAccelerationPenalty*per -
+		float64(speeding)/float64(len(points))*m.SpeedingPenalty
+
+	return math.Round(math.Min(m.MaxScore, math.Max(m.MinScore, score))*100) / 100
+}
@@ -0,0 +1,174 @@
+package telemetry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+)
+
+func point(seconds int, lat, lon float64) models.TelemetryPoint {
+	return models.TelemetryPoint{
+		RecordedAt: time.Date(2025, 1, 1, 10, 0, seconds, 0, time.UTC),
+		Latitude:   lat,
+		Longitude:  lon,
+	}
+}
+
+func odometer(p models.TelemetryPoint, km float64) models.TelemetryPoint {
+	p.Odometer = &km
+	return p
+}
+
+func TestHaversine(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 37.98, 23.72, 37.98, 23.72, 0},
+		{"one degree of latitude", 0, 0, 1, 0, 111.195},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111.195},
+		{"Athens to Thessaloniki", 37.9838, 23.7275, 40.6401, 22.9444, 302.95},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Haversine(tc.lat1, tc.lon1, tc.lat2, tc.lon2); math.Abs(got-tc.want) > 0.1 {
+				t.Fatalf("got %.3f km, want %.3f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		points     []models.TelemetryPoint
+		want       float64
+		wantSource DistanceSource
+	}{
+		{"no points", nil, 0, SourceNone},
+		{"single point", []models.TelemetryPoint{point(0, 0, 0)}, 0, SourceNone},
+		{
+			name:       "GPS track",
+			points:     []models.TelemetryPoint{point(0, 0, 0), point(30, 0.005, 0), point(60, 0.01, 0)},
+			want:       1.112,
+			wantSource: SourceGPS,
+		},
+		{
+			name:       "bad fix is skipped",
+			points:     []models.TelemetryPoint{point(0, 0, 0), point(30, 10, 10), point(60, 0.01, 0)},
+			want:       1.112,
+			wantSource: SourceGPS,
+		},
+		{
+			name: "odometer replaces a track with a bad fix",
+			points: []models.TelemetryPoint{
+				odometer(point(0, 0, 0), 100),
+				point(30, 10, 10),
+				odometer(point(60, 0.01, 0), 101.5),
+			},
+			want:       1.5,
+			wantSource: SourceOdometer,
+		},
+		{
+			name:       "odometer while the GPS position is stuck",
+			points:     []models.TelemetryPoint{odometer(point(0, 0, 0), 100), odometer(point(60, 0, 0), 102)},
+			want:       2,
+			wantSource: SourceOdometer,
+		},
+		{
+			name:       "parked",
+			points:     []models.TelemetryPoint{point(0, 0, 0), point(60, 0, 0)},
+			want:       0,
+			wantSource: SourceGPS,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, source := Distance(tc.points)
+			if math.Abs(got-tc.want) > 0.001 || source != tc.wantSource {
+				t.Fatalf("got %.3f km from %s, want %.3f km from %s", got, source, tc.want, tc.wantSource)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	model := DefaultScoringModel()
+
+	smooth := func(n int) []models.TelemetryPoint {
+		points := make([]models.TelemetryPoint, n)
+		for i := range points {
+			points[i] = point(i, 0, 0)
+			points[i].Speed = 50
+		}
+		return points
+	}
+
+	braking := smooth(10)
+	braking[2].Acceleration = -6
+	braking[3].Acceleration = -5 // same event as the point before
+	braking[7].HarshBraking = true
+
+	accelerating := smooth(10)
+	accelerating[4].Acceleration = 4
+
+	speeding := smooth(10)
+	for i := range 5 {
+		speeding[i].Speed = 150
+	}
+
+	reckless := smooth(10)
+	for i := range reckless {
+		reckless[i].Speed = 180
+		reckless[i].Acceleration = -8
+		if i%2 == 0 {
+			reckless[i].Acceleration = 8
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		points   []models.TelemetryPoint
+		distance float64
+		want     float64
+	}{
+		{"no telemetry", nil, 0, 10},
+		{"smooth", smooth(10), 5, 10},
+		{"harsh braking", braking, 5, 8},
+		{"harsh braking on a long trip", braking, 40, 9.5},
+		{"harsh acceleration", accelerating, 5, 9.5},
+		{"speeding half of the time", speeding, 5, 8},
+		{"never below the minimum", reckless, 5, 0.1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := model.Score(tc.points, tc.distance); got != tc.want {
+				t.Fatalf("got score %.2f, want %.2f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewScoringModel(t *testing.T) {
+	model, err := NewScoringModel(config.ScoringConfig{Model: `{"speed_limit": 110, "harsh_braking_penalty": 2}`})
+	if err != nil {
+		t.Fatalf("NewScoringModel: %v", err)
+	}
+	want := DefaultScoringModel()
+	want.SpeedLimit = 110
+	want.HarshBrakingPenalty = 2
+	if model != want {
+		t.Fatalf("got model %+v, want %+v", model, want)
+	}
+
+	for _, cfg := range []config.ScoringConfig{
+		{Model: `{"speed_limits": 110}`},
+		{Model: `{"min_score": 20}`},
+		{Model: `{"penalty_distance": 0}`},
+	} {
+		if _, err := NewScoringModel(cfg); err == nil {
+			t.Errorf("got no error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package testutil builds the full Fiber application against a pluggable
+// store so that the HTTP API can be exercised end to end from tests.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ntentasd/db-deliverable3/config"
+	"github.com/ntentasd/db-deliverable3/internal/database"
+	"github.com/ntentasd/db-deliverable3/internal/database/memory"
+	"github.com/ntentasd/db-deliverable3/internal/logging"
+	"github.com/ntentasd/db-deliverable3/internal/metrics"
+	"github.com/ntentasd/db-deliverable3/internal/models"
+	"github.com/ntentasd/db-deliverable3/internal/money"
+	"github.com/ntentasd/db-deliverable3/internal/payment"
+	"github.com/ntentasd/db-deliverable3/internal/pricing"
+	"github.com/ntentasd/db-deliverable3/internal/server"
+)
+
+const (
+	JWTSecret      = "test-secret"
+	FrontendOrigin = "http://localhost:3000"
+)
+
+// DistancePricing charges trips by the km alone, so that the amounts tests
+// see do not depend on how long they take or when they run.
+var DistancePricing = pricing.Rules{}
+
+type Harness struct {
+	T        testing.TB
+	Store    *memory.Store
+	Database *database.Database
+	Server   *server.Server
+	App      *fiber.App
+	// MetricsApp serves the metrics, apart from App.
+	MetricsApp *fiber.App
+	Mailbox    *Mailbox
+	// Payments is the fake provider trips are charged through. Its Config
+	// can be changed to make it decline.
+	Payments *payment.Fake
+	// Logs keeps what the application logs, from every level.
+	Logs *Logs
+}
+
+// New returns a harness backed by a fresh in-memory store.
+func New(t testing.TB) *Harness {
+	store := memory.New()
+	h := NewWithDatabase(t, store.Database())
+	h.Store = store
+	return h
+}
+
+// NewWithDatabase builds the application on top of db, the same way
+// cmd/api does it.
+func NewWithDatabase(t testing.TB, db *database.Database) *Harness {
+	t.Helper()
+
+	mailbox := &Mailbox{}
+	payments := payment.NewFake(payment.FakeConfig{})
+
+	m := metrics.New()
+	m.RegisterDatabase(nil, db)
+
+	logs := &Logs{}
+	logger := logging.New(config.LogConfig{Format: "json", Level: slog.LevelDebug}, logs)
+
+	app := server.NewApp(FrontendOrigin, m, logger)
+	srv := &server.Server{
+		FiberApp:  app,
+		Database:  db,
+		JWTSecret: JWTSecret,
+		Mailer:    mailbox,
+		AppURL:    FrontendOrigin,
+		Pricing:   DistancePricing,
+		Payments:  payments,
+		Logger:    logger,
+	}
+	srv.SetupRoutes()
+
+	return &Harness{
+		T:          t,
+		Database:   db,
+		Server:     srv,
+		App:        app,
+		MetricsApp: server.NewMetricsApp(m),
+		Mailbox:    mailbox,
+		Payments:   payments,
+		Logs:       logs,
+	}
+}
+
+// Token opens a session for email and mints an access token for it with the
+// given role, signed with the harness secret.
+func (h *Harness) Token(email, role string) string {
+	h.T.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := models.Session{
+		ID:         uuid.New().String(),
+		UserEmail:  email,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(server.RefreshTokenTTL),
+	}
+	if err := h.Database.SessionDB.CreateSession(context.Background(), session, server.HashToken(session.ID)); err != nil {
+		h.T.Fatalf("failed to create a session for %s: %v", email, err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+		"role":  role,
+		"sid":   session.ID,
+		"jti":   uuid.New().String(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(JWTSecret))
+	if err != nil {
+		h.T.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func (h *Harness) ClientToken(email string) string {
+	return h.Token(email, models.ClientRole)
+}
+
+func (h *Harness) AdminToken(email string) string {
+	return h.Token(email, models.AdminRole)
+}
+
+// SeedAdmin creates an administrator account that can log in with password.
+func (h *Harness) SeedAdmin(email, password string) {
+	h.T.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		h.T.Fatalf("failed to hash password: %v", err)
+	}
+	if err := database.BootstrapAdmin(context.Background(), h.Database, email, "admin", string(hash)); err != nil {
+		h.T.Fatalf("failed to seed admin %s: %v", email, err)
+	}
+}
+
+// SeedCar inserts car with the given cost per km, such as "0.50".
+func (h *Harness) SeedCar(licensePlate string, status models.Status, costPerKm string) models.Car {
+	h.T.Helper()
+
+	cost, err := money.Parse(costPerKm)
+	if err != nil {
+		h.T.Fatalf("invalid cost per km %q: %v", costPerKm, err)
+	}
+
+	latitude, longitude := 40.6320, 22.9515
+	car := models.Car{
+		LicensePlate: licensePlate,
+		Make:         "Toyota",
+		Model:        "Corolla",
+		Status:       status,
+		CostPerKm:    &cost,
+		Location:     "KAMARA",
+		Latitude:     &latitude,
+		Longitude:    &longitude,
+	}
+	if err := h.Database.CarDB.InsertCar(context.Background(), car); err != nil {
+		h.T.Fatalf("failed to seed car %s: %v", licensePlate, err)
+	}
+	return car
+}
+
+// SeedSubscriptions registers the three plans the seed migration inserts,
+// with the allowances and overage rates migration 0018 gives them. It
+// requires the in-memory store.
+func (h *Harness) SeedSubscriptions() {
+	h.T.Helper()
+
+	if h.Store == nil {
+		h.T.Fatalf("SeedSubscriptions requires the in-memory store")
+	}
+	plan := func(name models.SubscriptionName, months int, price, description string, km float64, minutes int) models.SubscriptionPlan {
+		overagePerKm, overagePerMinute := money.MustParse("0.30"), money.MustParse("0.08")
+		return models.SubscriptionPlan{
+			Name:             name,
+			DurationMonths:   months,
+			PricePerMonth:    money.MustParse(price),
+			Description:      description,
+			IncludedKm:       &km,
+			IncludedMinutes:  &minutes,
+			OveragePerKm:     &overagePerKm,
+			OveragePerMinute: &overagePerMinute,
+		}
+	}
+	h.Store.AddSubscriptionPlan(plan(models.OneMonth, 1, "60.00", "This is a subscription for 1 month", 500, 1500))
+	h.Store.AddSubscriptionPlan(plan(models.ThreeMonths, 3, "50.00", "This is a subscription for 3 months", 400, 1200))
+	h.Store.AddSubscriptionPlan(plan(models.OneYear, 12, "30.00", "This is a subscription for 1 year", 300, 900))
+}
+
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the response body into v, failing the test on error.
+func (r *Response) JSON(t testing.TB, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", r.Body, err)
+	}
+}
+
+// Map decodes the response body as a JSON object.
+func (r *Response) Map(t testing.TB) map[string]any {
+	t.Helper()
+
+	var m map[string]any
+	r.JSON(t, &m)
+	return m
+}
+
+// Do sends a request to the application. body is encoded as JSON unless it
+// is nil, and token is sent as a bearer token unless it is empty.
+func (h *Harness) Do(method, path string, body any, token string) *Response {
+	h.T.Helper()
+	return h.DoWithHeader(method, path, body, token, nil)
+}
+
+// DoWithHeader is Do with extra request headers.
+func (h *Harness) DoWithHeader(method, path string, body any, token string, header http.Header) *Response {
+	h.T.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			h.T.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	return h.send(h.App, req)
+}
+
+// Scrape reads the metrics from MetricsApp.
+func (h *Harness) Scrape() *Response {
+	h.T.Helper()
+	return h.send(h.MetricsApp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+}
+
+func (h *Harness) send(app *fiber.App, req *http.Request) *Response {
+	h.T.Helper()
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		h.T.Fatalf("%s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.T.Fatalf("failed to read response body: %v", err)
+	}
+
+	return &Response{Status: resp.StatusCode, Header: resp.Header, Body: respBody}
+}
+
+// Case describes one request and the response it is expected to produce.
+type Case struct {
+	Name       string
+	Method     string
+	Path       string
+	Body       any
+	Token      string
+	WantStatus int
+	Check      func(t *testing.T, resp *Response)
+}
+
+// Run executes the cases in order as subtests. Cases share the harness, so
+// later cases observe the changes made by earlier ones.
+func (h *Harness) Run(t *testing.T, cases []Case) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			previous := h.T
+			h.T = t
+			defer func() { h.T = previous }()
+
+			resp := h.Do(tc.Method, tc.Path, tc.Body, tc.Token)
+			if resp.Status != tc.WantStatus {
+				t.Fatalf("%s %s: got status %d, want %d, body %s", tc.Method, tc.Path, resp.Status, tc.WantStatus, resp.Body)
+			}
+			if tc.Check != nil {
+				tc.Check(t, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package testutil
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/ntentasd/db-deliverable3/internal/mailer"
+)
+
+// Mailbox is a mailer.Mailer that keeps every message it is given.
+type Mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *Mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent to to, oldest first.
+func (m *Mailbox) Messages(to string) []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []mailer.Message
+	for _, msg := range m.messages {
+		if msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+var tokenPattern = regexp.MustCompile(`[?&]token=([^\s&]+)`)
+
+// LastToken returns the token linked from the latest message sent to to.
+func (m *Mailbox) LastToken(t testing.TB, to string) string {
+	t.Helper()
+
+	messages := m.Messages(to)
+	if len(messages) == 0 {
+		t.Fatalf("no mail was sent to %s", to)
+	}
+	return Token(t, messages[len(messages)-1])
+}
+
+// Token returns the token linked from msg.
+func Token(t testing.TB, msg mailer.Message) string {
+	t.Helper()
+
+	match := tokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("the mail to %s has no token link", msg.To)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("failed to unescape token %q: %v", match[1], err)
+	}
+	return token
+}